@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aggregateBeta weighs how early entries are refreshed, above 1 refreshing
+// earlier.
+const aggregateBeta = 1.0
+
+// aggregateCache keeps the results of aggregate queries for ttl. A request
+// close to the expiry of an entry refreshes it in the background with a
+// probability growing as the expiry nears and with the time the query takes,
+// serving the current result meanwhile, so that entries are not all
+// recomputed by concurrent requests at the moment they expire.
+type aggregateCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*aggregateEntry
+	calls   map[string]*aggregateCall
+	// generation grows with every deletion, for computations started before
+	// one not to store what it dropped
+	generation uint64
+}
+
+type aggregateEntry struct {
+	value   interface{}
+	expires time.Time
+	// delta is the time the last computation took
+	delta      time.Duration
+	refreshing bool
+}
+
+// aggregateCall is a computation in flight, shared by the requests waiting
+// for it.
+type aggregateCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newAggregateCache(ttl time.Duration) *aggregateCache {
+	return &aggregateCache{
+		ttl:     ttl,
+		entries: make(map[string]*aggregateEntry),
+		calls:   make(map[string]*aggregateCall),
+	}
+}
+
+// Get returns the cached result of key, computing it with compute when
+// there is none or it expired.
+func (ac *aggregateCache) Get(ctx context.Context, key string, compute func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ac.mu.Lock()
+	e, now := ac.entries[key], time.Now()
+	if e != nil && now.Before(e.expires) {
+		if !e.refreshing && ac.early(e, now) {
+			e.refreshing = true
+			go ac.refresh(key, compute)
+		}
+		ac.mu.Unlock()
+		return e.value, nil
+	}
+	ac.mu.Unlock()
+	return ac.load(ctx, key, compute)
+}
+
+// early draws whether e is refreshed now, as in "Optimal Probabilistic
+// Cache Stampede Prevention" (Vattani et al.).
+func (ac *aggregateCache) early(e *aggregateEntry, now time.Time) bool {
+	gap := -float64(e.delta) * aggregateBeta * math.Log(1-rand.Float64())
+	return !now.Add(time.Duration(gap)).Before(e.expires)
+}
+
+func (ac *aggregateCache) refresh(key string, compute func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), ac.ttl)
+	defer cancel()
+	if _, err := ac.load(ctx, key, compute); err != nil {
+		logger.Error().Err(err).Str("key", key).Msg("aggregate cache: refresh failed")
+		ac.mu.Lock()
+		if e := ac.entries[key]; e != nil {
+			e.refreshing = false
+		}
+		ac.mu.Unlock()
+	}
+}
+
+// load computes key once for the requests asking for it at the same time.
+func (ac *aggregateCache) load(ctx context.Context, key string, compute func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ac.mu.Lock()
+	if call, ok := ac.calls[key]; ok {
+		ac.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.value, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &aggregateCall{done: make(chan struct{})}
+	ac.calls[key] = call
+	generation := ac.generation
+	ac.mu.Unlock()
+
+	start := time.Now()
+	call.value, call.err = compute(ctx)
+	finished := time.Now()
+
+	ac.mu.Lock()
+	delete(ac.calls, key)
+	if call.err == nil && generation == ac.generation {
+		ac.entries[key] = &aggregateEntry{value: call.value, expires: finished.Add(ac.ttl), delta: finished.Sub(start)}
+	}
+	ac.mu.Unlock()
+	close(call.done)
+	return call.value, call.err
+}
+
+// DeletePrefix drops the entries whose key starts with prefix.
+func (ac *aggregateCache) DeletePrefix(prefix string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.generation++
+	for key := range ac.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(ac.entries, key)
+		}
+	}
+}
+
+// cachedOutbreakRepo keeps the outbreak summaries in an aggregate cache,
+// writes through it dropping them.
+type cachedOutbreakRepo struct {
+	OutbreakRepository
+	cache *aggregateCache
+}
+
+var _ OutbreakRepository = &cachedOutbreakRepo{}
+
+func newCachedOutbreakRepo(repo OutbreakRepository, cache *aggregateCache) *cachedOutbreakRepo {
+	return &cachedOutbreakRepo{OutbreakRepository: repo, cache: cache}
+}
+
+func (or *cachedOutbreakRepo) Summary(ctx context.Context, provinceID string) (OutbreakSummaries, error) {
+	v, err := or.cache.Get(ctx, "outbreak_summary:"+provinceID, func(ctx context.Context) (interface{}, error) {
+		return or.OutbreakRepository.Summary(ctx, provinceID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(OutbreakSummaries), nil
+}
+
+func (or *cachedOutbreakRepo) Save(ctx context.Context, o *Outbreak) error {
+	defer or.cache.DeletePrefix("outbreak_summary:")
+	return or.OutbreakRepository.Save(ctx, o)
+}
+
+func (or *cachedOutbreakRepo) Update(ctx context.Context, o *Outbreak) error {
+	defer or.cache.DeletePrefix("outbreak_summary:")
+	return or.OutbreakRepository.Update(ctx, o)
+}
+
+func (or *cachedOutbreakRepo) Delete(ctx context.Context, id string) error {
+	defer or.cache.DeletePrefix("outbreak_summary:")
+	return or.OutbreakRepository.Delete(ctx, id)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// Alias is an alternative name a province is also known by, such as an old
+// spelling or a romanization.
+type Alias struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Aliases []*Alias
+
+func (a *Alias) Prepare() {
+	a.Name = html.EscapeString(strings.TrimSpace(a.Name))
+}
+
+func (a *Alias) Validate() error {
+	if a.Name == "" {
+		return errors.New("alias: name is required")
+	}
+	return nil
+}
+
+func (pA *provinceService) FindByProvinceID(c echo.Context) error {
+	p, err := pA.pApp.Resolve(c.Request().Context(),
+		html.EscapeString(strings.TrimSpace(c.Param("province_id"))))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		if p, err = provinceAsOf(c.Request().Context(), pA.history, p, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, pA.errMessage(msg))
+		}
+	}
+	setCacheTags(c, provinceCacheTags(p)...)
+	setEntityTag(c, p.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Province{"province": p})
+}
+
+func (pA *provinceService) ListAliases(c echo.Context) error {
+	aliases, err := pA.pApp.Aliases(c.Request().Context(), c.Param("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Aliases{"aliases": aliases})
+}
+
+func (pA *provinceService) AddAlias(c echo.Context) error {
+	var a Alias
+	if err := c.Bind(&a); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	a.Prepare()
+	a.CreatedAt = time.Now()
+	if err := a.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+
+	if err := pA.pApp.AddAlias(c.Request().Context(), c.Param("province_id"), &a); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not add alias")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*Alias{"alias": &a})
+}
+
+func (pA *provinceService) DeleteAlias(c echo.Context) error {
+	if err := pA.pApp.DeleteAlias(c.Request().Context(), c.Param("province_id"),
+		html.EscapeString(strings.TrimSpace(c.Param("alias")))); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not delete alias")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// keepOldName records the name a province had before a rename as an alias,
+// so links and import mappings using it keep resolving.
+func keepOldName(ctx context.Context, pApp ProvinceInterface, current, p *Province) error {
+	if current.Name == p.Name {
+		return nil
+	}
+	err := pApp.AddAlias(ctx, p.ID, &Alias{Name: current.Name, CreatedAt: time.Now()})
+	if errors.Is(err, errConflict) {
+		return nil
+	}
+	return err
+}
+
+// Resolve finds a province by id, by name or by one of its aliases, names
+// being compared case-insensitively.
+func (pr *provinceRepo) Resolve(ctx context.Context, key string) (*Province, error) {
+	var p Province
+	err := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").From("provinces").
+		Where(squirrel.Or{
+			squirrel.Eq{"id": key},
+			squirrel.Expr("lower(name) = lower(?)", key),
+			squirrel.Expr("id IN (SELECT province_id FROM province_aliases WHERE lower(name) = lower(?))", key),
+		}).
+		OrderByClause("id = ? DESC", key).
+		Limit(1).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ScanContext(ctx,
+		&p.ID,
+		&p.Name,
+		&p.Total,
+		&p.NewCase,
+		&p.Treated,
+		&p.DecoveringCase,
+		&p.TestCase,
+		&p.Dead,
+		&p.NegativeTest,
+		&p.Latitude,
+		&p.Longitude,
+		&p.Attributes,
+		&p.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("province", key, "resolve province", err)
+	}
+
+	metrics, err := selectMetrics(ctx, pr.db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Metrics = metrics[p.ID]
+
+	districts, err := selectDistricts(ctx, pr.db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Districts = districts
+	return &p, nil
+}
+
+func (pr *provinceRepo) Aliases(ctx context.Context, id string) (Aliases, error) {
+	rows, err := squirrel.Select("name", "created_at").
+		From("province_aliases").
+		Where(squirrel.Eq{"province_id": id}).
+		OrderBy("created_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", id, "select aliases", err)
+	}
+	defer rows.Close()
+
+	var aliases = make(Aliases, 0)
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.Name, &a.CreatedAt); err != nil {
+			return nil, wrapErr("province", id, "scan aliases", err)
+		}
+		aliases = append(aliases, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", id, "select aliases", err)
+	}
+	return aliases, nil
+}
+
+func (pr *provinceRepo) AddAlias(ctx context.Context, id string, a *Alias) error {
+	if _, err := squirrel.Insert("province_aliases").
+		Columns("name", "province_id", "created_at").
+		Values(&a.Name, id, &a.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ExecContext(ctx); err != nil {
+		return wrapErr("province", id, "insert alias", err)
+	}
+	return nil
+}
+
+func (pr *provinceRepo) DeleteAlias(ctx context.Context, id, name string) error {
+	res, err := squirrel.Delete("province_aliases").
+		Where(squirrel.Eq{"province_id": id}).
+		Where(squirrel.Expr("lower(name) = lower(?)", name)).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("province", id, "delete alias", err)
+	}
+	return wrapErr("province", id, "delete alias", affectedOne(res))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/lib/pq"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// Attributes holds deployment specific data attached to a record, stored as
+// JSONB, for fields that do not warrant a column of their own.
+type Attributes map[string]interface{}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+func (a *Attributes) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, a)
+	case string:
+		// SQLite stores the documents as text
+		return json.Unmarshal([]byte(src), a)
+	}
+	return fmt.Errorf("attributes: cannot scan %T", src)
+}
+
+// Equal reports whether a and b hold the same data, nil being the same as
+// empty.
+func (a Attributes) Equal(b Attributes) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// split separates a merge patch into the keys to set and the keys to remove,
+// which the patch marks with null.
+func (a Attributes) split() (Attributes, []string) {
+	set, remove := Attributes{}, []string{}
+	for k, v := range a {
+		if v == nil {
+			remove = append(remove, k)
+			continue
+		}
+		set[k] = v
+	}
+	return set, remove
+}
+
+// merge returns a with the merge patch applied, leaving a as it is.
+func (a Attributes) merge(patch Attributes) Attributes {
+	merged := make(Attributes, len(a)+len(patch))
+	for k, v := range a {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// attributesExpr is the value of the attributes column once the merge patch
+// is applied to its top-level keys, in the SQL of dialect.
+func attributesExpr(dialect migrations.Dialect, patch Attributes) squirrel.Sqlizer {
+	set, remove := patch.split()
+	if dialect == migrations.SQLite {
+		return squirrel.Expr("patch_attributes(attributes, ?, ?)", set, pq.Array(remove))
+	}
+	return squirrel.Expr("(attributes || ?::jsonb) - ?::text[]", set, pq.Array(remove))
+}
+
+// patchAttributes applies a JSON merge patch to the top-level keys of the
+// attributes of the record id in table.
+func patchAttributes(ctx context.Context, runner squirrel.BaseRunner, dialect migrations.Dialect, table, id string, patch Attributes, updatedAt time.Time) error {
+	res, err := squirrel.Update(table).
+		Set("attributes", attributesExpr(dialect, patch)).
+		Set("updated_at", updatedAt).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res)
+}
+
+func bindAttributes(c echo.Context) (Attributes, error) {
+	var patch Attributes
+	if err := c.Bind(&patch); err != nil {
+		return nil, err
+	}
+	if patch == nil {
+		return nil, errors.New("attributes: patch must be an object")
+	}
+	return patch, nil
+}
+
+func (cr *countryRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return wrapErr("country", id, "patch attributes", patchAttributes(ctx, cr.db, cr.dialect, "country", id, patch, updatedAt))
+}
+
+func (pr *provinceRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return wrapErr("province", id, "patch attributes", patchAttributes(ctx, pr.db, pr.dialect, "provinces", id, patch, updatedAt))
+}
+
+func (dr *districtRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return wrapErr("district", id, "patch attributes", patchAttributes(ctx, dr.db, dr.dialect, "districts", id, patch, updatedAt))
+}
+
+func (cA *countryService) PatchAttributes(c echo.Context) error {
+	patch, err := bindAttributes(c)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
+	}
+
+	// the country may be named by its ISO code, it is written and published
+	// by its id
+	ctx := c.Request().Context()
+	current, err := cA.cApp.GetByID(forWrite(ctx), c.Param("country_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	if err := cA.cApp.PatchAttributes(ctx, current.ID, patch, time.Now()); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update attributes")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	cA.changes.Publish(countryKey(current.ID))
+
+	// read back from where it was written
+	country, err := cA.cApp.GetByID(forWrite(ctx), current.ID)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	setEntityTag(c, country.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Country{"country": country})
+}
+
+func (pA *provinceService) PatchAttributes(c echo.Context) error {
+	patch, err := bindAttributes(c)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+
+	ctx := c.Request().Context()
+	id := c.Param("province_id")
+	if err := pA.pApp.PatchAttributes(ctx, id, patch, time.Now()); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update attributes")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	pA.changes.Publish(provinceKey(id))
+
+	p, err := pA.pApp.GetByID(forWrite(ctx), id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	setEntityTag(c, p.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Province{"province": p})
+}
+
+func (dA *districtService) PatchAttributes(c echo.Context) error {
+	patch, err := bindAttributes(c)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, dA.errMessage("request: unable to parse request payload"))
+	}
+
+	ctx := c.Request().Context()
+	id := c.Param("district_id")
+	if err := dA.dApp.PatchAttributes(ctx, id, patch, time.Now()); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update attributes")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	dA.changes.Publish(districtKey(id))
+
+	d, err := dA.dApp.GetByID(forWrite(ctx), id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	// the province holds its districts
+	dA.changes.Publish(provinceKey(d.ProvinceID))
+	setEntityTag(c, d.UpdatedAt)
+	return c.JSON(http.StatusOK, map[string]*District{"district": d})
+}
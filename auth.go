@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// roles of the staff, each one allowed what the ones before it are
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+var (
+	errUnauthenticated = errors.New("Error: A valid bearer token is required")
+	errForbidden       = errors.New("Error: Not allowed to change this data")
+	errBadCredentials  = errors.New("Error: Invalid email or password")
+)
+
+type User struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// Password is only read from requests, PasswordHash is what is stored.
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	// ProvinceID restricts an editor to one province, empty for every one.
+	ProvinceID string    `json:"province_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (u *User) Prepare() {
+	u.Email = html.EscapeString(strings.ToLower(strings.TrimSpace(u.Email)))
+	u.Role = strings.TrimSpace(u.Role)
+	u.ProvinceID = strings.TrimSpace(u.ProvinceID)
+}
+
+func (u *User) BeforeSave() error {
+	u.ID = uuid.NewV4().String()
+	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	u.Password = ""
+	return nil
+}
+
+func (u *User) Validate() error {
+	if !strings.Contains(u.Email, "@") {
+		return errors.New("user: a valid email is required")
+	}
+	if len(u.Password) < 12 {
+		return errors.New("user: password must be at least 12 characters")
+	}
+	if _, ok := roleRanks[u.Role]; !ok {
+		return errors.New("user: role must be viewer, editor or admin")
+	}
+	return nil
+}
+
+// authClaims are carried by the tokens issued on login.
+type authClaims struct {
+	Role       string `json:"role"`
+	ProvinceID string `json:"province_id,omitempty"`
+	jwt.StandardClaims
+}
+
+type identityKey struct{}
+
+// identity is put in the request context by authenticate, with nil claims
+// for requests without a token. Its absence means authentication is off.
+type identity struct {
+	claims *authClaims
+	// team and the regions it may edit, the ids of its country and of its
+	// provinces, for requests made with an API key
+	team    *Team
+	regions map[string]bool
+	// embargo is the time of day, in UTC, before which the key is shown the
+	// figures of the day before, empty for none
+	embargo string
+	// developer is set, without claims, for requests made with the key of a
+	// developer
+	developer *Developer
+	// embed is the province an embed token reads, set without claims, the
+	// token keeping the embargo of the caller that issued it
+	embed string
+}
+
+// authorize checks that the caller has at least role.
+func authorize(ctx context.Context, role string) error {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if !ok {
+		return nil
+	}
+	if id.claims == nil {
+		return errUnauthenticated
+	}
+	if roleRanks[id.claims.Role] < roleRanks[role] {
+		return errForbidden
+	}
+	return nil
+}
+
+// authorizeProvince checks that the caller may edit the data of provinceID,
+// an empty provinceID being data no single province owns.
+func authorizeProvince(ctx context.Context, provinceID string) error {
+	if err := authorize(ctx, RoleEditor); err != nil {
+		return err
+	}
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if ok && id.regions != nil {
+		if !id.regions[provinceID] {
+			return errForbidden
+		}
+		return nil
+	}
+	if !ok || id.claims.Role == RoleAdmin || id.claims.ProvinceID == "" {
+		return nil
+	}
+	if id.claims.ProvinceID != provinceID {
+		return errForbidden
+	}
+	return nil
+}
+
+// authorizeCountry checks that the caller may manage countryID, as an admin
+// or as the team it is delegated to.
+func authorizeCountry(ctx context.Context, countryID string) error {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	if ok && id.team != nil {
+		if id.team.CountryID != countryID {
+			return errForbidden
+		}
+		return nil
+	}
+	return authorize(ctx, RoleAdmin)
+}
+
+// Repository
+type UserRepository interface {
+	Save(ctx context.Context, u *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetAll(ctx context.Context) ([]*User, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type userRepo struct {
+	db *sql.DB
+}
+
+var _ UserRepository = &userRepo{}
+
+func NewUserRepo(db *sql.DB) *userRepo {
+	return &userRepo{db}
+}
+
+func (ur *userRepo) Save(ctx context.Context, u *User) error {
+	if _, err := squirrel.Insert("users").
+		Columns("id", "email", "password_hash", "role", "province_id", "created_at").
+		Values(&u.ID, &u.Email, &u.PasswordHash, &u.Role, squirrel.Expr("NULLIF(?, '')", u.ProvinceID), &u.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(ur.db).ExecContext(ctx); err != nil {
+		return wrapErr("user", u.ID, "insert user", err)
+	}
+	return nil
+}
+
+func (ur *userRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	var u User
+	err := squirrel.Select("id", "email", "password_hash", "role", "COALESCE(province_id, '')", "created_at").
+		From("users").
+		Where(squirrel.Expr("lower(email) = lower(?)", email)).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(ur.db).ScanContext(ctx, &u.ID, &u.Email, &u.PasswordHash, &u.Role, &u.ProvinceID, &u.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("user", email, "select user", err)
+	}
+	return &u, nil
+}
+
+func (ur *userRepo) GetAll(ctx context.Context) ([]*User, error) {
+	rows, err := squirrel.Select("id", "email", "role", "COALESCE(province_id, '')", "created_at").
+		From("users").
+		OrderBy("email").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(ur.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("user", "", "select users", err)
+	}
+	defer rows.Close()
+
+	var users = make([]*User, 0)
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Role, &u.ProvinceID, &u.CreatedAt); err != nil {
+			return nil, wrapErr("user", "", "scan users", err)
+		}
+		users = append(users, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("user", "", "select users", err)
+	}
+	return users, nil
+}
+
+func (ur *userRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("users").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(ur.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("user", id, "delete user", err)
+	}
+	return wrapErr("user", id, "delete user", affectedOne(res))
+}
+
+// handler
+type authService struct {
+	users      UserRepository
+	teams      TeamRepository
+	developers DeveloperRepository
+	usage      *developerUsage
+	// secret signs the tokens, authentication is off when it is empty
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewAuthService(users UserRepository, teams TeamRepository, developers DeveloperRepository, usage *developerUsage, secret string, ttl time.Duration) *authService {
+	return &authService{users: users, teams: teams, developers: developers, usage: usage, secret: []byte(secret), ttl: ttl}
+}
+
+func (aA *authService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (aA *authService) Enabled() bool {
+	return len(aA.secret) > 0
+}
+
+// Authenticate reads the bearer token, the API key of a team or of a
+// developer, or the embed token, of every request into its context. A
+// request without one goes on anonymously, an invalid one is rejected.
+func (aA *authService) Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !aA.Enabled() {
+			return next(c)
+		}
+		id := &identity{}
+		if raw := c.QueryParam(embedTokenParam); raw != "" {
+			var err error
+			if id, err = aA.authenticateEmbed(c, raw); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, aA.errMessage(msg))
+			}
+		} else if key := c.Request().Header.Get(headerAPIKey); key != "" {
+			authenticate := aA.authenticateKey
+			if strings.HasPrefix(key, developerKeyPrefix) {
+				authenticate = aA.authenticateDeveloper
+			}
+			var err error
+			if id, err = authenticate(c, key); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, aA.errMessage(msg))
+			}
+		} else if h := c.Request().Header.Get(echo.HeaderAuthorization); h != "" {
+			claims, err := aA.bearerClaims(h)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, aA.errMessage(errUnauthenticated.Error()))
+			}
+			id.claims = claims
+		}
+		r := c.Request()
+		c.SetRequest(r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+		return next(c)
+	}
+}
+
+// bearerClaims checks the bearer token of an Authorization header.
+func (aA *authService) bearerClaims(h string) (*authClaims, error) {
+	raw := strings.TrimPrefix(h, "Bearer ")
+	var claims authClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errUnauthenticated
+		}
+		return aA.secret, nil
+	})
+	if raw == h || err != nil || !token.Valid {
+		return nil, errUnauthenticated
+	}
+	return &claims, nil
+}
+
+// requireRole rejects callers below role.
+func requireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := authorize(c.Request().Context(), role); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, &ErrorMsg{msg})
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireProvince rejects callers not allowed to edit the province named by
+// the param route parameter, or when param is empty data of no single province.
+func requireProvince(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var provinceID string
+			if param != "" {
+				provinceID = c.Param(param)
+			}
+			if err := authorizeProvince(c.Request().Context(), provinceID); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, &ErrorMsg{msg})
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireCountry rejects callers not allowed to manage the country named by
+// the param route parameter, by its id or its ISO code.
+func requireCountry(cApp CountryRepository, param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			countryID := c.Param(param)
+			// teams are compared with the id of their country, which the
+			// code is resolved to
+			if id, ok := ctx.Value(identityKey{}).(*identity); ok && id.team != nil {
+				country, err := cApp.GetByID(ctx, countryID)
+				if err != nil {
+					status, msg := errorStatus(err, "Internal server error")
+					return c.JSON(status, &ErrorMsg{msg})
+				}
+				countryID = country.ID
+			}
+			if err := authorizeCountry(ctx, countryID); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, &ErrorMsg{msg})
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireDistrict rejects callers not allowed to edit the province of the
+// district named by :district_id.
+func requireDistrict(dApp DistrictInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			if err := authorize(ctx, RoleEditor); err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, &ErrorMsg{msg})
+			}
+			d, err := dApp.GetByID(ctx, c.Param("district_id"))
+			if err == nil {
+				err = authorizeProvince(ctx, d.ProvinceID)
+			}
+			if err != nil {
+				status, msg := errorStatus(err, "Internal server error")
+				return c.JSON(status, &ErrorMsg{msg})
+			}
+			return next(c)
+		}
+	}
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Token is issued on login, to be sent as a bearer token.
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (aA *authService) Login(c echo.Context) error {
+	if !aA.Enabled() {
+		return c.JSON(http.StatusNotFound, aA.errMessage("auth: authentication is not configured"))
+	}
+	var req loginRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, aA.errMessage("request: unable to parse request payload"))
+	}
+
+	u, err := aA.users.GetByEmail(c.Request().Context(), strings.TrimSpace(req.Email))
+	if errors.Is(err, errNotFound) {
+		return c.JSON(http.StatusUnauthorized, aA.errMessage(errBadCredentials.Error()))
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, aA.errMessage(msg))
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+		return c.JSON(http.StatusUnauthorized, aA.errMessage(errBadCredentials.Error()))
+	}
+
+	now := time.Now()
+	t := Token{ExpiresAt: now.Add(aA.ttl)}
+	t.Token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, &authClaims{
+		Role:       u.Role,
+		ProvinceID: u.ProvinceID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   u.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: t.ExpiresAt.Unix(),
+		},
+	}).SignedString(aA.secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, aA.errMessage("Internal server error"))
+	}
+	return c.JSON(http.StatusOK, map[string]*Token{"token": &t})
+}
+
+func (aA *authService) ListUsers(c echo.Context) error {
+	users, err := aA.users.GetAll(c.Request().Context())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, aA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string][]*User{"users": users})
+}
+
+func (aA *authService) StoreUser(c echo.Context) error {
+	var u User
+	if err := c.Bind(&u); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, aA.errMessage("request: unable to parse request payload"))
+	}
+	u.Prepare()
+	if err := u.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, aA.errMessage(err.Error()))
+	}
+	if err := u.BeforeSave(); err != nil {
+		return c.JSON(http.StatusInternalServerError, aA.errMessage("Internal server error"))
+	}
+	u.CreatedAt = time.Now()
+
+	if err := aA.users.Save(c.Request().Context(), &u); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not save user")
+		return c.JSON(status, aA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*User{"user": &u})
+}
+
+func (aA *authService) DeleteUser(c echo.Context) error {
+	if err := aA.users.Delete(c.Request().Context(), c.Param("user_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, aA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+const testJWTSecret = "test-secret"
+
+// newAuthTestServer serves the PUT routes of countries, provinces and
+// districts, and the PATCH of the attributes of countries, as main does,
+// over LA with VTE and LPB, TH with BKK, the districts VTE-1 and LPB-1, and a
+// team managing LA whose key it returns.
+func newAuthTestServer(t *testing.T) (*echo.Echo, *Repository, context.Context, string, *changeHub) {
+	t.Helper()
+	r, ctx := openTestStorage(t)
+	now := time.Now()
+	saveTestCountry(t, ctx, r, now)
+	th := &Country{ID: "TH", Name: "Thailand", Attributes: Attributes{}, UpdatedAt: now, Provinces: Provinces{
+		{ID: "BKK", Name: "Bangkok", Attributes: Attributes{}, UpdatedAt: now},
+	}}
+	if err := r.CountryRepo.Save(ctx, th); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*District{
+		{ID: "VTE-1", ProvinceID: "VTE", Name: "Chanthabouly", Attributes: Attributes{}, UpdatedAt: now},
+		{ID: "LPB-1", ProvinceID: "LPB", Name: "Luang Prabang", Attributes: Attributes{}, UpdatedAt: now},
+	} {
+		if err := r.DistrictRepo.Save(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	teamKey := saveTestTeam(t, ctx, r, "LA")
+
+	e := echo.New()
+	auth := NewAuthService(r.UserRepo, r.TeamRepo, r.DeveloperRepo, newDeveloperUsage(r.DeveloperRepo), testJWTSecret, time.Hour)
+	e.Use(requestDeadline(5 * time.Second))
+	e.Use(auth.Authenticate)
+	changes := newChangeHub()
+	country := NewCountryService(r.CountryRepo, r.ProvinceRepo, newJobRunner(r.NotificationRepo), changes, r.HistoryRepo)
+	province := NewProvinceService(r.ProvinceRepo, newJobRunner(r.NotificationRepo), changes, r.HistoryRepo)
+	district := NewDistrictService(r.DistrictRepo, r.HistoryRepo, changes)
+	e.PUT("/api/v1/country/:country_id", country.Edit, requireCountry(r.CountryRepo, "country_id"))
+	e.PATCH("/api/v1/country/:country_id/attributes", country.PatchAttributes, requireCountry(r.CountryRepo, "country_id"))
+	e.PUT("/api/v1/province/:province_id", province.UpdateProvince, requireProvince("province_id"))
+	e.PUT("/api/v1/district/:district_id", district.UpdateDistrict, requireDistrict(r.DistrictRepo))
+	return e, r, ctx, teamKey, changes
+}
+
+// saveTestTeam saves a team managing countryID and returns its key.
+func saveTestTeam(t *testing.T, ctx context.Context, r *Repository, countryID string) string {
+	t.Helper()
+	team := &Team{Name: countryID, CountryID: countryID, DailyWriteQuota: 100, CreatedAt: time.Now()}
+	team.BeforeSave()
+	if err := r.TeamRepo.Save(ctx, team); err != nil {
+		t.Fatal(err)
+	}
+	k, hash, err := newTeamKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.TeamRepo.SaveKey(ctx, team.ID, k, hash); err != nil {
+		t.Fatal(err)
+	}
+	return k.Key
+}
+
+// testToken is a bearer token of role, restricted to provinceID when set.
+func testToken(t *testing.T, role, provinceID string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &authClaims{
+		Role:       role,
+		ProvinceID: provinceID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "test",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// credentials are the headers a request authenticates with.
+type credentials map[string]string
+
+func bearer(token string) credentials {
+	return credentials{echo.HeaderAuthorization: "Bearer " + token}
+}
+
+func apiKey(key string) credentials {
+	return credentials{headerAPIKey: key}
+}
+
+func put(e *echo.Echo, path string, creds credentials, body string) *httptest.ResponseRecorder {
+	return send(e, http.MethodPut, path, creds, body)
+}
+
+func send(e *echo.Echo, method, path string, creds credentials, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for k, v := range creds {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPutProvinceAuthorizesThePathProvince(t *testing.T) {
+	e, r, ctx, teamKey, _ := newAuthTestServer(t)
+	editorVTE := bearer(testToken(t, RoleEditor, "VTE"))
+	for _, tt := range []struct {
+		name  string
+		path  string
+		creds credentials
+		body  string
+		want  int
+	}{
+		{"anonymous", "/api/v1/province/VTE", nil, `{"name":"Vientiane","total":7}`, http.StatusUnauthorized},
+		{"viewer", "/api/v1/province/VTE", bearer(testToken(t, RoleViewer, "")), `{"name":"Vientiane","total":7}`, http.StatusForbidden},
+		{"editor of another province", "/api/v1/province/LPB", editorVTE, `{"id":"VTE","name":"Luang Prabang","total":7}`, http.StatusForbidden},
+		{"team of another country", "/api/v1/province/BKK", apiKey(teamKey), `{"name":"Bangkok","total":7}`, http.StatusForbidden},
+		{"team of the country", "/api/v1/province/LPB", apiKey(teamKey), `{"name":"Luang Prabang","total":5}`, http.StatusOK},
+		{"editor of the province", "/api/v1/province/VTE", editorVTE, `{"id":"LPB","name":"Vientiane","total":7}`, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := put(e, tt.path, tt.creds, tt.body); rec.Code != tt.want {
+				t.Errorf("PUT %s = %d %s, want %d", tt.path, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	// the body naming another province changes the one of the path only
+	vte, err := r.ProvinceRepo.GetByID(ctx, "VTE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpb, err := r.ProvinceRepo.GetByID(ctx, "LPB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vte.Total != 7 || lpb.Total != 5 {
+		t.Errorf("totals VTE %d and LPB %d, want 7 and 5", vte.Total, lpb.Total)
+	}
+}
+
+func TestPutCountryAuthorizesThePathCountry(t *testing.T) {
+	e, r, ctx, teamKey, _ := newAuthTestServer(t)
+	admin := bearer(testToken(t, RoleAdmin, ""))
+	for _, tt := range []struct {
+		name  string
+		path  string
+		creds credentials
+		body  string
+		want  int
+	}{
+		{"anonymous", "/api/v1/country/LA", nil, `{"name":"Laos","total":11}`, http.StatusUnauthorized},
+		{"editor", "/api/v1/country/LA", bearer(testToken(t, RoleEditor, "")), `{"name":"Laos","total":11}`, http.StatusForbidden},
+		{"team of another country", "/api/v1/country/TH", apiKey(teamKey), `{"id":"LA","name":"Thailand","total":11}`, http.StatusForbidden},
+		{"team with a province of another country", "/api/v1/country/LA", apiKey(teamKey), `{"name":"Laos","provinces":[{"id":"BKK","name":"Bangkok","total":3}]}`, http.StatusBadRequest},
+		{"team of the country", "/api/v1/country/LA", apiKey(teamKey), `{"name":"Laos","total":11}`, http.StatusOK},
+		{"team of the country by its code", "/api/v1/country/lao", apiKey(teamKey), `{"name":"Laos","total":11}`, http.StatusNoContent},
+		{"admin", "/api/v1/country/TH", admin, `{"id":"LA","name":"Thailand","total":2}`, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := put(e, tt.path, tt.creds, tt.body); rec.Code != tt.want {
+				t.Errorf("PUT %s = %d %s, want %d", tt.path, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	la, err := r.CountryRepo.GetByID(ctx, "LA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	th, err := r.CountryRepo.GetByID(ctx, "TH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if la.Total != 11 || th.Total != 2 || th.Provinces[0].Total != 0 {
+		t.Errorf("totals LA %d, TH %d and BKK %d, want 11, 2 and 0", la.Total, th.Total, th.Provinces[0].Total)
+	}
+}
+
+func TestPutDistrictAuthorizesItsProvince(t *testing.T) {
+	e, r, ctx, teamKey, _ := newAuthTestServer(t)
+	editorVTE := bearer(testToken(t, RoleEditor, "VTE"))
+	for _, tt := range []struct {
+		name  string
+		path  string
+		creds credentials
+		body  string
+		want  int
+	}{
+		{"anonymous", "/api/v1/district/VTE-1", nil, `{"province_id":"VTE","name":"Chanthabouly","total":4}`, http.StatusUnauthorized},
+		{"editor of another province", "/api/v1/district/LPB-1", editorVTE, `{"id":"VTE-1","province_id":"VTE","name":"Luang Prabang","total":4}`, http.StatusForbidden},
+		{"editor moving it out of their province", "/api/v1/district/VTE-1", editorVTE, `{"province_id":"LPB","name":"Chanthabouly","total":4}`, http.StatusForbidden},
+		{"unknown district", "/api/v1/district/XXX", editorVTE, `{"province_id":"VTE","name":"Nowhere"}`, http.StatusNotFound},
+		{"team of the country", "/api/v1/district/LPB-1", apiKey(teamKey), `{"province_id":"LPB","name":"Luang Prabang","total":2}`, http.StatusOK},
+		{"editor of its province", "/api/v1/district/VTE-1", editorVTE, `{"id":"LPB-1","province_id":"VTE","name":"Chanthabouly","total":4}`, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := put(e, tt.path, tt.creds, tt.body); rec.Code != tt.want {
+				t.Errorf("PUT %s = %d %s, want %d", tt.path, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	vte1, err := r.DistrictRepo.GetByID(ctx, "VTE-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpb1, err := r.DistrictRepo.GetByID(ctx, "LPB-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vte1.ProvinceID != "VTE" || vte1.Total != 4 || lpb1.Total != 2 {
+		t.Errorf("VTE-1 in %s with %d, LPB-1 with %d, want VTE with 4 and 2", vte1.ProvinceID, vte1.Total, lpb1.Total)
+	}
+}
+
+func TestPatchCountryAttributesByCode(t *testing.T) {
+	e, r, ctx, teamKey, changes := newAuthTestServer(t)
+	sub := changes.Subscribe(countryKey("LA"))
+	defer sub.Close()
+	if rec := send(e, http.MethodPatch, "/api/v1/country/LAO/attributes", apiKey(teamKey), `{"who_region":"WPRO"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH by code = %d %s", rec.Code, rec.Body)
+	}
+	select {
+	case <-sub.C:
+	default:
+		t.Error("no change of LA was published")
+	}
+	la, err := r.CountryRepo.GetByID(ctx, "LA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if la.Attributes["who_region"] != "WPRO" {
+		t.Errorf("attributes = %v", la.Attributes)
+	}
+}
+
+func TestSequencingAuthorizesTheProvinceOfTheSubmission(t *testing.T) {
+	e, r, ctx, teamKey, _ := newAuthTestServer(t)
+	sequencing := NewSequencingService(r.SequencingRepo)
+	e.POST("/api/v1/sequencing", sequencing.Store, requireRole(RoleEditor))
+	e.DELETE("/api/v1/sequencing/:submission_id", sequencing.Delete, requireRole(RoleEditor))
+	s := &SequencingSubmission{Lab: "NCLE", SampleDate: time.Now().UTC(), Lineage: "BA.2", ProvinceID: "VTE", CreatedAt: time.Now()}
+	s.BeforeSave()
+	if err := r.SequencingRepo.Save(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"lab":"NCLE","sample_date":"2026-10-16T00:00:00Z","lineage":"BA.2","province_id":"VTE"}`
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		creds  credentials
+		want   int
+	}{
+		{"submit as the editor of another province", http.MethodPost, "/api/v1/sequencing", bearer(testToken(t, RoleEditor, "LPB")), http.StatusForbidden},
+		{"submit as the team of the country", http.MethodPost, "/api/v1/sequencing", apiKey(teamKey), http.StatusCreated},
+		{"delete as the editor of another province", http.MethodDelete, "/api/v1/sequencing/" + s.ID, bearer(testToken(t, RoleEditor, "LPB")), http.StatusForbidden},
+		{"delete as the editor of its province", http.MethodDelete, "/api/v1/sequencing/" + s.ID, bearer(testToken(t, RoleEditor, "VTE")), http.StatusNoContent},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := send(e, tt.method, tt.path, tt.creds, body); rec.Code != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutProvincesRespondAsync(t *testing.T) {
+	e, r, ctx, teamKey, _ := newAuthTestServer(t)
+	jobs := newJobRunner(r.NotificationRepo)
+	e.PUT("/api/v1/provinces", NewProvinceService(r.ProvinceRepo, jobs, newChangeHub(), r.HistoryRepo).UpdateProvinces, requireRole(RoleEditor))
+	creds := apiKey(teamKey)
+	creds["Prefer"] = "respond-async"
+
+	if rec := send(e, http.MethodPut, "/api/v1/provinces", creds, `[{"id":"BKK","name":"Bangkok","total":3}]`); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT a province of another country = %d %s, want 403 before any job", rec.Code, rec.Body)
+	}
+	rec := send(e, http.MethodPut, "/api/v1/provinces", creds, `[{"id":"VTE","name":"Vientiane","total":7},{"id":"LPB","name":"Luang Prabang","total":5}]`)
+	if rec.Code != http.StatusAccepted || rec.Header().Get(echo.HeaderLocation) == "" {
+		t.Fatalf("PUT = %d %s, want 202 with a Location", rec.Code, rec.Body)
+	}
+	jobs.Wait()
+
+	for id, want := range map[string]int64{"VTE": 7, "LPB": 5} {
+		p, err := r.ProvinceRepo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Total != want {
+			t.Errorf("total of %s = %d, want %d", id, p.Total, want)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const (
+	// the largest spreadsheet one backfill takes
+	maxBackfillSize = 32 << 20
+	// the row errors a backfill report lists at most
+	maxBackfillErrors = 100
+	// the history points written by one statement
+	backfillBatch = 500
+)
+
+// BackfillProfile maps the columns of one layout of the historical daily
+// spreadsheets of the ministry, which changed a few times over 2020 to 2022,
+// to history. Figures left out of Columns are recorded as 0.
+type BackfillProfile struct {
+	Name string `json:"name"`
+	// Format is csv or xlsx, told by the extension of the file when empty.
+	Format string `json:"format"`
+	// Sheet is the sheet of a workbook the figures are on, the first when
+	// empty.
+	Sheet string `json:"sheet"`
+	// Delimiter separates the fields of a CSV file, a comma when empty.
+	Delimiter string `json:"delimiter"`
+	// HeaderRow is the row, counted from 1, holding the column names, the
+	// data starting below it.
+	HeaderRow int `json:"header_row"`
+	// Kind is what the rows are the figures of: country, province or
+	// district.
+	Kind       string `json:"kind"`
+	DateColumn string `json:"date_column"`
+	// DateLayout is the Go layout of the dates, 2006-01-02 when empty. Dates
+	// a workbook stores as numbers are read as such whatever it is.
+	DateLayout string `json:"date_layout"`
+	// RegionColumn names the country by its id or ISO code, the province by
+	// its id, name or an alias, or the district by its name.
+	RegionColumn string `json:"region_column"`
+	// ProvinceColumn names the province of a district, as RegionColumn does.
+	ProvinceColumn string `json:"province_column"`
+	// Columns maps figures, as named by figureColumns, to the columns
+	// holding them.
+	Columns map[string]string `json:"columns"`
+}
+
+func (p *BackfillProfile) Prepare() {
+	p.Format = strings.ToLower(strings.TrimSpace(p.Format))
+	p.Kind = strings.TrimSpace(p.Kind)
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if p.HeaderRow == 0 {
+		p.HeaderRow = 1
+	}
+	if p.DateLayout == "" {
+		p.DateLayout = dateLayout
+	}
+}
+
+func (p *BackfillProfile) Validate() error {
+	switch p.Format {
+	case "", "csv", "xlsx":
+	default:
+		return errors.New("profile: format must be csv or xlsx")
+	}
+	switch p.Kind {
+	case "country", "province":
+	case "district":
+		if p.ProvinceColumn == "" {
+			return errors.New("profile: province_column is required for districts")
+		}
+	default:
+		return errors.New("profile: kind must be country, province or district")
+	}
+	if len([]rune(p.Delimiter)) != 1 {
+		return errors.New("profile: delimiter must be one character")
+	}
+	if p.HeaderRow < 1 {
+		return errors.New("profile: header_row must be positive")
+	}
+	if p.DateColumn == "" {
+		return errors.New("profile: date_column is required")
+	}
+	if p.RegionColumn == "" {
+		return errors.New("profile: region_column is required")
+	}
+	if len(p.Columns) == 0 {
+		return errors.New("profile: columns are required")
+	}
+	for figure := range p.Columns {
+		known := false
+		for _, column := range figureColumns {
+			known = known || figure == column
+		}
+		if !known {
+			return fmt.Errorf("profile: unknown figure %q, expected one of %s", figure, strings.Join(figureColumns, ", "))
+		}
+	}
+	return nil
+}
+
+// backfillPoint is the figures of one entity on one day of a spreadsheet.
+type backfillPoint struct {
+	EntityID string
+	Day      time.Time
+	figures
+}
+
+// BackfillReport tells what a backfill read from a spreadsheet and wrote.
+// Points already in history are kept, the spreadsheets only filling the days
+// before the API recorded them.
+type BackfillReport struct {
+	Profile string   `json:"profile"`
+	Kind    string   `json:"kind"`
+	Rows    int      `json:"rows"`
+	Points  int      `json:"points"`
+	Written int      `json:"written"`
+	Kept    int      `json:"kept"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	DryRun  bool     `json:"dry_run"`
+	Errors  []string `json:"errors"`
+}
+
+func (r *BackfillReport) fail(row int, format string, args ...interface{}) {
+	if len(r.Errors) < maxBackfillErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("row %d: ", row)+fmt.Sprintf(format, args...))
+	}
+}
+
+// parseBackfillCount reads a figure, with or without thousands separators,
+// an empty cell or a dash being 0.
+func parseBackfillCount(v string) (int64, error) {
+	v = strings.NewReplacer(",", "", " ", "", "\u00a0", "").Replace(strings.TrimSpace(v))
+	if v == "" || v == "-" {
+		return 0, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 || n != float64(int64(n)) {
+		return 0, fmt.Errorf("%q is not a count", v)
+	}
+	return int64(n), nil
+}
+
+// parseBackfillDay reads a date as laid out by the profile, or the serial
+// number a workbook stores it as.
+func parseBackfillDay(v, layout string, workbook bool) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if workbook {
+		if serial, err := strconv.ParseFloat(v, 64); err == nil {
+			day := xlsxEpoch.Add(time.Duration(serial * 24 * float64(time.Hour)))
+			return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date laid out as %s", v, layout)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// Repository
+type BackfillRepository interface {
+	// SavePoints adds points to the history of kind in one transaction,
+	// keeping the points already recorded, and returns how many it wrote.
+	SavePoints(ctx context.Context, kind string, points []*backfillPoint) (int, error)
+}
+
+type backfillRepo struct {
+	db *sql.DB
+}
+
+var _ BackfillRepository = &backfillRepo{}
+
+func NewBackfillRepo(db *sql.DB) *backfillRepo {
+	return &backfillRepo{db}
+}
+
+func (br *backfillRepo) SavePoints(ctx context.Context, kind string, points []*backfillPoint) (int, error) {
+	tx, err := br.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapErr(kind, "", "begin backfill", err)
+	}
+	defer tx.Rollback()
+
+	written := 0
+	for start := 0; start < len(points); start += backfillBatch {
+		end := start + backfillBatch
+		if end > len(points) {
+			end = len(points)
+		}
+		columns := append(append([]string{"kind", "entity_id", "day"}, figureColumns...), "recorded_at")
+		stm := squirrel.Insert("case_history").Columns(columns...)
+		for _, p := range points[start:end] {
+			values := []interface{}{kind, p.EntityID, p.Day.Format(dateLayout)}
+			for _, v := range p.values() {
+				values = append(values, v)
+			}
+			// the figures were those at the end of their day
+			stm = stm.Values(append(values, p.Day.Add(24*time.Hour-time.Second))...)
+		}
+		res, err := stm.Suffix("ON CONFLICT (kind, entity_id, day) DO NOTHING").
+			PlaceholderFormat(squirrel.Dollar).
+			RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return 0, wrapErr(kind, "", "insert backfill", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, wrapErr(kind, "", "insert backfill", err)
+		}
+		written += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, wrapErr(kind, "", "commit backfill", err)
+	}
+	return written, nil
+}
+
+// handler
+type backfillService struct {
+	bApp BackfillRepository
+	cApp CountryRepository
+	pApp ProvinceRepository
+	dApp DistrictRepository
+	jobs *jobRunner
+}
+
+func NewBackfillService(bApp BackfillRepository, cApp CountryRepository, pApp ProvinceRepository, dApp DistrictRepository, jobs *jobRunner) *backfillService {
+	return &backfillService{bApp: bApp, cApp: cApp, pApp: pApp, dApp: dApp, jobs: jobs}
+}
+
+func (bA *backfillService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// backfillResolver finds the entities the rows of a spreadsheet name, once
+// per name.
+type backfillResolver struct {
+	bA        *backfillService
+	ids       map[string]string
+	districts map[string]Districts
+}
+
+func (r *backfillResolver) resolve(ctx context.Context, kind, name, province string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(province)) + "/" + strings.ToLower(strings.TrimSpace(name))
+	if id, ok := r.ids[key]; ok {
+		return id, nil
+	}
+	var id string
+	switch kind {
+	case "country":
+		ct, err := r.bA.cApp.GetByID(ctx, strings.TrimSpace(name))
+		if err != nil {
+			return "", err
+		}
+		id = ct.ID
+	case "province":
+		p, err := r.bA.pApp.Resolve(ctx, strings.TrimSpace(name))
+		if err != nil {
+			return "", err
+		}
+		id = p.ID
+	case "district":
+		p, err := r.bA.pApp.Resolve(ctx, strings.TrimSpace(province))
+		if err != nil {
+			return "", err
+		}
+		ds, ok := r.districts[p.ID]
+		if !ok {
+			if ds, err = r.bA.dApp.GetAllByProvince(ctx, p.ID); err != nil {
+				return "", err
+			}
+			r.districts[p.ID] = ds
+		}
+		for _, d := range ds {
+			if strings.EqualFold(d.Name, strings.TrimSpace(name)) {
+				id = d.ID
+			}
+		}
+		if id == "" {
+			return "", errNotFound
+		}
+	}
+	r.ids[key] = id
+	return id, nil
+}
+
+// backfillColumns are the columns of a spreadsheet a profile maps, counted
+// from 0, those not mapped being -1.
+type backfillColumns struct {
+	date, region, province int
+	figures                []int
+}
+
+// locate finds the columns of p in the header row of a spreadsheet.
+func (p *BackfillProfile) locate(rows [][]string) (*backfillColumns, error) {
+	if len(rows) < p.HeaderRow {
+		return nil, fmt.Errorf("profile: no header row %d, the file has %d rows", p.HeaderRow, len(rows))
+	}
+	index := make(map[string]int)
+	for i, name := range rows[p.HeaderRow-1] {
+		index[strings.TrimSpace(name)] = i
+	}
+	column := func(name string) (int, error) {
+		i, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("profile: no column %q in the header row", name)
+		}
+		return i, nil
+	}
+	cols := &backfillColumns{province: -1, figures: make([]int, len(figureColumns))}
+	var err error
+	if cols.date, err = column(p.DateColumn); err != nil {
+		return nil, err
+	}
+	if cols.region, err = column(p.RegionColumn); err != nil {
+		return nil, err
+	}
+	if p.Kind == "district" {
+		if cols.province, err = column(p.ProvinceColumn); err != nil {
+			return nil, err
+		}
+	}
+	for i, figure := range figureColumns {
+		cols.figures[i] = -1
+		if name, ok := p.Columns[figure]; ok {
+			if cols.figures[i], err = column(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cols, nil
+}
+
+// read turns the rows of a spreadsheet below its header into history points
+// as the profile maps them, the rows it cannot read being reported.
+func (bA *backfillService) read(ctx context.Context, p *BackfillProfile, cols *backfillColumns, rows [][]string, report *BackfillReport) ([]*backfillPoint, error) {
+	resolver := &backfillResolver{bA: bA, ids: make(map[string]string), districts: make(map[string]Districts)}
+	seen := make(map[string]int)
+	var points []*backfillPoint
+	for n := p.HeaderRow; n < len(rows); n++ {
+		row, line := rows[n], n+1
+		cell := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return row[i]
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		report.Rows++
+
+		day, err := parseBackfillDay(cell(cols.date), p.DateLayout, p.Format == "xlsx")
+		if err != nil {
+			report.fail(line, "%s: %v", p.DateColumn, err)
+			continue
+		}
+		id, err := resolver.resolve(ctx, p.Kind, cell(cols.region), cell(cols.province))
+		if errors.Is(err, errNotFound) {
+			report.fail(line, "%s: no %s %q", p.RegionColumn, p.Kind, cell(cols.region))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := id + "/" + day.Format(dateLayout)
+		if first, ok := seen[key]; ok {
+			report.fail(line, "%s %q already has %s on row %d", p.Kind, cell(cols.region), day.Format(dateLayout), first)
+			continue
+		}
+		seen[key] = line
+
+		point := &backfillPoint{EntityID: id, Day: day}
+		counts := point.pointers()
+		failed := false
+		for i, at := range cols.figures {
+			if at < 0 {
+				continue
+			}
+			v, err := parseBackfillCount(cell(at))
+			if err != nil {
+				report.fail(line, "%s: %v", p.Columns[figureColumns[i]], err)
+				failed = true
+				break
+			}
+			*counts[i].(*int64) = v
+		}
+		if failed {
+			continue
+		}
+		points = append(points, point)
+		if d := day.Format(dateLayout); report.From == "" || d < report.From {
+			report.From = d
+		}
+		if d := day.Format(dateLayout); d > report.To {
+			report.To = d
+		}
+	}
+	report.Points = len(points)
+	return points, nil
+}
+
+// Backfill fills history from one of the historical daily spreadsheets of
+// the ministry, CSV or a workbook, posted as the file field of a multipart
+// form with its mapping profile as the profile field. Nothing is written
+// when a row cannot be read, the report listing why with 422, nor with
+// ?dry_run=true. Days already in history are kept.
+func (bA *backfillService) Backfill(c echo.Context) error {
+	var p BackfillProfile
+	if err := json.Unmarshal([]byte(c.FormValue("profile")), &p); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, bA.errMessage("request: unable to parse profile"))
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, bA.errMessage("request: file is required"))
+	}
+	if fh.Size > maxBackfillSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, bA.errMessage(fmt.Sprintf("request: file must be at most %d bytes", maxBackfillSize)))
+	}
+	p.Prepare()
+	if p.Format == "" {
+		p.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fh.Filename)), ".")
+	}
+	if err := p.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, bA.errMessage(err.Error()))
+	}
+	if p.Format == "" {
+		return c.JSON(http.StatusBadRequest, bA.errMessage("profile: format must be csv or xlsx"))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, bA.errMessage("request: unable to read file"))
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, bA.errMessage("request: unable to read file"))
+	}
+	var rows [][]string
+	if p.Format == "xlsx" {
+		rows, err = readXLSX(bytes.NewReader(data), int64(len(data)), p.Sheet)
+	} else {
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+		r.Comma = []rune(p.Delimiter)[0]
+		r.FieldsPerRecord = -1
+		rows, err = r.ReadAll()
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, bA.errMessage("request: unable to read file: "+err.Error()))
+	}
+
+	cols, err := p.locate(rows)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, bA.errMessage(err.Error()))
+	}
+
+	report := &BackfillReport{Profile: p.Name, Kind: p.Kind, DryRun: c.QueryParam("dry_run") == "true", Errors: make([]string, 0)}
+	points, err := bA.read(c.Request().Context(), &p, cols, rows, report)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, bA.errMessage(msg))
+	}
+	if len(report.Errors) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]*BackfillReport{"backfill": report})
+	}
+	if report.DryRun {
+		return c.JSON(http.StatusOK, map[string]*BackfillReport{"backfill": report})
+	}
+
+	// years of provinces can be more than fits in the router timeout
+	if respondAsync(c.Request()) {
+		job := bA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+			if report.Written, err = bA.bApp.SavePoints(ctx, p.Kind, points); err != nil {
+				return nil, err
+			}
+			report.Kept = report.Points - report.Written
+			return map[string]*BackfillReport{"backfill": report}, nil
+		})
+		return acceptJob(c, job)
+	}
+	if report.Written, err = bA.bApp.SavePoints(c.Request().Context(), p.Kind, points); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not write history")
+		return c.JSON(status, bA.errMessage(msg))
+	}
+	report.Kept = report.Points - report.Written
+	return c.JSON(http.StatusOK, map[string]*BackfillReport{"backfill": report})
+}
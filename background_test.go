@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// runInBackground runs loop as main does, with a context without a deadline
+// of its own, so that its database calls only pass the guard under the
+// deadlines the loop gives them. The loop is stopped when the test ends, or
+// by the function returned, which waits for it to return.
+func runInBackground(t *testing.T, loop func(ctx context.Context)) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop(ctx)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// eventually fails the test unless cond holds within 5 seconds.
+func eventually(t *testing.T, what string, cond func() (bool, error)) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ok, err := cond()
+		if err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not within 5s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// notificationsOf returns the notifications of kind.
+func notificationsOf(ctx context.Context, r *Repository, kind string) (Notifications, error) {
+	all, err := r.NotificationRepo.GetAll(ctx, false, 100)
+	if err != nil {
+		return nil, err
+	}
+	ns := make(Notifications, 0, len(all))
+	for _, n := range all {
+		if n.Kind == kind {
+			ns = append(ns, n)
+		}
+	}
+	return ns, nil
+}
+
+func TestFreshnessMonitorRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now().Add(-48*time.Hour))
+
+	fm := newFreshnessMonitor(24*time.Hour, time.Hour, r.NotificationRepo, "", http.DefaultClient)
+	fm.AddCheck(staleProvinces(r.ProvinceRepo))
+	runInBackground(t, fm.Run)
+
+	eventually(t, "stale provinces notified", func() (bool, error) {
+		ns, err := notificationsOf(ctx, r, NotificationStaleProvince)
+		return len(ns) == 2, err
+	})
+}
+
+func TestConsistencyCheckerRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	c := saveTestCountry(t, ctx, r, time.Now())
+	// VTE and LPB add up to 10
+	c.Total = 11
+	if err := r.CountryRepo.Update(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	runInBackground(t, newConsistencyChecker(time.Hour, r.ConsistencyRepo, r.NotificationRepo).Run)
+
+	eventually(t, "violation reported", func() (bool, error) {
+		vs, err := r.ConsistencyRepo.GetAll(ctx)
+		return len(vs) == 1 && vs[0].Rule == RuleProvinceSum && vs[0].SubjectID == "LA" && vs[0].Field == "total", err
+	})
+	ns, err := notificationsOf(ctx, r, NotificationViolation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns) != 1 {
+		t.Errorf("%d violations notified, want 1", len(ns))
+	}
+}
+
+func TestRetentionPurgerRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	expired := NewNotification(NotificationViolation, "LA", "expired")
+	expired.CreatedAt = time.Now().Add(-48 * time.Hour)
+	for _, n := range []*Notification{expired, NewNotification(NotificationViolation, "LA", "kept")} {
+		if err := r.NotificationRepo.Save(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rp := &retentionPurger{repo: r.RetentionRepo, interval: time.Hour, policies: []*RetentionPolicy{
+		{Table: "notifications", Window: "1d", column: "created_at", window: 24 * time.Hour},
+	}}
+	runInBackground(t, rp.Run)
+
+	eventually(t, "notifications purged", func() (bool, error) {
+		return rp.Policies()[0].LastPurgeAt != nil, nil
+	})
+	if p := rp.Policies()[0]; p.LastError != "" || p.LastPurged != 1 {
+		t.Errorf("purged %d with error %q, want 1 without", p.LastPurged, p.LastError)
+	}
+	ns, err := r.NotificationRepo.GetAll(ctx, false, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns) != 1 || ns[0].Message != "kept" {
+		t.Errorf("%d notifications left, want the one kept", len(ns))
+	}
+}
+
+func TestWebPusherRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	// a push service that no longer knows the subscription
+	var pushed sync.WaitGroup
+	pushed.Add(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusGone)
+		pushed.Done()
+	}))
+	defer srv.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browser, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	s := &PushSubscription{Endpoint: srv.URL + "/push/1", CreatedAt: time.Now()}
+	s.Keys.P256dh = base64.RawURLEncoding.EncodeToString(elliptic.Marshal(elliptic.P256(), browser.X, browser.Y))
+	s.Keys.Auth = base64.RawURLEncoding.EncodeToString(secret)
+	if err := r.PushRepo.Save(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	wp := &webPusher{key: key, subject: "mailto:ops@example.org", client: srv.Client(), subs: r.PushRepo,
+		queue: make(chan string, pushQueueSize), delay: 10 * time.Millisecond}
+	runInBackground(t, wp.Run)
+	wp.Enqueue([]string{countryKey("LA")})
+
+	pushed.Wait()
+	eventually(t, "gone subscription removed", func() (bool, error) {
+		subs, err := r.PushRepo.GetAll(ctx)
+		return len(subs) == 0, err
+	})
+}
+
+func TestDeveloperUsageRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	d := &Developer{ID: "dev-1", Email: "dev@example.org", Name: "Dev", CreatedAt: time.Now()}
+	if err := r.DeveloperRepo.Register(ctx, d, "token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	du := newDeveloperUsage(r.DeveloperRepo)
+	du.interval = 10 * time.Millisecond
+	runInBackground(t, du.Run)
+	now := time.Now()
+	du.Count(d.ID, now)
+	du.Count(d.ID, now)
+
+	eventually(t, "usage written", func() (bool, error) {
+		days, err := r.DeveloperRepo.Usage(ctx, d.ID, now.Add(-24*time.Hour), now.Add(24*time.Hour))
+		return len(days) == 1 && days[0].Requests == 2, err
+	})
+}
+
+func TestStreamServiceRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+
+	changes := newChangeHub()
+	sA := NewStreamService(r.CountryRepo, r.ProvinceRepo, changes)
+	runInBackground(t, sA.Run)
+	changes.Publish(countryKey("LA"), provinceKey("VTE"))
+
+	eventually(t, "changes streamed", func() (bool, error) {
+		sA.mu.Lock()
+		defer sA.mu.Unlock()
+		return len(sA.events) == 2 && sA.events[0].Name == EventCountryUpdated && sA.events[1].Name == EventProvinceUpdated, nil
+	})
+}
+
+func TestJHUSyncerRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "Province_State,Country_Region,Confirmed,Deaths,Recovered\nVientiane,Laos,20,1,5\n")
+	}))
+	defer srv.Close()
+
+	js := newJHUSyncer(srv.URL, map[string]string{}, srv.Client(), r, newChangeHub())
+	runInBackground(t, func(ctx context.Context) { js.Run(ctx, time.Hour) })
+
+	waitForSyncRun(t, ctx, r, sourceJHU)
+	vte, err := r.ProvinceRepo.GetByID(ctx, "VTE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vte.Total != 20 || vte.Dead != 1 {
+		t.Errorf("VTE total %d and dead %d, want 20 and 1", vte.Total, vte.Dead)
+	}
+}
+
+// newTestDHIS2 syncs the total of VTE with the organisation unit ouVTE of
+// the DHIS2 instance srv.
+func newTestDHIS2(r *Repository, srv *httptest.Server) *dhis2Syncer {
+	return &dhis2Syncer{
+		baseURL:       srv.URL,
+		username:      "admin",
+		password:      "district",
+		client:        srv.Client(),
+		dataElements:  map[string]string{"total": "deTotal"},
+		provinceUnits: map[string]string{"VTE": "ouVTE"},
+		districtUnits: map[string]string{},
+		dataSet:       "dsDaily",
+		history:       r.HistoryRepo,
+		provinces:     r.ProvinceRepo,
+		districts:     r.DistrictRepo,
+		runs:          r.SyncRunRepo,
+		notifications: r.NotificationRepo,
+		changes:       newChangeHub(),
+	}
+}
+
+// waitForSyncRun waits for a successful run of source.
+func waitForSyncRun(t *testing.T, ctx context.Context, r *Repository, source string) *SyncRun {
+	t.Helper()
+	var run *SyncRun
+	eventually(t, source+" sync recorded", func() (bool, error) {
+		var err error
+		run, err = r.SyncRunRepo.GetLatest(ctx, source)
+		if errors.Is(err, errNotFound) {
+			return false, nil
+		}
+		if err == nil && run.Status != SyncSucceeded {
+			return false, fmt.Errorf("sync %s: %s", run.Status, run.Error)
+		}
+		return err == nil, err
+	})
+	return run
+}
+
+func TestDHIS2SyncerRunPush(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, yesterday().Add(9*time.Hour))
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies <- string(body)
+		fmt.Fprint(w, `{"status":"SUCCESS"}`)
+	}))
+	defer srv.Close()
+
+	ds := newTestDHIS2(r, srv)
+	runInBackground(t, func(ctx context.Context) { ds.Run(ctx, time.Hour, ds.Push) })
+
+	if run := waitForSyncRun(t, ctx, r, sourceDHIS2); run.ProvincesUpdated != 1 {
+		t.Errorf("%d provinces pushed, want 1", run.ProvincesUpdated)
+	}
+	if body := <-bodies; !strings.Contains(body, `"orgUnit":"ouVTE","value":"6"`) {
+		t.Errorf("pushed %s, want the total of VTE", body)
+	}
+}
+
+func TestDHIS2SyncerRunPull(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"dataValues":[{"dataElement":"deTotal","period":%q,"orgUnit":"ouVTE","value":"9"}]}`,
+			yesterday().Format(dhis2PeriodLayout))
+	}))
+	defer srv.Close()
+
+	ds := newTestDHIS2(r, srv)
+	runInBackground(t, func(ctx context.Context) { ds.Run(ctx, time.Hour, ds.Pull) })
+
+	if run := waitForSyncRun(t, ctx, r, sourceDHIS2Pull); run.ProvincesUpdated != 1 {
+		t.Errorf("%d provinces pulled, want 1", run.ProvincesUpdated)
+	}
+	vte, err := r.ProvinceRepo.GetByID(ctx, "VTE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vte.Total != 9 {
+		t.Errorf("VTE total %d, want 9", vte.Total)
+	}
+}
+
+func TestOTLPTracerRun(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+	exported := make(chan string, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		exported <- string(body)
+	}))
+	defer srv.Close()
+
+	tracer = &otlpTracer{url: srv.URL + "/v1/traces", headers: map[string]string{}, service: defaultTraceService,
+		client: srv.Client(), queue: make(chan *span, traceQueueSize)}
+	defer func() { tracer = nil }()
+	stop := runInBackground(t, tracer.Run)
+
+	e := echo.New()
+	e.Use(traceRequests)
+	e.Use(requestDeadline(5 * time.Second))
+	e.GET("/api/v1/country/:country_id", func(c echo.Context) error {
+		if _, err := r.CountryRepo.GetByID(c.Request().Context(), c.Param("country_id")); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/country/LA", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("GET = %d %s", rec.Code, rec.Body)
+	}
+	// the spans still queued are exported as the loop stops
+	stop()
+
+	var all string
+	for len(exported) > 0 {
+		all += <-exported
+	}
+	for _, want := range []string{`"name":"GET /api/v1/country/:country_id"`, `"name":"SELECT"`, `{"key":"db.system","value":{"stringValue":"sqlite"}}`} {
+		if !strings.Contains(all, want) {
+			t.Errorf("exported spans lack %s", want)
+		}
+	}
+}
+
+func TestCDNPurgerRun(t *testing.T) {
+	// the purger makes no database call, it purges the keys the writes
+	// publish
+	purged := make(chan []string, 1)
+	cp := &cdnPurger{
+		purge: func(ctx context.Context, client *http.Client, tags []string) error {
+			purged <- tags
+			return nil
+		},
+		client: http.DefaultClient,
+		queue:  make(chan string, cdnPurgeQueueSize),
+	}
+	changes := newChangeHub()
+	changes.Listen(cp.Enqueue)
+	runInBackground(t, cp.Run)
+	changes.Publish(provinceKey("VTE"))
+	changes.Publish(provinceKey("VTE"), countryKey("LA"))
+
+	select {
+	case tags := <-purged:
+		if len(tags) != 2 {
+			t.Errorf("purged %v, want each key once", tags)
+		}
+	case <-time.After(cdnPurgeDelay + 5*time.Second):
+		t.Fatal("nothing purged")
+	}
+}
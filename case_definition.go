@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// CaseDefinition is a version of the health ministry's case definition,
+// in force from EffectiveFrom until the next version takes over.
+type CaseDefinition struct {
+	Version       string    `json:"version"`
+	Description   string    `json:"description"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CaseDefinitions []*CaseDefinition
+
+func (cd *CaseDefinition) Prepare() {
+	cd.Version = html.EscapeString(strings.TrimSpace(cd.Version))
+	cd.Description = html.EscapeString(strings.TrimSpace(cd.Description))
+}
+
+func (cd *CaseDefinition) Validate() error {
+	if cd.Version == "" {
+		return errors.New("case definition: version is required")
+	}
+	if cd.EffectiveFrom.IsZero() {
+		return errors.New("case definition: effective_from is required")
+	}
+	return nil
+}
+
+// Repository
+type CaseDefinitionRepository interface {
+	Save(ctx context.Context, cd *CaseDefinition) error
+	Delete(ctx context.Context, version string) error
+	GetAll(ctx context.Context) (CaseDefinitions, error)
+	// At returns the definition in force at t.
+	At(ctx context.Context, t time.Time) (*CaseDefinition, error)
+}
+
+type caseDefinitionRepo struct {
+	db *sql.DB
+}
+
+var _ CaseDefinitionRepository = &caseDefinitionRepo{}
+
+func NewCaseDefinitionRepo(db *sql.DB) *caseDefinitionRepo {
+	return &caseDefinitionRepo{db}
+}
+
+func (cr *caseDefinitionRepo) Save(ctx context.Context, cd *CaseDefinition) error {
+	if _, err := squirrel.Insert("case_definitions").
+		Columns("version", "description", "effective_from", "created_at").
+		Values(&cd.Version, &cd.Description, &cd.EffectiveFrom, &cd.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).ExecContext(ctx); err != nil {
+		return wrapErr("case definition", cd.Version, "insert case definition", err)
+	}
+	return nil
+}
+
+func (cr *caseDefinitionRepo) Delete(ctx context.Context, version string) error {
+	res, err := squirrel.Delete("case_definitions").
+		Where(squirrel.Eq{"version": version}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("case definition", version, "delete case definition", err)
+	}
+	return wrapErr("case definition", version, "delete case definition", affectedOne(res))
+}
+
+func (cr *caseDefinitionRepo) GetAll(ctx context.Context) (CaseDefinitions, error) {
+	rows, err := squirrel.Select("version", "description", "effective_from", "created_at").
+		From("case_definitions").
+		OrderBy("effective_from").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("case definition", "", "select case definitions", err)
+	}
+	defer rows.Close()
+
+	var cds = make(CaseDefinitions, 0)
+	for rows.Next() {
+		var cd CaseDefinition
+		if err := rows.Scan(&cd.Version, &cd.Description, &cd.EffectiveFrom, &cd.CreatedAt); err != nil {
+			return nil, wrapErr("case definition", "", "scan case definitions", err)
+		}
+		cds = append(cds, &cd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("case definition", "", "select case definitions", err)
+	}
+	return cds, nil
+}
+
+func (cr *caseDefinitionRepo) At(ctx context.Context, t time.Time) (*CaseDefinition, error) {
+	var cd CaseDefinition
+	err := squirrel.Select("version", "description", "effective_from", "created_at").
+		From("case_definitions").
+		Where(squirrel.LtOrEq{"effective_from": t}).
+		OrderBy("effective_from DESC").
+		Limit(1).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).ScanContext(ctx, &cd.Version, &cd.Description, &cd.EffectiveFrom, &cd.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("case definition", "", "select case definition", err)
+	}
+	return &cd, nil
+}
+
+// handler
+type caseDefinitionService struct {
+	cdApp CaseDefinitionRepository
+}
+
+func NewCaseDefinitionService(cdApp CaseDefinitionRepository) *caseDefinitionService {
+	return &caseDefinitionService{cdApp: cdApp}
+}
+
+func (cdA *caseDefinitionService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (cdA *caseDefinitionService) ListCaseDefinitions(c echo.Context) error {
+	cds, err := cdA.cdApp.GetAll(c.Request().Context())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cdA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]CaseDefinitions{"case_definitions": cds})
+}
+
+func (cdA *caseDefinitionService) Store(c echo.Context) error {
+	var cd CaseDefinition
+	if err := c.Bind(&cd); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, cdA.errMessage("request: unable to parse request payload"))
+	}
+	cd.Prepare()
+	cd.CreatedAt = time.Now()
+	if err := cd.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, cdA.errMessage(err.Error()))
+	}
+
+	if err := cdA.cdApp.Save(c.Request().Context(), &cd); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cdA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*CaseDefinition{"case_definition": &cd})
+}
+
+func (cdA *caseDefinitionService) Delete(c echo.Context) error {
+	if err := cdA.cdApp.Delete(c.Request().Context(), c.Param("version")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cdA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	cdnPurgeDelay     = 2 * time.Second
+	cdnPurgeQueueSize = 1024
+	// Cloudflare takes up to 30 tags per purge request
+	cdnPurgeBatch = 30
+)
+
+// setCacheTags tags a response with the keys of the entities it shows, as
+// Cache-Tag for Cloudflare and Surrogate-Key for Fastly, so that the CDN
+// copies of it are purged when any of them changes.
+func setCacheTags(c echo.Context, keys ...string) {
+	c.Response().Header().Set("Cache-Tag", strings.Join(keys, ","))
+	c.Response().Header().Set("Surrogate-Key", strings.Join(keys, " "))
+}
+
+func countryCacheTags(ct *Country) []string {
+	keys := []string{countryKey(ct.ID)}
+	for _, p := range ct.Provinces {
+		keys = append(keys, provinceKey(p.ID))
+	}
+	return keys
+}
+
+func provinceCacheTags(p *Province) []string {
+	keys := []string{provinceKey(p.ID)}
+	for _, d := range p.Districts {
+		keys = append(keys, districtKey(d.ID))
+	}
+	return keys
+}
+
+type purgeFunc func(ctx context.Context, client *http.Client, tags []string) error
+
+// cdnPurger purges the CDN copies of the responses tagged with the keys of
+// changed entities. Changes are collected for a short while so that a
+// country edit touching many provinces purges in as few requests as
+// possible.
+type cdnPurger struct {
+	purge  purgeFunc
+	client *http.Client
+	queue  chan string
+}
+
+// cdnPurgerFromEnv reads CDN_PURGE_PROVIDER, either cloudflare with
+// CLOUDFLARE_ZONE_ID and CLOUDFLARE_API_TOKEN or fastly with
+// FASTLY_SERVICE_ID and FASTLY_API_TOKEN. It returns nil when no provider is
+// configured.
+func cdnPurgerFromEnv(client *http.Client) (*cdnPurger, error) {
+	var purge purgeFunc
+	switch provider := os.Getenv("CDN_PURGE_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "cloudflare":
+		zone, token := os.Getenv("CLOUDFLARE_ZONE_ID"), os.Getenv("CLOUDFLARE_API_TOKEN")
+		if zone == "" || token == "" {
+			return nil, fmt.Errorf("cdn: CLOUDFLARE_ZONE_ID and CLOUDFLARE_API_TOKEN are required")
+		}
+		purge = cloudflarePurge(zone, token)
+	case "fastly":
+		service, token := os.Getenv("FASTLY_SERVICE_ID"), os.Getenv("FASTLY_API_TOKEN")
+		if service == "" || token == "" {
+			return nil, fmt.Errorf("cdn: FASTLY_SERVICE_ID and FASTLY_API_TOKEN are required")
+		}
+		purge = fastlyPurge(service, token)
+	default:
+		return nil, fmt.Errorf("cdn: unknown CDN_PURGE_PROVIDER %q", provider)
+	}
+	return &cdnPurger{purge: purge, client: client, queue: make(chan string, cdnPurgeQueueSize)}, nil
+}
+
+// Enqueue is the change hub listener of the purger. Keys that do not fit in
+// the queue are dropped, their responses expire on their TTL instead.
+func (cp *cdnPurger) Enqueue(keys []string) {
+	for _, key := range keys {
+		select {
+		case cp.queue <- key:
+		default:
+			logger.Warn().Str("key", key).Msg("cdn: purge queue full, dropped")
+		}
+	}
+}
+
+func (cp *cdnPurger) Run(ctx context.Context) {
+	for {
+		var first string
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-cp.queue:
+		}
+
+		pending := map[string]struct{}{first: {}}
+		timer := time.NewTimer(cdnPurgeDelay)
+	collect:
+		for {
+			select {
+			case key := <-cp.queue:
+				pending[key] = struct{}{}
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		tags := make([]string, 0, len(pending))
+		for key := range pending {
+			tags = append(tags, key)
+		}
+		for len(tags) > 0 {
+			n := len(tags)
+			if n > cdnPurgeBatch {
+				n = cdnPurgeBatch
+			}
+			if err := cp.purge(ctx, cp.client, tags[:n]); err != nil {
+				logger.Error().Err(err).Strs("tags", tags[:n]).Msg("cdn: failed to purge")
+			}
+			tags = tags[n:]
+		}
+	}
+}
+
+func cloudflarePurge(zone, token string) purgeFunc {
+	url := "https://api.cloudflare.com/client/v4/zones/" + zone + "/purge_cache"
+	return func(ctx context.Context, client *http.Client, tags []string) error {
+		body, err := json.Marshal(map[string][]string{"tags": tags})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return doPurge(client, req)
+	}
+}
+
+func fastlyPurge(service, token string) purgeFunc {
+	url := "https://api.fastly.com/service/" + service + "/purge"
+	return func(ctx context.Context, client *http.Client, tags []string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Fastly-Key", token)
+		req.Header.Set("Surrogate-Key", strings.Join(tags, " "))
+		return doPurge(client, req)
+	}
+}
+
+func doPurge(client *http.Client, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("cdn: %s answered %s", req.URL.Host, res.Status)
+	}
+	return nil
+}
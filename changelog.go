@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// kinds of API changes
+const (
+	ChangeAdded      = "added"
+	ChangeChanged    = "changed"
+	ChangeDeprecated = "deprecated"
+	ChangeRemoved    = "removed"
+)
+
+// ChangelogEntry is a change of the public API contract. IDs only ever
+// grow, integrators poll with ?since= the last ID they have seen.
+type ChangelogEntry struct {
+	ID          int    `json:"id"`
+	Date        string `json:"date"`
+	Kind        string `json:"kind"`
+	Endpoint    string `json:"endpoint"`
+	Field       string `json:"field,omitempty"`
+	Description string `json:"description"`
+}
+
+type Changelog []*ChangelogEntry
+
+// changelog lists the API changes, oldest first. Append an entry along with
+// every change of a route, a response field or a status code, and never
+// edit or reorder the existing ones.
+var changelog = Changelog{
+	{1, "2026-10-17", ChangeChanged, "PUT /api/v1/country/:country_id", "", "Answers 204 when the body does not change the country, 404 when the country does not exist and 409 on conflicting data."},
+	{2, "2026-10-17", ChangeAdded, "PUT /api/v1/country/:country_id", "", "Honors If-Match and If-Unmodified-Since, answering 412 when the country changed since."},
+	{3, "2026-10-17", ChangeAdded, "GET /api/v1/jobs/:job_id", "", "Writes sent with Prefer: respond-async are answered 202 with a job to poll."},
+	{4, "2026-10-17", ChangeAdded, "POST /api/v1/admin/provinces/merge", "", "Merges a province into another."},
+	{5, "2026-10-17", ChangeAdded, "POST /api/v1/admin/province/:province_id/split", "", "Splits a province into new ones."},
+	{6, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id", "", "Provinces are also found by name and alias."},
+	{7, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/aliases", "", "Lists, adds and removes province aliases."},
+	{8, "2026-10-17", ChangeAdded, "GET /api/v1/metrics", "", "Lists admin defined metrics, set per country or province."},
+	{9, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "metrics", "Values of the admin defined metrics."},
+	{10, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id", "metrics", "Values of the admin defined metrics."},
+	{11, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "attributes", "Free-form attributes, patched through PATCH /api/v1/country/:country_id/attributes."},
+	{12, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id", "attributes", "Free-form attributes, patched through PATCH /api/v1/province/:province_id/attributes."},
+	{13, "2026-10-17", ChangeAdded, "GET /api/v1/case-definitions", "", "Lists the versions of the case definition."},
+	{14, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/excess-mortality", "", "Excess mortality estimates, also per country."},
+	{15, "2026-10-17", ChangeAdded, "GET /api/v1/wastewater", "", "Wastewater samples and their weekly trend."},
+	{16, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/lineages", "", "Weekly lineage shares from sequencing submissions."},
+	{17, "2026-10-17", ChangeAdded, "GET /api/v1/outbreaks/summary", "", "Institutional outbreaks by institution type."},
+	{18, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/supplies", "", "Medical supply stock and the days it lasts."},
+	{19, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/beds", "", "Bed occupancy history and a projection of when beds run out."},
+	{20, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id/hotline", "", "Hotline calls by category and their weekly trend."},
+	{21, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id/frozen/:day", "", "Figures frozen for official publication and their revisions."},
+	{22, "2026-10-17", ChangeAdded, "GET /api/v1/changelog", "", "This changelog."},
+	{23, "2026-10-17", ChangeAdded, "GET /api/v1/countries", "", "Lists countries by name, paginated with ?page= and ?limit=."},
+	{24, "2026-10-17", ChangeAdded, "GET /api/v1/district/:district_id", "", "Districts are created, read, updated and deleted under /api/v1/district, and listed per province under /api/v1/province/:province_id/districts."},
+	{25, "2026-10-17", ChangeChanged, "GET /api/v1/province/:province_id", "districts", "Holds the districts of the province instead of always being null."},
+	{26, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id/wait", "", "Long-polls a country until it changes or ?timeout= elapses."},
+	{27, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id/history", "", "Daily history of the figures of a country, also per province and district, between ?from= and ?to=."},
+	{28, "2026-10-17", ChangeAdded, "POST /graphql", "", "GraphQL queries of countries, provinces and districts, and mutations of province and district figures."},
+	{29, "2026-10-17", ChangeAdded, "*", "meta", "Responses to requests with ?lang= carry meta.formatting, the locale, timezone, date format and number separators to render with."},
+	{30, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "", "Country, province and district responses carry Cache-Tag and Surrogate-Key headers naming the entities they show."},
+	{31, "2026-10-17", ChangeAdded, "GET /version", "", "The running release and the schema version it runs against."},
+	{32, "2026-10-17", ChangeChanged, "*", "", "With authentication configured, writes need a bearer token from POST /api/v1/auth/login and answer 401 without one and 403 outside the role or province of the caller."},
+	{33, "2026-10-17", ChangeAdded, "GET /readyz", "", "Readiness of the instance, with the schema drift found when not ready."},
+	{34, "2026-10-17", ChangeAdded, "GET /api/v1/openapi.json", "", "OpenAPI 3 specification of the API, generated from the routes and models."},
+	{35, "2026-10-17", ChangeAdded, "GET /api/v1/admin/journal", "", "Pages through the write requests recorded when the request journal is on."},
+	{36, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "", "?as_of= returns the figures of the country and its provinces as they were at the end of a day, or at a time."},
+	{37, "2026-10-17", ChangeAdded, "*", "", "Accept: application/json; profile=data or profile=bare returns the resource under a data key or bare instead of under a key naming it."},
+	{38, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/jhu", "", "Status of the last sync from the JHU CSSE daily reports, started with POST /api/v1/admin/sync/jhu."},
+	{39, "2026-10-17", ChangeChanged, "*", "", "History, trend, projection and excess mortality endpoints answer 503 with Retry-After when too many of them are running."},
+	{40, "2026-10-17", ChangeAdded, "GET /ws", "", "WebSocket pushing the changes of the countries subscribed to, and of their provinces and districts."},
+	{41, "2026-10-17", ChangeAdded, "GET /api/v1/stream", "", "Server-Sent Events country.updated and province.updated with the changed entity, resumable with Last-Event-ID."},
+	{42, "2026-10-17", ChangeChanged, "*", "", "Requests whose database calls outlast REQUEST_TIMEOUT, 30s by default, answer 503."},
+	{43, "2026-10-17", ChangeAdded, "POST /api/v1/admin/teams", "", "Delegates a country to a team, whose API keys, sent as X-API-Key, manage the country, its provinces and districts within a daily write quota."},
+	{44, "2026-10-17", ChangeChanged, "PUT /api/v1/country/:country_id", "", "Also allowed to the team the country is delegated to, as is PATCH /api/v1/country/:country_id/attributes."},
+	{45, "2026-10-17", ChangeAdded, "GET *", "", "Successful responses carry an ETag, requests with a matching If-None-Match are answered 304 Not Modified."},
+	{46, "2026-10-17", ChangeAdded, "GET /api/v1/meta/license", "", "The license, attribution and citation of the data."},
+	{47, "2026-10-17", ChangeAdded, "*", "", "Requests may be rate limited per client IP and per API key, carrying X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset, and answered 429 with Retry-After over the limit."},
+	{48, "2026-10-17", ChangeChanged, "GET /api/v1/country/:country_id/wait", "", "Answers 204 when the instance shuts down, as /api/v1/stream and /ws end, to be resumed against another instance."},
+	{49, "2026-10-17", ChangeAdded, "GET /api/v1/export/owid", "", "The history of countries as CSV in the Our World in Data compact format."},
+	{50, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id/fhir/MeasureReport", "", "The figures of a country and of its provinces as a FHIR R4 Bundle of MeasureReports, also ?as_of= a past time."},
+	{51, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/dhis2", "", "Status of the last push of daily province and district figures to DHIS2, started with POST /api/v1/admin/sync/dhis2."},
+	{52, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/jhu", "districts_updated", "Districts updated, or pushed, by the run."},
+	{53, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/dhis2/pull", "", "Status of the last pull of daily province and district figures from DHIS2, started with POST /api/v1/admin/sync/dhis2/pull."},
+	{54, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/jhu", "conflicts", "Values left as they are because they changed on both sides."},
+	{55, "2026-10-17", ChangeAdded, "GET /api/v1/meta", "", "Who runs the deployment, for which country, and its default locale and timezone."},
+	{56, "2026-10-17", ChangeChanged, "*", "meta.formatting.timezone", "Is the timezone of the deployment for every ?lang=, unless ?tz= is given."},
+	{57, "2026-10-17", ChangeAdded, "PATCH /api/v1/country/:country_id", "", "Updates only the figures, name and attributes given, as a JSON merge patch, leaving the provinces to PUT."},
+	{58, "2026-10-17", ChangeAdded, "PATCH /api/v1/province/:province_id", "", "Updates only the figures, name and attributes given, as a JSON merge patch, leaving the districts to PUT."},
+	{59, "2026-10-17", ChangeAdded, "PUT /api/v1/provinces", "", "Updates an array of provinces in one transaction, checking every entry first and writing all of them or none."},
+	{60, "2026-10-17", ChangeAdded, "POST /api/v1/validate", "", "Checks country, province, provinces and district payloads without storing them, answering their errors and the warnings of figures that are likely wrong."},
+	{61, "2026-10-17", ChangeAdded, "GET /api/v1/admin/data-quality", "", "Lists where the provinces do not add up to their country, the districts to their province, or history decreases, as found by the last consistency check."},
+	{62, "2026-10-17", ChangeAdded, "GET /api/v1/provinces", "", "Lists provinces, sorted with ?sort=total|new_case|dead|name and ?order=asc|desc, and filtered with ?min_total=."},
+	{63, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "", "Takes ?sort=, ?order= and ?min_total= for its provinces, which are otherwise by total, largest first."},
+	{64, "2026-10-17", ChangeAdded, "POST /api/v1/admin/imports/:sync_run_id/rollback", "", "Restores the figures the records updated by a JHU sync or a DHIS2 pull had before it, in one transaction, answering 409 when one of them changed since."},
+	{65, "2026-10-17", ChangeAdded, "GET /api/v1/admin/sync/jhu", "sync_run.rolled_back_at", "When the run was rolled back, as for the other sync endpoints."},
+	{66, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "meta.provinces", "Takes ?province_page= and ?province_limit= to hold a page of the provinces, meta.provinces giving their total count and the links to the next and previous pages."},
+	{67, "2026-10-17", ChangeAdded, "GET /metrics", "", "The national figures, the new cases of every province and the age of their last update as Prometheus gauges."},
+	{68, "2026-10-17", ChangeAdded, "POST /api/v1/push/subscriptions", "", "Subscribes a browser to Web Push notifications of published figures, with the key of GET /api/v1/push/vapid-key, DELETE unsubscribing it."},
+	{69, "2026-10-17", ChangeAdded, "PUT /api/v1/admin/teams/:team_id/keys/:key_id/embargo", "", "Puts an API key under an embargo, a time of day in UTC before which the countries, provinces, districts, their history and the exports are shown to it as they were at the end of the day before. It is no later than the public embargo, PUBLIC_EMBARGO, which anonymous callers and developer keys are under. Callers under embargo are refused by the WebSocket and SSE feeds, long polls, GraphQL, the gRPC reads and /metrics."},
+	{70, "2026-10-17", ChangeAdded, "GET /api/v1/country/:country_id", "country.iso2", "Countries carry their ISO 3166-1 alpha-2 and alpha-3 codes, iso2 and iso3, set with POST and PUT, and can be looked up by either instead of their id, in any case."},
+	{71, "2026-10-17", ChangeChanged, "GET /api/v1/country/:country_id/history", "", "The analytics endpoints answer 422 beyond their longest range: 731 days of country and province history, 184 of district history, 366 of hotline, bed and sequencing records, 104 weeks of trends, 60 months of excess mortality and 18300 country-days of OWID export, which also answers 422 for more than 50 country_id."},
+	{72, "2026-10-17", ChangeAdded, "GET /api/v1/province/:province_id", "province.latitude", "Provinces and districts carry latitude and longitude, set with their writes and kept when left out."},
+	{73, "2026-10-17", ChangeAdded, "GET /api/v1/geojson", "", "The provinces, or with ?level=district the districts, that have coordinates as a GeoJSON FeatureCollection of points with their figures as properties, ?parent_id= keeping those of one country or province."},
+	{74, "2026-10-17", ChangeAdded, "*", "error", "Error messages, and the issues of POST /api/v1/validate, are answered in Lao to requests with Accept-Language: lo, with Content-Language, messages without a translation staying in English."},
+	{75, "2026-10-17", ChangeAdded, "POST /api/v1/developers", "", "Developers register for a read-only API key of their own, issued by POST /api/v1/developers/verify with the token mailed to them, limited to RATE_LIMIT_PER_DEVELOPER_KEY requests a minute, 60 unless set. GET /api/v1/developers/me/usage answers its requests by day and POST /api/v1/developers/me/key replaces it."},
+	{76, "2026-10-17", ChangeAdded, "POST /api/v1/auth/embed-tokens", "", "Signs a token, for an hour or expires_in seconds up to a day, that reads one province and its records with ?embed_token=, for embeds not to hold an API key. It answers 403 on anything else."},
+	{77, "2026-10-17", ChangeAdded, "GET /api/v1/export/xlsx", "", "The figures of the countries, their provinces and their districts as an Excel workbook with a sheet each, ?country_id= keeping one country."},
+	{78, "2026-10-17", ChangeAdded, "POST /api/v1/admin/history/backfill", "", "Fills the history of countries, provinces or districts from a historical CSV or Excel spreadsheet, posted with a profile mapping its columns, keeping the days already recorded. ?dry_run=true only reports what would be written, and covidctl backfill posts a directory of files."},
+	{79, "2026-10-17", ChangeAdded, "GET /api/v1/report/daily.pdf", "", "The daily situation report of the country of ?country_id= as a PDF: its totals and new cases at the end of ?day=, today unless set, against the day before, and the ten provinces with the most new cases that day."},
+	{80, "2026-10-17", ChangeAdded, "GET /api/v1/admin/retention", "", "RETENTION_<TABLE>, e.g. RETENTION_REQUEST_JOURNAL=90d, purges the request journal, notifications, sync runs and usage counters older than their window every RETENTION_INTERVAL, an hour unless set. GET /api/v1/admin/retention answers the windows and the last purges, POST /api/v1/admin/retention/purge purges now."},
+	{81, "2026-10-17", ChangeAdded, "GET /api/v1/district/:district_id", "attributes", "Free-form attributes, patched through PATCH /api/v1/district/:district_id/attributes."},
+	{82, "2026-10-17", ChangeAdded, "POST /api/v1/export/history", "", "Exports the history of every country, province or district of ?kind= between ?from= and ?to= in a job, as CSV, NDJSON or Parquet by ?format=. The file is downloaded from GET /api/v1/export/history/:job_id once the job is done."},
+	{83, "2026-10-17", ChangeChanged, "GET /api/v1/country/:country_id", "", "Single countries, provinces and districts, and the writes to them, answer the ETag that If-Match is compared with. The tag of a country moves with its provinces, the one of a province with its districts."},
+	{84, "2026-10-17", ChangeChanged, "POST /api/v1/auth/embed-tokens", "", "Embed tokens are under the embargo of the caller that issued them, the key of a team passing on its own, a developer key the public one and a token none, and are limited per token to RATE_LIMIT_PER_EMBED_TOKEN requests a minute, 600 unless set, rather than per client IP."},
+	{85, "2026-10-17", ChangeChanged, "PUT /api/v1/admin/teams/:team_id/keys/:key_id/embargo", "", "Key embargoes apply without a public embargo, PUBLIC_EMBARGO, which they are only held to when it is set. /metrics answers callers under embargo the figures of the day before rather than refusing them."},
+	{86, "2026-10-17", ChangeChanged, "PUT /api/v1/provinces", "", "Honours Prefer: respond-async, answering 202 with a job once the entries are checked and authorized."},
+}
+
+// handler
+type changelogService struct{}
+
+func NewChangelogService() *changelogService {
+	return &changelogService{}
+}
+
+func (clA *changelogService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// ListChanges returns the changelog, or only the entries after ?since=.
+func (clA *changelogService) ListChanges(c echo.Context) error {
+	since := 0
+	if v := c.QueryParam("since"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, clA.errMessage("request: since must be a non-negative integer"))
+		}
+		since = n
+	}
+
+	var entries = make(Changelog, 0, len(changelog))
+	for _, e := range changelog {
+		if e.ID > since {
+			entries = append(entries, e)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]Changelog{"changelog": entries})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+)
+
+func countryKey(id string) string  { return "country:" + id }
+func provinceKey(id string) string { return "province:" + id }
+func districtKey(id string) string { return "district:" + id }
+
+// changeHub tells the requests waiting on an entity, and the listeners of
+// every change, that it changed. It only reaches requests served by the same
+// process.
+type changeHub struct {
+	mu        sync.Mutex
+	subs      map[string]map[*subscription]struct{}
+	listeners []func(keys []string)
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// subscription is woken by a change of any of the keys it was added to.
+// Changes coming in while nobody reads C coalesce into one.
+type subscription struct {
+	C    chan struct{}
+	hub  *changeHub
+	keys []string
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{subs: make(map[string]map[*subscription]struct{}), closed: make(chan struct{})}
+}
+
+// Close tells the requests waiting on changes that the server is shutting
+// down, so that they end instead of holding up the drain.
+func (h *changeHub) Close() {
+	h.closeOnce.Do(func() { close(h.closed) })
+}
+
+// Closed is closed by Close.
+func (h *changeHub) Closed() <-chan struct{} {
+	return h.closed
+}
+
+func (h *changeHub) Subscribe(keys ...string) *subscription {
+	s := &subscription{C: make(chan struct{}, 1), hub: h}
+	s.Add(keys...)
+	return s
+}
+
+// Add also wakes s on changes of keys.
+func (s *subscription) Add(keys ...string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for _, key := range keys {
+		subs, ok := s.hub.subs[key]
+		if !ok {
+			subs = make(map[*subscription]struct{})
+			s.hub.subs[key] = subs
+		}
+		subs[s] = struct{}{}
+		s.keys = append(s.keys, key)
+	}
+}
+
+func (s *subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	for _, key := range s.keys {
+		delete(s.hub.subs[key], s)
+		if len(s.hub.subs[key]) == 0 {
+			delete(s.hub.subs, key)
+		}
+	}
+	s.keys = nil
+}
+
+// Listen calls fn with the keys of every change. fn is called from the
+// publishing request and must not block.
+func (h *changeHub) Listen(fn func(keys []string)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+func (h *changeHub) Publish(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, fn := range h.listeners {
+		fn(keys)
+	}
+	for _, key := range keys {
+		for s := range h.subs[key] {
+			select {
+			case s.C <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
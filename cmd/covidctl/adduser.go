@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/myesui/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runAddUser creates a user straight in the database, which is how the first
+// admin is created before anyone can log in to create the others.
+func runAddUser(args []string) error {
+	fs := flag.NewFlagSet("adduser", flag.ExitOnError)
+	email := fs.String("email", "", "email the user logs in with")
+	role := fs.String("role", "admin", "viewer, editor or admin")
+	province := fs.String("province", "", "province an editor is restricted to, every one when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !strings.Contains(*email, "@") {
+		return errors.New("-email is required")
+	}
+	switch *role {
+	case "viewer", "editor", "admin":
+	default:
+		return errors.New("-role must be viewer, editor or admin")
+	}
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		return errors.New("DATABASE_URL is not set")
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) < 12 {
+		return errors.New("password must be at least 12 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	id := uuid.NewV4().String()
+	if _, err := db.ExecContext(ctx,
+		"INSERT INTO users (id, email, password_hash, role, province_id, created_at) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)",
+		id, strings.ToLower(strings.TrimSpace(*email)), string(hash), *role, *province, time.Now()); err != nil {
+		return err
+	}
+	fmt.Println(id)
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type backfillReport struct {
+	Rows    int      `json:"rows"`
+	Points  int      `json:"points"`
+	Written int      `json:"written"`
+	Kept    int      `json:"kept"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Errors  []string `json:"errors"`
+}
+
+// runBackfill posts historical spreadsheets, or the directories holding
+// them, to the backfill endpoint of an instance, each with the profile
+// mapping its layout. It stops at the first file that cannot be read.
+func runBackfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	target := fs.String("url", "http://localhost:5551", "base URL of the instance")
+	token := fs.String("token", os.Getenv("COVIDCTL_TOKEN"), "admin token")
+	profile := fs.String("profile", "", "JSON file of the mapping profile of the files")
+	dryRun := fs.Bool("dry-run", false, "only report what would be written")
+	timeout := fs.Duration("timeout", 5*time.Minute, "per file timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profile == "" || fs.NArg() == 0 {
+		return errors.New("-profile and at least one file or directory are required")
+	}
+	p, err := ioutil.ReadFile(*profile)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(p) {
+		return fmt.Errorf("%s is not JSON", *profile)
+	}
+	files, err := backfillFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	url := strings.TrimRight(*target, "/") + "/api/v1/admin/history/backfill"
+	if *dryRun {
+		url += "?dry_run=true"
+	}
+	for _, name := range files {
+		report, err := backfillDo(client, url, *token, p, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("%s\t%d rows\t%d points from %s to %s\t%d written\t%d kept\n",
+			name, report.Rows, report.Points, report.From, report.To, report.Written, report.Kept)
+	}
+	return nil
+}
+
+// backfillFiles lists the files named, and the CSV and Excel files of the
+// directories named, in order.
+func backfillFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		entries, err := ioutil.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".csv", ".xlsx":
+				names = append(names, filepath.Join(arg, e.Name()))
+			}
+		}
+		sort.Strings(names)
+		files = append(files, names...)
+	}
+	return files, nil
+}
+
+func backfillDo(client *http.Client, url, token string, profile []byte, name string) (*backfillReport, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("profile", string(profile)); err != nil {
+		return nil, err
+	}
+	fw, err := mw.CreateFormFile("file", filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(fw, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var out struct {
+		Backfill *backfillReport `json:"backfill"`
+		Error    string          `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("%s: %v", res.Status, err)
+	}
+	if res.StatusCode >= 400 {
+		if out.Backfill != nil && len(out.Backfill.Errors) > 0 {
+			return nil, fmt.Errorf("%s:\n  %s", res.Status, strings.Join(out.Backfill.Errors, "\n  "))
+		}
+		return nil, fmt.Errorf("%s: %s", res.Status, out.Error)
+	}
+	if out.Backfill == nil {
+		return nil, fmt.Errorf("%s: no report", res.Status)
+	}
+	return out.Backfill, nil
+}
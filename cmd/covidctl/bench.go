@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type benchProvince struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type benchCountry struct {
+	ID        string           `json:"id"`
+	Provinces []*benchProvince `json:"provinces"`
+}
+
+type benchResult struct {
+	op      string
+	latency time.Duration
+	err     error
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := fs.String("url", "http://localhost:5551", "base URL of the instance")
+	countryID := fs.String("country", "", "country to read and write, a throwaway one is created when empty")
+	duration := fs.Duration("duration", 30*time.Second, "how long to generate load")
+	concurrency := fs.Int("c", 10, "number of concurrent clients")
+	writeRatio := fs.Float64("write-ratio", 0.1, "fraction of requests that are province updates")
+	timeout := fs.Duration("timeout", 10*time.Second, "per request timeout")
+	token := fs.String("token", os.Getenv("COVIDCTL_TOKEN"), "admin token, sent with the writes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return errors.New("-c must be at least 1")
+	}
+	if *writeRatio < 0 || *writeRatio > 1 {
+		return errors.New("-write-ratio must be between 0 and 1")
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	base := strings.TrimRight(*target, "/")
+
+	country, err := benchSetup(client, base, *token, *countryID)
+	if err != nil {
+		return err
+	}
+	if len(country.Provinces) == 0 && *writeRatio > 0 {
+		return fmt.Errorf("country %s has no provinces to write to", country.ID)
+	}
+
+	fmt.Fprintf(os.Stderr, "bench: %d clients for %s against %s (country %s, %.0f%% writes)\n",
+		*concurrency, *duration, base, country.ID, *writeRatio*100)
+
+	results := make(chan benchResult, *concurrency*16)
+	deadline := time.Now().Add(*duration)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) {
+				if rnd.Float64() < *writeRatio {
+					p := country.Provinces[rnd.Intn(len(country.Provinces))]
+					results <- benchWrite(client, base, *token, p, rnd)
+				} else {
+					results <- benchRead(client, base, country.ID)
+				}
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	latencies := map[string][]time.Duration{}
+	failures := map[string]int{}
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			failures[r.op]++
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		latencies[r.op] = append(latencies[r.op], r.latency)
+	}
+
+	benchReport(os.Stdout, *duration, latencies, failures)
+	if firstErr != nil {
+		fmt.Fprintf(os.Stderr, "bench: first failure: %v\n", firstErr)
+	}
+	return nil
+}
+
+func benchSetup(client *http.Client, base, token, countryID string) (*benchCountry, error) {
+	var res map[string]*benchCountry
+	if countryID != "" {
+		if err := benchDo(client, http.MethodGet, base+"/api/v1/country/"+countryID, "", nil, &res); err != nil {
+			return nil, err
+		}
+		return res["country"], nil
+	}
+
+	provinces := make([]map[string]interface{}, 18)
+	for i := range provinces {
+		provinces[i] = map[string]interface{}{"name": fmt.Sprintf("Bench Province %d", i+1)}
+	}
+	body := map[string]interface{}{"name": "Bench", "provinces": provinces}
+	if err := benchDo(client, http.MethodPost, base+"/api/v1/country", token, body, &res); err != nil {
+		return nil, err
+	}
+	return res["country"], nil
+}
+
+func benchRead(client *http.Client, base, countryID string) benchResult {
+	start := time.Now()
+	err := benchDo(client, http.MethodGet, base+"/api/v1/country/"+countryID, "", nil, nil)
+	return benchResult{op: "read", latency: time.Since(start), err: err}
+}
+
+func benchWrite(client *http.Client, base, token string, p *benchProvince, rnd *rand.Rand) benchResult {
+	total := rnd.Int63n(10000)
+	body := map[string]interface{}{
+		"id":       p.ID,
+		"name":     p.Name,
+		"total":    total,
+		"new_case": rnd.Int63n(100),
+		"dead":     rnd.Int63n(total/100 + 1),
+	}
+	start := time.Now()
+	err := benchDo(client, http.MethodPut, base+"/api/v1/province/"+p.ID, token, body, nil)
+	return benchResult{op: "write", latency: time.Since(start), err: err}
+}
+
+func benchDo(client *http.Client, method, url, token string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, url, res.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func benchReport(w io.Writer, duration time.Duration, latencies map[string][]time.Duration, failures map[string]int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\terrors\treq/s\tp50\tp90\tp95\tp99\tmax\t")
+	for _, op := range []string{"read", "write"} {
+		ls := latencies[op]
+		if len(ls) == 0 && failures[op] == 0 {
+			continue
+		}
+		sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t\n",
+			op,
+			len(ls),
+			failures[op],
+			float64(len(ls))/duration.Seconds(),
+			percentile(ls, 50),
+			percentile(ls, 90),
+			percentile(ls, 95),
+			percentile(ls, 99),
+			percentile(ls, 100))
+	}
+	tw.Flush()
+}
+
+// percentile expects sorted latencies.
+func percentile(ls []time.Duration, p int) time.Duration {
+	if len(ls) == 0 {
+		return 0
+	}
+	i := (len(ls)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return ls[i].Round(time.Microsecond)
+}
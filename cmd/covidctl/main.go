@@ -0,0 +1,48 @@
+// Command covidctl is the operator tool for the covid19 API.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "bench", usage: "generate read/write load against an instance and report latencies", run: runBench},
+	{name: "release", usage: "migrate the database and check its seed data, run as the Heroku release phase", run: runRelease},
+	{name: "adduser", usage: "create a user, e.g. the first admin, reading the password from stdin", run: runAddUser},
+	{name: "replay", usage: "replay the request journal of an instance against another one", run: runReplay},
+	{name: "backfill", usage: "fill the history of an instance from historical spreadsheets", run: runBackfill},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: covidctl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "covidctl %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
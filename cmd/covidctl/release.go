@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// runRelease is the Heroku release phase: it migrates the database and checks
+// the seed data before the new slug serves traffic, a failure aborting the
+// deploy with the previous release left running.
+func runRelease(args []string) error {
+	fs := flag.NewFlagSet("release", flag.ExitOnError)
+	dir := fs.String("migrations", "migrations", "directory of the migration files")
+	allowEmpty := fs.Bool("allow-empty", false, "do not fail on a database without countries, for a first deploy")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long migrating may take")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		return errors.New("DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := migrations.Apply(ctx, db, migrations.Postgres, *dir)
+	for _, v := range applied {
+		fmt.Printf("applied %s\n", v)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("schema is up to date")
+	}
+	return checkSeed(ctx, db, *allowEmpty)
+}
+
+// checkSeed fails on a database without any country, which the API has
+// nothing to serve from.
+func checkSeed(ctx context.Context, db *sql.DB, allowEmpty bool) error {
+	var countries int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM country").Scan(&countries); err != nil {
+		return fmt.Errorf("seed check: %w", err)
+	}
+	if countries == 0 && !allowEmpty {
+		return errors.New("seed check: no country in the database, run with -allow-empty for a first deploy")
+	}
+	fmt.Printf("seed check: %d countries\n", countries)
+	return nil
+}
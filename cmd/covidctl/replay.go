@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type journalEntry struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+	Body   string `json:"body"`
+	Actor  string `json:"actor"`
+	Status int    `json:"status"`
+}
+
+// runReplay reads the request journal of one instance and sends the recorded
+// writes, in order, to another one, e.g. production to staging.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	from := fs.String("from", "", "base URL of the instance whose journal is read")
+	fromToken := fs.String("from-token", os.Getenv("COVIDCTL_FROM_TOKEN"), "admin token for -from")
+	to := fs.String("to", "", "base URL of the instance the requests are replayed against")
+	toToken := fs.String("to-token", os.Getenv("COVIDCTL_TO_TOKEN"), "token for -to")
+	after := fs.Int64("after", 0, "replay the entries after this id")
+	until := fs.Int64("until", 0, "stop after this id, 0 for the end of the journal")
+	failed := fs.Bool("failed", false, "also replay requests that failed when recorded")
+	timeout := fs.Duration("timeout", 30*time.Second, "per request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("-from and -to are required")
+	}
+	if strings.TrimRight(*from, "/") == strings.TrimRight(*to, "/") {
+		return errors.New("-from and -to are the same instance")
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	next := *after
+	for {
+		url := fmt.Sprintf("%s/api/v1/admin/journal?after=%d&limit=500", strings.TrimRight(*from, "/"), next)
+		var page map[string][]*journalEntry
+		if err := replayDo(client, http.MethodGet, url, *fromToken, nil, &page); err != nil {
+			return err
+		}
+		entries := page["journal"]
+		if len(entries) == 0 {
+			return nil
+		}
+		for _, e := range entries {
+			if *until > 0 && e.ID > *until {
+				return nil
+			}
+			next = e.ID
+			if e.Status >= 400 && !*failed {
+				continue
+			}
+			target := strings.TrimRight(*to, "/") + e.Path
+			if e.Query != "" {
+				target += "?" + e.Query
+			}
+			var body io.Reader
+			if e.Body != "" {
+				body = strings.NewReader(e.Body)
+			}
+			err := replayDo(client, e.Method, target, *toToken, body, nil)
+			result := "ok"
+			if err != nil {
+				result = err.Error()
+			}
+			fmt.Printf("%d\t%s %s\trecorded %d by %s\t%s\n", e.ID, e.Method, e.Path, e.Status, actorName(e.Actor), result)
+		}
+	}
+}
+
+func actorName(actor string) string {
+	if actor == "" {
+		return "anonymous"
+	}
+	return actor
+}
+
+func replayDo(client *http.Client, method, url, token string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
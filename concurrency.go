@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultHeavyConcurrency = 4
+	defaultHeavyQueue       = 8
+	defaultHeavyQueueWait   = 5 * time.Second
+)
+
+// concurrencyLimiter caps how many requests of a group of expensive endpoints
+// run at once, so that they cannot take the whole database pool. Requests over
+// the cap wait in a short queue for a slot, those finding the queue full or
+// waiting longer than wait are answered 503.
+type concurrencyLimiter struct {
+	name    string
+	slots   chan struct{}
+	queue   int64
+	waiting int64
+	wait    time.Duration
+}
+
+func newConcurrencyLimiter(name string, limit, queue int, wait time.Duration) (*concurrencyLimiter, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("concurrency: %s: limit must be at least 1", name)
+	}
+	if queue < 0 {
+		return nil, fmt.Errorf("concurrency: %s: queue must not be negative", name)
+	}
+	return &concurrencyLimiter{
+		name:  name,
+		slots: make(chan struct{}, limit),
+		queue: int64(queue),
+		wait:  wait,
+	}, nil
+}
+
+func (cl *concurrencyLimiter) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (cl *concurrencyLimiter) overloaded(c echo.Context) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(cl.wait.Seconds())+1))
+	return c.JSON(http.StatusServiceUnavailable,
+		cl.errMessage(fmt.Sprintf("Error: Too many %s requests, retry later", cl.name)))
+}
+
+func (cl *concurrencyLimiter) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		select {
+		case cl.slots <- struct{}{}:
+		default:
+			if atomic.AddInt64(&cl.waiting, 1) > cl.queue {
+				atomic.AddInt64(&cl.waiting, -1)
+				return cl.overloaded(c)
+			}
+			timer := time.NewTimer(cl.wait)
+			select {
+			case cl.slots <- struct{}{}:
+				timer.Stop()
+				atomic.AddInt64(&cl.waiting, -1)
+			case <-timer.C:
+				atomic.AddInt64(&cl.waiting, -1)
+				return cl.overloaded(c)
+			case <-c.Request().Context().Done():
+				timer.Stop()
+				atomic.AddInt64(&cl.waiting, -1)
+				return c.Request().Context().Err()
+			}
+		}
+		defer func() { <-cl.slots }()
+		return next(c)
+	}
+}
+
+// heavyLimiterFromEnv builds the limiter of the analytics endpoints from
+// HEAVY_CONCURRENCY, HEAVY_QUEUE and HEAVY_QUEUE_WAIT.
+func heavyLimiterFromEnv() (*concurrencyLimiter, error) {
+	limit, queue, wait := defaultHeavyConcurrency, defaultHeavyQueue, defaultHeavyQueueWait
+	var err error
+	if v := os.Getenv("HEAVY_CONCURRENCY"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("concurrency: invalid HEAVY_CONCURRENCY: %w", err)
+		}
+	}
+	if v := os.Getenv("HEAVY_QUEUE"); v != "" {
+		if queue, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("concurrency: invalid HEAVY_QUEUE: %w", err)
+		}
+	}
+	if v := os.Getenv("HEAVY_QUEUE_WAIT"); v != "" {
+		if wait, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("concurrency: invalid HEAVY_QUEUE_WAIT: %w", err)
+		}
+	}
+	return newConcurrencyLimiter("analytics", limit, queue, wait)
+}
@@ -0,0 +1,270 @@
+// Package config loads the settings of the server from an optional YAML
+// file, named by CONFIG_FILE, and from environment variables, which take
+// precedence so that Heroku config vars always win.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Duration is a time.Duration written as "30s" or "12h" in YAML.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type Config struct {
+	// Port is supplied by Heroku.
+	Port     string   `yaml:"port"`
+	Database Database `yaml:"database"`
+	CORS     CORS     `yaml:"cors"`
+	Cache    Cache    `yaml:"cache"`
+	Auth     Auth     `yaml:"auth"`
+	// Deployment describes who runs the server and for which country, so
+	// that forks for other countries only change settings.
+	Deployment Deployment `yaml:"deployment"`
+	// RequestTimeout bounds how long the database calls of a request run.
+	RequestTimeout Duration `yaml:"request_timeout"`
+	// ShutdownTimeout bounds how long a stopping server waits for the
+	// requests and jobs in flight.
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// LogLevel is the lowest level logged: debug, info, warn or error.
+	LogLevel string `yaml:"log_level"`
+}
+
+type Database struct {
+	// Driver names the storage backend: postgres, sqlite, whose URL is the
+	// path of the database file, or memory, which takes no URL and keeps
+	// the data for the life of the process.
+	Driver string `yaml:"driver"`
+	URL    string `yaml:"url"`
+	// ReplicaURL optionally points reads at a replica, HedgeAfter being how
+	// long to wait for it before also asking the primary.
+	ReplicaURL string   `yaml:"replica_url"`
+	HedgeAfter Duration `yaml:"hedge_after"`
+	// pool sizes, those of database/sql when 0
+	MaxOpenConns    int      `yaml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime"`
+}
+
+type CORS struct {
+	// AllowOrigins holds the origins browsers may call from, "*" being any.
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+type Cache struct {
+	// RedisURL caches the countries read by id, for RedisTTL at most.
+	RedisURL string   `yaml:"redis_url"`
+	RedisTTL Duration `yaml:"redis_ttl"`
+	// LocalTTL caches the countries and provinces read by id in memory, at
+	// most LocalSize of them.
+	LocalTTL  Duration `yaml:"local_ttl"`
+	LocalSize int      `yaml:"local_size"`
+	// AggregateTTL caches the results of the summary endpoints in memory,
+	// refreshing them shortly before they expire.
+	AggregateTTL Duration `yaml:"aggregate_ttl"`
+}
+
+type Auth struct {
+	// JWTSecret turns on authentication, tokens being valid for JWTTTL.
+	JWTSecret string   `yaml:"jwt_secret"`
+	JWTTTL    Duration `yaml:"jwt_ttl"`
+}
+
+type Deployment struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country the figures are
+	// about.
+	Country      string `yaml:"country"`
+	Operator     string `yaml:"operator"`
+	ContactEmail string `yaml:"contact_email"`
+	// Locale and Timezone are the defaults of the clients, the timezone being
+	// the one days are counted in.
+	Locale   string `yaml:"locale"`
+	Timezone string `yaml:"timezone"`
+}
+
+// Default is the configuration of a server given no settings.
+func Default() *Config {
+	return &Config{
+		Port:     "5551",
+		Database: Database{Driver: "postgres"},
+		CORS:     CORS{AllowOrigins: []string{"*"}},
+		Cache: Cache{
+			RedisTTL:  Duration(time.Minute),
+			LocalSize: 1024,
+		},
+		Auth:            Auth{JWTTTL: Duration(12 * time.Hour)},
+		Deployment:      Deployment{Country: "LA", Locale: "lo-LA", Timezone: "Asia/Vientiane"},
+		RequestTimeout:  Duration(30 * time.Second),
+		ShutdownTimeout: Duration(25 * time.Second),
+		LogLevel:        "info",
+	}
+}
+
+// Load reads the defaults, then the file of CONFIG_FILE when set, then the
+// environment, and validates the result.
+func Load() (*Config, error) {
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	if err := cfg.readEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readEnv overrides the settings whose variable is set.
+func (cfg *Config) readEnv(lookup func(string) (string, bool)) error {
+	vars := []struct {
+		name string
+		set  func(string) error
+	}{
+		{"PORT", setString(&cfg.Port)},
+		{"DATABASE_DRIVER", setString(&cfg.Database.Driver)},
+		{"DATABASE_URL", setString(&cfg.Database.URL)},
+		{"DATABASE_REPLICA_URL", setString(&cfg.Database.ReplicaURL)},
+		{"REPLICA_HEDGE_AFTER", setDuration(&cfg.Database.HedgeAfter)},
+		{"DB_MAX_OPEN_CONNS", setInt(&cfg.Database.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", setInt(&cfg.Database.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", setDuration(&cfg.Database.ConnMaxLifetime)},
+		{"CORS_ALLOW_ORIGINS", setList(&cfg.CORS.AllowOrigins)},
+		{"REDIS_URL", setString(&cfg.Cache.RedisURL)},
+		{"REDIS_CACHE_TTL", setDuration(&cfg.Cache.RedisTTL)},
+		{"LOCAL_CACHE_TTL", setDuration(&cfg.Cache.LocalTTL)},
+		{"LOCAL_CACHE_SIZE", setInt(&cfg.Cache.LocalSize)},
+		{"AGGREGATE_CACHE_TTL", setDuration(&cfg.Cache.AggregateTTL)},
+		{"JWT_SECRET", setString(&cfg.Auth.JWTSecret)},
+		{"JWT_TTL", setDuration(&cfg.Auth.JWTTTL)},
+		{"DEPLOYMENT_COUNTRY", setString(&cfg.Deployment.Country)},
+		{"DEPLOYMENT_OPERATOR", setString(&cfg.Deployment.Operator)},
+		{"DEPLOYMENT_CONTACT_EMAIL", setString(&cfg.Deployment.ContactEmail)},
+		{"DEFAULT_LOCALE", setString(&cfg.Deployment.Locale)},
+		{"DEFAULT_TIMEZONE", setString(&cfg.Deployment.Timezone)},
+		{"REQUEST_TIMEOUT", setDuration(&cfg.RequestTimeout)},
+		{"SHUTDOWN_TIMEOUT", setDuration(&cfg.ShutdownTimeout)},
+		{"LOG_LEVEL", setString(&cfg.LogLevel)},
+	}
+	for _, v := range vars {
+		s, ok := lookup(v.name)
+		if !ok || s == "" {
+			continue
+		}
+		if err := v.set(s); err != nil {
+			return fmt.Errorf("config: invalid %s %q", v.name, s)
+		}
+	}
+	return nil
+}
+
+func setString(dst *string) func(string) error {
+	return func(s string) error {
+		*dst = s
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(s)
+		*dst = n
+		return err
+	}
+}
+
+func setDuration(dst *Duration) func(string) error {
+	return func(s string) error {
+		d, err := time.ParseDuration(s)
+		*dst = Duration(d)
+		return err
+	}
+}
+
+// setList reads a comma separated list.
+func setList(dst *[]string) func(string) error {
+	return func(s string) error {
+		var l []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				l = append(l, v)
+			}
+		}
+		*dst = l
+		return nil
+	}
+}
+
+// Validate checks every setting, reporting all the invalid ones at once.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+	if n, err := strconv.Atoi(cfg.Port); err != nil || n < 1 || n > 65535 {
+		problems = append(problems, fmt.Sprintf("port %q is not a TCP port", cfg.Port))
+	}
+	check(cfg.Database.Driver != "", "database driver is required")
+	// the memory backend has nothing to connect to
+	check(cfg.Database.URL != "" || cfg.Database.Driver == "memory", "database url is required")
+	check(cfg.Database.HedgeAfter >= 0, "database hedge_after must not be negative")
+	check(cfg.Database.MaxOpenConns >= 0, "database max_open_conns must not be negative")
+	check(cfg.Database.MaxIdleConns >= 0, "database max_idle_conns must not be negative")
+	check(cfg.Database.MaxOpenConns == 0 || cfg.Database.MaxIdleConns <= cfg.Database.MaxOpenConns,
+		"database max_idle_conns must not exceed max_open_conns")
+	check(cfg.Database.ConnMaxLifetime >= 0, "database conn_max_lifetime must not be negative")
+	check(len(cfg.CORS.AllowOrigins) > 0, "cors allow_origins must not be empty")
+	check(cfg.Cache.RedisTTL >= Duration(time.Second), "cache redis_ttl must be at least 1s")
+	check(cfg.Cache.LocalTTL >= 0, "cache local_ttl must not be negative")
+	check(cfg.Cache.LocalSize >= 1, "cache local_size must be at least 1")
+	check(cfg.Cache.AggregateTTL >= 0, "cache aggregate_ttl must not be negative")
+	check(cfg.Auth.JWTTTL > 0, "auth jwt_ttl must be positive")
+	check(len(cfg.Deployment.Country) == 2 && strings.ToUpper(cfg.Deployment.Country) == cfg.Deployment.Country,
+		"deployment country must be an ISO 3166-1 alpha-2 code")
+	check(cfg.Deployment.ContactEmail == "" || strings.Contains(cfg.Deployment.ContactEmail, "@"),
+		"deployment contact_email is not an email address")
+	check(cfg.Deployment.Locale != "", "deployment locale is required")
+	if _, err := time.LoadLocation(cfg.Deployment.Timezone); err != nil || cfg.Deployment.Timezone == "" {
+		problems = append(problems, fmt.Sprintf("deployment timezone %q is unknown", cfg.Deployment.Timezone))
+	}
+	check(cfg.RequestTimeout > 0, "request_timeout must be positive")
+	check(cfg.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	switch cfg.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("log_level %q is not debug, info, warn or error", cfg.LogLevel))
+	}
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Package conformance holds the HTTP contract of the covid19 API as a table of
+// cases that can be run against any deployment, so forks and mirrors can check
+// that their clients will keep working against them.
+//
+// A fork typically wires it into its own test suite:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, os.Getenv("COVID19_API_URL"), conformance.Options{
+//			Token: os.Getenv("COVID19_API_TOKEN"),
+//		})
+//	}
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Options controls how the cases are run.
+type Options struct {
+	// Client is used to issue the requests, http.DefaultClient with a 10
+	// second timeout when nil.
+	Client *http.Client
+
+	// Writes enables the cases that create and update data. Only turn it on
+	// against a deployment whose data can be thrown away.
+	Writes bool
+
+	// Token is the bearer token sent with the write cases, one of an admin
+	// as creating a country takes. Deployments with JWT_SECRET set answer
+	// writes without it 401.
+	Token string
+}
+
+// Case is a single request and the response the contract expects for it.
+type Case struct {
+	Name   string
+	Method string
+	// Path may reference values captured by earlier cases, e.g. {country_id}.
+	Path string
+	Body string
+	// Write marks cases that modify data on the target.
+	Write bool
+
+	WantStatus int
+	// WantKey is the top-level key the payload must be wrapped in.
+	WantKey string
+	// WantFields are the fields the object under WantKey must carry.
+	WantFields []string
+	// Capture stores fields of the object under WantKey as variables for the
+	// following cases, keyed by variable name.
+	Capture map[string]string
+}
+
+var countryFields = []string{
+	"id",
+	"name",
+	"total",
+	"new_case",
+	"treaded",
+	"decovering_case",
+	"test_case",
+	"negative_case",
+	"dead",
+	"provinces",
+	"updated_at",
+}
+
+// Cases is the contract, in the order the cases are run.
+var Cases = []Case{
+	{
+		Name:       "unknown country",
+		Method:     http.MethodGet,
+		Path:       "/api/v1/country/00000000-0000-0000-0000-000000000000",
+		WantStatus: http.StatusNotFound,
+		WantKey:    "error",
+	},
+	{
+		Name:       "create country with malformed payload",
+		Method:     http.MethodPost,
+		Path:       "/api/v1/country",
+		Body:       `{"name":`,
+		Write:      true,
+		WantStatus: http.StatusUnprocessableEntity,
+		WantKey:    "error",
+	},
+	{
+		Name:       "create country without name",
+		Method:     http.MethodPost,
+		Path:       "/api/v1/country",
+		Body:       `{"total":1}`,
+		Write:      true,
+		WantStatus: http.StatusBadRequest,
+		WantKey:    "error",
+	},
+	{
+		Name:       "create country",
+		Method:     http.MethodPost,
+		Path:       "/api/v1/country",
+		Body:       `{"name":"Conformance","total":10,"new_case":2,"dead":1,"provinces":[{"name":"Conformance Province","total":10}]}`,
+		Write:      true,
+		WantStatus: http.StatusOK,
+		WantKey:    "country",
+		WantFields: countryFields,
+		Capture:    map[string]string{"country_id": "id"},
+	},
+	{
+		Name:       "get created country",
+		Method:     http.MethodGet,
+		Path:       "/api/v1/country/{country_id}",
+		Write:      true,
+		WantStatus: http.StatusOK,
+		WantKey:    "country",
+		WantFields: countryFields,
+	},
+	{
+		Name:       "edit country without name",
+		Method:     http.MethodPut,
+		Path:       "/api/v1/country/{country_id}",
+		Body:       `{"id":"{country_id}","total":11}`,
+		Write:      true,
+		WantStatus: http.StatusBadRequest,
+		WantKey:    "error",
+	},
+	{
+		Name:       "edit country",
+		Method:     http.MethodPut,
+		Path:       "/api/v1/country/{country_id}",
+		Body:       `{"id":"{country_id}","name":"Conformance","total":11,"new_case":1,"dead":1}`,
+		Write:      true,
+		WantStatus: http.StatusOK,
+		WantKey:    "country",
+		WantFields: countryFields,
+	},
+	{
+		Name:       "update province without name",
+		Method:     http.MethodPut,
+		Path:       "/api/v1/province/00000000-0000-0000-0000-000000000000",
+		Body:       `{"total":1}`,
+		Write:      true,
+		WantStatus: http.StatusBadRequest,
+		WantKey:    "error",
+	},
+}
+
+// Run runs every case against the deployment at baseURL as a subtest of t.
+// Cases that write are skipped unless opts.Writes is set.
+func Run(t *testing.T, baseURL string, opts Options) {
+	if baseURL == "" {
+		t.Skip("conformance: no base URL given")
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	vars := map[string]string{}
+	for _, tc := range Cases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			if tc.Write && !opts.Writes {
+				t.Skip("conformance: write cases are disabled")
+			}
+			token := ""
+			if tc.Write {
+				token = opts.Token
+			}
+			obj, err := check(client, baseURL, token, tc, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, field := range tc.Capture {
+				vars[name] = fmt.Sprint(obj[field])
+			}
+		})
+	}
+}
+
+func check(client *http.Client, baseURL, token string, tc Case, vars map[string]string) (map[string]interface{}, error) {
+	path, body := expand(tc.Path, vars), expand(tc.Body, vars)
+	if strings.Contains(path, "{") {
+		return nil, fmt.Errorf("%s %s: unresolved variable, did an earlier case fail?", tc.Method, path)
+	}
+
+	req, err := http.NewRequest(tc.Method, baseURL+path, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != tc.WantStatus {
+		return nil, fmt.Errorf("%s %s: got status %d, want %d: %s", tc.Method, path, res.StatusCode, tc.WantStatus, raw)
+	}
+	if tc.WantKey == "" {
+		return nil, nil
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, fmt.Errorf("%s %s: response is not a JSON object: %v", tc.Method, path, err)
+	}
+	v, ok := payload[tc.WantKey]
+	if !ok {
+		return nil, fmt.Errorf("%s %s: response has no %q key: %s", tc.Method, path, tc.WantKey, raw)
+	}
+	if len(tc.WantFields) == 0 {
+		return nil, nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(v, &obj); err != nil {
+		return nil, fmt.Errorf("%s %s: %q is not an object: %v", tc.Method, path, tc.WantKey, err)
+	}
+	for _, f := range tc.WantFields {
+		if _, ok := obj[f]; !ok {
+			return nil, fmt.Errorf("%s %s: %q has no %q field", tc.Method, path, tc.WantKey, f)
+		}
+	}
+	return obj, nil
+}
+
+func expand(s string, vars map[string]string) string {
+	for name, v := range vars {
+		s = strings.Replace(s, "{"+name+"}", v, -1)
+	}
+	return s
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// rules of the consistency checks
+const (
+	RuleProvinceSum      = "province_sum"
+	RuleDistrictSum      = "district_sum"
+	RuleHistoryMonotonic = "history_monotonic"
+)
+
+// Violation is a figure that does not agree with the others, found by the
+// consistency checks. Day is the day of history it is about, if any.
+type Violation struct {
+	Rule       string    `json:"rule"`
+	Kind       string    `json:"kind"`
+	SubjectID  string    `json:"subject_id"`
+	Field      string    `json:"field"`
+	Day        *string   `json:"day"`
+	Message    string    `json:"message"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+type Violations []*Violation
+
+func (v *Violation) key() string {
+	key := v.Rule + ":" + v.Kind + ":" + v.SubjectID + ":" + v.Field
+	if v.Day != nil {
+		key += ":" + *v.Day
+	}
+	return key
+}
+
+// figureColumns are the columns of figures, in its order.
+var figureColumns = []string{"total", "new_case", "treated", "decovering_case", "test_case", "dead", "negative_case"}
+
+func (f *figures) values() []int64 {
+	return []int64{f.Total, f.NewCase, f.Treated, f.DecoveringCase, f.TestCase, f.Dead, f.NegativeTest}
+}
+
+func (f *figures) pointers() []interface{} {
+	return []interface{}{&f.Total, &f.NewCase, &f.Treated, &f.DecoveringCase, &f.TestCase, &f.Dead, &f.NegativeTest}
+}
+
+// sumCheck is a parent and the sums of the figures of its children.
+type sumCheck struct {
+	ID, Name string
+	Own, Sum figures
+}
+
+// Repository
+type ConsistencyRepository interface {
+	// Sums lists the parents of table having children in childTable, through
+	// the parentColumn of the children.
+	Sums(ctx context.Context, table, childTable, parentColumn string) ([]*sumCheck, error)
+	// Decreases lists the days of history a cumulative count went down on.
+	Decreases(ctx context.Context) (Violations, error)
+	GetAll(ctx context.Context) (Violations, error)
+	// Replace makes vs the report, in place of the last one.
+	Replace(ctx context.Context, vs Violations) error
+}
+
+type consistencyRepo struct {
+	db *sql.DB
+}
+
+var _ ConsistencyRepository = &consistencyRepo{}
+
+func NewConsistencyRepo(db *sql.DB) *consistencyRepo {
+	return &consistencyRepo{db}
+}
+
+func (cr *consistencyRepo) Sums(ctx context.Context, table, childTable, parentColumn string) ([]*sumCheck, error) {
+	columns := []string{"p.id", "p.name"}
+	for _, column := range figureColumns {
+		columns = append(columns, "p."+column)
+	}
+	for _, column := range figureColumns {
+		columns = append(columns, "SUM(c."+column+")")
+	}
+	rows, err := squirrel.Select(columns...).
+		From(table + " p").
+		Join(childTable + " c ON c." + parentColumn + " = p.id").
+		GroupBy("p.id").
+		OrderBy("p.id").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr(table, "", "select sums", err)
+	}
+	defer rows.Close()
+
+	var checks []*sumCheck
+	for rows.Next() {
+		var s sumCheck
+		dest := append([]interface{}{&s.ID, &s.Name}, s.Own.pointers()...)
+		if err := rows.Scan(append(dest, s.Sum.pointers()...)...); err != nil {
+			return nil, wrapErr(table, "", "scan sums", err)
+		}
+		checks = append(checks, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(table, "", "select sums", err)
+	}
+	return checks, nil
+}
+
+// the cumulative counts of history, which only grow
+var cumulativeColumns = []string{"total", "test_case", "dead"}
+
+func (cr *consistencyRepo) Decreases(ctx context.Context) (Violations, error) {
+	columns := []string{"kind", "entity_id", "day"}
+	var decreased squirrel.Or
+	for _, column := range cumulativeColumns {
+		columns = append(columns, column, "LAG("+column+") OVER (PARTITION BY kind, entity_id ORDER BY day) AS previous_"+column)
+		decreased = append(decreased, squirrel.Expr(column+" < previous_"+column))
+	}
+	history := squirrel.Select(columns...).From("case_history")
+	rows, err := squirrel.Select("*").
+		FromSelect(history, "h").
+		Where(decreased).
+		OrderBy("kind", "entity_id", "day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("history", "", "select decreases", err)
+	}
+	defer rows.Close()
+
+	vs := make(Violations, 0)
+	for rows.Next() {
+		var kind, id string
+		var day time.Time
+		counts := make([]sql.NullInt64, 2*len(cumulativeColumns))
+		dest := []interface{}{&kind, &id, &day}
+		for i := range counts {
+			dest = append(dest, &counts[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, wrapErr("history", "", "scan decreases", err)
+		}
+		d := day.Format(dateLayout)
+		for i, column := range cumulativeColumns {
+			n, previous := counts[2*i], counts[2*i+1]
+			if !previous.Valid || n.Int64 >= previous.Int64 {
+				continue
+			}
+			vs = append(vs, &Violation{
+				Rule:      RuleHistoryMonotonic,
+				Kind:      kind,
+				SubjectID: id,
+				Field:     column,
+				Day:       &d,
+				Message:   fmt.Sprintf("%s %s: %s decreases from %d to %d on %s", kind, id, column, previous.Int64, n.Int64, d),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("history", "", "select decreases", err)
+	}
+	return vs, nil
+}
+
+func (cr *consistencyRepo) GetAll(ctx context.Context) (Violations, error) {
+	rows, err := squirrel.Select("rule", "kind", "subject_id", "field", "day", "message", "detected_at").
+		From("data_quality").
+		OrderBy("detected_at DESC", "rule", "subject_id", "field", "day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("data_quality", "", "select violations", err)
+	}
+	defer rows.Close()
+
+	var vs = make(Violations, 0)
+	for rows.Next() {
+		var v Violation
+		var day sql.NullTime
+		if err := rows.Scan(&v.Rule, &v.Kind, &v.SubjectID, &v.Field, &day, &v.Message, &v.DetectedAt); err != nil {
+			return nil, wrapErr("data_quality", "", "scan violations", err)
+		}
+		if day.Valid {
+			d := day.Time.Format(dateLayout)
+			v.Day = &d
+		}
+		vs = append(vs, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("data_quality", "", "select violations", err)
+	}
+	return vs, nil
+}
+
+func (cr *consistencyRepo) Replace(ctx context.Context, vs Violations) (err error) {
+	tx, err := cr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("data_quality", "", "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("data_quality", "", "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	if _, err := squirrel.Delete("data_quality").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("data_quality", "", "delete violations", err)
+	}
+	if len(vs) == 0 {
+		return nil
+	}
+	stm := squirrel.Insert("data_quality").
+		Columns("rule", "kind", "subject_id", "field", "day", "message", "detected_at")
+	for _, v := range vs {
+		stm = stm.Values(v.Rule, v.Kind, v.SubjectID, v.Field, v.Day, v.Message, v.DetectedAt)
+	}
+	if _, err := stm.PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("data_quality", "", "insert violations", err)
+	}
+	return nil
+}
+
+// consistencyChecker periodically checks that the provinces add up to their
+// country, the districts to their province, and that the cumulative counts
+// of history never decrease. The violations found make the data-quality
+// report, and those not reported before are posted to the notification
+// center.
+type consistencyChecker struct {
+	interval      time.Duration
+	repo          ConsistencyRepository
+	notifications NotificationRepository
+}
+
+func newConsistencyChecker(interval time.Duration, repo ConsistencyRepository, notifications NotificationRepository) *consistencyChecker {
+	return &consistencyChecker{interval: interval, repo: repo, notifications: notifications}
+}
+
+// Run checks every interval until ctx is done.
+func (cc *consistencyChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(cc.interval)
+	defer ticker.Stop()
+	for {
+		if err := cc.check(ctx); err != nil {
+			logger.Error().Err(err).Msg("consistency: check failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cc *consistencyChecker) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, cc.interval)
+	defer cancel()
+
+	var vs Violations
+	for _, rule := range []struct {
+		rule, kind, table, childTable, parentColumn string
+	}{
+		{RuleProvinceSum, "country", "country", "provinces", "country_id"},
+		{RuleDistrictSum, "province", "provinces", "districts", "province_id"},
+	} {
+		checks, err := cc.repo.Sums(ctx, rule.table, rule.childTable, rule.parentColumn)
+		if err != nil {
+			return err
+		}
+		for _, s := range checks {
+			own, sum := s.Own.values(), s.Sum.values()
+			for i, column := range figureColumns {
+				if own[i] == sum[i] {
+					continue
+				}
+				vs = append(vs, &Violation{
+					Rule:      rule.rule,
+					Kind:      rule.kind,
+					SubjectID: s.ID,
+					Field:     column,
+					Message: fmt.Sprintf("%s %s: %s is %d but its %s add up to %d",
+						rule.kind, s.Name, column, own[i], rule.childTable, sum[i]),
+				})
+			}
+		}
+	}
+	decreases, err := cc.repo.Decreases(ctx)
+	if err != nil {
+		return err
+	}
+	vs = append(vs, decreases...)
+
+	// a violation still there keeps the time it was first seen at, and is
+	// only notified the first time
+	previous, err := cc.repo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]time.Time, len(previous))
+	for _, v := range previous {
+		seen[v.key()] = v.DetectedAt
+	}
+	now := time.Now()
+	for _, v := range vs {
+		if detectedAt, ok := seen[v.key()]; ok {
+			v.DetectedAt = detectedAt
+			continue
+		}
+		v.DetectedAt = now
+		if err := cc.notifications.Save(ctx, NewNotification(NotificationViolation, v.SubjectID, "%s", v.Message)); err != nil {
+			logger.Error().Err(err).Str(v.Kind+"_id", v.SubjectID).Msg("consistency: failed to notify")
+		}
+	}
+	return cc.repo.Replace(ctx, vs)
+}
+
+// handler
+type consistencyService struct {
+	repo ConsistencyRepository
+}
+
+func NewConsistencyService(repo ConsistencyRepository) *consistencyService {
+	return &consistencyService{repo: repo}
+}
+
+func (cA *consistencyService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// DataQuality answers the violations found by the last consistency check.
+func (cA *consistencyService) DataQuality(c echo.Context) error {
+	vs, err := cA.repo.GetAll(c.Request().Context())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Violations{"violations": vs})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const countryCachePrefix = "covid19:country:"
+
+// cachedCountryRepo keeps the countries read by id in Redis, shared by every
+// instance. Writes through it drop the country they write, and changes of
+// provinces and districts, which are part of a country, drop every cached
+// country. Changes made behind its back, such as metrics, show after ttl.
+//
+// Redis being unavailable only costs the cache, reads then go to the database.
+type cachedCountryRepo struct {
+	CountryRepository
+	pool         *redis.Pool
+	ttl          time.Duration
+	invalidateCh chan struct{}
+}
+
+var _ CountryRepository = &cachedCountryRepo{}
+
+// newRedisPool returns the pool of the Redis server at url.
+func newRedisPool(url string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     8,
+		IdleTimeout: 4 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url,
+				redis.DialConnectTimeout(time.Second),
+				redis.DialReadTimeout(500*time.Millisecond),
+				redis.DialWriteTimeout(500*time.Millisecond))
+		},
+	}
+}
+
+func newCachedCountryRepo(repo CountryRepository, pool *redis.Pool, ttl time.Duration, changes *changeHub) *cachedCountryRepo {
+	cr := &cachedCountryRepo{
+		CountryRepository: repo,
+		pool:              pool,
+		ttl:               ttl,
+		invalidateCh:      make(chan struct{}, 1),
+	}
+	changes.Listen(cr.onChange)
+	go cr.invalidateLoop()
+	return cr
+}
+
+func (cr *cachedCountryRepo) GetByID(ctx context.Context, id string) (*Country, error) {
+	// a write compares to the country as it is
+	if readsForWrite(ctx) {
+		return cr.CountryRepository.GetByID(ctx, id)
+	}
+	if c := cr.get(ctx, id); c != nil {
+		return c, nil
+	}
+	c, err := cr.CountryRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cr.set(ctx, c)
+	return c, nil
+}
+
+func (cr *cachedCountryRepo) Save(ctx context.Context, c *Country) error {
+	if err := cr.CountryRepository.Save(ctx, c); err != nil {
+		return err
+	}
+	cr.drop(ctx, c.ID)
+	return nil
+}
+
+func (cr *cachedCountryRepo) Update(ctx context.Context, c *Country) error {
+	err := cr.CountryRepository.Update(ctx, c)
+	// dropped even on failure, the update may have been partly applied
+	cr.drop(ctx, c.ID)
+	return err
+}
+
+func (cr *cachedCountryRepo) Delete(ctx context.Context, c *Country) error {
+	err := cr.CountryRepository.Delete(ctx, c)
+	cr.drop(ctx, c.ID)
+	return err
+}
+
+func (cr *cachedCountryRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	err := cr.CountryRepository.PatchAttributes(ctx, id, patch, updatedAt)
+	cr.drop(ctx, id)
+	return err
+}
+
+func (cr *cachedCountryRepo) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	err := cr.CountryRepository.UpdatePartial(ctx, id, columns, updatedAt)
+	cr.drop(ctx, id)
+	return err
+}
+
+func (cr *cachedCountryRepo) get(ctx context.Context, id string) *Country {
+	conn, err := cr.pool.GetContext(ctx)
+	if err != nil {
+		logFor(ctx).Error().Err(err).Msg("country cache: no connection")
+		return nil
+	}
+	defer conn.Close()
+	b, err := redis.Bytes(conn.Do("GET", countryCachePrefix+id))
+	if err != nil {
+		if err != redis.ErrNil {
+			logFor(ctx).Error().Err(err).Str("country_id", id).Msg("country cache: get")
+		}
+		return nil
+	}
+	var c Country
+	if err := json.Unmarshal(b, &c); err != nil {
+		logFor(ctx).Error().Err(err).Str("country_id", id).Msg("country cache: decode")
+		return nil
+	}
+	return &c
+}
+
+func (cr *cachedCountryRepo) set(ctx context.Context, c *Country) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	conn, err := cr.pool.GetContext(ctx)
+	if err != nil {
+		logFor(ctx).Error().Err(err).Msg("country cache: no connection")
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Do("SET", countryCachePrefix+c.ID, b, "EX", int(cr.ttl.Seconds())); err != nil {
+		logFor(ctx).Error().Err(err).Str("country_id", c.ID).Msg("country cache: set")
+	}
+}
+
+func (cr *cachedCountryRepo) drop(ctx context.Context, id string) {
+	conn, err := cr.pool.GetContext(ctx)
+	if err != nil {
+		logFor(ctx).Error().Err(err).Msg("country cache: no connection")
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Do("DEL", countryCachePrefix+id); err != nil {
+		logFor(ctx).Error().Err(err).Str("country_id", id).Msg("country cache: drop")
+	}
+}
+
+// onChange drops the cached countries on changes within a country. It is
+// called from the publishing request, so the dropping is left to
+// invalidateLoop.
+func (cr *cachedCountryRepo) onChange(keys []string) {
+	for _, key := range keys {
+		if strings.HasPrefix(key, "province:") || strings.HasPrefix(key, "district:") {
+			select {
+			case cr.invalidateCh <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+func (cr *cachedCountryRepo) invalidateLoop() {
+	for range cr.invalidateCh {
+		cr.dropAll()
+	}
+}
+
+func (cr *cachedCountryRepo) dropAll() {
+	conn := cr.pool.Get()
+	defer conn.Close()
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", countryCachePrefix+"*", "COUNT", 100))
+		if err != nil {
+			logger.Error().Err(err).Msg("country cache: scan")
+			return
+		}
+		var keys []interface{}
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			logger.Error().Err(err).Msg("country cache: scan")
+			return
+		}
+		if len(keys) > 0 {
+			if _, err := conn.Do("DEL", keys...); err != nil {
+				logger.Error().Err(err).Msg("country cache: drop")
+				return
+			}
+		}
+		if cursor == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,397 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package covid19pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// Covid19Client is the client API for Covid19 service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type Covid19Client interface {
+	GetCountry(ctx context.Context, in *GetCountryRequest, opts ...grpc.CallOption) (*Country, error)
+	// ListCountries returns a page of countries ordered by name, without their
+	// provinces.
+	ListCountries(ctx context.Context, in *ListCountriesRequest, opts ...grpc.CallOption) (*ListCountriesResponse, error)
+	// UpdateCountry updates the figures of a country, its provinces are updated
+	// with UpdateProvince.
+	UpdateCountry(ctx context.Context, in *UpdateCountryRequest, opts ...grpc.CallOption) (*Country, error)
+	GetProvince(ctx context.Context, in *GetProvinceRequest, opts ...grpc.CallOption) (*Province, error)
+	ListProvinces(ctx context.Context, in *ListProvincesRequest, opts ...grpc.CallOption) (*ListProvincesResponse, error)
+	UpdateProvince(ctx context.Context, in *UpdateProvinceRequest, opts ...grpc.CallOption) (*Province, error)
+	GetDistrict(ctx context.Context, in *GetDistrictRequest, opts ...grpc.CallOption) (*District, error)
+	ListDistricts(ctx context.Context, in *ListDistrictsRequest, opts ...grpc.CallOption) (*ListDistrictsResponse, error)
+	UpdateDistrict(ctx context.Context, in *UpdateDistrictRequest, opts ...grpc.CallOption) (*District, error)
+}
+
+type covid19Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCovid19Client(cc grpc.ClientConnInterface) Covid19Client {
+	return &covid19Client{cc}
+}
+
+func (c *covid19Client) GetCountry(ctx context.Context, in *GetCountryRequest, opts ...grpc.CallOption) (*Country, error) {
+	out := new(Country)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/GetCountry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) ListCountries(ctx context.Context, in *ListCountriesRequest, opts ...grpc.CallOption) (*ListCountriesResponse, error) {
+	out := new(ListCountriesResponse)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/ListCountries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) UpdateCountry(ctx context.Context, in *UpdateCountryRequest, opts ...grpc.CallOption) (*Country, error) {
+	out := new(Country)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/UpdateCountry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) GetProvince(ctx context.Context, in *GetProvinceRequest, opts ...grpc.CallOption) (*Province, error) {
+	out := new(Province)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/GetProvince", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) ListProvinces(ctx context.Context, in *ListProvincesRequest, opts ...grpc.CallOption) (*ListProvincesResponse, error) {
+	out := new(ListProvincesResponse)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/ListProvinces", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) UpdateProvince(ctx context.Context, in *UpdateProvinceRequest, opts ...grpc.CallOption) (*Province, error) {
+	out := new(Province)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/UpdateProvince", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) GetDistrict(ctx context.Context, in *GetDistrictRequest, opts ...grpc.CallOption) (*District, error) {
+	out := new(District)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/GetDistrict", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) ListDistricts(ctx context.Context, in *ListDistrictsRequest, opts ...grpc.CallOption) (*ListDistrictsResponse, error) {
+	out := new(ListDistrictsResponse)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/ListDistricts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *covid19Client) UpdateDistrict(ctx context.Context, in *UpdateDistrictRequest, opts ...grpc.CallOption) (*District, error) {
+	out := new(District)
+	err := c.cc.Invoke(ctx, "/covid19.v1.Covid19/UpdateDistrict", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Covid19Server is the server API for Covid19 service.
+// All implementations must embed UnimplementedCovid19Server
+// for forward compatibility
+type Covid19Server interface {
+	GetCountry(context.Context, *GetCountryRequest) (*Country, error)
+	// ListCountries returns a page of countries ordered by name, without their
+	// provinces.
+	ListCountries(context.Context, *ListCountriesRequest) (*ListCountriesResponse, error)
+	// UpdateCountry updates the figures of a country, its provinces are updated
+	// with UpdateProvince.
+	UpdateCountry(context.Context, *UpdateCountryRequest) (*Country, error)
+	GetProvince(context.Context, *GetProvinceRequest) (*Province, error)
+	ListProvinces(context.Context, *ListProvincesRequest) (*ListProvincesResponse, error)
+	UpdateProvince(context.Context, *UpdateProvinceRequest) (*Province, error)
+	GetDistrict(context.Context, *GetDistrictRequest) (*District, error)
+	ListDistricts(context.Context, *ListDistrictsRequest) (*ListDistrictsResponse, error)
+	UpdateDistrict(context.Context, *UpdateDistrictRequest) (*District, error)
+	mustEmbedUnimplementedCovid19Server()
+}
+
+// UnimplementedCovid19Server must be embedded to have forward compatible implementations.
+type UnimplementedCovid19Server struct {
+}
+
+func (UnimplementedCovid19Server) GetCountry(context.Context, *GetCountryRequest) (*Country, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCountry not implemented")
+}
+func (UnimplementedCovid19Server) ListCountries(context.Context, *ListCountriesRequest) (*ListCountriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCountries not implemented")
+}
+func (UnimplementedCovid19Server) UpdateCountry(context.Context, *UpdateCountryRequest) (*Country, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCountry not implemented")
+}
+func (UnimplementedCovid19Server) GetProvince(context.Context, *GetProvinceRequest) (*Province, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProvince not implemented")
+}
+func (UnimplementedCovid19Server) ListProvinces(context.Context, *ListProvincesRequest) (*ListProvincesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProvinces not implemented")
+}
+func (UnimplementedCovid19Server) UpdateProvince(context.Context, *UpdateProvinceRequest) (*Province, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateProvince not implemented")
+}
+func (UnimplementedCovid19Server) GetDistrict(context.Context, *GetDistrictRequest) (*District, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDistrict not implemented")
+}
+func (UnimplementedCovid19Server) ListDistricts(context.Context, *ListDistrictsRequest) (*ListDistrictsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDistricts not implemented")
+}
+func (UnimplementedCovid19Server) UpdateDistrict(context.Context, *UpdateDistrictRequest) (*District, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateDistrict not implemented")
+}
+func (UnimplementedCovid19Server) mustEmbedUnimplementedCovid19Server() {}
+
+// UnsafeCovid19Server may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to Covid19Server will
+// result in compilation errors.
+type UnsafeCovid19Server interface {
+	mustEmbedUnimplementedCovid19Server()
+}
+
+func RegisterCovid19Server(s grpc.ServiceRegistrar, srv Covid19Server) {
+	s.RegisterService(&Covid19_ServiceDesc, srv)
+}
+
+func _Covid19_GetCountry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCountryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).GetCountry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/GetCountry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).GetCountry(ctx, req.(*GetCountryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_ListCountries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCountriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).ListCountries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/ListCountries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).ListCountries(ctx, req.(*ListCountriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_UpdateCountry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCountryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).UpdateCountry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/UpdateCountry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).UpdateCountry(ctx, req.(*UpdateCountryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_GetProvince_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProvinceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).GetProvince(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/GetProvince",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).GetProvince(ctx, req.(*GetProvinceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_ListProvinces_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProvincesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).ListProvinces(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/ListProvinces",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).ListProvinces(ctx, req.(*ListProvincesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_UpdateProvince_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateProvinceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).UpdateProvince(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/UpdateProvince",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).UpdateProvince(ctx, req.(*UpdateProvinceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_GetDistrict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDistrictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).GetDistrict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/GetDistrict",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).GetDistrict(ctx, req.(*GetDistrictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_ListDistricts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDistrictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).ListDistricts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/ListDistricts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).ListDistricts(ctx, req.(*ListDistrictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Covid19_UpdateDistrict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateDistrictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Covid19Server).UpdateDistrict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/covid19.v1.Covid19/UpdateDistrict",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Covid19Server).UpdateDistrict(ctx, req.(*UpdateDistrictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Covid19_ServiceDesc is the grpc.ServiceDesc for Covid19 service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Covid19_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "covid19.v1.Covid19",
+	HandlerType: (*Covid19Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCountry",
+			Handler:    _Covid19_GetCountry_Handler,
+		},
+		{
+			MethodName: "ListCountries",
+			Handler:    _Covid19_ListCountries_Handler,
+		},
+		{
+			MethodName: "UpdateCountry",
+			Handler:    _Covid19_UpdateCountry_Handler,
+		},
+		{
+			MethodName: "GetProvince",
+			Handler:    _Covid19_GetProvince_Handler,
+		},
+		{
+			MethodName: "ListProvinces",
+			Handler:    _Covid19_ListProvinces_Handler,
+		},
+		{
+			MethodName: "UpdateProvince",
+			Handler:    _Covid19_UpdateProvince_Handler,
+		},
+		{
+			MethodName: "GetDistrict",
+			Handler:    _Covid19_GetDistrict_Handler,
+		},
+		{
+			MethodName: "ListDistricts",
+			Handler:    _Covid19_ListDistricts_Handler,
+		},
+		{
+			MethodName: "UpdateDistrict",
+			Handler:    _Covid19_UpdateDistrict_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "proto/covid19.proto",
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// gauge is one sample of a Prometheus gauge.
+type gauge struct {
+	name   string
+	labels [][2]string
+	value  float64
+}
+
+// gaugeHelp documents the gauges, in the order they are exported.
+var gaugeHelp = []struct{ name, help string }{
+	{"covid19_country_figure", "Current figure of a country, by figure."},
+	{"covid19_country_last_update_age_seconds", "Seconds since the figures of a country were last updated."},
+	{"covid19_province_new_cases", "New cases of the last update of a province."},
+	{"covid19_province_last_update_age_seconds", "Seconds since the figures of a province were last updated."},
+}
+
+// escapeLabel escapes a label value of the Prometheus text format.
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// writeGauges writes gs in the Prometheus text exposition format, grouped by
+// the names of gaugeHelp.
+func writeGauges(gs []*gauge) []byte {
+	var b bytes.Buffer
+	for _, h := range gaugeHelp {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", h.name, h.help, h.name)
+		for _, g := range gs {
+			if g.name != h.name {
+				continue
+			}
+			b.WriteString(g.name)
+			if len(g.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range g.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, `%s="%s"`, l[0], escapeLabel(l[1]))
+				}
+				b.WriteByte('}')
+			}
+			fmt.Fprintf(&b, " %g\n", g.value)
+		}
+	}
+	return b.Bytes()
+}
+
+// handler
+type dataMetricsService struct {
+	cApp CountryAppInterface
+	pApp ProvinceInterface
+	hApp HistoryRepository
+}
+
+func NewDataMetricsService(cApp CountryAppInterface, pApp ProvinceInterface, hApp HistoryRepository) *dataMetricsService {
+	return &dataMetricsService{cApp: cApp, pApp: pApp, hApp: hApp}
+}
+
+// gauges samples the figures at now, as they were at the given time when
+// asOf is set.
+func (mA *dataMetricsService) gauges(ctx context.Context, now, at time.Time, asOf bool) ([]*gauge, error) {
+	var gs []*gauge
+	for page := uint64(1); ; page++ {
+		cs, err := mA.cApp.List(ctx, page, maxCountryLimit)
+		if err != nil {
+			return nil, err
+		}
+		more := len(cs) == maxCountryLimit
+		if asOf {
+			if cs, err = countriesAsOf(ctx, mA.hApp, cs, at); err != nil {
+				return nil, err
+			}
+		}
+		for _, c := range cs {
+			values := countryFigures(c).values()
+			for i, column := range figureColumns {
+				gs = append(gs, &gauge{"covid19_country_figure",
+					[][2]string{{"country_id", c.ID}, {"country", c.Name}, {"figure", column}}, float64(values[i])})
+			}
+			gs = append(gs, &gauge{"covid19_country_last_update_age_seconds",
+				[][2]string{{"country_id", c.ID}, {"country", c.Name}}, now.Sub(c.UpdatedAt).Seconds()})
+		}
+		if !more {
+			break
+		}
+	}
+
+	ps, err := mA.pApp.GetAll(ctx, &ProvinceFilter{Sort: "name", Asc: true})
+	if err != nil {
+		return nil, err
+	}
+	if asOf {
+		if ps, err = provincesAsOf(ctx, mA.hApp, ps, at); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range ps {
+		labels := [][2]string{{"province_id", p.ID}, {"province", p.Name}}
+		gs = append(gs,
+			&gauge{"covid19_province_new_cases", labels, float64(p.NewCase)},
+			&gauge{"covid19_province_last_update_age_seconds", labels, now.Sub(p.UpdatedAt).Seconds()})
+	}
+	return gs, nil
+}
+
+// Metrics exports the figures themselves as Prometheus gauges, for
+// dashboards and alerts on the data rather than on the traffic. Scrapers
+// under embargo are answered the figures of the day before, as the reads
+// are, rather than refused.
+func (mA *dataMetricsService) Metrics(c echo.Context) error {
+	at, asOf := embargoed(c)
+	gs, err := mA.gauges(c.Request().Context(), time.Now(), at, asOf)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.String(status, msg)
+	}
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", writeGauges(gs))
+}
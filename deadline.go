@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// long polls, given their longest wait on top of the request timeout
+var longPolls = map[string]bool{"/api/v1/country/:country_id/wait": true}
+
+// requestDeadline gives the context of every request a deadline, past which
+// its database calls are cancelled. Streams, which outlive any deadline, set
+// one for each of their calls instead.
+func requestDeadline(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if streamingRoutes[c.Path()] {
+				return next(c)
+			}
+			d := timeout
+			if longPolls[c.Path()] {
+				d += maxWaitTimeout
+			}
+			ctx, cancel := context.WithTimeout(c.Request().Context(), d)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
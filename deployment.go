@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/config"
+)
+
+// Deployment tells clients who runs the server and for which country, and
+// how to render its figures when they do not ask for a locale.
+type Deployment struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country the figures are
+	// about.
+	Country      string `json:"country"`
+	Operator     string `json:"operator"`
+	ContactEmail string `json:"contact_email"`
+	Locale       string `json:"locale"`
+	Timezone     string `json:"timezone"`
+}
+
+// handler
+type deploymentService struct {
+	deployment *Deployment
+}
+
+func NewDeploymentService(cfg config.Deployment) *deploymentService {
+	return &deploymentService{deployment: &Deployment{
+		Country:      cfg.Country,
+		Operator:     cfg.Operator,
+		ContactEmail: cfg.ContactEmail,
+		Locale:       cfg.Locale,
+		Timezone:     cfg.Timezone,
+	}}
+}
+
+func (dA *deploymentService) Meta(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]*Deployment{"deployment": dA.deployment})
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+// developer keys are developerKeyPrefix followed by 32 random bytes in hex,
+// told apart from the keys of teams by it
+const developerKeyPrefix = "cvd_dev_"
+
+const (
+	// how long a verification token sent by email can be used
+	developerTokenTTL = 24 * time.Hour
+	// how often the requests counted against developer keys are written
+	developerUsageFlush = time.Minute
+	// how long writing them may take, the guard rejecting statements
+	// without a deadline
+	developerUsageFlushTimeout = 30 * time.Second
+	defaultUsageDays           = 30
+	maxUsageDays               = 90
+)
+
+var (
+	errPortalOff    = errors.New("Error: The developer portal is not configured")
+	errInvalidToken = errors.New("Error: The verification token is invalid or expired")
+)
+
+// Developer registered through the portal for a key of their own, which
+// reads the API like anonymous clients do, within a rate limit of its own.
+// KeyPrefix identifies the key, empty until the email is verified.
+type Developer struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// DeveloperKey is only answered by the request issuing it.
+type DeveloperKey struct {
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+}
+
+type DeveloperUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+}
+
+// DeveloperUsageReport is the usage of a key over its last days, oldest
+// first, days without requests left out.
+type DeveloperUsageReport struct {
+	Developer *Developer        `json:"developer"`
+	RateLimit int               `json:"rate_limit_per_minute"`
+	Days      []*DeveloperUsage `json:"days"`
+}
+
+// DeveloperVerification is the body verifying the email of a developer.
+type DeveloperVerification struct {
+	Token string `json:"token"`
+}
+
+func (d *Developer) Prepare() {
+	d.Email = strings.ToLower(strings.TrimSpace(d.Email))
+	d.Name = html.EscapeString(strings.TrimSpace(d.Name))
+}
+
+func (d *Developer) BeforeSave() {
+	d.ID = uuid.NewV4().String()
+	d.CreatedAt = time.Now()
+}
+
+func (d *Developer) Validate() error {
+	// the email goes in the headers of the verification mail
+	if !strings.Contains(d.Email, "@") || strings.ContainsAny(d.Email, " \t\r\n<>,") || len(d.Email) > 254 {
+		return errors.New("developer: a valid email is required")
+	}
+	if d.Name == "" {
+		return errors.New("developer: name is required")
+	}
+	return nil
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newDeveloperKey generates a key, returning it with the hash it is stored
+// as.
+func newDeveloperKey() (*DeveloperKey, string, error) {
+	v, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := developerKeyPrefix + v
+	return &DeveloperKey{
+		Key:    key,
+		Prefix: key[:len(developerKeyPrefix)+8],
+	}, hashTeamKey(key), nil
+}
+
+// smtpMailer sends the verification mails of the developer portal.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// mailerFromEnv reads SMTP_ADDR, the host:port of the mail server, SMTP_FROM,
+// the address mails are sent from, and SMTP_USERNAME and SMTP_PASSWORD when
+// the server wants them. It returns nil when no server is set, the developer
+// portal being off.
+func mailerFromEnv() (*smtpMailer, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("mail: invalid SMTP_ADDR %q", addr)
+	}
+	from := os.Getenv("SMTP_FROM")
+	if !strings.Contains(from, "@") {
+		return nil, errors.New("mail: SMTP_FROM must be an email address")
+	}
+	m := &smtpMailer{addr: addr, from: from}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+// Send sends a plain text mail.
+func (m *smtpMailer) Send(to, subject, body string) error {
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.Replace(body, "\n", "\r\n", -1)
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("mail: send to %s: %w", to, err)
+	}
+	return nil
+}
+
+// Repository
+type DeveloperRepository interface {
+	// Register saves a developer with the hash of their verification token,
+	// registering an email again replacing its name and token.
+	Register(ctx context.Context, d *Developer, tokenHash string, expiresAt time.Time) error
+	// Verify uses up a verification token not expired at now, giving the
+	// developer it was sent to the key, in place of any they had.
+	Verify(ctx context.Context, tokenHash string, k *DeveloperKey, keyHash string, now time.Time) (*Developer, error)
+	GetByKey(ctx context.Context, hash string) (*Developer, error)
+	// RotateKey replaces the key of a developer.
+	RotateKey(ctx context.Context, id string, k *DeveloperKey, keyHash string) error
+	// AddUsage adds requests made by a developer on day.
+	AddUsage(ctx context.Context, id string, day string, requests int) error
+	Usage(ctx context.Context, id string, from, to time.Time) ([]*DeveloperUsage, error)
+}
+
+type developerRepo struct {
+	db *sql.DB
+}
+
+var _ DeveloperRepository = &developerRepo{}
+
+func NewDeveloperRepo(db *sql.DB) *developerRepo {
+	return &developerRepo{db}
+}
+
+func (dr *developerRepo) Register(ctx context.Context, d *Developer, tokenHash string, expiresAt time.Time) error {
+	if _, err := squirrel.Insert("developers").
+		Columns("id", "email", "name", "token_hash", "token_expires_at", "created_at").
+		Values(d.ID, d.Email, d.Name, tokenHash, expiresAt, d.CreatedAt).
+		Suffix("ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name, token_hash = EXCLUDED.token_hash, token_expires_at = EXCLUDED.token_expires_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx); err != nil {
+		return wrapErr("developer", d.ID, "insert developer", err)
+	}
+	return nil
+}
+
+func (dr *developerRepo) Verify(ctx context.Context, tokenHash string, k *DeveloperKey, keyHash string, now time.Time) (*Developer, error) {
+	var d Developer
+	err := squirrel.Update("developers").
+		Set("key_prefix", k.Prefix).
+		Set("key_hash", keyHash).
+		Set("verified_at", squirrel.Expr("COALESCE(verified_at, ?)", now)).
+		Set("token_hash", nil).
+		Set("token_expires_at", nil).
+		Where(squirrel.Eq{"token_hash": tokenHash}).
+		Where(squirrel.Gt{"token_expires_at": now}).
+		Suffix("RETURNING id, email, name, key_prefix, verified_at, created_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).QueryRowContext(ctx).
+		Scan(&d.ID, &d.Email, &d.Name, &d.KeyPrefix, &d.VerifiedAt, &d.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("developer", "", "verify developer", err)
+	}
+	return &d, nil
+}
+
+func (dr *developerRepo) GetByKey(ctx context.Context, hash string) (*Developer, error) {
+	var d Developer
+	err := squirrel.Select("id", "email", "name", "key_prefix", "verified_at", "created_at").
+		From("developers").
+		Where(squirrel.Eq{"key_hash": hash}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ScanContext(ctx, &d.ID, &d.Email, &d.Name, &d.KeyPrefix, &d.VerifiedAt, &d.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("developer", "", "select developer by key", err)
+	}
+	return &d, nil
+}
+
+func (dr *developerRepo) RotateKey(ctx context.Context, id string, k *DeveloperKey, keyHash string) error {
+	res, err := squirrel.Update("developers").
+		Set("key_prefix", k.Prefix).
+		Set("key_hash", keyHash).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("developer", id, "rotate developer key", err)
+	}
+	return wrapErr("developer", id, "rotate developer key", affectedOne(res))
+}
+
+func (dr *developerRepo) AddUsage(ctx context.Context, id string, day string, requests int) error {
+	if _, err := squirrel.Insert("developer_usage").
+		Columns("developer_id", "day", "requests").
+		Values(id, day, requests).
+		Suffix("ON CONFLICT (developer_id, day) DO UPDATE SET requests = developer_usage.requests + EXCLUDED.requests").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx); err != nil {
+		return wrapErr("developer", id, "add developer usage", err)
+	}
+	return nil
+}
+
+func (dr *developerRepo) Usage(ctx context.Context, id string, from, to time.Time) ([]*DeveloperUsage, error) {
+	rows, err := squirrel.Select("day", "requests").
+		From("developer_usage").
+		Where(squirrel.Eq{"developer_id": id}).
+		Where(squirrel.GtOrEq{"day": from.Format(dateLayout)}).
+		Where(squirrel.LtOrEq{"day": to.Format(dateLayout)}).
+		OrderBy("day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("developer", id, "select developer usage", err)
+	}
+	defer rows.Close()
+
+	var days = make([]*DeveloperUsage, 0)
+	for rows.Next() {
+		var u DeveloperUsage
+		var day time.Time
+		if err := rows.Scan(&day, &u.Requests); err != nil {
+			return nil, wrapErr("developer", id, "scan developer usage", err)
+		}
+		u.Day = day.Format(dateLayout)
+		days = append(days, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("developer", id, "select developer usage", err)
+	}
+	return days, nil
+}
+
+// developerDay is a developer on a day formatted with dateLayout.
+type developerDay struct {
+	id  string
+	day string
+}
+
+// developerUsage counts the requests made with developer keys in memory,
+// writing them every interval, developerUsageFlush, rather than on every
+// read.
+type developerUsage struct {
+	dApp     DeveloperRepository
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[developerDay]int
+}
+
+func newDeveloperUsage(dApp DeveloperRepository) *developerUsage {
+	return &developerUsage{dApp: dApp, interval: developerUsageFlush, counts: make(map[developerDay]int)}
+}
+
+// Count counts a request of the developer id made at now.
+func (du *developerUsage) Count(id string, now time.Time) {
+	du.mu.Lock()
+	du.counts[developerDay{id, now.UTC().Format(dateLayout)}]++
+	du.mu.Unlock()
+}
+
+// pending returns the requests of the developer id not written yet, by day.
+func (du *developerUsage) pending(id string) map[string]int {
+	du.mu.Lock()
+	defer du.mu.Unlock()
+	days := make(map[string]int)
+	for k, n := range du.counts {
+		if k.id == id {
+			days[k.day] += n
+		}
+	}
+	return days
+}
+
+// flush writes the counted requests within developerUsageFlushTimeout,
+// keeping those it failed to write for the next time.
+func (du *developerUsage) flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, developerUsageFlushTimeout)
+	defer cancel()
+
+	du.mu.Lock()
+	counts := du.counts
+	du.counts = make(map[developerDay]int)
+	du.mu.Unlock()
+
+	for k, n := range counts {
+		if err := du.dApp.AddUsage(ctx, k.id, k.day, n); err != nil {
+			logger.Error().Err(err).Str("developer_id", k.id).Msg("developers: failed to write usage")
+			du.mu.Lock()
+			du.counts[k] += n
+			du.mu.Unlock()
+		}
+	}
+}
+
+// Run writes the counted requests every interval until ctx is done. The
+// requests counted after its last write are written by Flush.
+func (du *developerUsage) Run(ctx context.Context) {
+	ticker := time.NewTicker(du.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			du.flush(ctx)
+		}
+	}
+}
+
+// Flush writes the counted requests once, on shutdown once the requests in
+// flight are done, within ctx.
+func (du *developerUsage) Flush(ctx context.Context) {
+	du.flush(ctx)
+}
+
+// authenticateDeveloper resolves a developer key to an identity without
+// claims, reading as anonymous clients do, counting the request.
+func (aA *authService) authenticateDeveloper(c echo.Context, key string) (*identity, error) {
+	return aA.developerIdentity(c.Request().Context(), key)
+}
+
+func (aA *authService) developerIdentity(ctx context.Context, key string) (*identity, error) {
+	d, err := aA.developers.GetByKey(ctx, hashTeamKey(key))
+	if errors.Is(err, errNotFound) {
+		return nil, errUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	aA.usage.Count(d.ID, time.Now())
+	return &identity{developer: d}, nil
+}
+
+// handler
+type developerService struct {
+	dApp   DeveloperRepository
+	usage  *developerUsage
+	mailer *smtpMailer
+	// rateLimit is the requests a minute allowed per developer key
+	rateLimit int
+}
+
+func NewDeveloperService(dApp DeveloperRepository, usage *developerUsage, mailer *smtpMailer, rateLimit int) *developerService {
+	return &developerService{dApp: dApp, usage: usage, mailer: mailer, rateLimit: rateLimit}
+}
+
+func (dA *developerService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (dA *developerService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+// developerOfKey returns the developer of the key the request is made with.
+func (dA *developerService) developerOfKey(c echo.Context) (*Developer, error) {
+	key := c.Request().Header.Get(headerAPIKey)
+	if !strings.HasPrefix(key, developerKeyPrefix) {
+		return nil, errUnauthenticated
+	}
+	d, err := dA.dApp.GetByKey(c.Request().Context(), hashTeamKey(key))
+	if errors.Is(err, errNotFound) {
+		return nil, errUnauthenticated
+	}
+	return d, err
+}
+
+// Register mails a verification token to the email of a developer, answered
+// the same whether it was registered before or not. Registering again is
+// also how a lost key is replaced.
+func (dA *developerService) Register(c echo.Context) error {
+	if dA.mailer == nil {
+		return c.JSON(http.StatusNotFound, dA.errMessage(errPortalOff.Error()))
+	}
+	var d Developer
+	if err := c.Bind(&d); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, dA.errMessage("request: unable to parse request payload"))
+	}
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, dA.errMessage(err.Error()))
+	}
+	d.BeforeSave()
+
+	token, err := randomHex(16)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, dA.errMessage("Internal server error"))
+	}
+	if err := dA.dApp.Register(c.Request().Context(), &d, hashTeamKey(token), d.CreatedAt.Add(developerTokenTTL)); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not register developer")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	body := fmt.Sprintf("Your verification token for the COVID-19 API is:\n\n%s\n\n"+
+		"Send it as {\"token\": \"%s\"} to POST /api/v1/developers/verify within %d hours to receive your API key.\n\n"+
+		"If you did not register, ignore this mail.\n", token, token, int(developerTokenTTL.Hours()))
+	if err := dA.mailer.Send(d.Email, "Your COVID-19 API verification token", body); err != nil {
+		logger.Error().Err(err).Msg("developers: failed to send verification")
+		return c.JSON(http.StatusBadGateway, dA.errMessage("Internal server error, could not send verification"))
+	}
+	return c.JSON(http.StatusAccepted, dA.successMsg("A verification token was sent to "+d.Email))
+}
+
+// Verify issues the key of the developer a verification token was sent to,
+// answered this once only.
+func (dA *developerService) Verify(c echo.Context) error {
+	if dA.mailer == nil {
+		return c.JSON(http.StatusNotFound, dA.errMessage(errPortalOff.Error()))
+	}
+	var v DeveloperVerification
+	if err := c.Bind(&v); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, dA.errMessage("request: unable to parse request payload"))
+	}
+	v.Token = strings.TrimSpace(v.Token)
+	if v.Token == "" {
+		return c.JSON(http.StatusBadRequest, dA.errMessage("developer: token is required"))
+	}
+	k, hash, err := newDeveloperKey()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, dA.errMessage("Internal server error"))
+	}
+	_, err = dA.dApp.Verify(c.Request().Context(), hashTeamKey(v.Token), k, hash, time.Now())
+	if errors.Is(err, errNotFound) {
+		return c.JSON(http.StatusBadRequest, dA.errMessage(errInvalidToken.Error()))
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not verify developer")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*DeveloperKey{"developer_key": k})
+}
+
+// Usage answers the requests made with the key of the request over its last
+// ?days=, 30 unless set.
+func (dA *developerService) Usage(c echo.Context) error {
+	days := defaultUsageDays
+	if v := c.QueryParam("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsageDays {
+			return c.JSON(http.StatusBadRequest, dA.errMessage(fmt.Sprintf("request: days must be between 1 and %d", maxUsageDays)))
+		}
+		days = n
+	}
+	d, err := dA.developerOfKey(c)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, 1-days)
+	usage, err := dA.dApp.Usage(c.Request().Context(), d.ID, from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	// the requests counted since the last write
+	for day, n := range dA.usage.pending(d.ID) {
+		if day < from.Format(dateLayout) {
+			continue
+		}
+		found := false
+		for _, u := range usage {
+			if u.Day == day {
+				u.Requests += n
+				found = true
+			}
+		}
+		if !found {
+			usage = append(usage, &DeveloperUsage{Day: day, Requests: n})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Day < usage[j].Day })
+	return c.JSON(http.StatusOK, map[string]*DeveloperUsageReport{"usage": {
+		Developer: d,
+		RateLimit: dA.rateLimit,
+		Days:      usage,
+	}})
+}
+
+// RotateKey replaces the key of the request by a new one, answered this once
+// only, the old one no longer working.
+func (dA *developerService) RotateKey(c echo.Context) error {
+	d, err := dA.developerOfKey(c)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	k, hash, err := newDeveloperKey()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, dA.errMessage("Internal server error"))
+	}
+	if err := dA.dApp.RotateKey(c.Request().Context(), d.ID, k, hash); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not rotate key")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*DeveloperKey{"developer_key": k})
+}
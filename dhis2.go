@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+// the national HMIS, which figures are pushed to, and pulled from where it
+// is the source of truth
+const (
+	sourceDHIS2     = "dhis2"
+	sourceDHIS2Pull = "dhis2-pull"
+)
+
+// DHIS2 daily periods are formatted as yyyyMMdd
+const dhis2PeriodLayout = "20060102"
+
+// figureFields returns the figures given, by the codes of fhirFigures.
+func figureFields(total, newCase, treated, decoveringCase, testCase, dead, negativeCase *int64) map[string]*int64 {
+	return map[string]*int64{
+		"total":           total,
+		"new_case":        newCase,
+		"treated":         treated,
+		"decovering_case": decoveringCase,
+		"test_case":       testCase,
+		"dead":            dead,
+		"negative_case":   negativeCase,
+	}
+}
+
+func pointFields(p *HistoryPoint) map[string]*int64 {
+	return figureFields(&p.Total, &p.NewCase, &p.Treated, &p.DecoveringCase, &p.TestCase, &p.Dead, &p.NegativeTest)
+}
+
+// parseDHIS2Mapping reads "key=DHIS2 uid" pairs separated by commas from the
+// variable env.
+func parseDHIS2Mapping(env, v string) (map[string]string, error) {
+	m := make(map[string]string)
+	if v == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("dhis2: invalid %s mapping %q", env, pair)
+		}
+		m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return m, nil
+}
+
+// reverseMapping maps the values of m back to their keys.
+func reverseMapping(m map[string]string) map[string]string {
+	r := make(map[string]string, len(m))
+	for k, v := range m {
+		r[v] = k
+	}
+	return r
+}
+
+type dhis2DataValue struct {
+	DataElement string `json:"dataElement"`
+	Period      string `json:"period"`
+	OrgUnit     string `json:"orgUnit"`
+	Value       string `json:"value"`
+}
+
+// dhis2Syncer exchanges the daily figures of provinces and districts with
+// the data elements of a DHIS2 instance, each province and district being
+// mapped to an organisation unit.
+type dhis2Syncer struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	// by figure code, see fhirFigures
+	dataElements map[string]string
+	// by province id and by district id
+	provinceUnits map[string]string
+	districtUnits map[string]string
+	// the data set values are pulled from, pulls being off when empty
+	dataSet string
+
+	history       HistoryRepository
+	provinces     ProvinceRepository
+	districts     DistrictRepository
+	runs          SyncRunRepository
+	notifications NotificationRepository
+	changes       *changeHub
+
+	mu      sync.Mutex
+	running bool
+}
+
+// dhis2SyncerFromEnv reads DHIS2_URL, DHIS2_USERNAME and DHIS2_PASSWORD,
+// along with the mappings of DHIS2_DATA_ELEMENTS, from figure to data
+// element, and of DHIS2_PROVINCE_ORG_UNITS and DHIS2_DISTRICT_ORG_UNITS, from
+// province and district id to organisation unit. DHIS2_DATA_SET is the data
+// set values are pulled from. It returns nil when DHIS2_URL is not set.
+func dhis2SyncerFromEnv(client *http.Client, r *Repository, changes *changeHub) (*dhis2Syncer, error) {
+	baseURL := os.Getenv("DHIS2_URL")
+	if baseURL == "" {
+		return nil, nil
+	}
+	ds := &dhis2Syncer{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		username:      os.Getenv("DHIS2_USERNAME"),
+		password:      os.Getenv("DHIS2_PASSWORD"),
+		dataSet:       os.Getenv("DHIS2_DATA_SET"),
+		client:        client,
+		history:       r.HistoryRepo,
+		provinces:     r.ProvinceRepo,
+		districts:     r.DistrictRepo,
+		runs:          r.SyncRunRepo,
+		notifications: r.NotificationRepo,
+		changes:       changes,
+	}
+	if ds.username == "" || ds.password == "" {
+		return nil, errors.New("dhis2: DHIS2_USERNAME and DHIS2_PASSWORD are required")
+	}
+	var err error
+	if ds.dataElements, err = parseDHIS2Mapping("DHIS2_DATA_ELEMENTS", os.Getenv("DHIS2_DATA_ELEMENTS")); err != nil {
+		return nil, err
+	}
+	if len(ds.dataElements) == 0 {
+		return nil, errors.New("dhis2: DHIS2_DATA_ELEMENTS maps no figure")
+	}
+	for code := range ds.dataElements {
+		if _, ok := pointFields(&HistoryPoint{})[code]; !ok {
+			return nil, fmt.Errorf("dhis2: DHIS2_DATA_ELEMENTS: unknown figure %q", code)
+		}
+	}
+	if ds.provinceUnits, err = parseDHIS2Mapping("DHIS2_PROVINCE_ORG_UNITS", os.Getenv("DHIS2_PROVINCE_ORG_UNITS")); err != nil {
+		return nil, err
+	}
+	if ds.districtUnits, err = parseDHIS2Mapping("DHIS2_DISTRICT_ORG_UNITS", os.Getenv("DHIS2_DISTRICT_ORG_UNITS")); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Run runs sync, Push or Pull, for the day before every interval until ctx
+// is done.
+func (ds *dhis2Syncer) Run(ctx context.Context, interval time.Duration, sync func(context.Context, time.Time) (*SyncRun, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		syncCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+		if _, err := sync(syncCtx, yesterday()); err != nil && !errors.Is(err, errSyncRunning) {
+			logger.Error().Err(err).Msg("dhis2: sync failed")
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// yesterday is the last complete day, in UTC.
+func yesterday() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+}
+
+// Push pushes the figures of day and records the run.
+func (ds *dhis2Syncer) Push(ctx context.Context, day time.Time) (*SyncRun, error) {
+	return ds.record(ctx, sourceDHIS2, "push", day, ds.push)
+}
+
+// Pull updates the figures of day from DHIS2 and records the run.
+func (ds *dhis2Syncer) Pull(ctx context.Context, day time.Time) (*SyncRun, error) {
+	return ds.record(ctx, sourceDHIS2Pull, "pull", day, ds.pull)
+}
+
+// record runs one sync of day and records it, failed runs being reported
+// to the notification center. Pushes and pulls do not run at once.
+func (ds *dhis2Syncer) record(ctx context.Context, source, what string, day time.Time,
+	sync func(context.Context, time.Time, *SyncRun) error) (*SyncRun, error) {
+	ds.mu.Lock()
+	if ds.running {
+		ds.mu.Unlock()
+		return nil, errSyncRunning
+	}
+	ds.running = true
+	ds.mu.Unlock()
+	defer func() {
+		ds.mu.Lock()
+		ds.running = false
+		ds.mu.Unlock()
+	}()
+
+	d := day.Format(dateLayout)
+	run := &SyncRun{ID: uuid.NewV4().String(), Source: source, ReportDate: &d, StartedAt: time.Now(),
+		Unmatched: make([]string, 0), Conflicts: make([]string, 0)}
+	err := sync(ctx, day, run)
+	run.FinishedAt = time.Now()
+	run.Status = SyncSucceeded
+
+	// recorded even when ctx ran out
+	recordCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err != nil {
+		run.Status = SyncFailed
+		run.Error = err.Error()
+		n := NewNotification(NotificationImportFailed, run.ID, "DHIS2 %s of %s failed: %s", what, d, err)
+		if nErr := ds.notifications.Save(recordCtx, n); nErr != nil {
+			logger.Error().Err(nErr).Str("sync_run_id", run.ID).Msg("dhis2: failed to notify")
+		}
+	}
+	if saveErr := ds.runs.Save(recordCtx, run); saveErr != nil {
+		return run, saveErr
+	}
+	return run, err
+}
+
+// push sends the figures of the mapped provinces and districts at the end of
+// day. Those without figures by then are listed as unmatched. Figures of a
+// day without changes are those of the day before, with no new cases.
+func (ds *dhis2Syncer) push(ctx context.Context, day time.Time, run *SyncRun) error {
+	end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	period := day.Format(dhis2PeriodLayout)
+	var values []dhis2DataValue
+	for _, kind := range []string{"province", "district"} {
+		units := ds.provinceUnits
+		if kind == "district" {
+			units = ds.districtUnits
+		}
+		if len(units) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(units))
+		for id := range units {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		points, err := ds.history.AsOf(ctx, kind, ids, end)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			p, ok := points[id]
+			if !ok {
+				run.Unmatched = append(run.Unmatched, kind+":"+id)
+				continue
+			}
+			if p.Day != day.Format(dateLayout) {
+				p.NewCase = 0
+			}
+			fields := pointFields(p)
+			for code, element := range ds.dataElements {
+				values = append(values, dhis2DataValue{DataElement: element, Period: period, OrgUnit: units[id], Value: fmt.Sprint(*fields[code])})
+			}
+			if kind == "province" {
+				run.ProvincesUpdated++
+			} else {
+				run.DistrictsUpdated++
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return ds.send(ctx, values)
+}
+
+// send posts values as a data value set, DHIS2 answering an import summary
+// whose status is ERROR when they were rejected.
+func (ds *dhis2Syncer) send(ctx context.Context, values []dhis2DataValue) error {
+	body, err := json.Marshal(map[string][]dhis2DataValue{"dataValues": values})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ds.baseURL+"/api/dataValueSets", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	data, err := ds.do(req)
+	if err != nil {
+		return err
+	}
+	var summary struct {
+		Status      string `json:"status"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &summary); err == nil && summary.Status == "ERROR" {
+		return fmt.Errorf("dhis2: push rejected: %s", summary.Description)
+	}
+	return nil
+}
+
+// do sends req, returning the body of a successful response.
+func (ds *dhis2Syncer) do(req *http.Request) ([]byte, error) {
+	req.SetBasicAuth(ds.username, ds.password)
+	req.Header.Set("Accept", "application/json")
+	res, err := ds.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dhis2: %w", err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("dhis2: %w", err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("dhis2: %s %s answered %s: %.200s", req.Method, req.URL.Path, res.Status, data)
+	}
+	return data, nil
+}
+
+// fetch reads the values of the data set for day of the mapped organisation
+// units.
+func (ds *dhis2Syncer) fetch(ctx context.Context, day time.Time) ([]dhis2DataValue, error) {
+	q := url.Values{"dataSet": {ds.dataSet}, "period": {day.Format(dhis2PeriodLayout)}}
+	for _, units := range []map[string]string{ds.provinceUnits, ds.districtUnits} {
+		for _, unit := range units {
+			q.Add("orgUnit", unit)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ds.baseURL+"/api/dataValueSets?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ds.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		DataValues []dhis2DataValue `json:"dataValues"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("dhis2: unable to parse data values: %w", err)
+	}
+	return set.DataValues, nil
+}
+
+// pull updates the mapped provinces and districts with the values of day.
+// Organisation units that are not mapped are listed as unmatched. Records
+// changed here since the last pull whose values differ are left as they are
+// and reported as conflicts, to be settled by hand.
+func (ds *dhis2Syncer) pull(ctx context.Context, day time.Time, run *SyncRun) error {
+	if ds.dataSet == "" {
+		return errDHIS2PullOff
+	}
+	var since time.Time
+	last, err := ds.runs.GetLatest(ctx, sourceDHIS2Pull)
+	switch {
+	case err == nil:
+		since = last.FinishedAt
+	case !errors.Is(err, errNotFound):
+		return err
+	}
+	values, err := ds.fetch(ctx, day)
+	if err != nil {
+		return err
+	}
+
+	codes := reverseMapping(ds.dataElements)
+	byUnit := make(map[string]map[string]int64)
+	for _, v := range values {
+		code, ok := codes[v.DataElement]
+		if !ok {
+			// another element of the data set
+			continue
+		}
+		n, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			run.Conflicts = append(run.Conflicts, fmt.Sprintf("%s %s: %q is not a count", v.OrgUnit, code, v.Value))
+			continue
+		}
+		if byUnit[v.OrgUnit] == nil {
+			byUnit[v.OrgUnit] = make(map[string]int64)
+		}
+		byUnit[v.OrgUnit][code] = n
+	}
+	units := make([]string, 0, len(byUnit))
+	for unit := range byUnit {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	provinceOf, districtOf := reverseMapping(ds.provinceUnits), reverseMapping(ds.districtUnits)
+	for _, unit := range units {
+		switch {
+		case provinceOf[unit] != "":
+			if err := ds.pullProvince(ctx, provinceOf[unit], byUnit[unit], since, run); err != nil {
+				return err
+			}
+		case districtOf[unit] != "":
+			if err := ds.pullDistrict(ctx, districtOf[unit], byUnit[unit], since, run); err != nil {
+				return err
+			}
+		default:
+			run.Unmatched = append(run.Unmatched, unit)
+		}
+	}
+	sort.Strings(run.Conflicts)
+	return nil
+}
+
+var errDHIS2PullOff = errors.New("Error: DHIS2_DATA_SET is not configured")
+
+// applyFigures sets figures on fields, unless the record they belong to,
+// updated at updatedAt, changed since the last pull and some of them
+// differ, which is returned as conflicts. since is zero on the first pull.
+func applyFigures(subject string, fields map[string]*int64, figures map[string]int64, updatedAt, since time.Time) []string {
+	var conflicts []string
+	if !since.IsZero() && updatedAt.After(since) {
+		for code, v := range figures {
+			if *fields[code] != v {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s: %d here, %d in DHIS2", subject, code, *fields[code], v))
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts
+	}
+	for code, v := range figures {
+		*fields[code] = v
+	}
+	return nil
+}
+
+func (ds *dhis2Syncer) pullProvince(ctx context.Context, id string, figures map[string]int64, since time.Time, run *SyncRun) error {
+	current, err := ds.provinces.GetByID(forWrite(ctx), id)
+	if errors.Is(err, errNotFound) {
+		run.Unmatched = append(run.Unmatched, "province:"+id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p := *current
+	conflicts := applyFigures("province:"+id,
+		figureFields(&p.Total, &p.NewCase, &p.Treated, &p.DecoveringCase, &p.TestCase, &p.Dead, &p.NegativeTest),
+		figures, current.UpdatedAt, since)
+	if len(conflicts) > 0 {
+		run.Conflicts = append(run.Conflicts, conflicts...)
+		return nil
+	}
+	if current.Equal(&p) {
+		return nil
+	}
+	p.UpdatedAt = time.Now()
+	if err := ds.provinces.Update(ctx, &p); err != nil {
+		return err
+	}
+	run.touched("province", p.ID, "", provinceFigures(current), p.UpdatedAt)
+	ds.changes.Publish(provinceKey(p.ID))
+	run.ProvincesUpdated++
+	return nil
+}
+
+func (ds *dhis2Syncer) pullDistrict(ctx context.Context, id string, figures map[string]int64, since time.Time, run *SyncRun) error {
+	current, err := ds.districts.GetByID(forWrite(ctx), id)
+	if errors.Is(err, errNotFound) {
+		run.Unmatched = append(run.Unmatched, "district:"+id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	d := *current
+	conflicts := applyFigures("district:"+id,
+		figureFields(&d.Total, &d.NewCase, &d.Treated, &d.DecoveringCase, &d.TestCase, &d.Dead, &d.NegativeTest),
+		figures, current.UpdatedAt, since)
+	if len(conflicts) > 0 {
+		run.Conflicts = append(run.Conflicts, conflicts...)
+		return nil
+	}
+	if current.Equal(&d) {
+		return nil
+	}
+	d.UpdatedAt = time.Now()
+	if err := ds.districts.Update(ctx, &d); err != nil {
+		return err
+	}
+	run.touched("district", d.ID, d.ProvinceID, districtFigures(current), d.UpdatedAt)
+	ds.changes.Publish(districtKey(d.ID), provinceKey(d.ProvinceID))
+	run.DistrictsUpdated++
+	return nil
+}
+
+// dhis2Day reads ?day=, the day before when not given.
+func dhis2Day(c echo.Context) (time.Time, error) {
+	v := c.QueryParam("day")
+	if v == "" {
+		return yesterday(), nil
+	}
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return t, errors.New("request: day must be formatted as YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+// triggerDHIS2 runs sync for ?day= in the background, to be followed through
+// the job.
+func (sA *syncService) triggerDHIS2(c echo.Context, sync func(context.Context, time.Time) (*SyncRun, error)) error {
+	day, err := dhis2Day(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, sA.errMessage(err.Error()))
+	}
+	job := sA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+		run, err := sync(ctx, day)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]*SyncRun{"sync_run": run}, nil
+	})
+	return acceptJob(c, job)
+}
+
+// TriggerDHIS2 pushes the figures of ?day=, the day before when not given.
+func (sA *syncService) TriggerDHIS2(c echo.Context) error {
+	if sA.dhis2 == nil {
+		return c.JSON(http.StatusNotFound, sA.errMessage("Error: DHIS2 is not configured"))
+	}
+	return sA.triggerDHIS2(c, sA.dhis2.Push)
+}
+
+// TriggerDHIS2Pull pulls the values of ?day=, the day before when not given.
+func (sA *syncService) TriggerDHIS2Pull(c echo.Context) error {
+	if sA.dhis2 == nil || sA.dhis2.dataSet == "" {
+		return c.JSON(http.StatusNotFound, sA.errMessage("Error: DHIS2 pulls are not configured"))
+	}
+	return sA.triggerDHIS2(c, sA.dhis2.Pull)
+}
+
+// DHIS2Status returns a handler serving the last run from source.
+func (sA *syncService) DHIS2Status(source string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		run, err := sA.runs.GetLatest(c.Request().Context(), source)
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, sA.errMessage(msg))
+		}
+		return c.JSON(http.StatusOK, map[string]*SyncRun{"sync_run": run})
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// data model
+type District struct {
+	ID             string     `json:"id"`
+	ProvinceID     string     `json:"province_id"`
+	Name           string     `json:"name"`
+	Total          int64      `json:"total"`
+	NewCase        int64      `json:"new_case"`
+	Treated        int64      `json:"treaded"`
+	DecoveringCase int64      `json:"decovering_case"`
+	TestCase       int64      `json:"test_case"`
+	Dead           int64      `json:"dead"`
+	NegativeTest   int64      `json:"negative_case"`
+	Latitude       *float64   `json:"latitude"`
+	Longitude      *float64   `json:"longitude"`
+	Attributes     Attributes `json:"attributes"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type Districts []*District
+
+func (d *District) Prepare() {
+	d.Name = html.EscapeString(strings.TrimSpace(d.Name))
+	d.ProvinceID = strings.TrimSpace(d.ProvinceID)
+}
+
+func (d *District) BeforeSave() {
+	d.ID = uuid.NewV4().String()
+}
+
+func (d *District) Validate() error {
+	if d.Name == "" {
+		return errors.New("district: name is required")
+	}
+	if d.ProvinceID == "" {
+		return errors.New("district: province_id is required")
+	}
+	return checkCoordinates("district", d.Latitude, d.Longitude)
+}
+
+func (d *District) Equal(o *District) bool {
+	return d.ProvinceID == o.ProvinceID &&
+		sameCoordinate(d.Latitude, o.Latitude) &&
+		sameCoordinate(d.Longitude, o.Longitude) &&
+		d.Name == o.Name &&
+		d.Total == o.Total &&
+		d.NewCase == o.NewCase &&
+		d.Treated == o.Treated &&
+		d.DecoveringCase == o.DecoveringCase &&
+		d.TestCase == o.TestCase &&
+		d.Dead == o.Dead &&
+		d.NegativeTest == o.NegativeTest &&
+		d.Attributes.Equal(o.Attributes)
+}
+
+// Application
+type districtApp struct {
+	dApp DistrictRepository
+}
+
+type DistrictInterface interface {
+	Save(ctx context.Context, d *District) error
+	Update(ctx context.Context, d *District) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*District, error)
+	GetAllByProvince(ctx context.Context, provinceID string) (Districts, error)
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+}
+
+var _ DistrictInterface = &districtApp{}
+
+func (da *districtApp) Save(ctx context.Context, d *District) error {
+	return da.dApp.Save(ctx, d)
+}
+func (da *districtApp) Update(ctx context.Context, d *District) error {
+	return da.dApp.Update(ctx, d)
+}
+func (da *districtApp) Delete(ctx context.Context, id string) error {
+	return da.dApp.Delete(ctx, id)
+}
+func (da *districtApp) GetByID(ctx context.Context, id string) (*District, error) {
+	return da.dApp.GetByID(ctx, id)
+}
+func (da *districtApp) GetAllByProvince(ctx context.Context, provinceID string) (Districts, error) {
+	return da.dApp.GetAllByProvince(ctx, provinceID)
+}
+func (da *districtApp) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return da.dApp.PatchAttributes(ctx, id, patch, updatedAt)
+}
+
+// Repository
+type DistrictRepository interface {
+	Save(ctx context.Context, d *District) error
+	Update(ctx context.Context, d *District) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*District, error)
+	GetAllByProvince(ctx context.Context, provinceID string) (Districts, error)
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+}
+
+type districtRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ DistrictRepository = &districtRepo{}
+
+func NewDistrictRepo(db *sql.DB, dialect migrations.Dialect) *districtRepo {
+	return &districtRepo{db: db, dialect: dialect}
+}
+
+func (dr *districtRepo) Save(ctx context.Context, d *District) error {
+	if _, err := squirrel.Insert("districts").
+		Columns("id",
+			"name",
+			"total",
+			"new_case",
+			"treated",
+			"decovering_case",
+			"test_case",
+			"dead",
+			"negative_case",
+			"province_id",
+			"latitude",
+			"longitude",
+			"attributes",
+			"updated_at").
+		Values(&d.ID,
+			&d.Name,
+			&d.Total,
+			&d.NewCase,
+			&d.Treated,
+			&d.DecoveringCase,
+			&d.TestCase,
+			&d.Dead,
+			&d.NegativeTest,
+			&d.ProvinceID,
+			d.Latitude,
+			d.Longitude,
+			&d.Attributes,
+			&d.UpdatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx); err != nil {
+		return wrapErr("district", d.ID, "insert district", err)
+	}
+	return nil
+}
+
+func (dr *districtRepo) Update(ctx context.Context, d *District) error {
+	res, err := squirrel.Update("districts").
+		Set("name", &d.Name).
+		Set("total", &d.Total).
+		Set("new_case", &d.NewCase).
+		Set("treated", &d.Treated).
+		Set("decovering_case", &d.DecoveringCase).
+		Set("test_case", &d.TestCase).
+		Set("dead", &d.Dead).
+		Set("negative_case", &d.NegativeTest).
+		Set("province_id", &d.ProvinceID).
+		// coordinates left out are kept
+		Set("latitude", squirrel.Expr("COALESCE(?, latitude)", d.Latitude)).
+		Set("longitude", squirrel.Expr("COALESCE(?, longitude)", d.Longitude)).
+		Set("attributes", &d.Attributes).
+		Set("updated_at", &d.UpdatedAt).
+		Where(squirrel.Eq{"id": d.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("district", d.ID, "update district", err)
+	}
+	return wrapErr("district", d.ID, "update district", affectedOne(res))
+}
+
+func (dr *districtRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("districts").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("district", id, "delete district", err)
+	}
+	return wrapErr("district", id, "delete district", affectedOne(res))
+}
+
+func (dr *districtRepo) GetByID(ctx context.Context, id string) (*District, error) {
+	var d District
+	err := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"province_id",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").From("districts").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(dr.db).ScanContext(ctx,
+		&d.ID,
+		&d.Name,
+		&d.Total,
+		&d.NewCase,
+		&d.Treated,
+		&d.DecoveringCase,
+		&d.TestCase,
+		&d.Dead,
+		&d.NegativeTest,
+		&d.ProvinceID,
+		&d.Latitude,
+		&d.Longitude,
+		&d.Attributes,
+		&d.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("district", id, "select district", err)
+	}
+	return &d, nil
+}
+
+func (dr *districtRepo) GetAllByProvince(ctx context.Context, provinceID string) (Districts, error) {
+	return selectDistricts(ctx, dr.db, provinceID)
+}
+
+// selectDistricts returns the districts of a province, the most cases
+// first.
+func selectDistricts(ctx context.Context, db *sql.DB, provinceID string) (Districts, error) {
+	rows, err := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"province_id",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").
+		From("districts").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		OrderBy("total DESC").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select districts", err)
+	}
+	defer rows.Close()
+
+	var ds = make(Districts, 0)
+	for rows.Next() {
+		var d District
+		if err := rows.Scan(&d.ID,
+			&d.Name,
+			&d.Total,
+			&d.NewCase,
+			&d.Treated,
+			&d.DecoveringCase,
+			&d.TestCase,
+			&d.Dead,
+			&d.NegativeTest,
+			&d.ProvinceID,
+			&d.Latitude,
+			&d.Longitude,
+			&d.Attributes,
+			&d.UpdatedAt); err != nil {
+			return nil, wrapErr("province", provinceID, "scan districts", err)
+		}
+		ds = append(ds, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select districts", err)
+	}
+	return ds, nil
+}
+
+// handler
+type districtService struct {
+	dApp    DistrictInterface
+	history HistoryRepository
+	changes *changeHub
+}
+
+func NewDistrictService(dApp DistrictInterface, history HistoryRepository, changes *changeHub) *districtService {
+	return &districtService{dApp: dApp, history: history, changes: changes}
+}
+
+func (dA *districtService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (dA *districtService) FindByDistrictID(c echo.Context) error {
+	d, err := dA.dApp.GetByID(c.Request().Context(), c.Param("district_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		past, err := districtsAsOf(c.Request().Context(), dA.history, Districts{d}, at)
+		if err == nil && len(past) == 0 {
+			err = wrapErr("district", d.ID, "history as of", errNotFound)
+		}
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, dA.errMessage(msg))
+		}
+		d = past[0]
+	}
+	setCacheTags(c, districtKey(d.ID))
+	setEntityTag(c, d.UpdatedAt)
+	return c.JSON(http.StatusOK, map[string]*District{"district": d})
+}
+
+func (dA *districtService) ListByProvince(c echo.Context) error {
+	ds, err := dA.dApp.GetAllByProvince(c.Request().Context(), c.Param("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		if ds, err = districtsAsOf(c.Request().Context(), dA.history, ds, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, dA.errMessage(msg))
+		}
+	}
+	keys := []string{provinceKey(c.Param("province_id"))}
+	for _, d := range ds {
+		keys = append(keys, districtKey(d.ID))
+	}
+	setCacheTags(c, keys...)
+	return c.JSON(http.StatusOK, map[string]Districts{"districts": ds})
+}
+
+func (dA *districtService) Store(c echo.Context) error {
+	var d District
+	if err := c.Bind(&d); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, dA.errMessage("request: unable to parse request payload"))
+	}
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, dA.errMessage(err.Error()))
+	}
+	if err := authorizeProvince(c.Request().Context(), d.ProvinceID); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	d.BeforeSave()
+	d.UpdatedAt = updateTime()
+
+	if err := dA.dApp.Save(c.Request().Context(), &d); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not save district information")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	dA.changes.Publish(provinceKey(d.ProvinceID))
+	setEntityTag(c, d.UpdatedAt)
+	return c.JSON(http.StatusCreated, map[string]*District{"district": &d})
+}
+
+func (dA *districtService) UpdateDistrict(c echo.Context) error {
+	var d District
+	if err := c.Bind(&d); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, dA.errMessage("request: unable to parse request payload"))
+	}
+	d.ID = c.Param("district_id")
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, dA.errMessage(err.Error()))
+	}
+
+	current, err := dA.dApp.GetByID(forWrite(c.Request().Context()), d.ID)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	if preconditionFailed(c.Request(), current.UpdatedAt) {
+		return c.JSON(http.StatusPreconditionFailed, dA.errMessage(errModified.Error()))
+	}
+	// requireDistrict authorized the province the district is in, moving it
+	// takes the one it goes to as well
+	moved := d.ProvinceID != current.ProvinceID
+	if moved {
+		if err := authorizeProvince(c.Request().Context(), d.ProvinceID); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, dA.errMessage(msg))
+		}
+	}
+	// attributes left out of the payload are kept as they are
+	if d.Attributes == nil {
+		d.Attributes = current.Attributes
+	}
+	if current.Equal(&d) {
+		setEntityTag(c, current.UpdatedAt)
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	d.UpdatedAt = updateTime()
+	if err := dA.dApp.Update(c.Request().Context(), &d); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update district information")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	if moved {
+		dA.changes.Publish(provinceKey(current.ProvinceID))
+	}
+	dA.changes.Publish(districtKey(d.ID), provinceKey(d.ProvinceID))
+	setEntityTag(c, d.UpdatedAt)
+	return c.JSON(http.StatusOK, map[string]*District{"district": &d})
+}
+
+func (dA *districtService) DeleteDistrict(c echo.Context) error {
+	if err := dA.dApp.Delete(c.Request().Context(), c.Param("district_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, dA.errMessage(msg))
+	}
+	dA.changes.Publish(districtKey(c.Param("district_id")))
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// embargoLayout is the layout of the time of day of an embargo, in UTC.
+const embargoLayout = "15:04"
+
+var errEmbargoed = errors.New("Error: The figures of today are under embargo, which this endpoint cannot show them as of")
+
+// publicEmbargo is the embargo of the callers without a key of a team nor a
+// token, set with PUBLIC_EMBARGO, empty for none.
+var publicEmbargo string
+
+// publicEmbargoFromEnv reads PUBLIC_EMBARGO, a time of day formatted as
+// HH:MM in UTC.
+func publicEmbargoFromEnv() (string, error) {
+	e := &KeyEmbargo{Embargo: os.Getenv("PUBLIC_EMBARGO")}
+	e.Prepare()
+	if _, err := time.Parse(embargoLayout, e.Embargo); e.Embargo != "" && err != nil {
+		return "", fmt.Errorf("embargo: invalid PUBLIC_EMBARGO %q, must be formatted as HH:MM", e.Embargo)
+	}
+	return e.Embargo, nil
+}
+
+// KeyEmbargo is the body setting the embargo of an API key.
+type KeyEmbargo struct {
+	Embargo string `json:"embargo"`
+}
+
+func (e *KeyEmbargo) Prepare() {
+	e.Embargo = strings.TrimSpace(e.Embargo)
+}
+
+func (e *KeyEmbargo) Validate() error {
+	if e.Embargo == "" {
+		return nil
+	}
+	t, err := time.Parse(embargoLayout, e.Embargo)
+	if err != nil {
+		return errors.New("embargo: must be a time of day formatted as HH:MM, in UTC")
+	}
+	// a key held back longer than anonymous callers would leave itself out
+	if publicEmbargo == "" {
+		return nil
+	}
+	if public, err := time.Parse(embargoLayout, publicEmbargo); err != nil || t.After(public) {
+		return fmt.Errorf("embargo: must not be later than the public embargo, PUBLIC_EMBARGO, %q", publicEmbargo)
+	}
+	return nil
+}
+
+// embargoCutoff evaluates the embargo of a key at now: before the time of
+// day it names, the key is shown the figures as they were at the end of the
+// day before, returned with true. Once it passed, or without an embargo, the
+// key is shown the current figures.
+func embargoCutoff(embargo string, now time.Time) (time.Time, bool) {
+	if embargo == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(embargoLayout, embargo)
+	if err != nil {
+		return time.Time{}, false
+	}
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	release := midnight.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+	if !now.Before(release) {
+		return time.Time{}, false
+	}
+	return midnight.Add(-time.Nanosecond), true
+}
+
+// embargoAt returns the time the caller is shown the figures as of when it
+// is under embargo at now. Callers with the key of a team or an embed token
+// are under its embargo, which never outlasts the public one when there is
+// one; those with a token are not; the others, anonymous or with the key of
+// a developer, are under the public embargo.
+func embargoAt(ctx context.Context, now time.Time) (time.Time, bool) {
+	id, ok := ctx.Value(identityKey{}).(*identity)
+	switch {
+	case ok && (id.team != nil || id.embed != ""):
+		if _, public := embargoCutoff(publicEmbargo, now); publicEmbargo != "" && !public {
+			return time.Time{}, false
+		}
+		return embargoCutoff(id.embargo, now)
+	case ok && id.claims != nil:
+		return time.Time{}, false
+	}
+	return embargoCutoff(publicEmbargo, now)
+}
+
+// embargoed is embargoAt for the read endpoints, whose responses depend on
+// the caller from then on: they vary by key and token, keys being under
+// embargo with or without a public one, and are kept out of shared caches
+// while under embargo.
+func embargoed(c echo.Context) (time.Time, bool) {
+	ctx := c.Request().Context()
+	c.Response().Header().Add(echo.HeaderVary, headerAPIKey)
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAuthorization)
+	at, ok := embargoAt(ctx, time.Now())
+	if ok {
+		c.Response().Header().Set("Cache-Control", "private")
+	}
+	return at, ok
+}
+
+// refuseEmbargoed refuses the callers under embargo on the endpoints that
+// only ever show the current figures, such as the live feeds.
+func refuseEmbargoed(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := embargoed(c); ok {
+			status, msg := errorStatus(errEmbargoed, "")
+			return c.JSON(status, &ErrorMsg{msg})
+		}
+		return next(c)
+	}
+}
+
+// readAsOf returns the time the figures are shown as of, when they are not
+// the current ones: the ?as_of= asked for, or the embargo of the key of the
+// caller when earlier.
+func readAsOf(c echo.Context) (time.Time, bool, error) {
+	var at time.Time
+	var ok bool
+	if v := c.QueryParam("as_of"); v != "" {
+		t, err := parseAsOf(v)
+		if err != nil {
+			return at, false, err
+		}
+		at, ok = t, true
+	}
+	if cutoff, embargo := embargoed(c); embargo && (!ok || cutoff.Before(at)) {
+		at, ok = cutoff, true
+	}
+	return at, ok, nil
+}
+
+// before leaves out of h the points recorded after at.
+func (h History) before(at time.Time) History {
+	kept := make(History, 0, len(h))
+	for _, p := range h {
+		if !p.RecordedAt.After(at) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// countriesAsOf rebuilds the figures of countries, without their provinces,
+// as they were at the given time, countries without history by then being
+// left out.
+func countriesAsOf(ctx context.Context, hApp HistoryRepository, countries Countries, at time.Time) (Countries, error) {
+	ids := make([]string, len(countries))
+	for i, ct := range countries {
+		ids[i] = ct.ID
+	}
+	points, err := hApp.AsOf(ctx, "country", ids, at)
+	if err != nil {
+		return nil, err
+	}
+	past := make(Countries, 0, len(countries))
+	for _, ct := range countries {
+		cp, ok := points[ct.ID]
+		if !ok {
+			continue
+		}
+		old := *ct
+		old.Metrics = nil
+		setHistoryFigures(cp, &old.Total, &old.NewCase, &old.Treated, &old.DecoveringCase, &old.TestCase, &old.Dead, &old.NegativeTest)
+		old.UpdatedAt = cp.RecordedAt
+		past = append(past, &old)
+	}
+	return past, nil
+}
+
+// provincesAsOf rebuilds the figures of provinces, without their districts,
+// as they were at the given time, provinces without history by then being
+// left out.
+func provincesAsOf(ctx context.Context, hApp HistoryRepository, ps Provinces, at time.Time) (Provinces, error) {
+	ids := make([]string, len(ps))
+	for i, p := range ps {
+		ids[i] = p.ID
+	}
+	points, err := hApp.AsOf(ctx, "province", ids, at)
+	if err != nil {
+		return nil, err
+	}
+	past := make(Provinces, 0, len(ps))
+	for _, p := range ps {
+		pp, ok := points[p.ID]
+		if !ok {
+			continue
+		}
+		old := *p
+		old.Metrics = nil
+		old.Districts = nil
+		setHistoryFigures(pp, &old.Total, &old.NewCase, &old.Treated, &old.DecoveringCase, &old.TestCase, &old.Dead, &old.NegativeTest)
+		old.UpdatedAt = pp.RecordedAt
+		past = append(past, &old)
+	}
+	return past, nil
+}
+
+// provinceAsOf rebuilds province as it was at the given time, as countryAsOf
+// does a country, with its current districts.
+func provinceAsOf(ctx context.Context, hApp HistoryRepository, province *Province, at time.Time) (*Province, error) {
+	past, err := provincesAsOf(ctx, hApp, Provinces{province}, at)
+	if err != nil {
+		return nil, err
+	}
+	if len(past) == 0 {
+		return nil, wrapErr("province", province.ID, "history as of", errNotFound)
+	}
+	p := past[0]
+	if p.Districts, err = districtsAsOf(ctx, hApp, province.Districts, at); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// districtsAsOf rebuilds the figures of districts as they were at the given
+// time, districts without history by then being left out.
+func districtsAsOf(ctx context.Context, hApp HistoryRepository, ds Districts, at time.Time) (Districts, error) {
+	ids := make([]string, len(ds))
+	for i, d := range ds {
+		ids[i] = d.ID
+	}
+	points, err := hApp.AsOf(ctx, "district", ids, at)
+	if err != nil {
+		return nil, err
+	}
+	past := make(Districts, 0, len(ds))
+	for _, d := range ds {
+		dp, ok := points[d.ID]
+		if !ok {
+			continue
+		}
+		old := *d
+		setHistoryFigures(dp, &old.Total, &old.NewCase, &old.Treated, &old.DecoveringCase, &old.TestCase, &old.Dead, &old.NegativeTest)
+		old.UpdatedAt = dp.RecordedAt
+		past = append(past, &old)
+	}
+	return past, nil
+}
+
+func (tr *teamRepo) SetKeyEmbargo(ctx context.Context, teamID, keyID, embargo string) error {
+	var value interface{}
+	if embargo != "" {
+		value = embargo
+	}
+	res, err := squirrel.Update("team_keys").
+		Set("embargo", value).
+		Where(squirrel.Eq{"id": keyID, "team_id": teamID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("team", teamID, "update key embargo", err)
+	}
+	return wrapErr("team", teamID, "update key embargo", affectedOne(res))
+}
+
+// SetKeyEmbargo puts an API key under an embargo, for media partners to be
+// shown the new daily figures only after the time they may publish them.
+// An empty embargo lifts it.
+func (tA *teamService) SetKeyEmbargo(c echo.Context) error {
+	var e KeyEmbargo
+	if err := c.Bind(&e); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, tA.errMessage("request: unable to parse request payload"))
+	}
+	e.Prepare()
+	if err := e.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, tA.errMessage(err.Error()))
+	}
+	if err := tA.tApp.SetKeyEmbargo(c.Request().Context(), c.Param("team_id"), c.Param("key_id"), e.Embargo); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not set embargo")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*KeyEmbargo{"embargo": &e})
+}
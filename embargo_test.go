@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyEmbargoWithoutPublicEmbargo(t *testing.T) {
+	defer func(embargo string) { publicEmbargo = embargo }(publicEmbargo)
+	publicEmbargo = ""
+	e := &KeyEmbargo{Embargo: "09:00"}
+	if err := e.Validate(); err != nil {
+		t.Fatalf("Validate without a public embargo: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), identityKey{}, &identity{team: &Team{ID: "team"}, embargo: e.Embargo})
+	if _, ok := embargoAt(ctx, time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC)); !ok {
+		t.Error("key not under its embargo before it passed")
+	}
+	if _, ok := embargoAt(ctx, time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)); ok {
+		t.Error("key under its embargo after it passed")
+	}
+
+	publicEmbargo = "08:00"
+	if err := e.Validate(); err == nil {
+		t.Error("Validate accepted an embargo later than the public one")
+	}
+}
+
+func TestMetricsAsOfTheEmbargo(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	yesterday := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	c := saveTestCountry(t, ctx, r, yesterday)
+	vte := c.Provinces[0]
+	vte.NewCase, vte.UpdatedAt = 3, yesterday.Add(24*time.Hour)
+	if err := r.ProvinceRepo.Update(ctx, vte); err != nil {
+		t.Fatal(err)
+	}
+
+	mA := NewDataMetricsService(r.CountryRepo, r.ProvinceRepo, r.HistoryRepo)
+	now := yesterday.Add(25 * time.Hour)
+	for _, tt := range []struct {
+		name string
+		asOf bool
+		want string
+	}{
+		{"current", false, `covid19_province_new_cases{province_id="VTE",province="Vientiane"} 3` + "\n"},
+		{"under embargo", true, `covid19_province_new_cases{province_id="VTE",province="Vientiane"} 0` + "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cutoff, _ := embargoCutoff("23:00", now)
+			gs, err := mA.gauges(ctx, now, cutoff, tt.asOf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(writeGauges(gs)); !strings.Contains(got, tt.want) {
+				t.Errorf("gauges\n%s\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+// the query parameter embeds pass their token in, an iframe having no say
+// over the headers of its requests
+const embedTokenParam = "embed_token"
+
+// the audience of embed tokens, which are signed with a key of their own
+// derived from the JWT secret, for them never to pass as bearer tokens
+const embedAudience = "embed"
+
+const (
+	defaultEmbedTTL = time.Hour
+	maxEmbedTTL     = 24 * time.Hour
+)
+
+var (
+	errEmbedToken   = errors.New("Error: The embed token is invalid or expired")
+	errOutsideEmbed = errors.New("Error: The embed token only reads its province")
+)
+
+// EmbedTokenRequest asks for a token reading the province ProvinceID for
+// ExpiresIn seconds, an hour unless set.
+type EmbedTokenRequest struct {
+	ProvinceID string `json:"province_id"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// EmbedToken reads one province, without the capabilities of the key or the
+// token that issued it but under its embargo, for the embeddable widget and
+// partner iframes.
+type EmbedToken struct {
+	Token      string    `json:"token"`
+	ProvinceID string    `json:"province_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type embedClaims struct {
+	ProvinceID string `json:"province_id"`
+	// Embargo is the embargo of the caller that issued the token, empty for
+	// none
+	Embargo string `json:"embargo,omitempty"`
+	jwt.StandardClaims
+}
+
+func (r *EmbedTokenRequest) Prepare() {
+	r.ProvinceID = strings.TrimSpace(r.ProvinceID)
+	if r.ExpiresIn == 0 {
+		r.ExpiresIn = int(defaultEmbedTTL.Seconds())
+	}
+}
+
+func (r *EmbedTokenRequest) Validate() error {
+	if r.ProvinceID == "" {
+		return errors.New("embed token: province_id is required")
+	}
+	if r.ExpiresIn < 1 || r.ExpiresIn > int(maxEmbedTTL.Seconds()) {
+		return fmt.Errorf("embed token: expires_in must be between 1 and %d seconds", int(maxEmbedTTL.Seconds()))
+	}
+	return nil
+}
+
+// embedKey is the key embed tokens are signed with.
+func (aA *authService) embedKey() []byte {
+	mac := hmac.New(sha256.New, aA.secret)
+	mac.Write([]byte(embedAudience))
+	return mac.Sum(nil)
+}
+
+// authenticateEmbed checks an embed token by its signature alone, and that
+// the request only reads the province it is scoped to, which the request
+// goes on as.
+func (aA *authService) authenticateEmbed(c echo.Context, raw string) (*identity, error) {
+	var claims embedClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errEmbedToken
+		}
+		return aA.embedKey(), nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(embedAudience, true) || claims.ProvinceID == "" {
+		return nil, errEmbedToken
+	}
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead:
+	default:
+		return nil, errOutsideEmbed
+	}
+	if c.Param("province_id") != claims.ProvinceID {
+		return nil, errOutsideEmbed
+	}
+	return &identity{embed: claims.ProvinceID, embargo: claims.Embargo}, nil
+}
+
+// handler
+type embedService struct {
+	auth *authService
+	pApp ProvinceInterface
+}
+
+func NewEmbedService(auth *authService, pApp ProvinceInterface) *embedService {
+	return &embedService{auth: auth, pApp: pApp}
+}
+
+func (eA *embedService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// IssueToken signs a token reading one province, for any caller with a
+// token or an API key, the token expiring within a day. The token is under
+// the embargo of its caller: that of the key of a team, the public one for a
+// developer, none for a token.
+func (eA *embedService) IssueToken(c echo.Context) error {
+	if !eA.auth.Enabled() {
+		return c.JSON(http.StatusNotFound, eA.errMessage("auth: authentication is not configured"))
+	}
+	id, ok := c.Request().Context().Value(identityKey{}).(*identity)
+	if !ok || (id.claims == nil && id.developer == nil) {
+		return c.JSON(http.StatusUnauthorized, eA.errMessage(errUnauthenticated.Error()))
+	}
+	var embargo string
+	switch {
+	case id.team != nil:
+		embargo = id.embargo
+	case id.developer != nil:
+		embargo = publicEmbargo
+	}
+	var r EmbedTokenRequest
+	if err := c.Bind(&r); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, eA.errMessage("request: unable to parse request payload"))
+	}
+	r.Prepare()
+	if err := r.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, eA.errMessage(err.Error()))
+	}
+	if _, err := eA.pApp.GetByID(c.Request().Context(), r.ProvinceID); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, eA.errMessage(msg))
+	}
+
+	now := time.Now()
+	t := EmbedToken{ProvinceID: r.ProvinceID, ExpiresAt: now.Add(time.Duration(r.ExpiresIn) * time.Second)}
+	var err error
+	t.Token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, &embedClaims{
+		ProvinceID: r.ProvinceID,
+		Embargo:    embargo,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  embedAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: t.ExpiresAt.Unix(),
+		},
+	}).SignedString(eA.auth.embedKey())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, eA.errMessage("Internal server error"))
+	}
+	return c.JSON(http.StatusCreated, map[string]*EmbedToken{"embed_token": &t})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// newEmbedTestServer issues embed tokens and serves GET /api/v1/province,
+// answering whether the caller is under embargo at the time of day ?at= on
+// 2026-10-17, over LA with VTE and LPB and a team managing LA whose key it
+// returns.
+func newEmbedTestServer(t *testing.T, limits *rateLimits) (*echo.Echo, *Repository, context.Context, string) {
+	t.Helper()
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+	teamKey := saveTestTeam(t, ctx, r, "LA")
+
+	e := echo.New()
+	auth := NewAuthService(r.UserRepo, r.TeamRepo, r.DeveloperRepo, newDeveloperUsage(r.DeveloperRepo), testJWTSecret, time.Hour)
+	e.Use(requestDeadline(5 * time.Second))
+	e.Use(limits.Middleware)
+	e.Use(auth.Authenticate)
+	e.Use(limits.KeyMiddleware)
+	e.POST("/api/v1/auth/embed-tokens", NewEmbedService(auth, r.ProvinceRepo).IssueToken)
+	e.GET("/api/v1/province/:province_id", func(c echo.Context) error {
+		at, err := time.Parse(dateLayout+" "+embargoLayout, "2026-10-17 "+c.QueryParam("at"))
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		_, embargoed := embargoAt(c.Request().Context(), at)
+		return c.JSON(http.StatusOK, map[string]bool{"embargoed": embargoed})
+	})
+	return e, r, ctx, teamKey
+}
+
+// issueEmbedToken issues a token reading VTE to the caller of creds.
+func issueEmbedToken(t *testing.T, e *echo.Echo, creds credentials) string {
+	t.Helper()
+	rec := send(e, http.MethodPost, "/api/v1/auth/embed-tokens", creds, `{"province_id":"VTE"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("issue = %d %s", rec.Code, rec.Body)
+	}
+	var body map[string]*EmbedToken
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body["embed_token"].Token
+}
+
+func TestEmbedTokenKeepsTheEmbargoOfItsIssuer(t *testing.T) {
+	defer func(embargo string) { publicEmbargo = embargo }(publicEmbargo)
+	publicEmbargo = "10:00"
+	e, r, ctx, teamKey := newEmbedTestServer(t, &rateLimits{})
+	team, key, _, err := r.TeamRepo.GetByKey(ctx, hashTeamKey(teamKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.TeamRepo.SetKeyEmbargo(ctx, team.ID, key.ID, "09:00"); err != nil {
+		t.Fatal(err)
+	}
+	byToken := issueEmbedToken(t, e, bearer(testToken(t, RoleViewer, "")))
+	byTeam := issueEmbedToken(t, e, apiKey(teamKey))
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{"anonymous", "at=09:30", true},
+		{"issued with a token", "at=08:30&embed_token=" + byToken, false},
+		{"issued with the key of a team before its embargo", "at=08:30&embed_token=" + byTeam, true},
+		{"issued with the key of a team after its embargo", "at=09:30&embed_token=" + byTeam, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := send(e, http.MethodGet, "/api/v1/province/VTE?"+tt.query, nil, "")
+			var body map[string]bool
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("GET = %d %s", rec.Code, rec.Body)
+			}
+			if body["embargoed"] != tt.want {
+				t.Errorf("embargoed %v, want %v", body["embargoed"], tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbedTokenHasItsOwnRateLimit(t *testing.T) {
+	e, _, _, teamKey := newEmbedTestServer(t, &rateLimits{ip: newRateLimiter(1), embed: newRateLimiter(3)})
+	token := issueEmbedToken(t, e, apiKey(teamKey))
+	path := "/api/v1/province/VTE?at=12:00&embed_token=" + token
+	for i := 0; i < 3; i++ {
+		if rec := send(e, http.MethodGet, path, nil, ""); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "3" {
+			t.Fatalf("request %d with the embed token = %d, limited to %s", i+1, rec.Code, rec.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+	if rec := send(e, http.MethodGet, path, nil, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("fourth request with the embed token = %d, want 429", rec.Code)
+	}
+
+	// the requests of the embed token left the bucket of the IP alone
+	if rec := send(e, http.MethodGet, "/api/v1/province/VTE?at=12:00", nil, ""); rec.Code != http.StatusOK {
+		t.Errorf("anonymous request = %d, want 200", rec.Code)
+	}
+	if rec := send(e, http.MethodGet, "/api/v1/province/VTE?at=12:00", nil, ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second anonymous request = %d, want 429", rec.Code)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// envelopes responses can be shaped in
+const (
+	// EnvelopeKeyed wraps the resource in a key naming it, {"country": ...}
+	EnvelopeKeyed = "keyed"
+	// EnvelopeData wraps the resource in a data key, {"data": ...}
+	EnvelopeData = "data"
+	// EnvelopeBare answers with the resource itself
+	EnvelopeBare = "bare"
+)
+
+var envelopes = map[string]bool{EnvelopeKeyed: true, EnvelopeData: true, EnvelopeBare: true}
+
+// envelopeShaper reshapes JSON responses from the keyed envelope the handlers
+// write into the one the client asked for with the profile parameter of
+// Accept, e.g. "application/json; profile=data", or the deployment default.
+// Errors keep their shape.
+type envelopeShaper struct {
+	def string
+}
+
+func newEnvelopeShaper(def string) (*envelopeShaper, error) {
+	if def == "" {
+		def = EnvelopeKeyed
+	}
+	if !envelopes[def] {
+		return nil, fmt.Errorf("envelope: unknown envelope %q", def)
+	}
+	return &envelopeShaper{def: def}, nil
+}
+
+// profile returns the envelope asked for in accept, empty when none is.
+func (es *envelopeShaper) profile(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || (mediaType != echo.MIMEApplicationJSON && mediaType != "*/*") {
+			continue
+		}
+		if p := params["profile"]; envelopes[p] {
+			return p
+		}
+	}
+	return ""
+}
+
+func (es *envelopeShaper) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		envelope := es.profile(c.Request().Header.Get(echo.HeaderAccept))
+		if envelope == "" {
+			envelope = es.def
+		}
+		c.Set("envelope", envelope)
+		c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+		if envelope == EnvelopeKeyed || rawResponses[c.Path()] || c.Path() == "/graphql" {
+			return next(c)
+		}
+
+		res := c.Response()
+		w := res.Writer
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		res.Writer = buf
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w
+
+		body := buf.body.Bytes()
+		if buf.status < http.StatusMultipleChoices &&
+			strings.HasPrefix(res.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+			body = reshape(body, envelope)
+		}
+		w.WriteHeader(buf.status)
+		_, err := w.Write(body)
+		return err
+	}
+}
+
+// reshape unwraps the one resource key of a keyed body, along with meta,
+// leaving bodies of any other shape as they are. The bare envelope has no
+// room for meta, which is dropped.
+func reshape(body []byte, envelope string) []byte {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return body
+	}
+	meta, hasMeta := obj["meta"]
+	delete(obj, "meta")
+	if len(obj) != 1 {
+		return body
+	}
+	var resource json.RawMessage
+	for key, v := range obj {
+		if key == "error" || key == "success" {
+			return body
+		}
+		resource = v
+	}
+
+	if envelope == EnvelopeBare {
+		return append(resource, '\n')
+	}
+	out := map[string]json.RawMessage{"data": resource}
+	if hasMeta {
+		out["meta"] = meta
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return body
+	}
+	return append(b, '\n')
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+var (
+	errConflict         = errors.New("Error: Data conflicts with an existing record")
+	errInvalidReference = errors.New("Error: Referenced data does not exist")
+	errSerialization    = errors.New("Error: Data was changed concurrently, please retry")
+	errModified         = errors.New("Error: Data was modified since it was read")
+	errTimeout          = errors.New("Error: The request took too long, please retry")
+)
+
+// postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+var pqErrorKinds = map[pq.ErrorCode]error{
+	"23505": errConflict,
+	"23503": errInvalidReference,
+	"40001": errSerialization,
+	"40P01": errSerialization,
+	// a query cancelled by its context, or by statement_timeout
+	"57014": errTimeout,
+}
+
+// dbError ties a driver error to the domain error it maps to, so that both
+// errors.Is(err, errConflict) and errors.As(err, &pqErr) hold.
+type dbError struct {
+	kind error
+	err  error
+}
+
+func (e *dbError) Error() string        { return e.err.Error() }
+func (e *dbError) Unwrap() error        { return e.err }
+func (e *dbError) Is(target error) bool { return target == e.kind }
+
+// wrapErr adds the entity, id and query name to an error coming out of the
+// database and maps the postgres errors handlers care about to domain errors.
+func wrapErr(entity, id, query string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if kind, ok := pqErrorKinds[pqErr.Code]; ok {
+			err = &dbError{kind: kind, err: err}
+		}
+	} else if kind, ok := sqliteErrorKind(err); ok {
+		err = &dbError{kind: kind, err: err}
+	}
+	if id == "" {
+		return fmt.Errorf("%s: %s: %w", entity, query, err)
+	}
+	return fmt.Errorf("%s %s: %s: %w", entity, id, query, err)
+}
+
+// affectedOne turns an update or delete that matched no row into errNotFound.
+func affectedOne(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// errorStatus maps an error returned by a repository to the status code and
+// message handlers answer with. Errors without a domain meaning are reported
+// as an internal server error with msg.
+func errorStatus(err error, msg string) (int, string) {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound, errNotFound.Error()
+	case errors.Is(err, errConflict):
+		return http.StatusConflict, errConflict.Error()
+	case errors.Is(err, errInvalidReference):
+		return http.StatusUnprocessableEntity, errInvalidReference.Error()
+	case errors.Is(err, errSerialization):
+		return http.StatusConflict, errSerialization.Error()
+	case errors.Is(err, errUnauthenticated):
+		return http.StatusUnauthorized, errUnauthenticated.Error()
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden, errForbidden.Error()
+	case errors.Is(err, errEmbedToken):
+		return http.StatusUnauthorized, errEmbedToken.Error()
+	case errors.Is(err, errOutsideEmbed):
+		return http.StatusForbidden, errOutsideEmbed.Error()
+	case errors.Is(err, errQuotaExceeded):
+		return http.StatusTooManyRequests, errQuotaExceeded.Error()
+	case errors.Is(err, errEmbargoed):
+		return http.StatusForbidden, errEmbargoed.Error()
+	case errors.Is(err, errTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, errTimeout.Error()
+	}
+	return http.StatusInternalServerError, msg
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// etagMiddleware tags successful GET responses with a strong ETag and answers
+// 304 Not Modified to requests whose If-None-Match holds it, sparing clients
+// the body they already have.
+//
+// The routes of single countries, provinces and districts tag their response
+// with the entityTag of the record, the one the If-Match of their writes is
+// compared with, and keep it. Lists and aggregates, which no write is checked
+// against, are tagged with the hash of their body as sent.
+func etagMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || streamingRoutes[c.Path()] || downloadRoutes[c.Path()] {
+			return next(c)
+		}
+
+		res := c.Response()
+		w := res.Writer
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		res.Writer = buf
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w
+
+		body := buf.body.Bytes()
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			_, err := w.Write(body)
+			return err
+		}
+		tag := res.Header().Get("ETag")
+		if tag == "" {
+			sum := sha256.Sum256(body)
+			tag = `"` + hex.EncodeToString(sum[:16]) + `"`
+			res.Header().Set("ETag", tag)
+		}
+		if noneMatch(r.Header.Get("If-None-Match"), tag) {
+			res.Header().Del(echo.HeaderContentType)
+			res.Status = http.StatusNotModified
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write(body)
+		return err
+	}
+}
+
+// noneMatch reports whether an If-None-Match header holds tag, compared
+// weakly as RFC 7232 asks.
+func noneMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
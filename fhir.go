@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	mimeFHIRJSON = "application/fhir+json"
+	// the code system of the figures and of the ids of countries and
+	// provinces, when FHIR_SYSTEM is not set
+	defaultFHIRSystem = "urn:covid19-api"
+	// the measure population the figures are counts of
+	fhirPopulationSystem = "http://terminology.hl7.org/CodeSystem/measure-population"
+)
+
+// fhirFigures are the figures reported as the groups of a MeasureReport, by
+// code.
+var fhirFigures = []struct {
+	code    string
+	display string
+}{
+	{"total", "Confirmed cases"},
+	{"new_case", "New cases"},
+	{"treated", "Treated"},
+	{"decovering_case", "Recovering cases"},
+	{"test_case", "Tests"},
+	{"dead", "Deaths"},
+	{"negative_case", "Negative tests"},
+}
+
+type fhirCoding struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Display string `json:"display,omitempty"`
+}
+
+type fhirCodeableConcept struct {
+	Coding []fhirCoding `json:"coding"`
+}
+
+type fhirIdentifier struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type fhirReference struct {
+	Identifier *fhirIdentifier `json:"identifier,omitempty"`
+	Display    string          `json:"display,omitempty"`
+}
+
+type fhirPeriod struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type fhirPopulation struct {
+	Code  fhirCodeableConcept `json:"code"`
+	Count int64               `json:"count"`
+}
+
+type fhirGroup struct {
+	Code       fhirCodeableConcept `json:"code"`
+	Population []fhirPopulation    `json:"population"`
+}
+
+// FHIRMeasureReport is the subset of the FHIR R4 MeasureReport resource the
+// figures of a country or a province are reported with.
+type FHIRMeasureReport struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id"`
+	Status       string        `json:"status"`
+	Type         string        `json:"type"`
+	Measure      string        `json:"measure"`
+	Subject      fhirReference `json:"subject"`
+	Date         string        `json:"date"`
+	Period       fhirPeriod    `json:"period"`
+	Group        []fhirGroup   `json:"group"`
+}
+
+type fhirBundleEntry struct {
+	Resource *FHIRMeasureReport `json:"resource"`
+}
+
+// FHIRBundle is a FHIR R4 Bundle collecting MeasureReports.
+type FHIRBundle struct {
+	ResourceType string            `json:"resourceType"`
+	Type         string            `json:"type"`
+	Timestamp    string            `json:"timestamp"`
+	Entry        []fhirBundleEntry `json:"entry"`
+}
+
+// handler
+type fhirService struct {
+	cApp    CountryRepository
+	hApp    HistoryRepository
+	system  string
+	measure string
+}
+
+// NewFHIRService reports with the codes of FHIR_SYSTEM, against the measure
+// FHIR_MEASURE_URL, which partners may have to register on their side.
+func NewFHIRService(cApp CountryRepository, hApp HistoryRepository) *fhirService {
+	fA := &fhirService{cApp: cApp, hApp: hApp, system: os.Getenv("FHIR_SYSTEM"), measure: os.Getenv("FHIR_MEASURE_URL")}
+	if fA.system == "" {
+		fA.system = defaultFHIRSystem
+	}
+	if fA.measure == "" {
+		fA.measure = fA.system + ":measure:aggregate-counts"
+	}
+	return fA
+}
+
+func (fA *fhirService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// report builds the MeasureReport of the figures of the kind country or
+// province with id, for the day they were last updated on.
+func (fA *fhirService) report(kind, id, name string, figures []int64, updatedAt time.Time) *FHIRMeasureReport {
+	day := updatedAt.UTC().Format(dateLayout)
+	r := &FHIRMeasureReport{
+		ResourceType: "MeasureReport",
+		ID:           kind + "-" + id + "-" + day,
+		Status:       "complete",
+		Type:         "summary",
+		Measure:      fA.measure,
+		Subject: fhirReference{
+			Identifier: &fhirIdentifier{System: fA.system + ":" + kind, Value: id},
+			Display:    name,
+		},
+		Date:   updatedAt.UTC().Format(time.RFC3339),
+		Period: fhirPeriod{Start: day, End: day},
+	}
+	for i, f := range fhirFigures {
+		r.Group = append(r.Group, fhirGroup{
+			Code: fhirCodeableConcept{Coding: []fhirCoding{{System: fA.system, Code: f.code, Display: f.display}}},
+			Population: []fhirPopulation{{
+				Code:  fhirCodeableConcept{Coding: []fhirCoding{{System: fhirPopulationSystem, Code: "initial-population"}}},
+				Count: figures[i],
+			}},
+		})
+	}
+	return r
+}
+
+// MeasureReport answers a FHIR Bundle of the MeasureReports of a country and
+// of its provinces, as they are or, with ?as_of=, as they were then.
+func (fA *fhirService) MeasureReport(c echo.Context) error {
+	ctx := c.Request().Context()
+	country, err := fA.cApp.GetByID(ctx, c.Param("country_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	at, asOf, err := readAsOf(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage(err.Error()))
+	}
+	if asOf {
+		if country, err = countryAsOf(ctx, fA.hApp, country, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, fA.errMessage(msg))
+		}
+	}
+
+	bundle := &FHIRBundle{
+		ResourceType: "Bundle",
+		Type:         "collection",
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+	}
+	bundle.Entry = append(bundle.Entry, fhirBundleEntry{fA.report("country", country.ID, country.Name, []int64{
+		country.Total, country.NewCase, country.Treated, country.DecoveringCase, country.TestCase, country.Dead, country.NegativeTest,
+	}, country.UpdatedAt)})
+	for _, p := range country.Provinces {
+		bundle.Entry = append(bundle.Entry, fhirBundleEntry{fA.report("province", p.ID, p.Name, []int64{
+			p.Total, p.NewCase, p.Treated, p.DecoveringCase, p.TestCase, p.Dead, p.NegativeTest,
+		}, p.UpdatedAt)})
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, fA.errMessage("Internal server error"))
+	}
+	return c.Blob(http.StatusOK, mimeFHIRJSON+"; charset=utf-8", data)
+}
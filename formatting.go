@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // the dyno image is not guaranteed to ship zoneinfo
+
+	"github.com/labstack/echo"
+)
+
+// Formatting tells thin clients how to render numbers and dates for a
+// locale, so that they do not need an i18n layer of their own.
+type Formatting struct {
+	Locale           string `json:"locale"`
+	Timezone         string `json:"timezone"`
+	DateFormat       string `json:"date_format"`
+	DecimalSeparator string `json:"decimal_separator"`
+	GroupSeparator   string `json:"group_separator"`
+}
+
+type ResponseMeta struct {
+	Formatting *Formatting `json:"formatting,omitempty"`
+	// Provinces is the page of the provinces of a country asked for with
+	// ?province_page= or ?province_limit=.
+	Provinces *Pagination `json:"provinces,omitempty"`
+}
+
+// formattings are the locales served by ?lang=, keyed by language, their
+// timezone being the one of the deployment.
+var formattings = map[string]Formatting{
+	"lo": {Locale: "lo-LA", DateFormat: "DD/MM/YYYY", DecimalSeparator: ",", GroupSeparator: "."},
+	"en": {Locale: "en-US", DateFormat: "MM/DD/YYYY", DecimalSeparator: ".", GroupSeparator: ","},
+	"th": {Locale: "th-TH", DateFormat: "DD/MM/YYYY", DecimalSeparator: ".", GroupSeparator: ","},
+}
+
+// formattingMiddleware adds a meta.formatting block to the JSON object
+// responses of requests asking for a locale with ?lang=, in timezone unless
+// overridden by ?tz=.
+func formattingMiddleware(timezone string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			lang := strings.ToLower(c.QueryParam("lang"))
+			if lang == "" || rawResponses[c.Path()] {
+				return next(c)
+			}
+			if i := strings.IndexAny(lang, "-_"); i > 0 {
+				lang = lang[:i]
+			}
+			f, ok := formattings[lang]
+			if !ok {
+				return c.JSON(http.StatusBadRequest, &ErrorMsg{"request: unsupported lang"})
+			}
+			f.Timezone = timezone
+			if tz := c.QueryParam("tz"); tz != "" {
+				if _, err := time.LoadLocation(tz); err != nil {
+					return c.JSON(http.StatusBadRequest, &ErrorMsg{"request: unknown tz"})
+				}
+				f.Timezone = tz
+			}
+
+			res := c.Response()
+			w := res.Writer
+			buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+			res.Writer = buf
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			res.Writer = w
+
+			body := buf.body.Bytes()
+			if buf.status < http.StatusMultipleChoices &&
+				strings.HasPrefix(res.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+				body = withMeta(body, &ResponseMeta{Formatting: &f})
+			}
+			w.WriteHeader(buf.status)
+			_, err := w.Write(body)
+			return err
+		}
+	}
+}
+
+// withMeta adds meta to a JSON object, along with the meta the handler may
+// have written, leaving any other body as it is.
+func withMeta(body []byte, meta *ResponseMeta) []byte {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return body
+	}
+	merged := make(map[string]json.RawMessage)
+	if written, ok := obj["meta"]; ok {
+		if err := json.Unmarshal(written, &merged); err != nil {
+			return body
+		}
+	}
+	m, err := json.Marshal(meta)
+	if err != nil {
+		return body
+	}
+	if err := json.Unmarshal(m, &merged); err != nil {
+		return body
+	}
+	if obj["meta"], err = json.Marshal(merged); err != nil {
+		return body
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return body
+	}
+	return append(b, '\n')
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// FrozenCountry is the figures of a country as published for a day. The
+// freeze itself is revision 0, every later correction of the day is stored
+// as the next revision with the reason for it, the earlier ones are kept.
+type FrozenCountry struct {
+	Day       string    `json:"day"`
+	Revision  int       `json:"revision"`
+	Reason    string    `json:"reason"`
+	Country   *Country  `json:"country"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FrozenCountries []*FrozenCountry
+
+// Revision is the body of a correction to a frozen day.
+type Revision struct {
+	Reason  string   `json:"reason"`
+	Country *Country `json:"country"`
+}
+
+func (r *Revision) Prepare() {
+	r.Reason = html.EscapeString(strings.TrimSpace(r.Reason))
+	if r.Country != nil {
+		r.Country.Prepare()
+		for _, p := range r.Country.Provinces {
+			p.Prepare()
+		}
+	}
+}
+
+func (r *Revision) Validate() error {
+	if r.Reason == "" {
+		return errors.New("revision: reason is required")
+	}
+	if r.Country == nil {
+		return errors.New("revision: country is required")
+	}
+	if err := r.Country.Validate(); err != nil {
+		return err
+	}
+	for _, p := range r.Country.Provinces {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Repository
+type FreezeRepository interface {
+	// Freeze stores fc as revision 0 of its day, failing with errConflict
+	// when the day is frozen already.
+	Freeze(ctx context.Context, fc *FrozenCountry) error
+	// Revise stores fc as the next revision of a frozen day, failing with
+	// errNotFound when the day is not frozen.
+	Revise(ctx context.Context, fc *FrozenCountry) error
+	// Get returns the given revision of a day, the latest when revision is
+	// negative.
+	Get(ctx context.Context, countryID, day string, revision int) (*FrozenCountry, error)
+	Revisions(ctx context.Context, countryID, day string) (FrozenCountries, error)
+}
+
+type freezeRepo struct {
+	db *sql.DB
+}
+
+var _ FreezeRepository = &freezeRepo{}
+
+func NewFreezeRepo(db *sql.DB) *freezeRepo {
+	return &freezeRepo{db}
+}
+
+func (fr *freezeRepo) Freeze(ctx context.Context, fc *FrozenCountry) error {
+	fc.Revision = 0
+	return fr.insert(ctx, fr.db, fc)
+}
+
+func (fr *freezeRepo) Revise(ctx context.Context, fc *FrozenCountry) (err error) {
+	tx, err := fr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return wrapErr("country", fc.Country.ID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("country", fc.Country.ID, "commit", commitErr)
+			}
+			return
+		}
+		tx.Rollback()
+	}()
+
+	var latest sql.NullInt64
+	if err := squirrel.Select("MAX(revision)").
+		From("frozen_countries").
+		Where(squirrel.Eq{"country_id": fc.Country.ID, "day": fc.Day}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ScanContext(ctx, &latest); err != nil {
+		return wrapErr("country", fc.Country.ID, "select latest revision", err)
+	}
+	if !latest.Valid {
+		return wrapErr("country", fc.Country.ID, "select latest revision", errNotFound)
+	}
+	fc.Revision = int(latest.Int64) + 1
+	return fr.insert(ctx, tx, fc)
+}
+
+func (fr *freezeRepo) insert(ctx context.Context, runner squirrel.BaseRunner, fc *FrozenCountry) error {
+	figures, err := json.Marshal(fc.Country)
+	if err != nil {
+		return err
+	}
+	if _, err := squirrel.Insert("frozen_countries").
+		Columns("country_id", "day", "revision", "reason", "figures", "created_at").
+		Values(&fc.Country.ID, &fc.Day, &fc.Revision, &fc.Reason, figures, &fc.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx); err != nil {
+		return wrapErr("country", fc.Country.ID, "insert frozen country", err)
+	}
+	return nil
+}
+
+func (fr *freezeRepo) Get(ctx context.Context, countryID, day string, revision int) (*FrozenCountry, error) {
+	q := squirrel.Select("day", "revision", "reason", "figures", "created_at").
+		From("frozen_countries").
+		Where(squirrel.Eq{"country_id": countryID, "day": day})
+	if revision >= 0 {
+		q = q.Where(squirrel.Eq{"revision": revision})
+	}
+	row := q.OrderBy("revision DESC").
+		Limit(1).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(fr.db).QueryRowContext(ctx)
+	fc, err := scanFrozenCountry(row)
+	if err != nil {
+		return nil, wrapErr("country", countryID, "select frozen country", err)
+	}
+	return fc, nil
+}
+
+func (fr *freezeRepo) Revisions(ctx context.Context, countryID, day string) (FrozenCountries, error) {
+	rows, err := squirrel.Select("day", "revision", "reason", "figures", "created_at").
+		From("frozen_countries").
+		Where(squirrel.Eq{"country_id": countryID, "day": day}).
+		OrderBy("revision").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(fr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("country", countryID, "select frozen countries", err)
+	}
+	defer rows.Close()
+
+	var fcs = make(FrozenCountries, 0)
+	for rows.Next() {
+		fc, err := scanFrozenCountry(rows)
+		if err != nil {
+			return nil, wrapErr("country", countryID, "scan frozen countries", err)
+		}
+		fcs = append(fcs, fc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("country", countryID, "select frozen countries", err)
+	}
+	if len(fcs) == 0 {
+		return nil, wrapErr("country", countryID, "select frozen countries", errNotFound)
+	}
+	return fcs, nil
+}
+
+func scanFrozenCountry(row squirrel.RowScanner) (*FrozenCountry, error) {
+	var fc FrozenCountry
+	var day time.Time
+	var figures []byte
+	if err := row.Scan(&day, &fc.Revision, &fc.Reason, &figures, &fc.CreatedAt); err != nil {
+		return nil, err
+	}
+	fc.Day = day.Format(dateLayout)
+	if err := json.Unmarshal(figures, &fc.Country); err != nil {
+		return nil, err
+	}
+	return &fc, nil
+}
+
+// handler
+type freezeService struct {
+	fApp FreezeRepository
+	cApp CountryAppInterface
+}
+
+func NewFreezeService(fApp FreezeRepository, cApp CountryAppInterface) *freezeService {
+	return &freezeService{fApp: fApp, cApp: cApp}
+}
+
+func (fA *freezeService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// Freeze locks the figures a country currently publishes as those of the
+// day. Later edits of the country leave the frozen figures alone, they can
+// only be corrected through Revise.
+func (fA *freezeService) Freeze(c echo.Context) error {
+	day := c.Param("day")
+	if _, err := time.Parse(dateLayout, day); err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage("freeze: day must be formatted as YYYY-MM-DD"))
+	}
+
+	ctx := c.Request().Context()
+	ct, err := fA.cApp.GetByID(ctx, c.Param("country_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	fc := &FrozenCountry{Day: day, Country: ct, CreatedAt: time.Now()}
+	if err := fA.fApp.Freeze(ctx, fc); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*FrozenCountry{"frozen_country": fc})
+}
+
+func (fA *freezeService) Revise(c echo.Context) error {
+	day := c.Param("day")
+	if _, err := time.Parse(dateLayout, day); err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage("freeze: day must be formatted as YYYY-MM-DD"))
+	}
+	var r Revision
+	if err := c.Bind(&r); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, fA.errMessage("request: unable to parse request payload"))
+	}
+	r.Prepare()
+	if err := r.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage(err.Error()))
+	}
+	r.Country.ID = c.Param("country_id")
+
+	fc := &FrozenCountry{Day: day, Reason: r.Reason, Country: r.Country, CreatedAt: time.Now()}
+	if err := fA.fApp.Revise(c.Request().Context(), fc); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*FrozenCountry{"frozen_country": fc})
+}
+
+// FindFrozen returns the latest revision of a frozen day, or the one given
+// by ?revision=.
+func (fA *freezeService) FindFrozen(c echo.Context) error {
+	revision := -1
+	if v := c.QueryParam("revision"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, fA.errMessage("request: revision must be a non-negative integer"))
+		}
+		revision = n
+	}
+	if _, err := time.Parse(dateLayout, c.Param("day")); err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage("freeze: day must be formatted as YYYY-MM-DD"))
+	}
+	fc, err := fA.fApp.Get(c.Request().Context(), c.Param("country_id"), c.Param("day"), revision)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*FrozenCountry{"frozen_country": fc})
+}
+
+func (fA *freezeService) ListRevisions(c echo.Context) error {
+	if _, err := time.Parse(dateLayout, c.Param("day")); err != nil {
+		return c.JSON(http.StatusBadRequest, fA.errMessage("freeze: day must be formatted as YYYY-MM-DD"))
+	}
+	fcs, err := fA.fApp.Revisions(c.Request().Context(), c.Param("country_id"), c.Param("day"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, fA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]FrozenCountries{"frozen_countries": fcs})
+}
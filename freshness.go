@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// staleSubject is something that should have been updated by now.
+type staleSubject struct {
+	ID        string
+	Kind      string
+	Name      string
+	UpdatedAt time.Time
+}
+
+// freshnessCheck lists the subjects of one source last updated before
+// before, e.g. provinces or an external sync.
+type freshnessCheck func(ctx context.Context, before time.Time) ([]*staleSubject, error)
+
+// freshnessMonitor periodically alerts when data has not been updated within
+// window, through the notification center and optionally Slack, catching
+// silent pipeline failures before the public notices stale numbers.
+type freshnessMonitor struct {
+	window   time.Duration
+	interval time.Duration
+	checks   []freshnessCheck
+
+	notifications NotificationRepository
+	// slackURL is an incoming webhook, alerts are not sent to Slack when empty
+	slackURL string
+	client   *http.Client
+
+	mu sync.Mutex
+	// alerted remembers what was already reported so that a subject staying
+	// stale is reported once, and again once it was updated and went stale
+	alerted map[string]time.Time
+}
+
+func newFreshnessMonitor(window, interval time.Duration, notifications NotificationRepository, slackURL string, client *http.Client) *freshnessMonitor {
+	return &freshnessMonitor{
+		window:        window,
+		interval:      interval,
+		notifications: notifications,
+		slackURL:      slackURL,
+		client:        client,
+		alerted:       make(map[string]time.Time),
+	}
+}
+
+func (fm *freshnessMonitor) AddCheck(check freshnessCheck) {
+	fm.checks = append(fm.checks, check)
+}
+
+// Run checks every interval until ctx is done.
+func (fm *freshnessMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(fm.interval)
+	defer ticker.Stop()
+	for {
+		fm.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (fm *freshnessMonitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, fm.interval)
+	defer cancel()
+
+	before := time.Now().Add(-fm.window)
+	for _, check := range fm.checks {
+		subjects, err := check(ctx, before)
+		if err != nil {
+			logger.Error().Err(err).Msg("freshness: check failed")
+			continue
+		}
+		for _, s := range subjects {
+			if !fm.firstAlert(s) {
+				continue
+			}
+			if err := fm.alert(ctx, s); err != nil {
+				logger.Error().Err(err).Str(s.Kind+"_id", s.ID).Msg("freshness: failed to alert")
+			}
+		}
+	}
+}
+
+func (fm *freshnessMonitor) firstAlert(s *staleSubject) bool {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	key := s.Kind + ":" + s.ID
+	if last, ok := fm.alerted[key]; ok && last.Equal(s.UpdatedAt) {
+		return false
+	}
+	fm.alerted[key] = s.UpdatedAt
+	return true
+}
+
+func (fm *freshnessMonitor) alert(ctx context.Context, s *staleSubject) error {
+	n := NewNotification(NotificationStaleProvince, s.ID, "%s %s has not been updated since %s",
+		s.Kind, s.Name, s.UpdatedAt.Format(time.RFC3339))
+	if s.Kind != "province" {
+		n.Kind = "stale_" + s.Kind
+	}
+	if err := fm.notifications.Save(ctx, n); err != nil {
+		return err
+	}
+	if fm.slackURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{"text": n.Message})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fm.slackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := fm.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("freshness: slack answered %s", res.Status)
+	}
+	return nil
+}
+
+// staleProvinces is the freshness check of provinces.
+func staleProvinces(pApp ProvinceInterface) freshnessCheck {
+	return func(ctx context.Context, before time.Time) ([]*staleSubject, error) {
+		ps, err := pApp.GetUpdatedBefore(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+		subjects := make([]*staleSubject, 0, len(ps))
+		for _, p := range ps {
+			subjects = append(subjects, &staleSubject{ID: p.ID, Kind: "province", Name: p.Name, UpdatedAt: p.UpdatedAt})
+		}
+		return subjects, nil
+	}
+}
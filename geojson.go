@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const mimeGeoJSON = "application/geo+json"
+
+// checkCoordinates checks the coordinates of a province or a district, in
+// WGS 84 degrees, given both or neither.
+func checkCoordinates(entity string, lat, lng *float64) error {
+	if (lat == nil) != (lng == nil) {
+		return fmt.Errorf("%s: latitude and longitude are given together", entity)
+	}
+	if lat == nil {
+		return nil
+	}
+	if *lat < -90 || *lat > 90 {
+		return fmt.Errorf("%s: latitude must be between -90 and 90", entity)
+	}
+	if *lng < -180 || *lng > 180 {
+		return fmt.Errorf("%s: longitude must be between -180 and 180", entity)
+	}
+	return nil
+}
+
+// sameCoordinate tells whether next leaves the coordinate cur as it is,
+// coordinates left out being kept.
+func sameCoordinate(cur, next *float64) bool {
+	return next == nil || (cur != nil && *cur == *next)
+}
+
+// GeoJSON is a FeatureCollection of the provinces or districts placed on a
+// map, their figures as properties (RFC 7946).
+type GeoJSON struct {
+	Type     string        `json:"type"`
+	Features []*GeoFeature `json:"features"`
+}
+
+type GeoFeature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Geometry   *GeoPoint      `json:"geometry"`
+	Properties *GeoProperties `json:"properties"`
+}
+
+// GeoPoint is a point, its coordinates being longitude then latitude.
+type GeoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type GeoProperties struct {
+	Name string `json:"name"`
+	// ParentID is the country of a province, the province of a district.
+	ParentID       string    `json:"parent_id"`
+	Total          int64     `json:"total"`
+	NewCase        int64     `json:"new_case"`
+	Treated        int64     `json:"treaded"`
+	DecoveringCase int64     `json:"decovering_case"`
+	TestCase       int64     `json:"test_case"`
+	Dead           int64     `json:"dead"`
+	NegativeTest   int64     `json:"negative_case"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// the tables of the levels a map shows, with the column of their parent
+var geoLevels = map[string][2]string{
+	"province": {"provinces", "country_id"},
+	"district": {"districts", "province_id"},
+}
+
+// Repository
+type GeoRepository interface {
+	// Features returns the records of level, province or district, that have
+	// coordinates, those of parentID only when it is given.
+	Features(ctx context.Context, level, parentID string) ([]*GeoFeature, error)
+}
+
+type geoRepo struct {
+	db *sql.DB
+}
+
+var _ GeoRepository = &geoRepo{}
+
+func NewGeoRepo(db *sql.DB) *geoRepo {
+	return &geoRepo{db}
+}
+
+func (gr *geoRepo) Features(ctx context.Context, level, parentID string) ([]*GeoFeature, error) {
+	table, parentColumn := geoLevels[level][0], geoLevels[level][1]
+	stm := squirrel.Select("id",
+		"name",
+		parentColumn,
+		"latitude",
+		"longitude",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"updated_at").
+		From(table).
+		Where(squirrel.NotEq{"latitude": nil, "longitude": nil})
+	if parentID != "" {
+		stm = stm.Where(squirrel.Eq{parentColumn: parentID})
+	}
+	rows, err := stm.OrderBy("name", "id").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(gr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr(level, "", "select features", err)
+	}
+	defer rows.Close()
+
+	var features = make([]*GeoFeature, 0)
+	for rows.Next() {
+		f := &GeoFeature{
+			Type:       "Feature",
+			Geometry:   &GeoPoint{Type: "Point"},
+			Properties: &GeoProperties{},
+		}
+		p := f.Properties
+		if err := rows.Scan(&f.ID,
+			&p.Name,
+			&p.ParentID,
+			&f.Geometry.Coordinates[1],
+			&f.Geometry.Coordinates[0],
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&p.UpdatedAt); err != nil {
+			return nil, wrapErr(level, "", "scan features", err)
+		}
+		features = append(features, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(level, "", "select features", err)
+	}
+	return features, nil
+}
+
+// handler
+type geoService struct {
+	gApp GeoRepository
+	hApp HistoryRepository
+}
+
+func NewGeoService(gApp GeoRepository, hApp HistoryRepository) *geoService {
+	return &geoService{gApp: gApp, hApp: hApp}
+}
+
+func (gA *geoService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// featuresAsOf rebuilds the properties of features as they were at the
+// given time, features without history by then being left out.
+func (gA *geoService) featuresAsOf(ctx context.Context, level string, features []*GeoFeature, at time.Time) ([]*GeoFeature, error) {
+	ids := make([]string, len(features))
+	for i, f := range features {
+		ids[i] = f.ID
+	}
+	points, err := gA.hApp.AsOf(ctx, level, ids, at)
+	if err != nil {
+		return nil, err
+	}
+	past := make([]*GeoFeature, 0, len(features))
+	for _, f := range features {
+		hp, ok := points[f.ID]
+		if !ok {
+			continue
+		}
+		old, props := *f, *f.Properties
+		setHistoryFigures(hp, &props.Total, &props.NewCase, &props.Treated, &props.DecoveringCase, &props.TestCase, &props.Dead, &props.NegativeTest)
+		props.UpdatedAt = hp.RecordedAt
+		old.Properties = &props
+		past = append(past, &old)
+	}
+	return past, nil
+}
+
+// GeoJSON answers the provinces, or with ?level=district the districts,
+// that have coordinates as a GeoJSON FeatureCollection of points, for maps
+// to be drawn from it directly. ?parent_id= keeps those of one country, or
+// of one province.
+func (gA *geoService) GeoJSON(c echo.Context) error {
+	level := c.QueryParam("level")
+	if level == "" {
+		level = "province"
+	}
+	if _, ok := geoLevels[level]; !ok {
+		return c.JSON(http.StatusBadRequest, gA.errMessage("request: level must be province or district"))
+	}
+	features, err := gA.gApp.Features(c.Request().Context(), level, c.QueryParam("parent_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, gA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		if features, err = gA.featuresAsOf(c.Request().Context(), level, features, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, gA.errMessage(msg))
+		}
+	}
+
+	keys := make([]string, len(features))
+	for i, f := range features {
+		if level == "district" {
+			keys[i] = districtKey(f.ID)
+		} else {
+			keys[i] = provinceKey(f.ID)
+		}
+	}
+	setCacheTags(c, keys...)
+	data, err := json.Marshal(&GeoJSON{Type: "FeatureCollection", Features: features})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, gA.errMessage("Internal server error"))
+	}
+	return c.Blob(http.StatusOK, mimeGeoJSON+"; charset=utf-8", data)
+}
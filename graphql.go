@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	country(id: ID!): Country
+	countries(page: Int = 1, limit: Int = 50): [Country!]!
+	province(id: ID!): Province
+	district(id: ID!): District
+}
+
+type Mutation {
+	updateProvince(id: ID!, input: FiguresInput!): Province!
+	updateDistrict(id: ID!, input: FiguresInput!): District!
+}
+
+input FiguresInput {
+	name: String!
+	total: Int!
+	newCase: Int!
+	treated: Int!
+	decoveringCase: Int!
+	testCase: Int!
+	dead: Int!
+	negativeCase: Int!
+}
+
+type Country {
+	id: ID!
+	name: String!
+	total: Int!
+	newCase: Int!
+	treated: Int!
+	decoveringCase: Int!
+	testCase: Int!
+	dead: Int!
+	negativeCase: Int!
+	updatedAt: String!
+	provinces(ids: [ID!], minTotal: Int, first: Int): [Province!]!
+}
+
+type Province {
+	id: ID!
+	name: String!
+	total: Int!
+	newCase: Int!
+	treated: Int!
+	decoveringCase: Int!
+	testCase: Int!
+	dead: Int!
+	negativeCase: Int!
+	updatedAt: String!
+	districts(ids: [ID!], minTotal: Int, first: Int): [District!]!
+}
+
+type District {
+	id: ID!
+	provinceId: ID!
+	name: String!
+	total: Int!
+	newCase: Int!
+	treated: Int!
+	decoveringCase: Int!
+	testCase: Int!
+	dead: Int!
+	negativeCase: Int!
+	updatedAt: String!
+}
+`
+
+var errInvalidPage = fmt.Errorf("graphql: page must be positive and limit between 1 and %d", maxCountryLimit)
+
+// graphqlResolver serves /graphql from the same repositories as the REST
+// routes. GraphQL integers are 32 bits, which case counts fit in.
+type graphqlResolver struct {
+	countries CountryAppInterface
+	provinces ProvinceInterface
+	districts DistrictInterface
+	changes   *changeHub
+}
+
+func newGraphQLSchema(r *graphqlResolver) *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, r)
+}
+
+// filterArgs narrows the provinces of a country or the districts of a
+// province down. They are ordered by total already.
+type filterArgs struct {
+	IDs      *[]graphql.ID
+	MinTotal *int32
+	First    *int32
+}
+
+func (f filterArgs) keep(id string, total int64) bool {
+	if f.MinTotal != nil && total < int64(*f.MinTotal) {
+		return false
+	}
+	if f.IDs == nil {
+		return true
+	}
+	for _, v := range *f.IDs {
+		if string(v) == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (f filterArgs) full(n int) bool {
+	return f.First != nil && n >= int(*f.First)
+}
+
+type figuresInput struct {
+	Name           string
+	Total          int32
+	NewCase        int32
+	Treated        int32
+	DecoveringCase int32
+	TestCase       int32
+	Dead           int32
+	NegativeCase   int32
+}
+
+func (r *graphqlResolver) Country(ctx context.Context, args struct{ ID graphql.ID }) (*countryResolver, error) {
+	c, err := r.countries.GetByID(ctx, string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	return &countryResolver{r, c}, nil
+}
+
+func (r *graphqlResolver) Countries(ctx context.Context, args struct{ Page, Limit int32 }) ([]*countryResolver, error) {
+	if args.Page < 1 || args.Limit < 1 || args.Limit > maxCountryLimit {
+		return nil, errInvalidPage
+	}
+	cs, err := r.countries.List(ctx, uint64(args.Page), uint64(args.Limit))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*countryResolver, len(cs))
+	for i, c := range cs {
+		res[i] = &countryResolver{r, c}
+	}
+	return res, nil
+}
+
+func (r *graphqlResolver) Province(ctx context.Context, args struct{ ID graphql.ID }) (*provinceResolver, error) {
+	p, err := r.provinces.GetByID(ctx, string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	return &provinceResolver{r, p}, nil
+}
+
+func (r *graphqlResolver) District(ctx context.Context, args struct{ ID graphql.ID }) (*districtResolver, error) {
+	d, err := r.districts.GetByID(ctx, string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	return &districtResolver{d}, nil
+}
+
+// UpdateProvince goes through the same validation and bookkeeping as
+// PUT /api/v1/province/:province_id.
+func (r *graphqlResolver) UpdateProvince(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input figuresInput
+}) (*provinceResolver, error) {
+	if err := authorizeProvince(ctx, string(args.ID)); err != nil {
+		return nil, err
+	}
+	current, err := r.provinces.GetByID(forWrite(ctx), string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	in := args.Input
+	p := &Province{
+		ID:             current.ID,
+		Name:           in.Name,
+		Total:          int64(in.Total),
+		NewCase:        int64(in.NewCase),
+		Treated:        int64(in.Treated),
+		DecoveringCase: int64(in.DecoveringCase),
+		TestCase:       int64(in.TestCase),
+		Dead:           int64(in.Dead),
+		NegativeTest:   int64(in.NegativeCase),
+		Attributes:     current.Attributes,
+		Districts:      current.Districts,
+		Metrics:        current.Metrics,
+	}
+	p.Prepare()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if current.Equal(p) {
+		return &provinceResolver{r, current}, nil
+	}
+
+	p.UpdatedAt = time.Now()
+	if err := r.provinces.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	r.changes.Publish(provinceKey(p.ID))
+	if err := keepOldName(ctx, r.provinces, current, p); err != nil {
+		return nil, err
+	}
+	return &provinceResolver{r, p}, nil
+}
+
+// UpdateDistrict goes through the same validation as
+// PUT /api/v1/district/:district_id.
+func (r *graphqlResolver) UpdateDistrict(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input figuresInput
+}) (*districtResolver, error) {
+	if err := authorize(ctx, RoleEditor); err != nil {
+		return nil, err
+	}
+	current, err := r.districts.GetByID(forWrite(ctx), string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeProvince(ctx, current.ProvinceID); err != nil {
+		return nil, err
+	}
+	in := args.Input
+	d := &District{
+		ID:             current.ID,
+		ProvinceID:     current.ProvinceID,
+		Name:           in.Name,
+		Total:          int64(in.Total),
+		NewCase:        int64(in.NewCase),
+		Treated:        int64(in.Treated),
+		DecoveringCase: int64(in.DecoveringCase),
+		TestCase:       int64(in.TestCase),
+		Dead:           int64(in.Dead),
+		NegativeTest:   int64(in.NegativeCase),
+		Attributes:     current.Attributes,
+	}
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	if current.Equal(d) {
+		return &districtResolver{current}, nil
+	}
+
+	d.UpdatedAt = time.Now()
+	if err := r.districts.Update(ctx, d); err != nil {
+		return nil, err
+	}
+	r.changes.Publish(districtKey(d.ID), provinceKey(d.ProvinceID))
+	return &districtResolver{d}, nil
+}
+
+type countryResolver struct {
+	r *graphqlResolver
+	c *Country
+}
+
+func (cr *countryResolver) ID() graphql.ID        { return graphql.ID(cr.c.ID) }
+func (cr *countryResolver) Name() string          { return cr.c.Name }
+func (cr *countryResolver) Total() int32          { return int32(cr.c.Total) }
+func (cr *countryResolver) NewCase() int32        { return int32(cr.c.NewCase) }
+func (cr *countryResolver) Treated() int32        { return int32(cr.c.Treated) }
+func (cr *countryResolver) DecoveringCase() int32 { return int32(cr.c.DecoveringCase) }
+func (cr *countryResolver) TestCase() int32       { return int32(cr.c.TestCase) }
+func (cr *countryResolver) Dead() int32           { return int32(cr.c.Dead) }
+func (cr *countryResolver) NegativeCase() int32   { return int32(cr.c.NegativeTest) }
+func (cr *countryResolver) UpdatedAt() string     { return cr.c.UpdatedAt.Format(time.RFC3339Nano) }
+
+// Provinces loads the provinces of countries coming from a list, which
+// are listed without them.
+func (cr *countryResolver) Provinces(ctx context.Context, args filterArgs) ([]*provinceResolver, error) {
+	if cr.c.Provinces == nil {
+		c, err := cr.r.countries.GetByID(ctx, cr.c.ID)
+		if err != nil {
+			return nil, err
+		}
+		cr.c = c
+	}
+	res := make([]*provinceResolver, 0, len(cr.c.Provinces))
+	for _, p := range cr.c.Provinces {
+		if args.full(len(res)) {
+			break
+		}
+		if args.keep(p.ID, p.Total) {
+			res = append(res, &provinceResolver{cr.r, p})
+		}
+	}
+	return res, nil
+}
+
+type provinceResolver struct {
+	r *graphqlResolver
+	p *Province
+}
+
+func (pr *provinceResolver) ID() graphql.ID        { return graphql.ID(pr.p.ID) }
+func (pr *provinceResolver) Name() string          { return pr.p.Name }
+func (pr *provinceResolver) Total() int32          { return int32(pr.p.Total) }
+func (pr *provinceResolver) NewCase() int32        { return int32(pr.p.NewCase) }
+func (pr *provinceResolver) Treated() int32        { return int32(pr.p.Treated) }
+func (pr *provinceResolver) DecoveringCase() int32 { return int32(pr.p.DecoveringCase) }
+func (pr *provinceResolver) TestCase() int32       { return int32(pr.p.TestCase) }
+func (pr *provinceResolver) Dead() int32           { return int32(pr.p.Dead) }
+func (pr *provinceResolver) NegativeCase() int32   { return int32(pr.p.NegativeTest) }
+func (pr *provinceResolver) UpdatedAt() string     { return pr.p.UpdatedAt.Format(time.RFC3339Nano) }
+
+// Districts loads the districts of provinces coming with a country, which
+// are read without them.
+func (pr *provinceResolver) Districts(ctx context.Context, args filterArgs) ([]*districtResolver, error) {
+	if pr.p.Districts == nil {
+		ds, err := pr.r.districts.GetAllByProvince(ctx, pr.p.ID)
+		if err != nil {
+			return nil, err
+		}
+		pr.p.Districts = ds
+	}
+	res := make([]*districtResolver, 0, len(pr.p.Districts))
+	for _, d := range pr.p.Districts {
+		if args.full(len(res)) {
+			break
+		}
+		if args.keep(d.ID, d.Total) {
+			res = append(res, &districtResolver{d})
+		}
+	}
+	return res, nil
+}
+
+type districtResolver struct {
+	d *District
+}
+
+func (dr *districtResolver) ID() graphql.ID         { return graphql.ID(dr.d.ID) }
+func (dr *districtResolver) ProvinceID() graphql.ID { return graphql.ID(dr.d.ProvinceID) }
+func (dr *districtResolver) Name() string           { return dr.d.Name }
+func (dr *districtResolver) Total() int32           { return int32(dr.d.Total) }
+func (dr *districtResolver) NewCase() int32         { return int32(dr.d.NewCase) }
+func (dr *districtResolver) Treated() int32         { return int32(dr.d.Treated) }
+func (dr *districtResolver) DecoveringCase() int32  { return int32(dr.d.DecoveringCase) }
+func (dr *districtResolver) TestCase() int32        { return int32(dr.d.TestCase) }
+func (dr *districtResolver) Dead() int32            { return int32(dr.d.Dead) }
+func (dr *districtResolver) NegativeCase() int32    { return int32(dr.d.NegativeTest) }
+func (dr *districtResolver) UpdatedAt() string      { return dr.d.UpdatedAt.Format(time.RFC3339Nano) }
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phuangpheth/covid19/covid19pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves proto/covid19.proto for internal consumers from the same
+// repositories as the HTTP API, writes going through the same authorization
+// and validation.
+type grpcServer struct {
+	covid19pb.UnimplementedCovid19Server
+
+	countries CountryRepository
+	provinces ProvinceRepository
+	districts DistrictRepository
+	changes   *changeHub
+}
+
+var _ covid19pb.Covid19Server = &grpcServer{}
+
+// grpcDeadline gives calls arriving without a deadline one of timeout, as
+// requestDeadline does for HTTP.
+func grpcDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcWrite tells whether a call is one of the Update calls.
+func grpcWrite(info *grpc.UnaryServerInfo) bool {
+	return strings.HasPrefix(info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:], "Update")
+}
+
+// grpcAuthenticate reads the x-api-key or authorization metadata of calls
+// into their context as Authenticate does the headers of HTTP requests, calls
+// without either going on anonymously. The Update calls count against the
+// write quota of a team key.
+func grpcAuthenticate(aA *authService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !aA.Enabled() {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		id := &identity{}
+		if keys := md.Get(strings.ToLower(headerAPIKey)); len(keys) > 0 && keys[0] != "" {
+			var err error
+			if strings.HasPrefix(keys[0], developerKeyPrefix) {
+				id, err = aA.developerIdentity(ctx, keys[0])
+			} else {
+				id, err = aA.keyIdentity(ctx, keys[0], grpcWrite(info), http.Header{})
+			}
+			if err != nil {
+				return nil, grpcError(err)
+			}
+		} else if hs := md.Get("authorization"); len(hs) > 0 && hs[0] != "" {
+			claims, err := aA.bearerClaims(hs[0])
+			if err != nil {
+				return nil, grpcError(err)
+			}
+			id.claims = claims
+		}
+		return handler(context.WithValue(ctx, identityKey{}, id), req)
+	}
+}
+
+// grpcEmbargo refuses the Get and List calls of callers under embargo, which
+// only show the current figures.
+func grpcEmbargo(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if _, ok := embargoAt(ctx, time.Now()); ok && !grpcWrite(info) {
+		return nil, grpcError(errEmbargoed)
+	}
+	return handler(ctx, req)
+}
+
+// grpcJournal records the Update calls in the request journal as the PUT
+// requests doing the same over HTTP, for them to be replayed with the rest.
+func grpcJournal(jApp JournalRepository) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		res, err := handler(ctx, req)
+		var path string
+		var body interface{}
+		switch r := req.(type) {
+		case *covid19pb.UpdateCountryRequest:
+			c := &Country{Name: r.GetName()}
+			setFigures(r.GetFigures(), &c.Total, &c.NewCase, &c.Treated, &c.DecoveringCase, &c.TestCase, &c.Dead, &c.NegativeTest)
+			path, body = "/api/v1/country/"+r.GetId(), c
+		case *covid19pb.UpdateProvinceRequest:
+			p := &Province{Name: r.GetName()}
+			setFigures(r.GetFigures(), &p.Total, &p.NewCase, &p.Treated, &p.DecoveringCase, &p.TestCase, &p.Dead, &p.NegativeTest)
+			path, body = "/api/v1/province/"+r.GetId(), p
+		case *covid19pb.UpdateDistrictRequest:
+			d := &District{Name: r.GetName()}
+			setFigures(r.GetFigures(), &d.Total, &d.NewCase, &d.Treated, &d.DecoveringCase, &d.TestCase, &d.Dead, &d.NegativeTest)
+			// the call keeps the province of the district, which PUT takes
+			if rd, ok := res.(*covid19pb.District); ok {
+				d.ProvinceID = rd.GetProvinceId()
+			}
+			path, body = "/api/v1/district/"+r.GetId(), d
+		default:
+			return res, err
+		}
+
+		b, _ := json.Marshal(body)
+		e := &JournalEntry{
+			Method:     http.MethodPut,
+			Path:       path,
+			Body:       string(b),
+			Actor:      actorOf(ctx),
+			Status:     grpcHTTPStatus(err),
+			RecordedAt: time.Now(),
+		}
+		saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if saveErr := jApp.Save(saveCtx, e); saveErr != nil {
+			logFor(ctx).Error().Err(saveErr).Msg("journal: failed to record")
+		}
+		return res, err
+	}
+}
+
+// grpcHTTPStatus is the HTTP status of the outcome of a call, for the journal.
+func grpcHTTPStatus(err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusUnprocessableEntity
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcError maps an error returned by a repository to a gRPC status the same
+// way errorStatus does for HTTP.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		return status.Error(codes.Unauthenticated, errUnauthenticated.Error())
+	case errors.Is(err, errForbidden):
+		return status.Error(codes.PermissionDenied, errForbidden.Error())
+	case errors.Is(err, errQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, errQuotaExceeded.Error())
+	case errors.Is(err, errEmbargoed):
+		return status.Error(codes.PermissionDenied, errEmbargoed.Error())
+	case errors.Is(err, errNotFound):
+		return status.Error(codes.NotFound, errNotFound.Error())
+	case errors.Is(err, errConflict):
+		return status.Error(codes.AlreadyExists, errConflict.Error())
+	case errors.Is(err, errInvalidReference):
+		return status.Error(codes.FailedPrecondition, errInvalidReference.Error())
+	case errors.Is(err, errSerialization):
+		return status.Error(codes.Aborted, errSerialization.Error())
+	}
+	return status.Error(codes.Internal, "Internal server error")
+}
+
+func (s *grpcServer) GetCountry(ctx context.Context, req *covid19pb.GetCountryRequest) (*covid19pb.Country, error) {
+	c, err := s.countries.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return countryToProto(c), nil
+}
+
+func (s *grpcServer) ListCountries(ctx context.Context, req *covid19pb.ListCountriesRequest) (*covid19pb.ListCountriesResponse, error) {
+	page, limit := req.GetPage(), req.GetLimit()
+	if page == 0 {
+		page = 1
+	}
+	if limit == 0 {
+		limit = defaultCountryLimit
+	}
+	if limit > maxCountryLimit {
+		return nil, status.Error(codes.InvalidArgument, errInvalidPage.Error())
+	}
+	cs, err := s.countries.List(ctx, page, limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &covid19pb.ListCountriesResponse{Countries: make([]*covid19pb.Country, len(cs))}
+	for i, c := range cs {
+		res.Countries[i] = countryToProto(c)
+	}
+	return res, nil
+}
+
+// UpdateCountry goes through the same authorization and validation as
+// PUT /api/v1/country/:country_id, leaving the provinces alone.
+func (s *grpcServer) UpdateCountry(ctx context.Context, req *covid19pb.UpdateCountryRequest) (*covid19pb.Country, error) {
+	current, err := s.countries.GetByID(forWrite(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := authorizeCountry(ctx, current.ID); err != nil {
+		return nil, grpcError(err)
+	}
+	c := &Country{
+		ID:         current.ID,
+		Name:       req.GetName(),
+		Provinces:  current.Provinces,
+		Metrics:    current.Metrics,
+		Attributes: current.Attributes,
+	}
+	setFigures(req.GetFigures(), &c.Total, &c.NewCase, &c.Treated, &c.DecoveringCase, &c.TestCase, &c.Dead, &c.NegativeTest)
+	c.Prepare()
+	if err := c.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if current.Equal(c) {
+		return countryToProto(current), nil
+	}
+
+	c.UpdatedAt = time.Now()
+	if err := s.countries.Update(ctx, c); err != nil {
+		return nil, grpcError(err)
+	}
+	s.changes.Publish(countryKey(c.ID))
+	return countryToProto(c), nil
+}
+
+func (s *grpcServer) GetProvince(ctx context.Context, req *covid19pb.GetProvinceRequest) (*covid19pb.Province, error) {
+	p, err := s.provinces.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return provinceToProto(p), nil
+}
+
+func (s *grpcServer) ListProvinces(ctx context.Context, req *covid19pb.ListProvincesRequest) (*covid19pb.ListProvincesResponse, error) {
+	ps, err := s.provinces.GetAll(ctx, nil)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &covid19pb.ListProvincesResponse{Provinces: make([]*covid19pb.Province, len(ps))}
+	for i, p := range ps {
+		res.Provinces[i] = provinceToProto(p)
+	}
+	return res, nil
+}
+
+// UpdateProvince goes through the same authorization and validation as
+// PUT /api/v1/province/:province_id.
+func (s *grpcServer) UpdateProvince(ctx context.Context, req *covid19pb.UpdateProvinceRequest) (*covid19pb.Province, error) {
+	if err := authorizeProvince(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	current, err := s.provinces.GetByID(forWrite(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	p := &Province{
+		ID:         current.ID,
+		Name:       req.GetName(),
+		Districts:  current.Districts,
+		Metrics:    current.Metrics,
+		Attributes: current.Attributes,
+	}
+	setFigures(req.GetFigures(), &p.Total, &p.NewCase, &p.Treated, &p.DecoveringCase, &p.TestCase, &p.Dead, &p.NegativeTest)
+	p.Prepare()
+	if err := p.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if current.Equal(p) {
+		return provinceToProto(current), nil
+	}
+
+	p.UpdatedAt = time.Now()
+	if err := s.provinces.Update(ctx, p); err != nil {
+		return nil, grpcError(err)
+	}
+	s.changes.Publish(provinceKey(p.ID))
+	if err := keepOldName(ctx, s.provinces, current, p); err != nil {
+		return nil, grpcError(err)
+	}
+	return provinceToProto(p), nil
+}
+
+func (s *grpcServer) GetDistrict(ctx context.Context, req *covid19pb.GetDistrictRequest) (*covid19pb.District, error) {
+	d, err := s.districts.GetByID(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return districtToProto(d), nil
+}
+
+func (s *grpcServer) ListDistricts(ctx context.Context, req *covid19pb.ListDistrictsRequest) (*covid19pb.ListDistrictsResponse, error) {
+	ds, err := s.districts.GetAllByProvince(ctx, req.GetProvinceId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &covid19pb.ListDistrictsResponse{Districts: make([]*covid19pb.District, len(ds))}
+	for i, d := range ds {
+		res.Districts[i] = districtToProto(d)
+	}
+	return res, nil
+}
+
+// UpdateDistrict goes through the same authorization and validation as
+// PUT /api/v1/district/:district_id.
+func (s *grpcServer) UpdateDistrict(ctx context.Context, req *covid19pb.UpdateDistrictRequest) (*covid19pb.District, error) {
+	if err := authorize(ctx, RoleEditor); err != nil {
+		return nil, grpcError(err)
+	}
+	current, err := s.districts.GetByID(forWrite(ctx), req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := authorizeProvince(ctx, current.ProvinceID); err != nil {
+		return nil, grpcError(err)
+	}
+	d := &District{
+		ID:         current.ID,
+		ProvinceID: current.ProvinceID,
+		Name:       req.GetName(),
+		Attributes: current.Attributes,
+	}
+	setFigures(req.GetFigures(), &d.Total, &d.NewCase, &d.Treated, &d.DecoveringCase, &d.TestCase, &d.Dead, &d.NegativeTest)
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if current.Equal(d) {
+		return districtToProto(current), nil
+	}
+
+	d.UpdatedAt = time.Now()
+	if err := s.districts.Update(ctx, d); err != nil {
+		return nil, grpcError(err)
+	}
+	s.changes.Publish(districtKey(d.ID), provinceKey(d.ProvinceID))
+	return districtToProto(d), nil
+}
+
+func figuresToProto(total, newCase, treated, decoveringCase, testCase, dead, negativeCase int64) *covid19pb.Figures {
+	return &covid19pb.Figures{
+		Total:          total,
+		NewCase:        newCase,
+		Treated:        treated,
+		DecoveringCase: decoveringCase,
+		TestCase:       testCase,
+		Dead:           dead,
+		NegativeCase:   negativeCase,
+	}
+}
+
+// setFigures copies f into the figures of a model, a missing f zeroes them
+// like a JSON payload without them does.
+func setFigures(f *covid19pb.Figures, total, newCase, treated, decoveringCase, testCase, dead, negativeCase *int64) {
+	*total = f.GetTotal()
+	*newCase = f.GetNewCase()
+	*treated = f.GetTreated()
+	*decoveringCase = f.GetDecoveringCase()
+	*testCase = f.GetTestCase()
+	*dead = f.GetDead()
+	*negativeCase = f.GetNegativeCase()
+}
+
+func countryToProto(c *Country) *covid19pb.Country {
+	pc := &covid19pb.Country{
+		Id:        c.ID,
+		Name:      c.Name,
+		Figures:   figuresToProto(c.Total, c.NewCase, c.Treated, c.DecoveringCase, c.TestCase, c.Dead, c.NegativeTest),
+		Provinces: make([]*covid19pb.Province, len(c.Provinces)),
+		UpdatedAt: timestamppb.New(c.UpdatedAt),
+	}
+	for i, p := range c.Provinces {
+		pc.Provinces[i] = provinceToProto(p)
+	}
+	return pc
+}
+
+func provinceToProto(p *Province) *covid19pb.Province {
+	pp := &covid19pb.Province{
+		Id:        p.ID,
+		Name:      p.Name,
+		Figures:   figuresToProto(p.Total, p.NewCase, p.Treated, p.DecoveringCase, p.TestCase, p.Dead, p.NegativeTest),
+		Districts: make([]*covid19pb.District, len(p.Districts)),
+		UpdatedAt: timestamppb.New(p.UpdatedAt),
+	}
+	for i, d := range p.Districts {
+		pp.Districts[i] = districtToProto(d)
+	}
+	return pp
+}
+
+func districtToProto(d *District) *covid19pb.District {
+	return &covid19pb.District{
+		Id:         d.ID,
+		ProvinceId: d.ProvinceID,
+		Name:       d.Name,
+		Figures:    figuresToProto(d.Total, d.NewCase, d.Treated, d.DecoveringCase, d.TestCase, d.Dead, d.NegativeTest),
+		UpdatedAt:  timestamppb.New(d.UpdatedAt),
+	}
+}
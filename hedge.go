@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// writeReadKey marks the context of the reads a write is checked against.
+type writeReadKey struct{}
+
+// forWrite marks ctx for reading what a write compares to, its If-Match
+// precondition and whether it changes anything at all. Such reads go to the
+// primary, a lagging replica letting lost updates through and skipping
+// writes that do change something.
+func forWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeReadKey{}, true)
+}
+
+// readsForWrite reports whether ctx was marked by forWrite.
+func readsForWrite(ctx context.Context) bool {
+	v, _ := ctx.Value(writeReadKey{}).(bool)
+	return v
+}
+
+type readFunc func(ctx context.Context, db *sql.DB) (interface{}, error)
+
+type readResult struct {
+	v   interface{}
+	err error
+}
+
+// hedgedRead runs read against the replica and, when the replica has not
+// answered within after, against the primary as well, returning whichever
+// succeeds first. A failed replica read, including a not found that may just
+// be replication lag, falls back to the primary straight away.
+//
+// Without a replica, or for a write, the read goes to the primary, and with a
+// zero after it is never hedged.
+func hedgedRead(ctx context.Context, primary, replica *sql.DB, after time.Duration, read readFunc) (interface{}, error) {
+	if replica == nil || readsForWrite(ctx) {
+		return read(ctx, primary)
+	}
+	if after <= 0 {
+		return read(ctx, replica)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan readResult, 2)
+	run := func(db *sql.DB) {
+		v, err := read(ctx, db)
+		results <- readResult{v, err}
+	}
+
+	go run(replica)
+	pending, hedged := 1, false
+	hedge := func() {
+		hedged = true
+		pending++
+		go run(primary)
+	}
+
+	timer := time.NewTimer(after)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedge()
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.v, nil
+			}
+			lastErr = r.err
+			if !hedged {
+				hedge()
+				continue
+			}
+			if pending == 0 {
+				return nil, lastErr
+			}
+		}
+	}
+}
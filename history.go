@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// HistoryPoint is the figures of a country, province or district at the end
+// of a day they changed on. Days without a change have no point.
+type HistoryPoint struct {
+	Day            string    `json:"day"`
+	Total          int64     `json:"total"`
+	NewCase        int64     `json:"new_case"`
+	Treated        int64     `json:"treaded"`
+	DecoveringCase int64     `json:"decovering_case"`
+	TestCase       int64     `json:"test_case"`
+	Dead           int64     `json:"dead"`
+	NegativeTest   int64     `json:"negative_case"`
+	RecordedAt     time.Time `json:"recorded_at"`
+}
+
+type History []*HistoryPoint
+
+// HistoryRecord is a point of the history of an entity, among those of other
+// entities.
+type HistoryRecord struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	*HistoryPoint
+}
+
+// Repository
+type HistoryRepository interface {
+	// Get returns the history of the entity of kind country, province or
+	// district with the given id, oldest first.
+	Get(ctx context.Context, kind, id string, from, to time.Time) (History, error)
+	// AsOf returns the latest point recorded by at of each of the entities of
+	// kind with the given ids, by id. Entities without one are left out.
+	AsOf(ctx context.Context, kind string, ids []string, at time.Time) (map[string]*HistoryPoint, error)
+	// Range returns the history of every entity of kind between from and to,
+	// by id and then oldest first.
+	Range(ctx context.Context, kind string, from, to time.Time) ([]*HistoryRecord, error)
+}
+
+type historyRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ HistoryRepository = &historyRepo{}
+
+func NewHistoryRepo(db *sql.DB, dialect migrations.Dialect) *historyRepo {
+	return &historyRepo{db: db, dialect: dialect}
+}
+
+func (hr *historyRepo) Get(ctx context.Context, kind, id string, from, to time.Time) (History, error) {
+	rows, err := squirrel.Select("day",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"recorded_at").
+		From("case_history").
+		Where(squirrel.Eq{"kind": kind, "entity_id": id}).
+		Where(squirrel.GtOrEq{"day": from}).
+		Where(squirrel.LtOrEq{"day": to}).
+		OrderBy("day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr(kind, id, "select history", err)
+	}
+	defer rows.Close()
+
+	var h = make(History, 0)
+	for rows.Next() {
+		var p HistoryPoint
+		var day time.Time
+		if err := rows.Scan(&day,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&p.RecordedAt); err != nil {
+			return nil, wrapErr(kind, id, "scan history", err)
+		}
+		p.Day = day.Format(dateLayout)
+		h = append(h, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(kind, id, "select history", err)
+	}
+	return h, nil
+}
+
+func (hr *historyRepo) AsOf(ctx context.Context, kind string, ids []string, at time.Time) (map[string]*HistoryPoint, error) {
+	figures := []string{"total", "new_case", "treated", "decovering_case", "test_case", "dead", "negative_case", "recorded_at"}
+	stm := squirrel.Select(append([]string{"DISTINCT ON (entity_id) entity_id", "day"}, figures...)...).
+		OrderBy("entity_id", "day DESC")
+	if hr.dialect == migrations.SQLite {
+		// the other columns of a group are those of the row MAX picks
+		stm = squirrel.Select(append([]string{"entity_id", "MAX(day)"}, figures...)...).
+			GroupBy("entity_id")
+	}
+	rows, err := stm.From("case_history").
+		Where(squirrel.Eq{"kind": kind, "entity_id": ids}).
+		Where(squirrel.LtOrEq{"recorded_at": at}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr(kind, "", "select history as of", err)
+	}
+	defer rows.Close()
+
+	points := make(map[string]*HistoryPoint, len(ids))
+	for rows.Next() {
+		var id string
+		var p HistoryPoint
+		var day time.Time
+		if err := rows.Scan(&id,
+			&day,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&p.RecordedAt); err != nil {
+			return nil, wrapErr(kind, "", "scan history as of", err)
+		}
+		p.Day = day.Format(dateLayout)
+		points[id] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(kind, "", "select history as of", err)
+	}
+	return points, nil
+}
+
+func (hr *historyRepo) Range(ctx context.Context, kind string, from, to time.Time) ([]*HistoryRecord, error) {
+	rows, err := squirrel.Select("entity_id",
+		"day",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"recorded_at").
+		From("case_history").
+		Where(squirrel.Eq{"kind": kind}).
+		Where(squirrel.GtOrEq{"day": from}).
+		Where(squirrel.LtOrEq{"day": to}).
+		OrderBy("entity_id", "day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr(kind, "", "select history range", err)
+	}
+	defer rows.Close()
+
+	var records = make([]*HistoryRecord, 0)
+	for rows.Next() {
+		r := HistoryRecord{Kind: kind, HistoryPoint: &HistoryPoint{}}
+		var day time.Time
+		if err := rows.Scan(&r.ID,
+			&day,
+			&r.Total,
+			&r.NewCase,
+			&r.Treated,
+			&r.DecoveringCase,
+			&r.TestCase,
+			&r.Dead,
+			&r.NegativeTest,
+			&r.RecordedAt); err != nil {
+			return nil, wrapErr(kind, "", "scan history range", err)
+		}
+		r.Day = day.Format(dateLayout)
+		records = append(records, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr(kind, "", "select history range", err)
+	}
+	return records, nil
+}
+
+// parseAsOf reads ?as_of=, a day meaning the end of that day in UTC.
+func parseAsOf(v string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, v); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, errors.New("request: as_of must be formatted as YYYY-MM-DD or RFC 3339")
+	}
+	return t, nil
+}
+
+// countryAsOf rebuilds country as it was at the given time from the history
+// of its figures and of its current provinces, provinces without history by
+// then being left out. History only keeps the last figures of each day, so a
+// time within a day a change happened on shows the day before. Names and
+// attributes are not versioned and are the current ones, metrics are dropped.
+func countryAsOf(ctx context.Context, hApp HistoryRepository, country *Country, at time.Time) (*Country, error) {
+	points, err := hApp.AsOf(ctx, "country", []string{country.ID}, at)
+	if err != nil {
+		return nil, err
+	}
+	cp, ok := points[country.ID]
+	if !ok {
+		return nil, wrapErr("country", country.ID, "history as of", errNotFound)
+	}
+	past := *country
+	past.Metrics = nil
+	setHistoryFigures(cp, &past.Total, &past.NewCase, &past.Treated, &past.DecoveringCase, &past.TestCase, &past.Dead, &past.NegativeTest)
+	past.UpdatedAt = cp.RecordedAt
+
+	ids := make([]string, len(country.Provinces))
+	for i, p := range country.Provinces {
+		ids[i] = p.ID
+	}
+	points, err = hApp.AsOf(ctx, "province", ids, at)
+	if err != nil {
+		return nil, err
+	}
+	past.Provinces = make(Provinces, 0, len(country.Provinces))
+	for _, p := range country.Provinces {
+		pp, ok := points[p.ID]
+		if !ok {
+			continue
+		}
+		old := *p
+		old.Metrics = nil
+		old.Districts = nil
+		setHistoryFigures(pp, &old.Total, &old.NewCase, &old.Treated, &old.DecoveringCase, &old.TestCase, &old.Dead, &old.NegativeTest)
+		old.UpdatedAt = pp.RecordedAt
+		past.Provinces = append(past.Provinces, &old)
+	}
+	return &past, nil
+}
+
+func setHistoryFigures(p *HistoryPoint, total, newCase, treated, decoveringCase, testCase, dead, negativeCase *int64) {
+	*total = p.Total
+	*newCase = p.NewCase
+	*treated = p.Treated
+	*decoveringCase = p.DecoveringCase
+	*testCase = p.TestCase
+	*dead = p.Dead
+	*negativeCase = p.NegativeTest
+}
+
+// handler
+type historyService struct {
+	hApp HistoryRepository
+}
+
+func NewHistoryService(hApp HistoryRepository) *historyService {
+	return &historyService{hApp: hApp}
+}
+
+func (hA *historyService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// History returns a handler serving the history of the entity of kind whose
+// id is in the route param.
+func (hA *historyService) History(kind, param string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		from, to, err := dayRange(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, hA.errMessage(err.Error()))
+		}
+		limit := maxHistoryDays
+		if kind == "district" {
+			limit = maxDistrictHistoryDays
+		}
+		if err := checkDays(from, to, limit); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, hA.errMessage(err.Error()))
+		}
+		h, err := hA.hApp.Get(c.Request().Context(), kind, c.Param(param), from, to)
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, hA.errMessage(msg))
+		}
+		if at, ok := embargoed(c); ok {
+			h = h.before(at)
+		}
+		return c.JSON(http.StatusOK, map[string]History{"history": h})
+	}
+}
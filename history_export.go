@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// the formats the history can be exported in, by their ?format=
+var historyExportFormats = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"ndjson":  "application/x-ndjson",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// historyColumns are the columns of the CSV and Parquet exports, named as the
+// fields of the JSON of a HistoryRecord.
+var historyColumns = []string{"kind", "id", "day", "total", "new_case", "treaded", "decovering_case", "test_case", "dead", "negative_case", "recorded_at"}
+
+var errExportNotReady = errors.New("Error: The export is not done yet, its job tells when it is")
+
+// HistoryExport is the result of a history export job, the file being
+// downloaded from Download.
+type HistoryExport struct {
+	Kind     string `json:"kind"`
+	Format   string `json:"format"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Rows     int    `json:"rows"`
+	Size     int    `json:"size"`
+	Download string `json:"download"`
+
+	data []byte
+	// the embargo the figures were exported under, if any
+	embargo *time.Time
+}
+
+// historyParquetRow is a HistoryRecord as a Parquet row, days being dates and
+// recorded_at a timestamp in UTC.
+type historyParquetRow struct {
+	Kind           string `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ID             string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Day            int32  `parquet:"name=day, type=INT32, convertedtype=DATE"`
+	Total          int64  `parquet:"name=total, type=INT64"`
+	NewCase        int64  `parquet:"name=new_case, type=INT64"`
+	Treated        int64  `parquet:"name=treaded, type=INT64"`
+	DecoveringCase int64  `parquet:"name=decovering_case, type=INT64"`
+	TestCase       int64  `parquet:"name=test_case, type=INT64"`
+	Dead           int64  `parquet:"name=dead, type=INT64"`
+	NegativeTest   int64  `parquet:"name=negative_case, type=INT64"`
+	RecordedAt     int64  `parquet:"name=recorded_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+// writeHistory encodes records in format.
+func writeHistory(format string, records []*HistoryRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		w := csv.NewWriter(&buf)
+		if err := w.Write(historyColumns); err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if err := w.Write([]string{
+				r.Kind,
+				r.ID,
+				r.Day,
+				strconv.FormatInt(r.Total, 10),
+				strconv.FormatInt(r.NewCase, 10),
+				strconv.FormatInt(r.Treated, 10),
+				strconv.FormatInt(r.DecoveringCase, 10),
+				strconv.FormatInt(r.TestCase, 10),
+				strconv.FormatInt(r.Dead, 10),
+				strconv.FormatInt(r.NegativeTest, 10),
+				r.RecordedAt.UTC().Format(time.RFC3339Nano),
+			}); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+	case "ndjson":
+		enc := json.NewEncoder(&buf)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+		}
+	case "parquet":
+		pw, err := writer.NewParquetWriterFromWriter(&buf, new(historyParquetRow), 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			day, err := time.Parse(dateLayout, r.Day)
+			if err != nil {
+				return nil, err
+			}
+			if err := pw.Write(historyParquetRow{
+				Kind:           r.Kind,
+				ID:             r.ID,
+				Day:            int32(day.Unix() / 86400),
+				Total:          r.Total,
+				NewCase:        r.NewCase,
+				Treated:        r.Treated,
+				DecoveringCase: r.DecoveringCase,
+				TestCase:       r.TestCase,
+				Dead:           r.Dead,
+				NegativeTest:   r.NegativeTest,
+				RecordedAt:     r.RecordedAt.UnixNano() / int64(time.Microsecond),
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if err := pw.WriteStop(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("history export: unknown format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// handler
+type historyExportService struct {
+	hApp HistoryRepository
+	jobs *jobRunner
+}
+
+func NewHistoryExportService(hApp HistoryRepository, jobs *jobRunner) *historyExportService {
+	return &historyExportService{hApp: hApp, jobs: jobs}
+}
+
+func (heA *historyExportService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// Export exports the history of every entity of ?kind= between ?from= and
+// ?to= in ?format=, csv unless set, in a job whose result tells where to
+// download the file from. Callers under embargo export the figures they are
+// shown.
+func (heA *historyExportService) Export(c echo.Context) error {
+	kind := c.QueryParam("kind")
+	limit := maxHistoryDays
+	switch kind {
+	case "country", "province":
+	case "district":
+		limit = maxDistrictHistoryDays
+	default:
+		return c.JSON(http.StatusBadRequest, heA.errMessage("request: kind must be country, province or district"))
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	if _, ok := historyExportFormats[format]; !ok {
+		return c.JSON(http.StatusBadRequest, heA.errMessage("request: format must be csv, ndjson or parquet"))
+	}
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, heA.errMessage(err.Error()))
+	}
+	if err := checkDays(from, to, limit); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, heA.errMessage(err.Error()))
+	}
+
+	export := &HistoryExport{Kind: kind, Format: format, From: from.Format(dateLayout), To: to.Format(dateLayout)}
+	if at, ok := embargoed(c); ok {
+		export.embargo = &at
+	}
+	// the job learns its id, which its download is at, once submitted
+	id := make(chan string, 1)
+	job := heA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+		export.Download = "/api/v1/export/history/" + <-id
+		records, err := heA.hApp.Range(ctx, kind, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if export.embargo != nil {
+			kept := records[:0]
+			for _, r := range records {
+				if !r.RecordedAt.After(*export.embargo) {
+					kept = append(kept, r)
+				}
+			}
+			records = kept
+		}
+		if export.data, err = writeHistory(format, records); err != nil {
+			return nil, err
+		}
+		export.Rows, export.Size = len(records), len(export.data)
+		return export, nil
+	})
+	id <- job.ID
+	return acceptJob(c, job)
+}
+
+// Download serves the file of the history export job in the route param. A
+// caller under embargo cannot download figures exported past it.
+func (heA *historyExportService) Download(c echo.Context) error {
+	job, ok := heA.jobs.Get(c.Param("job_id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, heA.errMessage(errNotFound.Error()))
+	}
+	if job.Status == JobPending || job.Status == JobRunning {
+		return c.JSON(http.StatusConflict, heA.errMessage(errExportNotReady.Error()))
+	}
+	export, ok := job.Result.(*HistoryExport)
+	if !ok {
+		return c.JSON(http.StatusNotFound, heA.errMessage(errNotFound.Error()))
+	}
+	if at, ok := embargoed(c); ok && (export.embargo == nil || export.embargo.After(at)) {
+		status, msg := errorStatus(errEmbargoed, "")
+		return c.JSON(status, heA.errMessage(msg))
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-history-%s-%s.%s", export.Kind, export.From, export.To, export.Format)))
+	return c.Blob(http.StatusOK, historyExportFormats[export.Format], export.data)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// exportTestHistory exports the history of the provinces in format through
+// the handlers, and returns the downloaded file.
+func exportTestHistory(t *testing.T, format string) []byte {
+	t.Helper()
+	r, ctx := openTestStorage(t)
+	yesterday := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	c := saveTestCountry(t, ctx, r, yesterday)
+	vte := c.Provinces[0]
+	vte.Total, vte.UpdatedAt = 8, yesterday.Add(24*time.Hour)
+	if err := r.ProvinceRepo.Update(ctx, vte); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	jobs := newJobRunner(nil)
+	heA := NewHistoryExportService(r.HistoryRepo, jobs)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/export/history?kind=province&from=2026-10-01&to=2026-10-31&format="+format, nil)
+	rec := httptest.NewRecorder()
+	if err := heA.Export(e.NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("export = %d %s", rec.Code, rec.Body)
+	}
+	var accepted map[string]*Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &accepted); err != nil {
+		t.Fatal(err)
+	}
+	jobs.Wait()
+
+	job, _ := jobs.Get(accepted["job"].ID)
+	export, ok := job.Result.(*HistoryExport)
+	if job.Status != JobSucceeded || !ok {
+		t.Fatalf("job = %+v", job)
+	}
+	if export.Rows != 3 || export.Download != "/api/v1/export/history/"+job.ID {
+		t.Errorf("export of %d rows at %s, want 3", export.Rows, export.Download)
+	}
+	req = httptest.NewRequest(http.MethodGet, export.Download, nil)
+	rec = httptest.NewRecorder()
+	dc := e.NewContext(req, rec)
+	dc.SetParamNames("job_id")
+	dc.SetParamValues(job.ID)
+	if err := heA.Download(dc); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != historyExportFormats[format] {
+		t.Fatalf("download = %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	return rec.Body.Bytes()
+}
+
+func TestHistoryExportCSV(t *testing.T) {
+	want := strings.Join([]string{
+		strings.Join(historyColumns, ","),
+		"province,LPB,2026-10-16,4,0,0,0,0,0,0,2026-10-16T09:30:00Z",
+		"province,VTE,2026-10-16,6,0,0,0,0,0,0,2026-10-16T09:30:00Z",
+		"province,VTE,2026-10-17,8,0,0,0,0,0,0,2026-10-17T09:30:00Z",
+	}, "\n") + "\n"
+	if got := string(exportTestHistory(t, "csv")); got != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+}
+
+func TestHistoryExportNDJSON(t *testing.T) {
+	lines := bytes.Split(bytes.TrimSpace(exportTestHistory(t, "ndjson")), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("%d lines, want 3", len(lines))
+	}
+	var r HistoryRecord
+	if err := json.Unmarshal(lines[2], &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != "province" || r.ID != "VTE" || r.Day != "2026-10-17" || r.Total != 8 {
+		t.Errorf("last line = %s", lines[2])
+	}
+}
+
+func TestHistoryExportParquet(t *testing.T) {
+	f, err := buffer.NewBufferFile(exportTestHistory(t, "parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetReader(f, new(historyParquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	rows := make([]historyParquetRow, pr.GetNumRows())
+	if err := pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3", len(rows))
+	}
+	last := rows[2]
+	day := time.Unix(int64(last.Day)*86400, 0).UTC().Format(dateLayout)
+	recordedAt := time.Unix(0, last.RecordedAt*int64(time.Microsecond)).UTC()
+	if last.ID != "VTE" || day != "2026-10-17" || last.Total != 8 || !recordedAt.Equal(time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("last row = %+v", last)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+var hotlineCategories = map[string]bool{
+	"symptoms":      true,
+	"testing":       true,
+	"vaccination":   true,
+	"travel":        true,
+	"mental_health": true,
+	"other":         true,
+}
+
+// HotlineDay is the number of calls a province's hotline took on a day, by
+// category.
+type HotlineDay struct {
+	Day       string           `json:"day"`
+	Total     int64            `json:"total"`
+	Calls     map[string]int64 `json:"calls"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+type HotlineDays []*HotlineDay
+
+func (h *HotlineDay) Validate() error {
+	if _, err := time.Parse(dateLayout, h.Day); err != nil {
+		return errors.New("hotline: day must be formatted as YYYY-MM-DD")
+	}
+	if len(h.Calls) == 0 {
+		return errors.New("hotline: calls are required")
+	}
+	for category, n := range h.Calls {
+		if !hotlineCategories[category] {
+			return errors.New("hotline: unknown category " + category)
+		}
+		if n < 0 {
+			return errors.New("hotline: calls must not be negative")
+		}
+	}
+	return nil
+}
+
+func (h *HotlineDay) sum() {
+	h.Total = 0
+	for _, n := range h.Calls {
+		h.Total += n
+	}
+}
+
+// HotlineWeek is the calls taken in the week starting on Week, with the
+// percentage change against the week before.
+type HotlineWeek struct {
+	Week   time.Time `json:"week"`
+	Calls  int64     `json:"calls"`
+	Change *float64  `json:"change"`
+}
+
+type HotlineTrend []*HotlineWeek
+
+// Repository
+type HotlineRepository interface {
+	// Save replaces the categories recorded for the day.
+	Save(ctx context.Context, provinceID string, h *HotlineDay) error
+	Delete(ctx context.Context, provinceID, day string) error
+	GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (HotlineDays, error)
+	Trend(ctx context.Context, provinceID string, from, to time.Time) (HotlineTrend, error)
+}
+
+type hotlineRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ HotlineRepository = &hotlineRepo{}
+
+func NewHotlineRepo(db *sql.DB, dialect migrations.Dialect) *hotlineRepo {
+	return &hotlineRepo{db: db, dialect: dialect}
+}
+
+func (hr *hotlineRepo) Save(ctx context.Context, provinceID string, h *HotlineDay) (err error) {
+	day, err := time.Parse(dateLayout, h.Day)
+	if err != nil {
+		return err
+	}
+	tx, err := hr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("province", provinceID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("province", provinceID, "commit", commitErr)
+			}
+			return
+		}
+		tx.Rollback()
+	}()
+
+	if _, err := squirrel.Delete("hotline_calls").
+		Where(squirrel.Eq{"province_id": provinceID, "day": day}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("province", provinceID, "delete hotline calls", err)
+	}
+
+	q := squirrel.Insert("hotline_calls").
+		Columns("province_id", "day", "category", "calls", "updated_at")
+	for category, n := range h.Calls {
+		q = q.Values(provinceID, day, category, n, h.UpdatedAt)
+	}
+	if _, err := q.PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("province", provinceID, "insert hotline calls", err)
+	}
+	return nil
+}
+
+func (hr *hotlineRepo) Delete(ctx context.Context, provinceID, day string) error {
+	d, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return err
+	}
+	res, err := squirrel.Delete("hotline_calls").
+		Where(squirrel.Eq{"province_id": provinceID, "day": d}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("province", provinceID, "delete hotline calls", err)
+	}
+	return wrapErr("province", provinceID, "delete hotline calls", affectedOne(res))
+}
+
+func (hr *hotlineRepo) GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (HotlineDays, error) {
+	rows, err := squirrel.Select("day", "category", "calls", "updated_at").
+		From("hotline_calls").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"day": from}).
+		Where(squirrel.LtOrEq{"day": to}).
+		OrderBy("day", "category").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select hotline calls", err)
+	}
+	defer rows.Close()
+
+	var hs = make(HotlineDays, 0)
+	for rows.Next() {
+		var day time.Time
+		var category string
+		var calls int64
+		var updatedAt time.Time
+		if err := rows.Scan(&day, &category, &calls, &updatedAt); err != nil {
+			return nil, wrapErr("province", provinceID, "scan hotline calls", err)
+		}
+		d := day.Format(dateLayout)
+		if n := len(hs); n == 0 || hs[n-1].Day != d {
+			hs = append(hs, &HotlineDay{Day: d, Calls: map[string]int64{}, UpdatedAt: updatedAt})
+		}
+		h := hs[len(hs)-1]
+		h.Calls[category] = calls
+		h.Total += calls
+		if updatedAt.After(h.UpdatedAt) {
+			h.UpdatedAt = updatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select hotline calls", err)
+	}
+	return hs, nil
+}
+
+func (hr *hotlineRepo) Trend(ctx context.Context, provinceID string, from, to time.Time) (HotlineTrend, error) {
+	rows, err := squirrel.Select(weekOf(hr.dialect, "day")+" AS week", "SUM(calls)").
+		From("hotline_calls").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"day": from}).
+		Where(squirrel.LtOrEq{"day": to}).
+		GroupBy("week").
+		OrderBy("week").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(hr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select hotline trend", err)
+	}
+	defer rows.Close()
+
+	var trend = make(HotlineTrend, 0)
+	for rows.Next() {
+		var w HotlineWeek
+		if err := rows.Scan(&w.Week, &w.Calls); err != nil {
+			return nil, wrapErr("province", provinceID, "scan hotline trend", err)
+		}
+		if n := len(trend); n > 0 && trend[n-1].Calls > 0 {
+			change := math.Round((float64(w.Calls)/float64(trend[n-1].Calls)-1)*10000) / 100
+			w.Change = &change
+		}
+		trend = append(trend, &w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select hotline trend", err)
+	}
+	return trend, nil
+}
+
+// handler
+type hotlineService struct {
+	hApp HotlineRepository
+}
+
+func NewHotlineService(hApp HotlineRepository) *hotlineService {
+	return &hotlineService{hApp: hApp}
+}
+
+func (hA *hotlineService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (hA *hotlineService) StoreDay(c echo.Context) error {
+	var h HotlineDay
+	if err := c.Bind(&h); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, hA.errMessage("request: unable to parse request payload"))
+	}
+	h.Day = c.Param("day")
+	h.UpdatedAt = time.Now()
+	if err := h.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, hA.errMessage(err.Error()))
+	}
+
+	if err := hA.hApp.Save(c.Request().Context(), c.Param("province_id"), &h); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, hA.errMessage(msg))
+	}
+	h.sum()
+	return c.JSON(http.StatusOK, map[string]*HotlineDay{"hotline_day": &h})
+}
+
+func (hA *hotlineService) DeleteDay(c echo.Context) error {
+	if _, err := time.Parse(dateLayout, c.Param("day")); err != nil {
+		return c.JSON(http.StatusBadRequest, hA.errMessage("hotline: day must be formatted as YYYY-MM-DD"))
+	}
+	if err := hA.hApp.Delete(c.Request().Context(), c.Param("province_id"), c.Param("day")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, hA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (hA *hotlineService) ListDays(c echo.Context) error {
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, hA.errMessage(err.Error()))
+	}
+	if err := checkDays(from, to, maxRecordDays); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, hA.errMessage(err.Error()))
+	}
+	hs, err := hA.hApp.GetByProvince(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, hA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]HotlineDays{"hotline_days": hs})
+}
+
+func (hA *hotlineService) Trend(c echo.Context) error {
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, hA.errMessage(err.Error()))
+	}
+	if err := checkWeeks(from, to, maxTrendWeeks); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, hA.errMessage(err.Error()))
+	}
+	trend, err := hA.hApp.Trend(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, hA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]HotlineTrend{"hotline_trend": trend})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// the language messages are written in, and answered in when the client
+// asks for none of the catalogs
+const sourceLanguage = "en"
+
+// loMessages translates the messages answered to data entry staff to Lao.
+// Keys are the messages as the handlers write them, verbs standing for the
+// values they are formatted with, which the translations take in the same
+// order.
+var loMessages = map[string]string{
+	"Internal server error": "ເກີດຂໍ້ຜິດພາດພາຍໃນເຊີບເວີ",
+	"Not Found":             "ບໍ່ພົບ",
+	"Error: No data found":  "ຂໍ້ຜິດພາດ: ບໍ່ພົບຂໍ້ມູນ",
+	"Error: Data conflicts with an existing record":                     "ຂໍ້ຜິດພາດ: ຂໍ້ມູນຂັດກັບຂໍ້ມູນທີ່ມີຢູ່ແລ້ວ",
+	"Error: Referenced data does not exist":                             "ຂໍ້ຜິດພາດ: ບໍ່ພົບຂໍ້ມູນທີ່ອ້າງອີງເຖິງ",
+	"Error: Data was changed concurrently, please retry":                "ຂໍ້ຜິດພາດ: ຂໍ້ມູນຖືກປ່ຽນແປງໃນເວລາດຽວກັນ, ກະລຸນາລອງໃໝ່",
+	"Error: Data was modified since it was read":                        "ຂໍ້ຜິດພາດ: ຂໍ້ມູນຖືກແກ້ໄຂແລ້ວຫຼັງຈາກທີ່ອ່ານ",
+	"Error: The request took too long, please retry":                    "ຂໍ້ຜິດພາດ: ຄຳຮ້ອງໃຊ້ເວລາດົນເກີນໄປ, ກະລຸນາລອງໃໝ່",
+	"Error: A valid bearer token is required":                           "ຂໍ້ຜິດພາດ: ຕ້ອງມີ bearer token ທີ່ຖືກຕ້ອງ",
+	"Error: Not allowed to change this data":                            "ຂໍ້ຜິດພາດ: ບໍ່ມີສິດປ່ຽນແປງຂໍ້ມູນນີ້",
+	"Error: Invalid email or password":                                  "ຂໍ້ຜິດພາດ: ອີເມວ ຫຼື ລະຫັດຜ່ານບໍ່ຖືກຕ້ອງ",
+	"Error: The daily write quota of the team is used up":               "ຂໍ້ຜິດພາດ: ໂຄຕາການບັນທຶກປະຈຳວັນຂອງທີມໝົດແລ້ວ",
+	"Error: Service is read-only until the database schema is migrated": "ຂໍ້ຜິດພາດ: ບໍລິການອ່ານໄດ້ຢ່າງດຽວຈົນກວ່າຈະອັບເດດໂຄງສ້າງຖານຂໍ້ມູນ",
+
+	"request: unable to parse request payload":                                 "ຄຳຮ້ອງ: ບໍ່ສາມາດອ່ານຂໍ້ມູນທີ່ສົ່ງມາໄດ້",
+	"request: page must be a positive integer":                                 "ຄຳຮ້ອງ: page ຕ້ອງເປັນຈຳນວນເຕັມບວກ",
+	"request: limit must be between 1 and %d":                                  "ຄຳຮ້ອງ: limit ຕ້ອງຢູ່ລະຫວ່າງ 1 ແລະ %d",
+	"request: from must be formatted as YYYY-MM-DD":                            "ຄຳຮ້ອງ: from ຕ້ອງຢູ່ໃນຮູບແບບ YYYY-MM-DD",
+	"request: to must be formatted as YYYY-MM-DD":                              "ຄຳຮ້ອງ: to ຕ້ອງຢູ່ໃນຮູບແບບ YYYY-MM-DD",
+	"request: from must be formatted as YYYY-MM":                               "ຄຳຮ້ອງ: from ຕ້ອງຢູ່ໃນຮູບແບບ YYYY-MM",
+	"request: to must be formatted as YYYY-MM":                                 "ຄຳຮ້ອງ: to ຕ້ອງຢູ່ໃນຮູບແບບ YYYY-MM",
+	"request: to must not be before from":                                      "ຄຳຮ້ອງ: to ຕ້ອງບໍ່ກ່ອນ from",
+	"request: from and to span %d days, at most %d can be asked for at once":   "ຄຳຮ້ອງ: ຈາກ from ຫາ to ແມ່ນ %d ມື້, ຂໍໄດ້ບໍ່ເກີນ %d ມື້ຕໍ່ຄັ້ງ",
+	"request: from and to span %d weeks, at most %d can be asked for at once":  "ຄຳຮ້ອງ: ຈາກ from ຫາ to ແມ່ນ %d ອາທິດ, ຂໍໄດ້ບໍ່ເກີນ %d ອາທິດຕໍ່ຄັ້ງ",
+	"request: from and to span %d months, at most %d can be asked for at once": "ຄຳຮ້ອງ: ຈາກ from ຫາ to ແມ່ນ %d ເດືອນ, ຂໍໄດ້ບໍ່ເກີນ %d ເດືອນຕໍ່ຄັ້ງ",
+
+	"%s: name is required":                             "%s: ຕ້ອງລະບຸຊື່",
+	"%s: province_id is required":                      "%s: ຕ້ອງລະບຸ province_id",
+	"%s: country_id is required":                       "%s: ຕ້ອງລະບຸ country_id",
+	"%s: latitude and longitude are given together":    "%s: ຕ້ອງລະບຸ latitude ແລະ longitude ພ້ອມກັນ",
+	"%s: latitude must be between -90 and 90":          "%s: latitude ຕ້ອງຢູ່ລະຫວ່າງ -90 ແລະ 90",
+	"%s: longitude must be between -180 and 180":       "%s: longitude ຕ້ອງຢູ່ລະຫວ່າງ -180 ແລະ 180",
+	"country: iso2 must be an ISO 3166-1 alpha-2 code": "country: iso2 ຕ້ອງເປັນລະຫັດ ISO 3166-1 alpha-2",
+	"country: iso3 must be an ISO 3166-1 alpha-3 code": "country: iso3 ຕ້ອງເປັນລະຫັດ ISO 3166-1 alpha-3",
+
+	"must not be negative":                                  "ຕ້ອງບໍ່ເປັນຄ່າລົບ",
+	"must be an object":                                     "ຕ້ອງເປັນ object",
+	"%s is given twice":                                     "%s ຖືກລະບຸສອງຄັ້ງ",
+	"decreases from %d to %d":                               "ຫຼຸດລົງຈາກ %d ເປັນ %d",
+	"%d new cases are more than the %d confirmed":           "ຜູ້ຕິດເຊື້ອໃໝ່ %d ຄົນ ຫຼາຍກວ່າຜູ້ຕິດເຊື້ອທີ່ຢືນຢັນ %d ຄົນ",
+	"%d treated and %d dead are more than the %d confirmed": "ປິ່ນປົວ %d ຄົນ ແລະ ເສຍຊີວິດ %d ຄົນ ຫຼາຍກວ່າຜູ້ຕິດເຊື້ອທີ່ຢືນຢັນ %d ຄົນ",
+	"%d negative tests are more than the %d tests":          "ຜົນກວດເປັນລົບ %d ຄັ້ງ ຫຼາຍກວ່າການກວດທັງໝົດ %d ຄັ້ງ",
+}
+
+// messageCatalog translates messages to one language, those it has no
+// translation of being left in the source language.
+type messageCatalog struct {
+	exact    map[string]string
+	patterns []*messagePattern
+}
+
+// messagePattern matches the messages formatted from one format.
+type messagePattern struct {
+	re     *regexp.Regexp
+	format string
+}
+
+var verbRe = regexp.MustCompile(`%[dsq]`)
+
+func newMessageCatalog(messages map[string]string) *messageCatalog {
+	mc := &messageCatalog{exact: make(map[string]string)}
+	keys := make([]string, 0, len(messages))
+	for k := range messages {
+		keys = append(keys, k)
+	}
+	// the longest formats first, the most specific matching
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, k := range keys {
+		if !verbRe.MatchString(k) {
+			mc.exact[k] = messages[k]
+			continue
+		}
+		var expr strings.Builder
+		expr.WriteString("^")
+		last := 0
+		for _, loc := range verbRe.FindAllStringIndex(k, -1) {
+			expr.WriteString(regexp.QuoteMeta(k[last:loc[0]]))
+			switch k[loc[1]-1] {
+			case 'd':
+				expr.WriteString(`(-?\d+)`)
+			default:
+				expr.WriteString(`(.+?)`)
+			}
+			last = loc[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(k[last:]) + "$")
+		mc.patterns = append(mc.patterns, &messagePattern{
+			re:     regexp.MustCompile(expr.String()),
+			format: verbRe.ReplaceAllString(messages[k], "%s"),
+		})
+	}
+	return mc
+}
+
+// translate returns msg in the language of mc, and whether it has it.
+func (mc *messageCatalog) translate(msg string) (string, bool) {
+	if t, ok := mc.exact[msg]; ok {
+		return t, true
+	}
+	for _, p := range mc.patterns {
+		m := p.re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		args := make([]interface{}, len(m)-1)
+		for i, v := range m[1:] {
+			args[i] = v
+		}
+		return fmt.Sprintf(p.format, args...), true
+	}
+	return msg, false
+}
+
+// the languages messages are translated to
+var messageCatalogs = map[string]*messageCatalog{
+	"lo": newMessageCatalog(loMessages),
+}
+
+// negotiateLanguage picks the language of a response from Accept-Language,
+// the source language when none of those asked for has a catalog.
+func negotiateLanguage(accept string) string {
+	best, bestQ := sourceLanguage, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if i := strings.IndexByte(tag, '-'); i >= 0 {
+			tag = tag[:i]
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if _, ok := messageCatalogs[tag]; (ok || tag == sourceLanguage) && q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// localizeMessages translates the messages of JSON error responses, and
+// those of the issues of /api/v1/validate, to the language of
+// Accept-Language.
+func localizeMessages(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+		lang := negotiateLanguage(c.Request().Header.Get("Accept-Language"))
+		mc, ok := messageCatalogs[lang]
+		if !ok || rawResponses[c.Path()] {
+			return next(c)
+		}
+
+		res := c.Response()
+		w := res.Writer
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		res.Writer = buf
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w
+
+		body := buf.body.Bytes()
+		if strings.HasPrefix(res.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+			if b, ok := localizeBody(mc, body, buf.status >= http.StatusBadRequest); ok {
+				body = b
+				res.Header().Set("Content-Language", lang)
+			}
+		}
+		w.WriteHeader(buf.status)
+		_, err := w.Write(body)
+		return err
+	}
+}
+
+// localizeBody translates the messages of a JSON body, of any shape for an
+// error, only those of a validation otherwise.
+func localizeBody(mc *messageCatalog, body []byte, failed bool) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	target := v
+	if !failed {
+		obj, _ := v.(map[string]interface{})
+		if target = obj["validation"]; target == nil {
+			return nil, false
+		}
+	}
+	if !translateMessages(mc, target) {
+		return nil, false
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return append(b, '\n'), true
+}
+
+// translateMessages translates in place the "error" and "message" strings
+// of v, reporting whether it translated any.
+func translateMessages(mc *messageCatalog, v interface{}) bool {
+	translated := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if s, ok := e.(string); ok && (k == "error" || k == "message") {
+				if t, ok := mc.translate(s); ok {
+					v[k] = t
+					translated = true
+				}
+				continue
+			}
+			if translateMessages(mc, e) {
+				translated = true
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if translateMessages(mc, e) {
+				translated = true
+			}
+		}
+	}
+	return translated
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+var (
+	errRolledBack     = errors.New("Error: The import was already rolled back")
+	errNothingChanged = errors.New("Error: The run did not update any record")
+)
+
+// the tables of the kinds of records an import updates
+var importTables = map[string]string{
+	"country":  "country",
+	"province": "provinces",
+	"district": "districts",
+}
+
+// syncChange is a record an import updated, with the figures it had before.
+// UpdatedAt is the time the import wrote it at, for the rollback to tell
+// whether it changed since.
+type syncChange struct {
+	Kind string
+	ID   string
+	// ParentID is the province of a district.
+	ParentID  string
+	Before    figures
+	UpdatedAt time.Time
+}
+
+// touched records that the run updated a record, from before to the figures
+// written at updatedAt.
+func (run *SyncRun) touched(kind, id, parentID string, before *figures, updatedAt time.Time) {
+	run.changes = append(run.changes, &syncChange{
+		Kind:      kind,
+		ID:        id,
+		ParentID:  parentID,
+		Before:    *before,
+		UpdatedAt: updatedAt,
+	})
+}
+
+func insertSyncChanges(ctx context.Context, runner squirrel.BaseRunner, run *SyncRun) error {
+	if len(run.changes) == 0 {
+		return nil
+	}
+	stm := squirrel.Insert("sync_run_changes").
+		Columns("run_id", "kind", "entity_id", "parent_id", "total", "new_case", "treated", "decovering_case",
+			"test_case", "dead", "negative_case", "updated_at")
+	for _, c := range run.changes {
+		b := c.Before
+		stm = stm.Values(run.ID, c.Kind, c.ID, c.ParentID, b.Total, b.NewCase, b.Treated, b.DecoveringCase,
+			b.TestCase, b.Dead, b.NegativeTest, c.UpdatedAt)
+	}
+	if _, err := stm.PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx); err != nil {
+		return wrapErr("sync run", run.ID, "insert changes", err)
+	}
+	return nil
+}
+
+func selectSyncChanges(ctx context.Context, runner squirrel.BaseRunner, id string) ([]*syncChange, error) {
+	rows, err := squirrel.Select("kind", "entity_id", "parent_id", "total", "new_case", "treated", "decovering_case",
+		"test_case", "dead", "negative_case", "updated_at").
+		From("sync_run_changes").
+		Where(squirrel.Eq{"run_id": id}).
+		OrderBy("kind", "entity_id").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("sync run", id, "select changes", err)
+	}
+	defer rows.Close()
+
+	var changes []*syncChange
+	for rows.Next() {
+		var c syncChange
+		dest := append([]interface{}{&c.Kind, &c.ID, &c.ParentID}, c.Before.pointers()...)
+		if err := rows.Scan(append(dest, &c.UpdatedAt)...); err != nil {
+			return nil, wrapErr("sync run", id, "scan changes", err)
+		}
+		changes = append(changes, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("sync run", id, "select changes", err)
+	}
+	return changes, nil
+}
+
+// Rollback restores the figures the records updated by the run had before
+// it, in one transaction, and marks the run rolled back at at. It fails with
+// errModified, restoring nothing, when one of them changed since the run.
+func (sr *syncRunRepo) Rollback(ctx context.Context, id string, at time.Time) (changes []*syncChange, err error) {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("sync run", id, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("sync run", id, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	var rolledBackAt *time.Time
+	if err := forUpdate(sr.dialect, squirrel.Select("rolled_back_at").
+		From("sync_runs").
+		Where(squirrel.Eq{"id": id})).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ScanContext(ctx, &rolledBackAt); err != nil {
+		return nil, wrapErr("sync run", id, "select sync run", err)
+	}
+	if rolledBackAt != nil {
+		return nil, errRolledBack
+	}
+	changes, err = selectSyncChanges(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, errNothingChanged
+	}
+
+	for _, c := range changes {
+		table := importTables[c.Kind]
+		var updatedAt time.Time
+		if err := forUpdate(sr.dialect, squirrel.Select("updated_at").
+			From(table).
+			Where(squirrel.Eq{"id": c.ID})).
+			PlaceholderFormat(squirrel.Dollar).
+			RunWith(tx).ScanContext(ctx, &updatedAt); err != nil {
+			return nil, wrapErr(c.Kind, c.ID, "select "+c.Kind, err)
+		}
+		if !updatedAt.Equal(c.UpdatedAt) {
+			return nil, fmt.Errorf("%s %s: changed since the import: %w", c.Kind, c.ID, errModified)
+		}
+		b := c.Before
+		if _, err := squirrel.Update(table).
+			SetMap(map[string]interface{}{
+				"total":           b.Total,
+				"new_case":        b.NewCase,
+				"treated":         b.Treated,
+				"decovering_case": b.DecoveringCase,
+				"test_case":       b.TestCase,
+				"dead":            b.Dead,
+				"negative_case":   b.NegativeTest,
+				"updated_at":      at,
+			}).
+			Where(squirrel.Eq{"id": c.ID}).
+			PlaceholderFormat(squirrel.Dollar).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			return nil, wrapErr(c.Kind, c.ID, "restore "+c.Kind, err)
+		}
+	}
+
+	if _, err := squirrel.Update("sync_runs").
+		Set("rolled_back_at", at).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return nil, wrapErr("sync run", id, "mark rolled back", err)
+	}
+	return changes, nil
+}
+
+// RollbackImport undoes an import, restoring the figures of every record it
+// updated, the fastest way back from a malformed file. Records changed since
+// by anything else are not overwritten, the rollback being refused instead.
+func (sA *syncService) RollbackImport(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("sync_run_id")
+	changes, err := sA.runs.Rollback(ctx, id, time.Now())
+	if errors.Is(err, errRolledBack) || errors.Is(err, errNothingChanged) || errors.Is(err, errModified) {
+		return c.JSON(http.StatusConflict, sA.errMessage(err.Error()))
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not roll back the import")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+
+	keys := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		switch ch.Kind {
+		case "country":
+			keys = append(keys, countryKey(ch.ID))
+		case "province":
+			keys = append(keys, provinceKey(ch.ID))
+		case "district":
+			keys = append(keys, districtKey(ch.ID), provinceKey(ch.ParentID))
+		}
+	}
+	sA.changes.Publish(keys...)
+
+	run, err := sA.runs.Get(ctx, id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*SyncRun{"sync_run": run})
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// isoCode tells whether code is made of n uppercase ASCII letters, the shape
+// of the ISO 3166-1 alpha-2 and alpha-3 codes.
+func isoCode(code string, n int) bool {
+	if len(code) != n {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// countryIDOrCode matches the country whose id is v or, for a v shaped like
+// one, whose ISO 3166-1 alpha-2 or alpha-3 code is v, in any case.
+func countryIDOrCode(v string) squirrel.Sqlizer {
+	code := strings.ToUpper(v)
+	switch {
+	case isoCode(code, 2):
+		return squirrel.Or{squirrel.Eq{"id": v}, squirrel.Eq{"iso2": code}}
+	case isoCode(code, 3):
+		return squirrel.Or{squirrel.Eq{"id": v}, squirrel.Eq{"iso3": code}}
+	}
+	return squirrel.Eq{"id": v}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/lib/pq"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+const (
+	SyncSucceeded = "succeeded"
+	SyncFailed    = "failed"
+)
+
+// sourceJHU is the Johns Hopkins CSSE daily reports.
+const sourceJHU = "jhu"
+
+const defaultJHUReportsURL = "https://raw.githubusercontent.com/CSSEGISandData/COVID-19/master/csse_covid_19_data/csse_covid_19_daily_reports"
+
+// how many days back the latest published daily report is looked for
+const jhuLookbackDays = 7
+
+var errSyncRunning = errors.New("Error: A sync is already running")
+
+// SyncRun is one run of an importer, or of an exporter pushing to an
+// external system.
+type SyncRun struct {
+	ID               string  `json:"id"`
+	Source           string  `json:"source"`
+	Status           string  `json:"status"`
+	ReportDate       *string `json:"report_date"`
+	CountriesUpdated int     `json:"countries_updated"`
+	ProvincesUpdated int     `json:"provinces_updated"`
+	DistrictsUpdated int     `json:"districts_updated"`
+	// Unmatched lists the names of the report no record was found for.
+	Unmatched []string `json:"unmatched"`
+	// Conflicts lists the values left as they are because they changed on
+	// both sides.
+	Conflicts  []string  `json:"conflicts"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// RolledBackAt is when the records the run updated were restored.
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+
+	// the records the run updated, saved along with it
+	changes []*syncChange
+}
+
+// jhuFigures are the figures of a region of a daily report, summed over its
+// subdivisions.
+type jhuFigures struct {
+	Confirmed int64
+	Deaths    int64
+	Recovered int64
+}
+
+func (f *jhuFigures) add(o jhuFigures) {
+	f.Confirmed += o.Confirmed
+	f.Deaths += o.Deaths
+	f.Recovered += o.Recovered
+}
+
+// jhuReport is a daily report by country and by province within a country,
+// keyed by lower-cased names.
+type jhuReport struct {
+	Date      time.Time
+	Countries map[string]*jhuFigures
+	Provinces map[string]map[string]*jhuFigures
+	// names as spelled in the report, by key
+	Names map[string]string
+}
+
+func parseJHUReport(r io.Reader, date time.Time) (*jhuReport, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("jhu: read header: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.TrimPrefix(strings.TrimSpace(h), "\ufeff")] = i
+	}
+	for _, name := range []string{"Province_State", "Country_Region", "Confirmed", "Deaths", "Recovered"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("jhu: report has no %s column", name)
+		}
+	}
+
+	report := &jhuReport{
+		Date:      date,
+		Countries: make(map[string]*jhuFigures),
+		Provinces: make(map[string]map[string]*jhuFigures),
+		Names:     make(map[string]string),
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jhu: read report: %w", err)
+		}
+		field := func(name string) string {
+			if i := cols[name]; i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		f := jhuFigures{
+			Confirmed: jhuCount(field("Confirmed")),
+			Deaths:    jhuCount(field("Deaths")),
+			Recovered: jhuCount(field("Recovered")),
+		}
+
+		country := field("Country_Region")
+		ck := strings.ToLower(country)
+		report.Names[ck] = country
+		if report.Countries[ck] == nil {
+			report.Countries[ck] = &jhuFigures{}
+		}
+		report.Countries[ck].add(f)
+
+		province := field("Province_State")
+		if province == "" {
+			continue
+		}
+		pk := strings.ToLower(province)
+		report.Names[ck+"/"+pk] = province
+		if report.Provinces[ck] == nil {
+			report.Provinces[ck] = make(map[string]*jhuFigures)
+		}
+		if report.Provinces[ck][pk] == nil {
+			report.Provinces[ck][pk] = &jhuFigures{}
+		}
+		report.Provinces[ck][pk].add(f)
+	}
+	return report, nil
+}
+
+// jhuCount reads a count, which some reports write as a float and leave
+// empty when unknown.
+func jhuCount(v string) int64 {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n)
+}
+
+// Repository
+type SyncRunRepository interface {
+	Save(ctx context.Context, run *SyncRun) error
+	Get(ctx context.Context, id string) (*SyncRun, error)
+	GetLatest(ctx context.Context, source string) (*SyncRun, error)
+	Rollback(ctx context.Context, id string, at time.Time) ([]*syncChange, error)
+}
+
+type syncRunRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ SyncRunRepository = &syncRunRepo{}
+
+func NewSyncRunRepo(db *sql.DB, dialect migrations.Dialect) *syncRunRepo {
+	return &syncRunRepo{db: db, dialect: dialect}
+}
+
+func (sr *syncRunRepo) Save(ctx context.Context, run *SyncRun) (err error) {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("sync run", run.ID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("sync run", run.ID, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	if _, err := squirrel.Insert("sync_runs").
+		Columns("id", "source", "status", "report_date", "countries_updated", "provinces_updated",
+			"districts_updated", "unmatched", "conflicts", "error", "started_at", "finished_at").
+		Values(&run.ID, &run.Source, &run.Status, run.ReportDate, &run.CountriesUpdated, &run.ProvincesUpdated,
+			&run.DistrictsUpdated, pq.Array(run.Unmatched), pq.Array(run.Conflicts), &run.Error, &run.StartedAt, &run.FinishedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("sync run", run.ID, "insert sync run", err)
+	}
+	return insertSyncChanges(ctx, tx, run)
+}
+
+func (sr *syncRunRepo) Get(ctx context.Context, id string) (*SyncRun, error) {
+	run, err := sr.get(ctx, squirrel.Select().Where(squirrel.Eq{"id": id}))
+	if err != nil {
+		return nil, wrapErr("sync run", id, "select sync run", err)
+	}
+	return run, nil
+}
+
+func (sr *syncRunRepo) GetLatest(ctx context.Context, source string) (*SyncRun, error) {
+	run, err := sr.get(ctx, squirrel.Select().
+		Where(squirrel.Eq{"source": source}).
+		OrderBy("started_at DESC").
+		Limit(1))
+	if err != nil {
+		return nil, wrapErr("sync run", source, "select latest sync run", err)
+	}
+	return run, nil
+}
+
+// get selects the first run stm finds.
+func (sr *syncRunRepo) get(ctx context.Context, stm squirrel.SelectBuilder) (*SyncRun, error) {
+	var run SyncRun
+	var reportDate *time.Time
+	err := stm.Columns("id", "source", "status", "report_date", "countries_updated", "provinces_updated",
+		"districts_updated", "unmatched", "conflicts", "error", "started_at", "finished_at", "rolled_back_at").
+		From("sync_runs").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ScanContext(ctx, &run.ID, &run.Source, &run.Status, &reportDate, &run.CountriesUpdated,
+		&run.ProvincesUpdated, &run.DistrictsUpdated, pq.Array(&run.Unmatched), pq.Array(&run.Conflicts), &run.Error,
+		&run.StartedAt, &run.FinishedAt, &run.RolledBackAt)
+	if err != nil {
+		return nil, err
+	}
+	if reportDate != nil {
+		d := reportDate.Format(dateLayout)
+		run.ReportDate = &d
+	}
+	return &run, nil
+}
+
+// jhuSyncer updates the figures of the countries and provinces found in the
+// latest JHU CSSE daily report. Countries are matched by name, or through
+// names mapping report names to country ids, and provinces by name or alias.
+type jhuSyncer struct {
+	baseURL string
+	names   map[string]string
+	client  *http.Client
+
+	countries     CountryRepository
+	provinces     ProvinceRepository
+	runs          SyncRunRepository
+	notifications NotificationRepository
+	changes       *changeHub
+
+	mu      sync.Mutex
+	running bool
+}
+
+func newJHUSyncer(baseURL string, names map[string]string, client *http.Client, r *Repository, changes *changeHub) *jhuSyncer {
+	if baseURL == "" {
+		baseURL = defaultJHUReportsURL
+	}
+	return &jhuSyncer{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		names:         names,
+		client:        client,
+		countries:     r.CountryRepo,
+		provinces:     r.ProvinceRepo,
+		runs:          r.SyncRunRepo,
+		notifications: r.NotificationRepo,
+		changes:       changes,
+	}
+}
+
+// parseJHUNames reads "report name=country id" pairs separated by commas.
+func parseJHUNames(v string) (map[string]string, error) {
+	names := make(map[string]string)
+	if v == "" {
+		return names, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("jhu: invalid name mapping %q", pair)
+		}
+		names[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return names, nil
+}
+
+// Run syncs every interval until ctx is done.
+func (js *jhuSyncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		syncCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+		if _, err := js.Sync(syncCtx); err != nil && !errors.Is(err, errSyncRunning) {
+			logger.Error().Err(err).Msg("jhu: sync failed")
+		}
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync runs one sync and records it, failed runs being reported to the
+// notification center.
+func (js *jhuSyncer) Sync(ctx context.Context) (*SyncRun, error) {
+	js.mu.Lock()
+	if js.running {
+		js.mu.Unlock()
+		return nil, errSyncRunning
+	}
+	js.running = true
+	js.mu.Unlock()
+	defer func() {
+		js.mu.Lock()
+		js.running = false
+		js.mu.Unlock()
+	}()
+
+	run := &SyncRun{ID: uuid.NewV4().String(), Source: sourceJHU, StartedAt: time.Now(),
+		Unmatched: make([]string, 0), Conflicts: make([]string, 0)}
+	err := js.sync(ctx, run)
+	run.FinishedAt = time.Now()
+	run.Status = SyncSucceeded
+
+	// recorded even when ctx ran out
+	recordCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err != nil {
+		run.Status = SyncFailed
+		run.Error = err.Error()
+		n := NewNotification(NotificationImportFailed, run.ID, "JHU CSSE sync failed: %s", err)
+		if nErr := js.notifications.Save(recordCtx, n); nErr != nil {
+			logger.Error().Err(nErr).Str("sync_run_id", run.ID).Msg("jhu: failed to notify")
+		}
+	}
+	if saveErr := js.runs.Save(recordCtx, run); saveErr != nil {
+		return run, saveErr
+	}
+	return run, err
+}
+
+func (js *jhuSyncer) sync(ctx context.Context, run *SyncRun) error {
+	report, err := js.latestReport(ctx)
+	if err != nil {
+		return err
+	}
+	d := report.Date.Format(dateLayout)
+	run.ReportDate = &d
+
+	countryIDs, err := js.matchCountries(ctx, report)
+	if err != nil {
+		return err
+	}
+	for ck := range report.Countries {
+		if countryIDs[ck] == "" {
+			run.Unmatched = append(run.Unmatched, report.Names[ck])
+		}
+	}
+	sort.Strings(run.Unmatched)
+
+	for ck, id := range countryIDs {
+		if id == "" {
+			continue
+		}
+		country, err := js.countries.GetByID(forWrite(ctx), id)
+		if err != nil {
+			return err
+		}
+		updated, err := js.updateCountry(ctx, run, country, report.Countries[ck])
+		if err != nil {
+			return err
+		}
+		if updated {
+			run.CountriesUpdated++
+		}
+
+		for pk, f := range report.Provinces[ck] {
+			p := findProvince(country, report.Names[ck+"/"+pk])
+			if p == nil {
+				if resolved, err := js.provinces.Resolve(ctx, report.Names[ck+"/"+pk]); err == nil {
+					p = findProvince(country, resolved.ID)
+				}
+			}
+			if p == nil {
+				run.Unmatched = append(run.Unmatched, report.Names[ck]+"/"+report.Names[ck+"/"+pk])
+				continue
+			}
+			updated, err := js.updateProvince(ctx, run, p, f)
+			if err != nil {
+				return err
+			}
+			if updated {
+				run.ProvincesUpdated++
+			}
+		}
+	}
+	return nil
+}
+
+// latestReport fetches the daily report of today, or of the latest day
+// before it one was published for.
+func (js *jhuSyncer) latestReport(ctx context.Context) (*jhuReport, error) {
+	day := time.Now().UTC()
+	for i := 0; i < jhuLookbackDays; i++ {
+		date := time.Date(day.Year(), day.Month(), day.Day()-i, 0, 0, 0, 0, time.UTC)
+		url := fmt.Sprintf("%s/%s.csv", js.baseURL, date.Format("01-02-2006"))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := js.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("jhu: fetch %s: %w", url, err)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			res.Body.Close()
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("jhu: fetch %s: %s", url, res.Status)
+		}
+		report, err := parseJHUReport(res.Body, date)
+		res.Body.Close()
+		return report, err
+	}
+	return nil, fmt.Errorf("jhu: no daily report in the last %d days", jhuLookbackDays)
+}
+
+// matchCountries maps the countries of the report to country ids, empty for
+// the ones not found.
+func (js *jhuSyncer) matchCountries(ctx context.Context, report *jhuReport) (map[string]string, error) {
+	byName := make(map[string]string)
+	for page := uint64(1); ; page++ {
+		cs, err := js.countries.List(ctx, page, maxCountryLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			byName[strings.ToLower(c.Name)] = c.ID
+		}
+		if len(cs) < maxCountryLimit {
+			break
+		}
+	}
+
+	ids := make(map[string]string, len(report.Countries))
+	for ck := range report.Countries {
+		if id, ok := js.names[ck]; ok {
+			ids[ck] = id
+		} else {
+			ids[ck] = byName[ck]
+		}
+	}
+	return ids, nil
+}
+
+// findProvince finds a province of country by id or name.
+func findProvince(country *Country, key string) *Province {
+	for _, p := range country.Provinces {
+		if p.ID == key || strings.EqualFold(p.Name, key) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (js *jhuSyncer) updateCountry(ctx context.Context, run *SyncRun, current *Country, f *jhuFigures) (bool, error) {
+	c := *current
+	c.Total, c.Dead, c.DecoveringCase = f.Confirmed, f.Deaths, f.Recovered
+	if f.Confirmed > current.Total {
+		c.NewCase = f.Confirmed - current.Total
+	}
+	if current.Equal(&c) {
+		return false, nil
+	}
+	c.UpdatedAt = time.Now()
+	if err := js.countries.Update(ctx, &c); err != nil {
+		return false, err
+	}
+	run.touched("country", c.ID, "", countryFigures(current), c.UpdatedAt)
+	js.changes.Publish(countryKey(c.ID))
+	return true, nil
+}
+
+func (js *jhuSyncer) updateProvince(ctx context.Context, run *SyncRun, current *Province, f *jhuFigures) (bool, error) {
+	p := *current
+	p.Total, p.Dead, p.DecoveringCase = f.Confirmed, f.Deaths, f.Recovered
+	if f.Confirmed > current.Total {
+		p.NewCase = f.Confirmed - current.Total
+	}
+	if current.Equal(&p) {
+		return false, nil
+	}
+	p.UpdatedAt = time.Now()
+	if err := js.provinces.Update(ctx, &p); err != nil {
+		return false, err
+	}
+	run.touched("province", p.ID, "", provinceFigures(current), p.UpdatedAt)
+	js.changes.Publish(provinceKey(p.ID))
+	return true, nil
+}
+
+// handler
+type syncService struct {
+	jhu *jhuSyncer
+	// nil when DHIS2 is not configured
+	dhis2   *dhis2Syncer
+	runs    SyncRunRepository
+	jobs    *jobRunner
+	changes *changeHub
+}
+
+func NewSyncService(jhu *jhuSyncer, dhis2 *dhis2Syncer, runs SyncRunRepository, jobs *jobRunner, changes *changeHub) *syncService {
+	return &syncService{jhu: jhu, dhis2: dhis2, runs: runs, jobs: jobs, changes: changes}
+}
+
+func (sA *syncService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// TriggerJHU starts a sync in the background, to be followed through the job.
+func (sA *syncService) TriggerJHU(c echo.Context) error {
+	job := sA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+		run, err := sA.jhu.Sync(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]*SyncRun{"sync_run": run}, nil
+	})
+	return acceptJob(c, job)
+}
+
+func (sA *syncService) JHUStatus(c echo.Context) error {
+	run, err := sA.runs.GetLatest(c.Request().Context(), sourceJHU)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*SyncRun{"sync_run": run})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// finished jobs are kept around this long for clients to pick up the result
+const jobRetention = time.Hour
+
+// the longest a job may run, its database calls being cancelled past it
+const jobTimeout = 10 * time.Minute
+
+type Job struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+type JobFunc func(ctx context.Context) (interface{}, error)
+
+// jobRunner runs work in the background of the dyno that accepted it. Jobs
+// live in memory only, so their status is lost on restart and only the dyno
+// running a job can report on it.
+type jobRunner struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	wg   sync.WaitGroup
+
+	// failed jobs are reported to the notification center
+	notifications NotificationRepository
+}
+
+func newJobRunner(notifications NotificationRepository) *jobRunner {
+	return &jobRunner{jobs: make(map[string]*Job), notifications: notifications}
+}
+
+func (jr *jobRunner) Submit(fn JobFunc) *Job {
+	job := &Job{
+		ID:        uuid.NewV4().String(),
+		Status:    JobPending,
+		CreatedAt: time.Now(),
+	}
+
+	jr.mu.Lock()
+	jr.purge()
+	jr.jobs[job.ID] = job
+	jr.mu.Unlock()
+
+	jr.wg.Add(1)
+	go func() {
+		defer jr.wg.Done()
+		jr.setStatus(job.ID, JobRunning, nil, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+		defer cancel()
+		result, err := fn(ctx)
+		if err != nil {
+			jr.setStatus(job.ID, JobFailed, nil, err)
+			jr.notifyFailure(job.ID, err)
+			return
+		}
+		jr.setStatus(job.ID, JobSucceeded, result, nil)
+	}()
+
+	return jr.snapshot(job)
+}
+
+func (jr *jobRunner) Get(id string) (*Job, bool) {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+	job, ok := jr.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	j := *job
+	return &j, true
+}
+
+// Wait blocks until every submitted job has finished.
+func (jr *jobRunner) Wait() {
+	jr.wg.Wait()
+}
+
+func (jr *jobRunner) snapshot(job *Job) *Job {
+	jr.mu.RLock()
+	defer jr.mu.RUnlock()
+	j := *job
+	return &j
+}
+
+func (jr *jobRunner) setStatus(id, status string, result interface{}, err error) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	job := jr.jobs[id]
+	job.Status = status
+	job.Result = result
+	if err != nil {
+		_, job.Error = errorStatus(err, "Internal server error")
+	}
+	if status == JobSucceeded || status == JobFailed {
+		now := time.Now()
+		job.FinishedAt = &now
+	}
+}
+
+func (jr *jobRunner) notifyFailure(id string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n := NewNotification(NotificationJobFailed, id, "job %s failed: %v", id, err)
+	if err := jr.notifications.Save(ctx, n); err != nil {
+		logger.Error().Err(err).Str("job_id", id).Msg("job: failed to record notification")
+	}
+}
+
+// purge drops jobs that finished more than jobRetention ago, jr.mu must be held.
+func (jr *jobRunner) purge() {
+	for id, job := range jr.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(jr.jobs, id)
+		}
+	}
+}
+
+// respondAsync reports whether the client asked with Prefer: respond-async
+// for the work to be acknowledged before it is done.
+func respondAsync(r *http.Request) bool {
+	for _, prefer := range r.Header["Prefer"] {
+		for _, p := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(p), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptJob answers 202 with where the status of job can be followed.
+func acceptJob(c echo.Context, job *Job) error {
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/jobs/"+job.ID)
+	c.Response().Header().Set("Preference-Applied", "respond-async")
+	return c.JSON(http.StatusAccepted, map[string]*Job{"job": job})
+}
+
+type jobService struct {
+	jobs *jobRunner
+}
+
+func NewJobService(jobs *jobRunner) *jobService {
+	return &jobService{jobs: jobs}
+}
+
+func (jS *jobService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (jS *jobService) FindByJobID(c echo.Context) error {
+	job, ok := jS.jobs.Get(c.Param("job_id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, jS.errMessage(errNotFound.Error()))
+	}
+	return c.JSON(http.StatusOK, map[string]*Job{"job": job})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultJournalLimit = 100
+	maxJournalLimit     = 1000
+)
+
+// maxJournalBody is the largest body recorded, larger ones are truncated and
+// cannot be replayed faithfully.
+const maxJournalBody = 1 << 20
+
+// fields removed from recorded bodies, at any depth
+var secretFields = map[string]bool{"password": true, "token": true, "secret": true}
+
+// routes never recorded
+var unjournaledPaths = map[string]bool{"/api/v1/auth/login": true, "/api/v1/validate": true, "/api/v1/push/subscriptions": true,
+	"/api/v1/developers": true, "/api/v1/developers/verify": true, "/api/v1/developers/me/key": true,
+	"/api/v1/admin/history/backfill": true}
+
+// JournalEntry is a write request as it was received, for replaying.
+type JournalEntry struct {
+	ID         int64     `json:"id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	Body       string    `json:"body"`
+	Actor      string    `json:"actor"`
+	Status     int       `json:"status"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type Journal []*JournalEntry
+
+// sanitizeBody drops the secretFields of a JSON body, other bodies are kept
+// as they are.
+func sanitizeBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	b, err := json.Marshal(dropSecrets(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(b)
+}
+
+func dropSecrets(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, f := range v {
+			if secretFields[strings.ToLower(k)] {
+				delete(v, k)
+				continue
+			}
+			v[k] = dropSecrets(f)
+		}
+	case []interface{}:
+		for i, f := range v {
+			v[i] = dropSecrets(f)
+		}
+	}
+	return v
+}
+
+// actorOf names the authenticated caller of a request, empty when anonymous.
+func actorOf(ctx context.Context) string {
+	if id, ok := ctx.Value(identityKey{}).(*identity); ok && id.claims != nil {
+		return id.claims.Subject
+	}
+	return ""
+}
+
+// Repository
+type JournalRepository interface {
+	Save(ctx context.Context, e *JournalEntry) error
+	GetSince(ctx context.Context, afterID int64, limit uint64) (Journal, error)
+}
+
+type journalRepo struct {
+	db *sql.DB
+}
+
+var _ JournalRepository = &journalRepo{}
+
+func NewJournalRepo(db *sql.DB) *journalRepo {
+	return &journalRepo{db}
+}
+
+func (jr *journalRepo) Save(ctx context.Context, e *JournalEntry) error {
+	if err := squirrel.Insert("request_journal").
+		Columns("method", "path", "query", "body", "actor", "status", "recorded_at").
+		Values(&e.Method, &e.Path, &e.Query, &e.Body, &e.Actor, &e.Status, &e.RecordedAt).
+		Suffix("RETURNING id").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(jr.db).QueryRowContext(ctx).Scan(&e.ID); err != nil {
+		return wrapErr("journal", "", "insert entry", err)
+	}
+	return nil
+}
+
+func (jr *journalRepo) GetSince(ctx context.Context, afterID int64, limit uint64) (Journal, error) {
+	rows, err := squirrel.Select("id", "method", "path", "query", "body", "actor", "status", "recorded_at").
+		From("request_journal").
+		Where(squirrel.Gt{"id": afterID}).
+		OrderBy("id").
+		Limit(limit).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(jr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("journal", "", "select entries", err)
+	}
+	defer rows.Close()
+
+	var j = make(Journal, 0)
+	for rows.Next() {
+		var e JournalEntry
+		if err := rows.Scan(&e.ID, &e.Method, &e.Path, &e.Query, &e.Body, &e.Actor, &e.Status, &e.RecordedAt); err != nil {
+			return nil, wrapErr("journal", "", "scan entries", err)
+		}
+		j = append(j, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("journal", "", "select entries", err)
+	}
+	return j, nil
+}
+
+// handler
+type journalService struct {
+	jApp JournalRepository
+}
+
+func NewJournalService(jApp JournalRepository) *journalService {
+	return &journalService{jApp: jApp}
+}
+
+func (jA *journalService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// Record is the middleware journaling the write requests, whatever their
+// outcome, once they are answered.
+func (jA *journalService) Record(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		r := c.Request()
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if unjournaledPaths[r.URL.Path] {
+			return next(c)
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, jA.errMessage("request: unable to read request payload"))
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		err := next(c)
+
+		if len(body) > maxJournalBody {
+			body = body[:maxJournalBody]
+		}
+		e := &JournalEntry{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Body:       sanitizeBody(body),
+			Actor:      actorOf(c.Request().Context()),
+			Status:     c.Response().Status,
+			RecordedAt: time.Now(),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if saveErr := jA.jApp.Save(ctx, e); saveErr != nil {
+			logFor(c.Request().Context()).Error().Err(saveErr).Msg("journal: failed to record")
+		}
+		return err
+	}
+}
+
+// ListEntries pages through the journal by id, from the entry after ?after=.
+func (jA *journalService) ListEntries(c echo.Context) error {
+	var after int64
+	if v := c.QueryParam("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return c.JSON(http.StatusBadRequest, jA.errMessage("request: after must be a non-negative integer"))
+		}
+		after = n
+	}
+	limit := uint64(defaultJournalLimit)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n == 0 || n > maxJournalLimit {
+			return c.JSON(http.StatusBadRequest, jA.errMessage(fmt.Sprintf("request: limit must be between 1 and %d", maxJournalLimit)))
+		}
+		limit = n
+	}
+
+	j, err := jA.jApp.GetSince(c.Request().Context(), after, limit)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, jA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Journal{"journal": j})
+}
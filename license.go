@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo"
+)
+
+// the license the data is published under when DATA_LICENSE is not set
+const (
+	defaultDataLicense    = "CC-BY-4.0"
+	defaultDataLicenseURL = "https://creativecommons.org/licenses/by/4.0/"
+)
+
+// License is the license the data is published under, for clients to show
+// and cite it without reading the terms by hand.
+type License struct {
+	// ID is the SPDX identifier of the license.
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	Attribution string `json:"attribution"`
+	Citation    string `json:"citation"`
+}
+
+// licenseFromEnv reads DATA_LICENSE, DATA_LICENSE_URL, DATA_ATTRIBUTION and
+// DATA_CITATION, a license left unset being CC-BY-4.0.
+func licenseFromEnv() *License {
+	l := &License{
+		ID:          os.Getenv("DATA_LICENSE"),
+		URL:         os.Getenv("DATA_LICENSE_URL"),
+		Attribution: os.Getenv("DATA_ATTRIBUTION"),
+		Citation:    os.Getenv("DATA_CITATION"),
+	}
+	if l.ID == "" {
+		l.ID = defaultDataLicense
+		if l.URL == "" {
+			l.URL = defaultDataLicenseURL
+		}
+	}
+	return l
+}
+
+// handler
+type licenseService struct {
+	license *License
+}
+
+func NewLicenseService() *licenseService {
+	return &licenseService{license: licenseFromEnv()}
+}
+
+func (lA *licenseService) License(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]*License{"license": lA.license})
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+)
+
+const (
+	// changes buffered for a connection, one falling further behind is closed
+	liveBuffer       = 64
+	livePingInterval = 30 * time.Second
+	liveWriteTimeout = 10 * time.Second
+	liveMaxMessage   = 4096
+	// each database read of a connection, which has no deadline of its own
+	liveReadTimeout = 10 * time.Second
+)
+
+// anyone may read the figures, as with CORS
+var liveUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// liveRequest is a message sent by a client, subscribing to or unsubscribing
+// from the changes of a country.
+type liveRequest struct {
+	Action    string `json:"action"`
+	CountryID string `json:"country_id"`
+}
+
+// liveMessage is a message pushed to a client. Changes carry the record as it
+// is after the change under the key naming it.
+type liveMessage struct {
+	Type      string    `json:"type"`
+	Entity    string    `json:"entity,omitempty"`
+	ID        string    `json:"id,omitempty"`
+	CountryID string    `json:"country_id,omitempty"`
+	Country   *Country  `json:"country,omitempty"`
+	Province  *Province `json:"province,omitempty"`
+	District  *District `json:"district,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// liveEvent is a change of an entity of a country a connection subscribed to.
+type liveEvent struct {
+	entity    string
+	id        string
+	countryID string
+}
+
+// liveHub fans the changes published on the change hub out to the WebSocket
+// connections subscribed to the country they belong to.
+type liveHub struct {
+	mu     sync.Mutex
+	conns  map[*liveConn]struct{}
+	closed <-chan struct{}
+}
+
+func newLiveHub(changes *changeHub) *liveHub {
+	h := &liveHub{conns: make(map[*liveConn]struct{}), closed: changes.Closed()}
+	changes.Listen(h.publish)
+	return h
+}
+
+func (h *liveHub) add(lc *liveConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[lc] = struct{}{}
+}
+
+func (h *liveHub) remove(lc *liveConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, lc)
+}
+
+func (h *liveHub) publish(keys []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for lc := range h.conns {
+		ev := lc.match(keys)
+		if ev == nil {
+			continue
+		}
+		select {
+		case lc.events <- ev:
+		default:
+			lc.lag()
+		}
+	}
+}
+
+// liveConn is one WebSocket connection. Only its write loop writes to it.
+type liveConn struct {
+	ws      *websocket.Conn
+	events  chan *liveEvent
+	replies chan *liveMessage
+	lagged  chan struct{}
+	lagOnce sync.Once
+	// embargoed tells whether the caller is under embargo by now, the
+	// connection being closed before it is sent a change then
+	embargoed func() bool
+
+	mu sync.Mutex
+	// change keys followed, to the id of the country subscribed to
+	keys map[string]string
+}
+
+func (lc *liveConn) lag() {
+	lc.lagOnce.Do(func() { close(lc.lagged) })
+}
+
+// match returns the change of keys lc follows, described by the first of the
+// keys, the most specific one, or nil when it follows none of them.
+func (lc *liveConn) match(keys []string) *liveEvent {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for _, key := range keys {
+		countryID, ok := lc.keys[key]
+		if !ok {
+			continue
+		}
+		kv := strings.SplitN(keys[0], ":", 2)
+		if len(kv) != 2 {
+			return nil
+		}
+		return &liveEvent{entity: kv[0], id: kv[1], countryID: countryID}
+	}
+	return nil
+}
+
+// follow sets the keys of country, and of its provinces, for the changes of
+// lc. Districts are reached through their province.
+func (lc *liveConn) follow(country *Country) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.unfollowLocked(country.ID)
+	lc.keys[countryKey(country.ID)] = country.ID
+	for _, p := range country.Provinces {
+		lc.keys[provinceKey(p.ID)] = country.ID
+	}
+}
+
+func (lc *liveConn) unfollow(countryID string) bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.unfollowLocked(countryID)
+}
+
+func (lc *liveConn) unfollowLocked(countryID string) bool {
+	found := false
+	for key, id := range lc.keys {
+		if id == countryID {
+			delete(lc.keys, key)
+			found = true
+		}
+	}
+	return found
+}
+
+// handler
+type liveService struct {
+	countries CountryRepository
+	provinces ProvinceRepository
+	districts DistrictRepository
+	hub       *liveHub
+}
+
+func NewLiveService(countries CountryRepository, provinces ProvinceRepository, districts DistrictRepository, changes *changeHub) *liveService {
+	return &liveService{
+		countries: countries,
+		provinces: provinces,
+		districts: districts,
+		hub:       newLiveHub(changes),
+	}
+}
+
+func (lA *liveService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// Live upgrades the request to a WebSocket pushing the changes of countries,
+// and of their provinces and districts, as they are saved. Countries are
+// subscribed to with ?country_id=, which may be repeated, or by sending
+// {"action": "subscribe", "country_id": "..."}, and unsubscribed from with
+// the unsubscribe action.
+func (lA *liveService) Live(c echo.Context) error {
+	countryIDs := c.QueryParams()["country_id"]
+	if len(countryIDs) > liveBuffer {
+		return c.JSON(http.StatusBadRequest, lA.errMessage(fmt.Sprintf("request: at most %d country_id", liveBuffer)))
+	}
+	ws, err := liveUpgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// the upgrader already answered
+		return nil
+	}
+	defer ws.Close()
+
+	lc := &liveConn{
+		ws:      ws,
+		events:  make(chan *liveEvent, liveBuffer),
+		replies: make(chan *liveMessage, liveBuffer),
+		lagged:  make(chan struct{}),
+		keys:    make(map[string]string),
+		embargoed: func() bool {
+			_, ok := embargoAt(c.Request().Context(), time.Now())
+			return ok
+		},
+	}
+	lA.hub.add(lc)
+	defer lA.hub.remove(lc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, id := range countryIDs {
+		lc.replies <- lA.subscribe(ctx, lc, id)
+	}
+	go func() {
+		defer cancel()
+		lA.readLoop(ctx, lc)
+	}()
+	lA.writeLoop(ctx, lc)
+	return nil
+}
+
+func (lA *liveService) subscribe(ctx context.Context, lc *liveConn, countryID string) *liveMessage {
+	ctx, cancel := context.WithTimeout(ctx, liveReadTimeout)
+	defer cancel()
+	country, err := lA.countries.GetByID(ctx, countryID)
+	if err != nil {
+		_, msg := errorStatus(err, "Internal server error")
+		return &liveMessage{Type: "error", CountryID: countryID, Error: msg}
+	}
+	lc.follow(country)
+	return &liveMessage{Type: "subscribed", CountryID: country.ID, Country: country}
+}
+
+func (lA *liveService) readLoop(ctx context.Context, lc *liveConn) {
+	lc.ws.SetReadLimit(liveMaxMessage)
+	lc.ws.SetReadDeadline(time.Now().Add(2 * livePingInterval))
+	lc.ws.SetPongHandler(func(string) error {
+		return lc.ws.SetReadDeadline(time.Now().Add(2 * livePingInterval))
+	})
+	for {
+		_, data, err := lc.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req liveRequest
+		var reply *liveMessage
+		switch err := json.Unmarshal(data, &req); {
+		case err != nil:
+			reply = &liveMessage{Type: "error", Error: "request: unable to parse message"}
+		case req.Action == "subscribe":
+			reply = lA.subscribe(ctx, lc, req.CountryID)
+		case req.Action == "unsubscribe":
+			if !lc.unfollow(req.CountryID) {
+				reply = &liveMessage{Type: "error", CountryID: req.CountryID, Error: "Error: Not subscribed to the country"}
+			} else {
+				reply = &liveMessage{Type: "unsubscribed", CountryID: req.CountryID}
+			}
+		default:
+			reply = &liveMessage{Type: "error", Error: "request: action must be subscribe or unsubscribe"}
+		}
+		select {
+		case lc.replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (lA *liveService) writeLoop(ctx context.Context, lc *liveConn) {
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	for {
+		var msg *liveMessage
+		select {
+		case <-ctx.Done():
+			return
+		case <-lc.lagged:
+			lc.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"),
+				time.Now().Add(liveWriteTimeout))
+			return
+		case <-lA.hub.closed:
+			lc.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(liveWriteTimeout))
+			return
+		case <-ping.C:
+			if err := lc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteTimeout)); err != nil {
+				return
+			}
+			continue
+		case msg = <-lc.replies:
+		case ev := <-lc.events:
+			if lc.embargoed() {
+				lc.ws.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "figures under embargo"),
+					time.Now().Add(liveWriteTimeout))
+				return
+			}
+			msg = lA.change(ctx, lc, ev)
+			if msg == nil {
+				continue
+			}
+		}
+		lc.ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		if err := lc.ws.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// change reads the record ev is about, nil when it is gone.
+func (lA *liveService) change(ctx context.Context, lc *liveConn, ev *liveEvent) *liveMessage {
+	ctx, cancel := context.WithTimeout(ctx, liveReadTimeout)
+	defer cancel()
+	msg := &liveMessage{Type: "change", Entity: ev.entity, ID: ev.id, CountryID: ev.countryID}
+	var err error
+	switch ev.entity {
+	case "country":
+		msg.Country, err = lA.countries.GetByID(ctx, ev.id)
+		if err == nil {
+			// provinces may have been split or merged
+			lc.follow(msg.Country)
+		}
+	case "province":
+		msg.Province, err = lA.provinces.GetByID(ctx, ev.id)
+	case "district":
+		msg.District, err = lA.districts.GetByID(ctx, ev.id)
+	default:
+		return nil
+	}
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Err(err).Str(ev.entity+"_id", ev.id).Msg("live: failed to read")
+		}
+		return nil
+	}
+	return msg
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rs/zerolog"
+)
+
+// logger writes the logs of the server as JSON lines to stdout, those of a
+// request going through the logger of its context instead, see logFor.
+var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+// setLogLevel drops the logs below level: debug, info, warn or error.
+func setLogLevel(level string) error {
+	l, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(l)
+	return nil
+}
+
+// logFor is the logger of the request ctx belongs to, or the server one
+// for the background jobs.
+func logFor(ctx context.Context) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &logger
+}
+
+// requestLogger gives every request a logger carrying its id and route,
+// then logs the request once answered with its status, latency and the ids
+// of the entities of its path, such as country_id. It must come after the
+// RequestID middleware.
+func requestLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req, res := c.Request(), c.Response()
+		lc := logger.With().
+			Str("request_id", res.Header().Get(echo.HeaderXRequestID)).
+			Str("method", req.Method).
+			Str("route", c.Path())
+		if s := spanFrom(req.Context()); s != nil {
+			lc = lc.Hex("trace_id", s.traceID[:])
+		}
+		l := lc.Logger()
+		c.SetRequest(req.WithContext(l.WithContext(req.Context())))
+
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			// answers the error now, so that its status is the one logged
+			c.Error(err)
+		}
+
+		ev := l.Info()
+		switch {
+		case res.Status >= 500:
+			ev = l.Error()
+		case res.Status >= 400:
+			ev = l.Warn()
+		}
+		for i, name := range c.ParamNames() {
+			if values := c.ParamValues(); i < len(values) {
+				ev = ev.Str(name, values[i])
+			}
+		}
+		if err != nil {
+			ev = ev.Err(err)
+		}
+		ev.Str("uri", req.RequestURI).
+			Str("remote_ip", c.RealIP()).
+			Int("status", res.Status).
+			Dur("latency", time.Since(start)).
+			Int64("bytes_out", res.Size).
+			Msg("request")
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 60 * time.Second
+)
+
+// countryVersion is when a country or any of its provinces last changed.
+func countryVersion(c *Country) time.Time {
+	v := c.UpdatedAt
+	for _, p := range c.Provinces {
+		if p.UpdatedAt.After(v) {
+			v = p.UpdatedAt
+		}
+	}
+	return v
+}
+
+// WaitCountry holds the request until the country or one of its provinces
+// changes, answering with the country, or until ?timeout= elapses, answering
+// 204. A client passing the updated_at of the country it last saw as
+// ?since= is answered right away when it missed a change in between polls.
+func (cA *countryService) WaitCountry(c echo.Context) error {
+	timeout := defaultWaitTimeout
+	if v := c.QueryParam("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxWaitTimeout {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(fmt.Sprintf("request: timeout must be a duration up to %s", maxWaitTimeout)))
+		}
+		timeout = d
+	}
+	var since time.Time
+	if v := c.QueryParam("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, cA.errMessage("request: since must be an RFC 3339 time"))
+		}
+		since = t
+	}
+
+	ctx := c.Request().Context()
+	id := c.Param("country_id")
+
+	// subscribe before reading so that a change in between is not missed
+	sub := cA.changes.Subscribe(countryKey(id))
+	defer sub.Close()
+	country, err := cA.cApp.GetByID(ctx, id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	for _, p := range country.Provinces {
+		sub.Add(provinceKey(p.ID))
+	}
+	if !since.IsZero() && countryVersion(country).After(since) {
+		return c.JSON(http.StatusOK, map[string]*Country{"country": country})
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-sub.C:
+	case <-timer.C:
+		return c.NoContent(http.StatusNoContent)
+	case <-cA.changes.Closed():
+		// as if it timed out, polling again reaches another instance
+		return c.NoContent(http.StatusNoContent)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// the embargo may have begun while waiting
+	if _, ok := embargoed(c); ok {
+		status, msg := errorStatus(errEmbargoed, "")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+
+	country, err = cA.cApp.GetByID(ctx, id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*Country{"country": country})
+}
@@ -1,679 +1,1639 @@
-package main
-
-import (
-	"context"
-	"database/sql"
-	"errors"
-	"fmt"
-	"html"
-	"net/http"
-	"os"
-	"strings"
-	"time"
-
-	"github.com/Masterminds/squirrel"
-	"github.com/labstack/echo"
-	"github.com/labstack/echo/middleware"
-	_ "github.com/lib/pq"
-	"github.com/myesui/uuid"
-)
-
-func getPort() string {
-	// the PORT is supplied by Heroku
-	port := os.Getenv("PORT")
-	if port == "" {
-		return ":5551"
-	}
-	return ":" + port
-}
-
-func failOnError(err error, msg string) {
-	if err != nil {
-		fmt.Printf("%s: %+v\n ", msg, err)
-		os.Exit(1)
-	}
-}
-
-var errNotFound = errors.New("Error: No data found")
-
-func main() {
-	dbURL := os.Getenv("DATABASE_URL")
-	db, err := sql.Open("postgres", dbURL)
-	failOnError(err, "failed to connect db")
-	defer db.Close()
-
-	err = db.Ping()
-	failOnError(err, "failed to connect db")
-
-	e := echo.New()
-	e.Use(middleware.RequestID())
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	serives, err := NewRepositories(db)
-	failOnError(err, "failed to connect db")
-
-	country := NewCountryService(serives.CountryRepo, serives.ProvinceRepo)
-	province := NewProvinceService(serives.ProvinceRepo)
-
-	e.GET("/api/v1/country/:country_id", country.FindByCountryID)
-	e.POST("/api/v1/country", country.Store)
-	e.PUT("/api/v1/country/:country_id", country.Edit)
-	e.PUT("/api/v1/province/:province_id", province.UpdateProvince)
-
-	if err := e.Start(getPort()); err != nil && err != http.ErrServerClosed {
-		fmt.Print(err)
-		os.Exit(1)
-	}
-	defer serives.Close()
-}
-
-// Application
-type countryApp struct {
-	cApp CountryRepository
-}
-
-type CountryAppInterface interface {
-	Save(ctx context.Context, c *Country) error
-	Update(ctx context.Context, c *Country) error
-	Delete(ctx context.Context, c *Country) error
-	GetByID(ctx context.Context, id string) (*Country, error)
-}
-
-var _ CountryAppInterface = &countryRepo{}
-
-func (ca *countryApp) Save(ctx context.Context, ct *Country) error {
-	return ca.cApp.Save(ctx, ct)
-}
-func (ca *countryApp) Update(ctx context.Context, ct *Country) error {
-	return ca.cApp.Update(ctx, ct)
-}
-func (ca *countryApp) Delete(ctx context.Context, ct *Country) error {
-	return ca.cApp.Delete(ctx, ct)
-}
-func (ca *countryApp) GetByID(ctx context.Context, id string) (*Country, error) {
-	return ca.cApp.GetByID(ctx, id)
-}
-
-type provinceApp struct {
-	pApp ProvinceRepository
-}
-
-type ProvinceInterface interface {
-	Save(ctx context.Context, p *Province) error
-	Update(ctx context.Context, p *Province) error
-	Delete(ctx context.Context, p *Province) error
-	GetByID(ctx context.Context, id string) (*Province, error)
-	GetAll(ctx context.Context) (Provinces, error)
-}
-
-var _ ProvinceInterface = &provinceApp{}
-
-func (pa *provinceApp) Save(ctx context.Context, p *Province) error {
-	return pa.pApp.Save(ctx, p)
-}
-func (pa *provinceApp) Update(ctx context.Context, p *Province) error {
-	return pa.pApp.Update(ctx, p)
-}
-func (pa *provinceApp) Delete(ctx context.Context, p *Province) error {
-	return pa.pApp.Delete(ctx, p)
-}
-func (pa *provinceApp) GetByID(ctx context.Context, id string) (*Province, error) {
-	return pa.pApp.GetByID(ctx, id)
-}
-func (pa *provinceApp) GetAll(ctx context.Context) (Provinces, error) {
-	return pa.pApp.GetAll(ctx)
-}
-
-// new handler
-type countryService struct {
-	cApp CountryAppInterface
-	pApp ProvinceInterface
-}
-
-type provinceService struct {
-	pApp ProvinceInterface
-}
-
-type ErrorMsg struct {
-	Msg string `json:"error"`
-}
-
-type SuccessResponse struct {
-	Msg string `json:"success"`
-}
-
-func NewCountryService(cApp CountryAppInterface, pApp ProvinceInterface) *countryService {
-	return &countryService{cApp: cApp, pApp: pApp}
-}
-
-func (cA *countryService) errMessage(err string) *ErrorMsg {
-	return &ErrorMsg{err}
-}
-
-func (cA *countryService) successMsg(success string) *SuccessResponse {
-	return &SuccessResponse{success}
-}
-
-func (cA *countryService) FindByCountryID(c echo.Context) error {
-	country, err := cA.cApp.GetByID(c.Request().Context(),
-		html.EscapeString(strings.TrimSpace(c.Param("country_id"))))
-	if err == errNotFound {
-		return c.JSON(http.StatusNotFound, cA.errMessage(err.Error()))
-	}
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, cA.errMessage("Internal server error"))
-	}
-	return c.JSON(http.StatusOK, map[string]*Country{"country": country})
-}
-
-func (cA *countryService) Store(c echo.Context) error {
-	var country Country
-	if err := c.Bind(&country); err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
-	}
-	country.Prepare()
-	country.BeforeSave()
-	country.UpdatedAt = time.Now()
-	if err := country.Validate(); err != nil {
-		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
-	}
-
-	for _, p := range country.Provinces {
-		p.Prepare()
-		p.BeforeSave()
-		p.UpdatedAt = time.Now()
-		if err := p.Validate(); err != nil {
-			return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
-		}
-	}
-
-	if err := cA.cApp.Save(c.Request().Context(), &country); err != nil {
-		return c.JSON(http.StatusInternalServerError, cA.errMessage("Internal server error"))
-	}
-
-	return c.JSON(http.StatusOK, map[string]*Country{"country": &country})
-}
-
-func (cA *countryService) Edit(c echo.Context) error {
-	var country Country
-	if err := c.Bind(&country); err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
-	}
-	country.Prepare()
-	country.UpdatedAt = time.Now()
-	if err := country.Validate(); err != nil {
-		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
-	}
-
-	for _, p := range country.Provinces {
-		if err := p.Validate(); err != nil {
-			return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
-		}
-	}
-
-	for _, p := range country.Provinces {
-		p.Prepare()
-		p.UpdatedAt = time.Now()
-		if err := cA.pApp.Update(c.Request().Context(), p); err != nil {
-			return c.JSON(http.StatusInternalServerError, cA.errMessage("Internal server error, could not update province information"))
-		}
-	}
-
-	if err := cA.cApp.Update(c.Request().Context(), &country); err != nil {
-		return c.JSON(http.StatusInternalServerError, cA.errMessage("Internal server error"))
-	}
-
-	return c.JSON(http.StatusOK, map[string]*Country{"country": &country})
-}
-
-func NewProvinceService(pApp ProvinceInterface) *provinceService {
-	return &provinceService{pApp: pApp}
-}
-
-func (pA *provinceService) errMessage(err string) *ErrorMsg {
-	return &ErrorMsg{err}
-}
-
-func (pA *provinceService) successMsg(success string) *SuccessResponse {
-	return &SuccessResponse{success}
-}
-
-func (pA *provinceService) UpdateProvince(c echo.Context) error {
-	var p Province
-	if err := c.Bind(&p); err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
-	}
-	p.Prepare()
-	p.UpdatedAt = time.Now()
-	if err := p.Validate(); err != nil {
-		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
-	}
-
-	if err := pA.pApp.Update(c.Request().Context(), &p); err != nil {
-		return c.JSON(http.StatusInternalServerError, pA.errMessage("Internal server error, could not update province information"))
-	}
-	return c.JSON(http.StatusOK, map[string]*Province{"province": &p})
-}
-
-// data model
-type District struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Total          int64     `json:"total"`
-	NewCase        int64     `json:"new_case"`
-	Treated        int64     `json:"treaded"`
-	DecoveringCase int64     `json:"decovering_case"`
-	TestCase       int64     `json:"test_case"`
-	Dead           int64     `json:"dead"`
-	NegativeTest   int64     `json:"negative_case"`
-	UpdatedAt      time.Time `json:"updated_at"`
-}
-
-type Districts []*District
-
-func (d *District) Prepare() {
-	d.ID = uuid.NewV4().String()
-	d.Name = html.EscapeString(strings.TrimSpace(d.Name))
-}
-
-func (d *District) BeforeSave() {
-	d.ID = uuid.NewV4().String()
-}
-
-func (d *District) Validate() error {
-	if d.Name == "" {
-		return errors.New("district: name is required")
-	}
-	return nil
-}
-
-type Province struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Total          int64     `json:"total"`
-	NewCase        int64     `json:"new_case"`
-	Treated        int64     `json:"treaded"`
-	DecoveringCase int64     `json:"decovering_case"`
-	TestCase       int64     `json:"test_case"`
-	Dead           int64     `json:"dead"`
-	NegativeTest   int64     `json:"negative_case"`
-	Districts      Districts `json:"districts"`
-	UpdatedAt      time.Time `json:"updated_at"`
-}
-
-type Provinces []*Province
-
-func (p *Province) Prepare() {
-	p.Name = html.EscapeString(strings.TrimSpace(p.Name))
-}
-
-func (p *Province) BeforeSave() {
-	p.ID = uuid.NewV4().String()
-}
-
-func (p *Province) Validate() error {
-	if p.Name == "" {
-		return errors.New("province: name is required")
-	}
-	return nil
-}
-
-type Country struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Total          int64     `json:"total"`
-	NewCase        int64     `json:"new_case"`
-	Treated        int64     `json:"treaded"`
-	DecoveringCase int64     `json:"decovering_case"`
-	TestCase       int64     `json:"test_case"`
-	NegativeTest   int64     `json:"negative_case"`
-	Dead           int64     `json:"dead"`
-	Provinces      Provinces `json:"provinces"`
-	UpdatedAt      time.Time `json:"updated_at"`
-}
-
-type Countries []*Country
-
-func (c *Country) Prepare() {
-	c.Name = html.EscapeString(strings.TrimSpace(c.Name))
-}
-
-func (c *Country) BeforeSave() {
-	c.ID = uuid.NewV4().String()
-}
-
-func (c *Country) Validate() error {
-	if c.Name == "" {
-		return errors.New("country: name is required")
-	}
-	return nil
-}
-
-// Repository
-type CountryRepository interface {
-	Save(ctx context.Context, c *Country) error
-	Update(ctx context.Context, c *Country) error
-	Delete(ctx context.Context, c *Country) error
-	GetByID(ctx context.Context, id string) (*Country, error)
-}
-
-type ProvinceRepository interface {
-	Save(ctx context.Context, p *Province) error
-	Update(ctx context.Context, p *Province) error
-	Delete(ctx context.Context, p *Province) error
-	GetByID(ctx context.Context, id string) (*Province, error)
-	GetAll(ctx context.Context) (Provinces, error)
-}
-
-type DistrictRepository interface {
-	Save(ctx context.Context, c *Country) error
-	Update(ctx context.Context, c *Country) error
-	Delete(ctx context.Context, c *Country) error
-	GetByID(ctx context.Context, id string) (*Country, error)
-	GetAll(ctx context.Context) (Countries, error)
-}
-
-type Repository struct {
-	CountryRepo  CountryRepository
-	ProvinceRepo ProvinceRepository
-	DistrictRepo DistrictRepository
-	DB           *sql.DB
-}
-
-func NewRepositories(db *sql.DB) (*Repository, error) {
-	return &Repository{
-		CountryRepo:  NewCountryRepo(db),
-		ProvinceRepo: NewProvinceRepo(db),
-		DistrictRepo: NewDistrictRepo(db),
-	}, nil
-}
-
-func (r *Repository) Close() error {
-	return r.DB.Close()
-}
-
-// Country Repo
-type countryRepo struct {
-	db *sql.DB
-}
-
-var _ CountryRepository = &countryRepo{}
-
-func NewCountryRepo(db *sql.DB) *countryRepo {
-	return &countryRepo{db}
-}
-
-func (cr *countryRepo) Save(ctx context.Context, c *Country) error {
-	tx, err := cr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err == nil {
-			if commitErr := tx.Commit(); commitErr != nil {
-				return
-			}
-		}
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return
-		}
-	}()
-
-	if _, err := squirrel.Insert("country").
-		Columns("id",
-			"name",
-			"total",
-			"new_case",
-			"treated",
-			"decovering_case",
-			"test_case",
-			"dead",
-			"negative_case",
-			"updated_at").
-		Values(&c.ID,
-			&c.Name,
-			&c.Total,
-			&c.NewCase,
-			&c.Treated,
-			&c.DecoveringCase,
-			&c.TestCase,
-			&c.Dead,
-			&c.NegativeTest,
-			&c.UpdatedAt).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(tx).ExecContext(ctx); err != nil {
-		return err
-	}
-
-	stmProvince := squirrel.Insert("provinces").
-		Columns("id",
-			"name",
-			"total",
-			"new_case",
-			"treated",
-			"decovering_case",
-			"test_case",
-			"dead",
-			"negative_case",
-			"country_id",
-			"updated_at")
-	for _, p := range c.Provinces {
-		stmProvince = stmProvince.Values(&p.ID,
-			&p.Name,
-			&p.Total,
-			&p.NewCase,
-			&p.Treated,
-			&p.DecoveringCase,
-			&p.TestCase,
-			&p.Dead,
-			&p.NegativeTest,
-			&c.ID,
-			&p.UpdatedAt)
-	}
-
-	if _, err := stmProvince.PlaceholderFormat(squirrel.Dollar).RunWith(tx).ExecContext(ctx); err != nil {
-		return err
-	}
-
-	return nil
-}
-func (cr *countryRepo) Update(ctx context.Context, c *Country) error {
-	if _, err := squirrel.Update("country").
-		Set("name", &c.Name).
-		Set("total", &c.Total).
-		Set("new_case", &c.NewCase).
-		Set("treated", &c.Treated).
-		Set("decovering_case", &c.DecoveringCase).
-		Set("test_case", &c.TestCase).
-		Set("dead", &c.Dead).
-		Set("negative_case", &c.NegativeTest).
-		Set("updated_at", &c.UpdatedAt).
-		Where(squirrel.Eq{"id": &c.ID}).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(cr.db).ExecContext(ctx); err != nil {
-		return err
-	}
-
-	return nil
-}
-func (cr *countryRepo) Delete(ctx context.Context, c *Country) error {
-	tx, err := cr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err == nil {
-			if commitErr := tx.Commit(); commitErr != nil {
-				return
-			}
-		}
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return
-		}
-	}()
-
-	if _, err := squirrel.Delete("country").
-		Where(squirrel.Eq{"id": &c.ID}).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(tx).ExecContext(ctx); err != nil {
-		return err
-	}
-
-	if _, err := squirrel.Delete("provinces").
-		Where(squirrel.Eq{"country_id": &c.ID}).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(tx).ExecContext(ctx); err != nil {
-		return err
-	}
-
-	return nil
-}
-func (cr *countryRepo) GetByID(ctx context.Context, id string) (*Country, error) {
-	var c Country
-	err := squirrel.Select("id",
-		"name",
-		"total",
-		"new_case",
-		"treated",
-		"decovering_case",
-		"test_case",
-		"dead",
-		"negative_case",
-		"updated_at").From("country").
-		Where(squirrel.Eq{"id": id}).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(cr.db).ScanContext(ctx,
-		&c.ID,
-		&c.Name,
-		&c.Total,
-		&c.NewCase,
-		&c.Treated,
-		&c.DecoveringCase,
-		&c.TestCase,
-		&c.Dead,
-		&c.NegativeTest,
-		&c.UpdatedAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, errNotFound
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := squirrel.Select("id",
-		"name",
-		"total",
-		"new_case",
-		"treated",
-		"decovering_case",
-		"test_case",
-		"dead",
-		"negative_case",
-		"updated_at").
-		From("provinces").
-		Where(squirrel.Eq{"country_id": id}).
-		OrderBy("total DESC").
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(cr.db).QueryContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var ps = make(Provinces, 0)
-	for rows.Next() {
-		var p Province
-		if err := rows.Scan(&p.ID,
-			&p.Name,
-			&p.Total,
-			&p.NewCase,
-			&p.Treated,
-			&p.DecoveringCase,
-			&p.TestCase,
-			&p.Dead,
-			&p.NegativeTest,
-			&p.UpdatedAt); err != nil {
-			return nil, err
-		}
-		ps = append(ps, &p)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	c.Provinces = ps
-
-	return &c, nil
-}
-
-// Province Repo
-type provinceRepo struct {
-	db *sql.DB
-}
-
-var _ ProvinceRepository = &provinceRepo{}
-
-func NewProvinceRepo(db *sql.DB) *provinceRepo {
-	return &provinceRepo{db}
-}
-
-func (pr *provinceRepo) Save(ctx context.Context, p *Province) error {
-	return nil
-}
-func (pr *provinceRepo) Update(ctx context.Context, p *Province) error {
-	_, err := squirrel.Update("provinces").
-		Set("name", &p.Name).
-		Set("total", &p.Total).
-		Set("treated", &p.Treated).
-		Set("decovering_case", &p.DecoveringCase).
-		Set("test_case", &p.TestCase).
-		Set("dead", &p.Dead).
-		Set("negative_case", &p.NegativeTest).
-		Set("updated_at", &p.UpdatedAt).
-		Where(squirrel.Eq{"id": &p.ID}).
-		PlaceholderFormat(squirrel.Dollar).
-		RunWith(pr.db).ExecContext(ctx)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-func (pr *provinceRepo) Delete(ctx context.Context, p *Province) error {
-	return nil
-}
-func (pr *provinceRepo) GetByID(ctx context.Context, id string) (*Province, error) {
-	return nil, nil
-}
-func (pr *provinceRepo) GetAll(ctx context.Context) (Provinces, error) {
-	return nil, nil
-}
-
-// District Repo
-type districtRepo struct {
-	db *sql.DB
-}
-
-var _ DistrictRepository = &districtRepo{}
-
-func NewDistrictRepo(db *sql.DB) *districtRepo {
-	return &districtRepo{db}
-}
-
-func (dr *districtRepo) Save(ctx context.Context, c *Country) error {
-	return nil
-}
-func (dr *districtRepo) Update(ctx context.Context, c *Country) error {
-	return nil
-}
-func (dr *districtRepo) Delete(ctx context.Context, c *Country) error {
-	return nil
-}
-func (dr *districtRepo) GetByID(ctx context.Context, id string) (*Country, error) {
-	return nil, nil
-}
-func (dr *districtRepo) GetAll(ctx context.Context) (Countries, error) {
-	return nil, nil
-}
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/graph-gophers/graphql-go/relay"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	_ "github.com/lib/pq"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/config"
+	"github.com/phuangpheth/covid19/covid19pb"
+	"github.com/phuangpheth/covid19/migrations"
+	"github.com/phuangpheth/covid19/storage"
+	"google.golang.org/grpc"
+)
+
+func failOnError(err error, msg string) {
+	if err != nil {
+		logger.Fatal().Err(err).Msg(msg)
+	}
+}
+
+var errNotFound = errors.New("Error: No data found")
+
+// how long the checks of the database before serving may take
+const bootTimeout = 30 * time.Second
+
+func main() {
+	// CONFIG_FILE optionally names a YAML file of the settings below, the
+	// environment overriding it.
+	cfg, err := config.Load()
+	failOnError(err, "invalid configuration")
+	failOnError(setLogLevel(cfg.LogLevel), "invalid LOG_LEVEL")
+
+	bootCtx, cancelBoot := context.WithTimeout(context.Background(), bootTimeout)
+	defer cancelBoot()
+	// the database driver setting picks the storage backend, postgres unless
+	// set
+	serives, err := openStorage(bootCtx, cfg.Database)
+	failOnError(err, "failed to connect db")
+	db := serives.DB
+
+	// the schema is checked against the migrations before serving anything,
+	// SCHEMA_DRIFT=readonly serves reads from a drifted schema instead of
+	// refusing to start.
+	selfcheck := newSelfCheck(db, serives.Dialect, serives.Migrations)
+	readiness, err := selfcheck.Check(bootCtx)
+	failOnError(err, "failed to check the database schema")
+	readOnly := false
+	if !readiness.Ready {
+		for _, p := range readiness.Problems {
+			logger.Warn().Str("problem", p).Msg("schema drift")
+		}
+		if os.Getenv("SCHEMA_DRIFT") != "readonly" {
+			failOnError(errors.New("the database does not match the migrations"), "refusing to start")
+		}
+		readOnly = true
+	}
+
+	e := echo.New()
+	// only JSON lines go to stdout
+	e.HideBanner, e.HidePort = true, true
+	e.Use(middleware.RequestID())
+	e.Use(traceRequests)
+	e.Use(requestLogger)
+	e.Use(middleware.Recover())
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{AllowOrigins: cfg.CORS.AllowOrigins}))
+
+	// SQL_DEADLINES=warn only logs the database calls made without a deadline.
+	requestTimeout := time.Duration(cfg.RequestTimeout)
+	e.Use(requestDeadline(requestTimeout))
+
+	// VALIDATE_RESPONSES is meant for debug and staging deployments, it checks
+	// every JSON response against the model schemas and logs the violations.
+	if os.Getenv("VALIDATE_RESPONSES") == "true" {
+		e.Use(middleware.BodyDumpWithConfig(middleware.BodyDumpConfig{
+			// streams would be held in memory for as long as they last
+			Skipper: func(c echo.Context) bool { return streamingRoutes[c.Path()] },
+			Handler: validateResponse,
+		}))
+	}
+	// RESPONSE_ENVELOPE is the envelope of responses whose request does not
+	// ask for one: keyed (the default), data or bare.
+	envelope, err := newEnvelopeShaper(os.Getenv("RESPONSE_ENVELOPE"))
+	failOnError(err, "invalid RESPONSE_ENVELOPE")
+	e.Use(etagMiddleware)
+	e.Use(envelope.Middleware)
+	e.Use(formattingMiddleware(cfg.Deployment.Timezone))
+	e.Use(localizeMessages)
+	if readOnly {
+		e.Use(selfcheck.ReadOnly)
+	}
+
+	jobs := newJobRunner(serives.NotificationRepo)
+
+	// a JWT secret turns on authentication, writes then need a token issued
+	// by POST /api/v1/auth/login.
+	developerUsage := newDeveloperUsage(serives.DeveloperRepo)
+	auth := NewAuthService(serives.UserRepo, serives.TeamRepo, serives.DeveloperRepo, developerUsage, cfg.Auth.JWTSecret, time.Duration(cfg.Auth.JWTTTL))
+	if !auth.Enabled() {
+		logger.Warn().Msg("auth: JWT_SECRET is not set, writes are not authenticated")
+	}
+	// PUBLIC_EMBARGO, a time of day in UTC, shows the callers without a key
+	// of a team nor a token the figures of the day before until then, the
+	// endpoints that cannot refusing them.
+	publicEmbargo, err = publicEmbargoFromEnv()
+	failOnError(err, "invalid embargo configuration")
+	// RATE_LIMIT_PER_IP, RATE_LIMIT_PER_KEY, RATE_LIMIT_PER_DEVELOPER_KEY and
+	// RATE_LIMIT_PER_EMBED_TOKEN cap the requests a minute of a client,
+	// answering 429 over them. Client IPs are limited before authentication,
+	// keys and embed tokens once they are known.
+	limits, err := rateLimitsFromEnv()
+	failOnError(err, "invalid rate limit configuration")
+	e.Use(limits.Middleware)
+	e.Use(auth.Authenticate)
+	e.Use(limits.KeyMiddleware)
+
+	// REQUEST_JOURNAL=true records the write requests, to be replayed against
+	// a staging deployment with covidctl replay.
+	journal := NewJournalService(serives.JournalRepo)
+	if os.Getenv("REQUEST_JOURNAL") == "true" {
+		e.Use(journal.Record)
+	}
+
+	changes := newChangeHub()
+	// the loops running next to the server stop when it shuts down
+	background, stopBackground := context.WithCancel(context.Background())
+
+	if cfg.Cache.RedisURL != "" {
+		cachePool := newRedisPool(cfg.Cache.RedisURL)
+		defer cachePool.Close()
+		serives.CountryRepo = newCachedCountryRepo(serives.CountryRepo, cachePool, time.Duration(cfg.Cache.RedisTTL), changes)
+	}
+	// every instance has a local cache of its own, for deployments without
+	// Redis or in front of it, changes made through another one showing after
+	// its ttl
+	if cfg.Cache.LocalTTL > 0 {
+		localCache := newLRUCache(cfg.Cache.LocalSize, time.Duration(cfg.Cache.LocalTTL))
+		serives.CountryRepo = newLocalCountryRepo(serives.CountryRepo, localCache, changes)
+		serives.ProvinceRepo = newLocalProvinceRepo(serives.ProvinceRepo, localCache, changes)
+	}
+	if cfg.Cache.AggregateTTL > 0 {
+		serives.OutbreakRepo = newCachedOutbreakRepo(serives.OutbreakRepo, newAggregateCache(time.Duration(cfg.Cache.AggregateTTL)))
+	}
+
+	country := NewCountryService(serives.CountryRepo, serives.ProvinceRepo, jobs, changes, serives.HistoryRepo)
+	province := NewProvinceService(serives.ProvinceRepo, jobs, changes, serives.HistoryRepo)
+
+	outbound, err := outboundConfigFromEnv()
+	failOnError(err, "invalid outbound configuration")
+
+	// FRESHNESS_WINDOW enables alerts on provinces not updated within it,
+	// also posted to SLACK_WEBHOOK_URL when set.
+	if v := os.Getenv("FRESHNESS_WINDOW"); v != "" {
+		window, err := time.ParseDuration(v)
+		failOnError(err, "invalid FRESHNESS_WINDOW")
+		interval := time.Hour
+		if v := os.Getenv("FRESHNESS_CHECK_INTERVAL"); v != "" {
+			interval, err = time.ParseDuration(v)
+			failOnError(err, "invalid FRESHNESS_CHECK_INTERVAL")
+		}
+		freshness := newFreshnessMonitor(window, interval, serives.NotificationRepo,
+			os.Getenv("SLACK_WEBHOOK_URL"), newOutboundClient(outbound))
+		freshness.AddCheck(staleProvinces(serives.ProvinceRepo))
+		go freshness.Run(background)
+	}
+
+	// CONSISTENCY_CHECK_INTERVAL enables checking that the provinces add up
+	// to their country, the districts to their province, and that history
+	// never decreases, for the data-quality report.
+	if v := os.Getenv("CONSISTENCY_CHECK_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		failOnError(err, "invalid CONSISTENCY_CHECK_INTERVAL")
+		go newConsistencyChecker(interval, serives.ConsistencyRepo, serives.NotificationRepo).Run(background)
+	}
+
+	// OTEL_EXPORTER_OTLP_ENDPOINT turns on the tracing of requests, down to
+	// their SQL statements.
+	tracer, err = otlpTracerFromEnv()
+	failOnError(err, "invalid tracing configuration")
+	if tracer != nil {
+		go tracer.Run(background)
+	}
+
+	// CDN_PURGE_PROVIDER purges the CDN copies of responses showing an
+	// entity when it changes.
+	purger, err := cdnPurgerFromEnv(newOutboundClient(outbound))
+	failOnError(err, "invalid CDN purge configuration")
+	if purger != nil {
+		changes.Listen(purger.Enqueue)
+		go purger.Run(background)
+	}
+
+	// VAPID_PRIVATE_KEY turns on Web Push, browsers subscribed through
+	// /api/v1/push/subscriptions being notified when figures are published.
+	pusher, err := webPusherFromEnv(newOutboundClient(outbound), serives.PushRepo)
+	failOnError(err, "invalid push configuration")
+	if pusher != nil {
+		changes.Listen(pusher.Enqueue)
+		go pusher.Run(background)
+	}
+
+	// RETENTION_<TABLE>, e.g. RETENTION_REQUEST_JOURNAL=90d, purges the rows
+	// of the logs and usage tables older than their window every
+	// RETENTION_INTERVAL.
+	retention, err := retentionFromEnv(serives.RetentionRepo)
+	failOnError(err, "invalid retention configuration")
+	if retention != nil {
+		go retention.Run(background)
+	}
+
+	// the JHU CSSE daily reports are synced on demand, and every
+	// JHU_SYNC_INTERVAL when set. JHU_COUNTRY_NAMES maps report names that
+	// differ from ours to country ids, e.g. "Laos=<id>".
+	jhuNames, err := parseJHUNames(os.Getenv("JHU_COUNTRY_NAMES"))
+	failOnError(err, "invalid JHU_COUNTRY_NAMES")
+	jhu := newJHUSyncer(os.Getenv("JHU_REPORTS_URL"), jhuNames, newOutboundClient(outbound), serives, changes)
+	if v := os.Getenv("JHU_SYNC_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		failOnError(err, "invalid JHU_SYNC_INTERVAL")
+		go jhu.Run(background, interval)
+	}
+
+	// DHIS2_URL pushes the daily figures of the provinces and districts
+	// mapped to organisation units to the national HMIS, on demand and every
+	// DHIS2_PUSH_INTERVAL when set. Where the HMIS is the source of truth,
+	// they are pulled from DHIS2_DATA_SET instead, every DHIS2_PULL_INTERVAL.
+	dhis2, err := dhis2SyncerFromEnv(newOutboundClient(outbound), serives, changes)
+	failOnError(err, "invalid DHIS2 configuration")
+	if v := os.Getenv("DHIS2_PUSH_INTERVAL"); v != "" && dhis2 != nil {
+		interval, err := time.ParseDuration(v)
+		failOnError(err, "invalid DHIS2_PUSH_INTERVAL")
+		go dhis2.Run(background, interval, dhis2.Push)
+	}
+	if v := os.Getenv("DHIS2_PULL_INTERVAL"); v != "" && dhis2 != nil {
+		interval, err := time.ParseDuration(v)
+		failOnError(err, "invalid DHIS2_PULL_INTERVAL")
+		if dhis2.dataSet == "" {
+			failOnError(errDHIS2PullOff, "invalid DHIS2_PULL_INTERVAL")
+		}
+		go dhis2.Run(background, interval, dhis2.Pull)
+	}
+
+	stale := newStaleCache()
+
+	// the analytics endpoints run a few at a time, see HEAVY_CONCURRENCY.
+	heavy, err := heavyLimiterFromEnv()
+	failOnError(err, "invalid concurrency limits")
+
+	e.GET("/api/v1/countries", country.ListCountries)
+	e.GET("/api/v1/country/:country_id", country.FindByCountryID, stale.Middleware)
+	e.GET("/api/v1/country/:country_id/wait", country.WaitCountry, refuseEmbargoed)
+	e.POST("/api/v1/country", country.Store, requireRole(RoleAdmin))
+	e.PUT("/api/v1/country/:country_id", country.Edit, requireCountry(serives.CountryRepo, "country_id"))
+	e.PATCH("/api/v1/country/:country_id", country.Patch, requireCountry(serives.CountryRepo, "country_id"))
+	e.PATCH("/api/v1/country/:country_id/attributes", country.PatchAttributes, requireCountry(serives.CountryRepo, "country_id"))
+	e.GET("/api/v1/province/:province_id", province.FindByProvinceID, stale.Middleware)
+	e.PUT("/api/v1/province/:province_id", province.UpdateProvince, requireProvince("province_id"))
+	e.PATCH("/api/v1/province/:province_id", province.Patch, requireProvince("province_id"))
+	e.GET("/api/v1/provinces", province.ListProvinces)
+	e.PUT("/api/v1/provinces", province.UpdateProvinces, requireRole(RoleEditor))
+	e.PATCH("/api/v1/province/:province_id/attributes", province.PatchAttributes, requireProvince("province_id"))
+	e.GET("/api/v1/province/:province_id/aliases", province.ListAliases)
+	e.POST("/api/v1/province/:province_id/aliases", province.AddAlias, requireProvince("province_id"))
+	e.DELETE("/api/v1/province/:province_id/aliases/:alias", province.DeleteAlias, requireProvince("province_id"))
+
+	district := NewDistrictService(serives.DistrictRepo, serives.HistoryRepo, changes)
+	e.GET("/api/v1/province/:province_id/districts", district.ListByProvince)
+	e.GET("/api/v1/district/:district_id", district.FindByDistrictID)
+	e.POST("/api/v1/district", district.Store, requireRole(RoleEditor))
+	e.PUT("/api/v1/district/:district_id", district.UpdateDistrict, requireDistrict(serives.DistrictRepo))
+	e.PATCH("/api/v1/district/:district_id/attributes", district.PatchAttributes, requireDistrict(serives.DistrictRepo))
+	e.POST("/api/v1/validate", NewValidationService(serives.CountryRepo, serives.ProvinceRepo, serives.DistrictRepo).Validate)
+	e.DELETE("/api/v1/district/:district_id", district.DeleteDistrict, requireDistrict(serives.DistrictRepo))
+
+	history := NewHistoryService(serives.HistoryRepo)
+	e.GET("/api/v1/country/:country_id/history", history.History("country", "country_id"), heavy.Middleware)
+	e.GET("/api/v1/province/:province_id/history", history.History("province", "province_id"), heavy.Middleware)
+	e.GET("/api/v1/district/:district_id/history", history.History("district", "district_id"), heavy.Middleware)
+	e.GET("/api/v1/country/:country_id/fhir/MeasureReport", NewFHIRService(serives.CountryRepo, serives.HistoryRepo).MeasureReport)
+	e.GET("/api/v1/export/owid", NewOWIDService(serives.CountryRepo, serives.HistoryRepo).Export, heavy.Middleware)
+	e.GET("/api/v1/export/xlsx", NewXLSXService(serives.CountryRepo, serives.ProvinceRepo, serives.DistrictRepo, serives.HistoryRepo).Export, heavy.Middleware)
+	historyExport := NewHistoryExportService(serives.HistoryRepo, jobs)
+	e.POST("/api/v1/export/history", historyExport.Export, heavy.Middleware)
+	e.GET("/api/v1/export/history/:job_id", historyExport.Download)
+	e.GET("/api/v1/report/daily.pdf", NewReportService(serives.CountryRepo, serives.ProvinceRepo, serives.HistoryRepo).Daily)
+	e.GET("/api/v1/geojson", NewGeoService(serives.GeoRepo, serives.HistoryRepo).GeoJSON)
+
+	gql := newGraphQLSchema(&graphqlResolver{
+		countries: serives.CountryRepo,
+		provinces: serives.ProvinceRepo,
+		districts: serives.DistrictRepo,
+		changes:   changes,
+	})
+	e.POST("/graphql", echo.WrapHandler(&relay.Handler{Schema: gql}), refuseEmbargoed)
+
+	// GRPC_PORT serves proto/covid19.proto to internal consumers next to the
+	// HTTP API, authenticated and journaled as it is.
+	var grpcSrv *grpc.Server
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		lis, err := net.Listen("tcp", ":"+port)
+		failOnError(err, "failed to listen on GRPC_PORT")
+		interceptors := []grpc.UnaryServerInterceptor{grpcDeadline(requestTimeout), grpcAuthenticate(auth), grpcEmbargo}
+		if os.Getenv("REQUEST_JOURNAL") == "true" {
+			interceptors = append(interceptors, grpcJournal(serives.JournalRepo))
+		}
+		srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+		covid19pb.RegisterCovid19Server(srv, &grpcServer{
+			countries: serives.CountryRepo,
+			provinces: serives.ProvinceRepo,
+			districts: serives.DistrictRepo,
+			changes:   changes,
+		})
+		go func() {
+			if err := srv.Serve(lis); err != nil {
+				logger.Error().Err(err).Msg("grpc: stopped serving")
+			}
+		}()
+		grpcSrv = srv
+	}
+
+	e.POST("/api/v1/auth/login", auth.Login)
+	// the embeddable widget and partner iframes read one province with a
+	// short-lived token instead of an API key
+	e.POST("/api/v1/auth/embed-tokens", NewEmbedService(auth, serives.ProvinceRepo).IssueToken)
+	e.GET("/api/v1/admin/users", auth.ListUsers, requireRole(RoleAdmin))
+	e.POST("/api/v1/admin/users", auth.StoreUser, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/users/:user_id", auth.DeleteUser, requireRole(RoleAdmin))
+	e.GET("/api/v1/admin/journal", journal.ListEntries, requireRole(RoleAdmin))
+
+	team := NewTeamService(serives.TeamRepo)
+	e.GET("/api/v1/admin/teams", team.ListTeams, requireRole(RoleViewer))
+	e.POST("/api/v1/admin/teams", team.StoreTeam, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/teams/:team_id", team.DeleteTeam, requireRole(RoleAdmin))
+	e.POST("/api/v1/admin/teams/:team_id/keys", team.StoreKey, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/teams/:team_id/keys/:key_id", team.DeleteKey, requireRole(RoleAdmin))
+	e.PUT("/api/v1/admin/teams/:team_id/keys/:key_id/embargo", team.SetKeyEmbargo, requireRole(RoleAdmin))
+
+	sync := NewSyncService(jhu, dhis2, serives.SyncRunRepo, jobs, changes)
+	e.POST("/api/v1/admin/sync/jhu", sync.TriggerJHU, requireRole(RoleAdmin))
+	e.GET("/api/v1/admin/sync/jhu", sync.JHUStatus, requireRole(RoleViewer))
+	e.POST("/api/v1/admin/sync/dhis2", sync.TriggerDHIS2, requireRole(RoleAdmin))
+	e.GET("/api/v1/admin/sync/dhis2", sync.DHIS2Status(sourceDHIS2), requireRole(RoleViewer))
+	e.POST("/api/v1/admin/sync/dhis2/pull", sync.TriggerDHIS2Pull, requireRole(RoleAdmin))
+	e.GET("/api/v1/admin/sync/dhis2/pull", sync.DHIS2Status(sourceDHIS2Pull), requireRole(RoleViewer))
+	e.POST("/api/v1/admin/imports/:sync_run_id/rollback", sync.RollbackImport, requireRole(RoleAdmin))
+	// the spreadsheets the ministry kept before the API, see covidctl backfill
+	backfill := NewBackfillService(serives.BackfillRepo, serives.CountryRepo, serives.ProvinceRepo, serives.DistrictRepo, jobs)
+	e.POST("/api/v1/admin/history/backfill", backfill.Backfill, requireRole(RoleAdmin))
+	retentionAdmin := NewRetentionService(retention, jobs)
+	e.GET("/api/v1/admin/retention", retentionAdmin.Policies, requireRole(RoleViewer))
+	e.POST("/api/v1/admin/retention/purge", retentionAdmin.Purge, requireRole(RoleAdmin))
+
+	// dashboards follow countries over a WebSocket, or Server-Sent Events,
+	// instead of polling
+	live := NewLiveService(serives.CountryRepo, serives.ProvinceRepo, serives.DistrictRepo, changes)
+	e.GET("/ws", live.Live, refuseEmbargoed)
+	stream := NewStreamService(serives.CountryRepo, serives.ProvinceRepo, changes)
+	go stream.Run(background)
+	e.GET("/api/v1/stream", stream.Stream, refuseEmbargoed)
+
+	e.GET("/api/v1/jobs/:job_id", NewJobService(jobs).FindByJobID)
+
+	metric := NewMetricService(serives.MetricRepo)
+	e.GET("/api/v1/metrics", metric.ListMetrics)
+	e.PUT("/api/v1/metrics/:name/:region_id", metric.SetValue, requireProvince("region_id"))
+	e.POST("/api/v1/admin/metrics", metric.Store, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/metrics/:name", metric.Delete, requireRole(RoleAdmin))
+
+	notification := NewNotificationService(serives.NotificationRepo)
+	e.GET("/api/v1/admin/notifications", notification.ListNotifications, requireRole(RoleViewer))
+	e.GET("/api/v1/admin/data-quality", NewConsistencyService(serives.ConsistencyRepo).DataQuality, requireRole(RoleViewer))
+	e.PUT("/api/v1/admin/notifications/:notification_id/read", notification.MarkRead, requireRole(RoleAdmin))
+	e.POST("/api/v1/admin/notifications/read", notification.MarkAllRead, requireRole(RoleAdmin))
+
+	caseDefinition := NewCaseDefinitionService(serives.CaseDefRepo)
+	e.GET("/api/v1/case-definitions", caseDefinition.ListCaseDefinitions)
+	e.POST("/api/v1/admin/case-definitions", caseDefinition.Store, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/case-definitions/:version", caseDefinition.Delete, requireRole(RoleAdmin))
+
+	mortality := NewMortalityService(serives.MortalityRepo)
+	e.PUT("/api/v1/province/:province_id/mortality/:month", mortality.StoreMonth, requireProvince("province_id"))
+	e.GET("/api/v1/province/:province_id/excess-mortality", mortality.ProvinceExcess, heavy.Middleware)
+	e.GET("/api/v1/country/:country_id/excess-mortality", mortality.CountryExcess, heavy.Middleware)
+
+	wastewater := NewWastewaterService(serives.WastewaterRepo)
+	e.GET("/api/v1/wastewater", wastewater.ListSamples)
+	e.GET("/api/v1/wastewater/trend", wastewater.Trend, heavy.Middleware)
+	e.GET("/api/v1/wastewater/:sample_id", wastewater.FindBySampleID)
+	e.POST("/api/v1/wastewater", wastewater.Store, requireProvince(""))
+	e.PUT("/api/v1/wastewater/:sample_id", wastewater.Edit, requireProvince(""))
+	e.DELETE("/api/v1/wastewater/:sample_id", wastewater.Delete, requireProvince(""))
+
+	sequencing := NewSequencingService(serives.SequencingRepo)
+	e.POST("/api/v1/sequencing", sequencing.Store, requireRole(RoleEditor))
+	e.GET("/api/v1/sequencing/:submission_id", sequencing.FindBySubmissionID)
+	e.DELETE("/api/v1/sequencing/:submission_id", sequencing.Delete, requireRole(RoleEditor))
+	e.GET("/api/v1/province/:province_id/sequencing", sequencing.ListByProvince)
+	e.GET("/api/v1/province/:province_id/lineages", sequencing.LineageTrend, heavy.Middleware)
+
+	outbreak := NewOutbreakService(serives.OutbreakRepo)
+	e.GET("/api/v1/outbreaks/summary", outbreak.Summary, heavy.Middleware)
+	e.GET("/api/v1/admin/outbreaks", outbreak.ListOutbreaks, requireRole(RoleViewer))
+	e.GET("/api/v1/admin/outbreaks/:outbreak_id", outbreak.FindByOutbreakID, requireRole(RoleViewer))
+	e.POST("/api/v1/admin/outbreaks", outbreak.Store, requireRole(RoleAdmin))
+	e.PUT("/api/v1/admin/outbreaks/:outbreak_id", outbreak.Edit, requireRole(RoleAdmin))
+	e.DELETE("/api/v1/admin/outbreaks/:outbreak_id", outbreak.Delete, requireRole(RoleAdmin))
+
+	supply := NewSupplyService(serives.SupplyRepo, serives.NotificationRepo)
+	e.GET("/api/v1/supplies/low-stock", supply.ListLowStock)
+	e.GET("/api/v1/province/:province_id/supplies", supply.ListByProvince)
+	e.PUT("/api/v1/province/:province_id/supplies", supply.Store, requireProvince("province_id"))
+	e.DELETE("/api/v1/province/:province_id/supplies/:item", supply.Delete, requireProvince("province_id"))
+
+	occupancy := NewOccupancyService(serives.OccupancyRepo)
+	e.PUT("/api/v1/province/:province_id/beds/:day", occupancy.StoreDay, requireProvince("province_id"))
+	e.GET("/api/v1/province/:province_id/beds", occupancy.History)
+	e.GET("/api/v1/province/:province_id/beds/projection", occupancy.Projection, heavy.Middleware)
+
+	hotline := NewHotlineService(serives.HotlineRepo)
+	e.GET("/api/v1/province/:province_id/hotline", hotline.ListDays)
+	e.GET("/api/v1/province/:province_id/hotline/trend", hotline.Trend, heavy.Middleware)
+	e.PUT("/api/v1/province/:province_id/hotline/:day", hotline.StoreDay, requireProvince("province_id"))
+	e.DELETE("/api/v1/province/:province_id/hotline/:day", hotline.DeleteDay, requireProvince("province_id"))
+
+	freeze := NewFreezeService(serives.FreezeRepo, serives.CountryRepo)
+	e.GET("/api/v1/country/:country_id/frozen/:day", freeze.FindFrozen)
+	e.GET("/api/v1/country/:country_id/frozen/:day/revisions", freeze.ListRevisions)
+	e.POST("/api/v1/admin/country/:country_id/freeze/:day", freeze.Freeze, requireRole(RoleAdmin))
+	e.POST("/api/v1/admin/country/:country_id/frozen/:day/revisions", freeze.Revise, requireRole(RoleAdmin))
+
+	e.GET("/api/v1/changelog", NewChangelogService().ListChanges)
+	e.GET("/api/v1/meta", NewDeploymentService(cfg.Deployment).Meta)
+	e.GET("/api/v1/meta/license", NewLicenseService().License)
+	e.GET("/api/v1/openapi.json", NewOpenAPIService().Spec)
+	e.GET("/version", NewVersionService(db, serives.Dialect, serives.Migrations).Version)
+	e.GET("/readyz", selfcheck.Readyz)
+	// SMTP_ADDR turns on the developer portal, developers registering for a
+	// key of their own verified by email. Their keys only count with
+	// authentication on.
+	mailer, err := mailerFromEnv()
+	failOnError(err, "invalid mail configuration")
+	go developerUsage.Run(background)
+	developer := NewDeveloperService(serives.DeveloperRepo, developerUsage, mailer, int(limits.developer.burst))
+	e.POST("/api/v1/developers", developer.Register)
+	e.POST("/api/v1/developers/verify", developer.Verify)
+	e.GET("/api/v1/developers/me/usage", developer.Usage)
+	e.POST("/api/v1/developers/me/key", developer.RotateKey)
+
+	push := NewPushService(pusher, serives.PushRepo)
+	e.GET("/api/v1/push/vapid-key", push.VAPIDKey)
+	e.POST("/api/v1/push/subscriptions", push.Subscribe)
+	e.DELETE("/api/v1/push/subscriptions", push.Unsubscribe)
+	e.GET("/metrics", NewDataMetricsService(serives.CountryRepo, serives.ProvinceRepo, serives.HistoryRepo).Metrics)
+
+	e.POST("/api/v1/admin/provinces/merge", province.MergeProvinces, requireRole(RoleAdmin))
+	e.POST("/api/v1/admin/province/:province_id/split", province.SplitProvince, requireRole(RoleAdmin))
+
+	logger.Info().Str("port", cfg.Port).Msg("listening")
+	go func() {
+		if err := e.Start(":" + cfg.Port); err != nil && err != http.ErrServerClosed {
+			logger.Fatal().Err(err).Msg("failed to serve")
+		}
+	}()
+	// a SIGTERM waits for the requests and jobs in flight before the database
+	// is closed, for the shutdown timeout at most
+	shutdownTimeout := time.Duration(cfg.ShutdownTimeout)
+	logger.Info().Stringer("signal", waitForStop()).Dur("timeout", shutdownTimeout).Msg("shutdown: draining")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// streams, WebSockets and long polls end, new requests are refused and
+	// those in flight finish
+	stopBackground()
+	changes.Close()
+	if err := e.Shutdown(ctx); err != nil {
+		logger.Warn().Err(err).Msg("shutdown: requests still in flight")
+	}
+	if grpcSrv != nil {
+		if err := waitOrDone(ctx, grpcSrv.GracefulStop); err != nil {
+			grpcSrv.Stop()
+		}
+	}
+	if err := waitOrDone(ctx, jobs.Wait); err != nil {
+		logger.Warn().Err(err).Msg("shutdown: jobs still running")
+	}
+	// the requests counted against developer keys since the last write
+	developerUsage.Flush(ctx)
+	// waits for the queries still running
+	if err := serives.Close(); err != nil {
+		logger.Error().Err(err).Msg("shutdown: failed to close db")
+	}
+}
+
+const (
+	defaultCountryLimit = 50
+	maxCountryLimit     = 500
+)
+
+// Application
+type countryApp struct {
+	cApp CountryRepository
+}
+
+type CountryAppInterface interface {
+	Save(ctx context.Context, c *Country) error
+	Update(ctx context.Context, c *Country) error
+	Delete(ctx context.Context, c *Country) error
+	GetByID(ctx context.Context, id string) (*Country, error)
+	List(ctx context.Context, page, limit uint64) (Countries, error)
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+	UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error
+}
+
+var _ CountryAppInterface = &countryRepo{}
+
+func (ca *countryApp) Save(ctx context.Context, ct *Country) error {
+	return ca.cApp.Save(ctx, ct)
+}
+func (ca *countryApp) Update(ctx context.Context, ct *Country) error {
+	return ca.cApp.Update(ctx, ct)
+}
+func (ca *countryApp) Delete(ctx context.Context, ct *Country) error {
+	return ca.cApp.Delete(ctx, ct)
+}
+func (ca *countryApp) GetByID(ctx context.Context, id string) (*Country, error) {
+	return ca.cApp.GetByID(ctx, id)
+}
+func (ca *countryApp) List(ctx context.Context, page, limit uint64) (Countries, error) {
+	return ca.cApp.List(ctx, page, limit)
+}
+func (ca *countryApp) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return ca.cApp.PatchAttributes(ctx, id, patch, updatedAt)
+}
+func (ca *countryApp) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	return ca.cApp.UpdatePartial(ctx, id, columns, updatedAt)
+}
+
+type provinceApp struct {
+	pApp ProvinceRepository
+}
+
+type ProvinceInterface interface {
+	Save(ctx context.Context, p *Province) error
+	Update(ctx context.Context, p *Province) error
+	Delete(ctx context.Context, p *Province) error
+	GetByID(ctx context.Context, id string) (*Province, error)
+	GetAll(ctx context.Context, f *ProvinceFilter) (Provinces, error)
+	Merge(ctx context.Context, sourceID, targetID string) (*Province, error)
+	Split(ctx context.Context, id string, parts Provinces) error
+	Resolve(ctx context.Context, key string) (*Province, error)
+	Aliases(ctx context.Context, id string) (Aliases, error)
+	AddAlias(ctx context.Context, id string, a *Alias) error
+	DeleteAlias(ctx context.Context, id, name string) error
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+	UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error
+	UpdateAll(ctx context.Context, ps Provinces) error
+	GetUpdatedBefore(ctx context.Context, before time.Time) (Provinces, error)
+}
+
+var _ ProvinceInterface = &provinceApp{}
+
+func (pa *provinceApp) Save(ctx context.Context, p *Province) error {
+	return pa.pApp.Save(ctx, p)
+}
+func (pa *provinceApp) Update(ctx context.Context, p *Province) error {
+	return pa.pApp.Update(ctx, p)
+}
+func (pa *provinceApp) Delete(ctx context.Context, p *Province) error {
+	return pa.pApp.Delete(ctx, p)
+}
+func (pa *provinceApp) GetByID(ctx context.Context, id string) (*Province, error) {
+	return pa.pApp.GetByID(ctx, id)
+}
+func (pa *provinceApp) GetAll(ctx context.Context, f *ProvinceFilter) (Provinces, error) {
+	return pa.pApp.GetAll(ctx, f)
+}
+func (pa *provinceApp) Merge(ctx context.Context, sourceID, targetID string) (*Province, error) {
+	return pa.pApp.Merge(ctx, sourceID, targetID)
+}
+func (pa *provinceApp) Split(ctx context.Context, id string, parts Provinces) error {
+	return pa.pApp.Split(ctx, id, parts)
+}
+func (pa *provinceApp) Resolve(ctx context.Context, key string) (*Province, error) {
+	return pa.pApp.Resolve(ctx, key)
+}
+func (pa *provinceApp) Aliases(ctx context.Context, id string) (Aliases, error) {
+	return pa.pApp.Aliases(ctx, id)
+}
+func (pa *provinceApp) AddAlias(ctx context.Context, id string, a *Alias) error {
+	return pa.pApp.AddAlias(ctx, id, a)
+}
+func (pa *provinceApp) DeleteAlias(ctx context.Context, id, name string) error {
+	return pa.pApp.DeleteAlias(ctx, id, name)
+}
+func (pa *provinceApp) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	return pa.pApp.PatchAttributes(ctx, id, patch, updatedAt)
+}
+func (pa *provinceApp) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	return pa.pApp.UpdatePartial(ctx, id, columns, updatedAt)
+}
+func (pa *provinceApp) UpdateAll(ctx context.Context, ps Provinces) error {
+	return pa.pApp.UpdateAll(ctx, ps)
+}
+func (pa *provinceApp) GetUpdatedBefore(ctx context.Context, before time.Time) (Provinces, error) {
+	return pa.pApp.GetUpdatedBefore(ctx, before)
+}
+
+// new handler
+type countryService struct {
+	cApp    CountryAppInterface
+	pApp    ProvinceInterface
+	jobs    *jobRunner
+	changes *changeHub
+	history HistoryRepository
+}
+
+type provinceService struct {
+	pApp    ProvinceInterface
+	jobs    *jobRunner
+	changes *changeHub
+	history HistoryRepository
+}
+
+type ErrorMsg struct {
+	Msg string `json:"error"`
+}
+
+type SuccessResponse struct {
+	Msg string `json:"success"`
+}
+
+func NewCountryService(cApp CountryAppInterface, pApp ProvinceInterface, jobs *jobRunner, changes *changeHub, history HistoryRepository) *countryService {
+	return &countryService{cApp: cApp, pApp: pApp, jobs: jobs, changes: changes, history: history}
+}
+
+func (cA *countryService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (cA *countryService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+func (cA *countryService) ListCountries(c echo.Context) error {
+	page := uint64(1)
+	if v := c.QueryParam("page"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n == 0 {
+			return c.JSON(http.StatusBadRequest, cA.errMessage("request: page must be a positive integer"))
+		}
+		page = n
+	}
+	limit := uint64(defaultCountryLimit)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n == 0 || n > maxCountryLimit {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(fmt.Sprintf("request: limit must be between 1 and %d", maxCountryLimit)))
+		}
+		limit = n
+	}
+
+	countries, err := cA.cApp.List(c.Request().Context(), page, limit)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		if countries, err = countriesAsOf(c.Request().Context(), cA.history, countries, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, cA.errMessage(msg))
+		}
+	}
+	keys := make([]string, len(countries))
+	for i, ct := range countries {
+		keys[i] = countryKey(ct.ID)
+	}
+	setCacheTags(c, keys...)
+	return c.JSON(http.StatusOK, map[string]Countries{"countries": countries})
+}
+
+func (cA *countryService) FindByCountryID(c echo.Context) error {
+	country, err := cA.cApp.GetByID(c.Request().Context(),
+		html.EscapeString(strings.TrimSpace(c.Param("country_id"))))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	// the tag is the one of the country with all of its provinces, which
+	// writes are compared with
+	tagAt := country.lastUpdated()
+	// ?sort=, ?order= and ?min_total= list the provinces otherwise than by
+	// total, largest first
+	var filter *ProvinceFilter
+	if provinceFilterGiven(c) {
+		if c.QueryParam("as_of") != "" {
+			return c.JSON(http.StatusBadRequest, cA.errMessage("request: sort, order and min_total cannot be combined with as_of"))
+		}
+		f, err := parseProvinceFilter(c)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+		}
+		f.CountryID = country.ID
+		if country.Provinces, err = cA.pApp.GetAll(c.Request().Context(), f); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, cA.errMessage(msg))
+		}
+		filter = f
+	}
+	// ?as_of= shows the country as it was published at a past time, as
+	// does the embargo of the key of the caller
+	at, asOf, err := readAsOf(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+	if asOf {
+		country, err = countryAsOf(c.Request().Context(), cA.history, country, at)
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, cA.errMessage(msg))
+		}
+		tagAt = country.lastUpdated()
+		country.Provinces = filter.keep(country.Provinces)
+	}
+	setCacheTags(c, countryCacheTags(country)...)
+	setEntityTag(c, tagAt)
+
+	// ?province_page= and ?province_limit= keep a page of the provinces,
+	// for countries with too many of them for one response
+	provinces, pagination, err := pageProvinces(c, country.Provinces)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+	if pagination == nil {
+		return c.JSON(http.StatusOK, map[string]*Country{"country": country})
+	}
+	country.Provinces = provinces
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"country": country,
+		"meta":    &ResponseMeta{Provinces: pagination},
+	})
+}
+
+func (cA *countryService) Store(c echo.Context) error {
+	var country Country
+	if err := c.Bind(&country); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
+	}
+	country.Prepare()
+	country.BeforeSave()
+	country.UpdatedAt = updateTime()
+	if err := country.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+
+	for _, p := range country.Provinces {
+		p.Prepare()
+		p.BeforeSave()
+		p.UpdatedAt = updateTime()
+		if err := p.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+		}
+	}
+
+	// a country comes with all of its provinces, which can be more than fits
+	// in the router timeout
+	if respondAsync(c.Request()) {
+		job := cA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+			if err := cA.cApp.Save(ctx, &country); err != nil {
+				return nil, err
+			}
+			cA.changes.Publish(countryKey(country.ID))
+			return map[string]*Country{"country": &country}, nil
+		})
+		return acceptJob(c, job)
+	}
+
+	if err := cA.cApp.Save(c.Request().Context(), &country); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	cA.changes.Publish(countryKey(country.ID))
+
+	setEntityTag(c, country.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Country{"country": &country})
+}
+
+func (cA *countryService) Edit(c echo.Context) error {
+	var country Country
+	if err := c.Bind(&country); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
+	}
+	country.Prepare()
+	if err := country.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+
+	for _, p := range country.Provinces {
+		if err := p.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+		}
+	}
+
+	// the country is the one of the path, which the caller was authorized
+	// for, whatever id the body carries
+	current, err := cA.cApp.GetByID(forWrite(c.Request().Context()), c.Param("country_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	country.ID = current.ID
+	if preconditionFailed(c.Request(), current.lastUpdated()) {
+		return c.JSON(http.StatusPreconditionFailed, cA.errMessage(errModified.Error()))
+	}
+	currentProvinces := make(map[string]*Province, len(current.Provinces))
+	for _, p := range current.Provinces {
+		currentProvinces[p.ID] = p
+	}
+	// and so are its provinces
+	for _, p := range country.Provinces {
+		if _, ok := currentProvinces[p.ID]; !ok {
+			return c.JSON(http.StatusBadRequest, cA.errMessage(fmt.Sprintf("country: province %s is not a province of the country", p.ID)))
+		}
+	}
+
+	// only the records that actually differ are written, so that an identical
+	// payload does not bump updated_at
+	changed := false
+	// attributes left out of the payload are kept as they are
+	if country.Attributes == nil {
+		country.Attributes = current.Attributes
+	}
+	// as are the codes
+	if country.ISO2 == "" {
+		country.ISO2 = current.ISO2
+	}
+	if country.ISO3 == "" {
+		country.ISO3 = current.ISO3
+	}
+	for _, p := range country.Provinces {
+		p.Prepare()
+		cp, ok := currentProvinces[p.ID]
+		if ok && p.Attributes == nil {
+			p.Attributes = cp.Attributes
+		}
+		if ok && cp.Equal(p) {
+			p.UpdatedAt = cp.UpdatedAt
+			continue
+		}
+		p.UpdatedAt = updateTime()
+		if err := cA.pApp.Update(c.Request().Context(), p); err != nil {
+			status, msg := errorStatus(err, "Internal server error, could not update province information")
+			return c.JSON(status, cA.errMessage(msg))
+		}
+		if ok {
+			if err := keepOldName(c.Request().Context(), cA.pApp, cp, p); err != nil {
+				status, msg := errorStatus(err, "Internal server error, could not keep the old province name")
+				return c.JSON(status, cA.errMessage(msg))
+			}
+		}
+		cA.changes.Publish(provinceKey(p.ID))
+		changed = true
+	}
+
+	if current.Equal(&country) {
+		country.UpdatedAt = current.UpdatedAt
+	} else {
+		country.UpdatedAt = updateTime()
+		if err := cA.cApp.Update(c.Request().Context(), &country); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, cA.errMessage(msg))
+		}
+		cA.changes.Publish(countryKey(country.ID))
+		changed = true
+	}
+
+	// the provinces left out of the payload are still the country's
+	setEntityTag(c, latest(current.lastUpdated(), country.lastUpdated()))
+	if !changed {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, map[string]*Country{"country": &country})
+}
+
+func NewProvinceService(pApp ProvinceInterface, jobs *jobRunner, changes *changeHub, history HistoryRepository) *provinceService {
+	return &provinceService{pApp: pApp, jobs: jobs, changes: changes, history: history}
+}
+
+func (pA *provinceService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (pA *provinceService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+func (pA *provinceService) UpdateProvince(c echo.Context) error {
+	var p Province
+	if err := c.Bind(&p); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	// the province is the one of the path, which the caller was authorized for
+	p.ID = c.Param("province_id")
+	p.Prepare()
+	if err := p.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+
+	current, err := pA.pApp.GetByID(forWrite(c.Request().Context()), p.ID)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	if preconditionFailed(c.Request(), current.lastUpdated()) {
+		return c.JSON(http.StatusPreconditionFailed, pA.errMessage(errModified.Error()))
+	}
+	// attributes left out of the payload are kept as they are
+	if p.Attributes == nil {
+		p.Attributes = current.Attributes
+	}
+	if current.Equal(&p) {
+		setEntityTag(c, current.lastUpdated())
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	p.UpdatedAt = updateTime()
+	if err := pA.pApp.Update(c.Request().Context(), &p); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update province information")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	pA.changes.Publish(provinceKey(p.ID))
+	if err := keepOldName(c.Request().Context(), pA.pApp, current, &p); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not keep the old province name")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	// its districts are the ones it had
+	setEntityTag(c, latest(current.lastUpdated(), p.UpdatedAt))
+	return c.JSON(http.StatusOK, map[string]*Province{"province": &p})
+}
+
+// data model
+type Province struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	Total          int64              `json:"total"`
+	NewCase        int64              `json:"new_case"`
+	Treated        int64              `json:"treaded"`
+	DecoveringCase int64              `json:"decovering_case"`
+	TestCase       int64              `json:"test_case"`
+	Dead           int64              `json:"dead"`
+	NegativeTest   int64              `json:"negative_case"`
+	Latitude       *float64           `json:"latitude"`
+	Longitude      *float64           `json:"longitude"`
+	Districts      Districts          `json:"districts"`
+	Metrics        map[string]float64 `json:"metrics"`
+	Attributes     Attributes         `json:"attributes"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+type Provinces []*Province
+
+func (p *Province) Prepare() {
+	p.Name = html.EscapeString(strings.TrimSpace(p.Name))
+}
+
+func (p *Province) BeforeSave() {
+	p.ID = uuid.NewV4().String()
+}
+
+func (p *Province) Validate() error {
+	if p.Name == "" {
+		return errors.New("province: name is required")
+	}
+	return checkCoordinates("province", p.Latitude, p.Longitude)
+}
+
+// Equal reports whether p and o carry the same name, figures and attributes,
+// and o no other coordinates, regardless of when they were updated.
+func (p *Province) Equal(o *Province) bool {
+	return p.Name == o.Name &&
+		sameCoordinate(p.Latitude, o.Latitude) &&
+		sameCoordinate(p.Longitude, o.Longitude) &&
+		p.Total == o.Total &&
+		p.NewCase == o.NewCase &&
+		p.Treated == o.Treated &&
+		p.DecoveringCase == o.DecoveringCase &&
+		p.TestCase == o.TestCase &&
+		p.Dead == o.Dead &&
+		p.NegativeTest == o.NegativeTest &&
+		p.Attributes.Equal(o.Attributes)
+}
+
+type Country struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	ISO2           string             `json:"iso2"`
+	ISO3           string             `json:"iso3"`
+	Total          int64              `json:"total"`
+	NewCase        int64              `json:"new_case"`
+	Treated        int64              `json:"treaded"`
+	DecoveringCase int64              `json:"decovering_case"`
+	TestCase       int64              `json:"test_case"`
+	NegativeTest   int64              `json:"negative_case"`
+	Dead           int64              `json:"dead"`
+	Provinces      Provinces          `json:"provinces"`
+	Metrics        map[string]float64 `json:"metrics"`
+	Attributes     Attributes         `json:"attributes"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+type Countries []*Country
+
+func (c *Country) Prepare() {
+	c.Name = html.EscapeString(strings.TrimSpace(c.Name))
+	c.ISO2 = strings.ToUpper(strings.TrimSpace(c.ISO2))
+	c.ISO3 = strings.ToUpper(strings.TrimSpace(c.ISO3))
+}
+
+func (c *Country) BeforeSave() {
+	c.ID = uuid.NewV4().String()
+}
+
+func (c *Country) Validate() error {
+	if c.Name == "" {
+		return errors.New("country: name is required")
+	}
+	if c.ISO2 != "" && !isoCode(c.ISO2, 2) {
+		return errors.New("country: iso2 must be an ISO 3166-1 alpha-2 code")
+	}
+	if c.ISO3 != "" && !isoCode(c.ISO3, 3) {
+		return errors.New("country: iso3 must be an ISO 3166-1 alpha-3 code")
+	}
+	return nil
+}
+
+// Equal reports whether c and o carry the same name, codes, figures and attributes,
+// regardless of their provinces and of when they were updated.
+func (c *Country) Equal(o *Country) bool {
+	return c.Name == o.Name &&
+		c.ISO2 == o.ISO2 &&
+		c.ISO3 == o.ISO3 &&
+		c.Total == o.Total &&
+		c.NewCase == o.NewCase &&
+		c.Treated == o.Treated &&
+		c.DecoveringCase == o.DecoveringCase &&
+		c.TestCase == o.TestCase &&
+		c.Dead == o.Dead &&
+		c.NegativeTest == o.NegativeTest &&
+		c.Attributes.Equal(o.Attributes)
+}
+
+// Repository
+type CountryRepository interface {
+	Save(ctx context.Context, c *Country) error
+	Update(ctx context.Context, c *Country) error
+	Delete(ctx context.Context, c *Country) error
+	GetByID(ctx context.Context, id string) (*Country, error)
+	// List returns a page of countries ordered by name, without their
+	// provinces and metrics. Pages start at 1.
+	List(ctx context.Context, page, limit uint64) (Countries, error)
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+	// UpdatePartial sets the columns given, by name, and updated_at.
+	UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error
+}
+
+type ProvinceRepository interface {
+	Save(ctx context.Context, p *Province) error
+	Update(ctx context.Context, p *Province) error
+	Delete(ctx context.Context, p *Province) error
+	GetByID(ctx context.Context, id string) (*Province, error)
+	GetAll(ctx context.Context, f *ProvinceFilter) (Provinces, error)
+	Merge(ctx context.Context, sourceID, targetID string) (*Province, error)
+	Split(ctx context.Context, id string, parts Provinces) error
+	Resolve(ctx context.Context, key string) (*Province, error)
+	Aliases(ctx context.Context, id string) (Aliases, error)
+	AddAlias(ctx context.Context, id string, a *Alias) error
+	DeleteAlias(ctx context.Context, id, name string) error
+	PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error
+	// UpdatePartial sets the columns given, by name, and updated_at.
+	UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error
+	// UpdateAll updates every province of ps, or none of them.
+	UpdateAll(ctx context.Context, ps Provinces) error
+	GetUpdatedBefore(ctx context.Context, before time.Time) (Provinces, error)
+}
+
+type Repository struct {
+	CountryRepo      CountryRepository
+	ProvinceRepo     ProvinceRepository
+	DistrictRepo     DistrictRepository
+	MetricRepo       MetricRepository
+	NotificationRepo NotificationRepository
+	CaseDefRepo      CaseDefinitionRepository
+	MortalityRepo    MortalityRepository
+	WastewaterRepo   WastewaterRepository
+	SequencingRepo   SequencingRepository
+	OutbreakRepo     OutbreakRepository
+	SupplyRepo       SupplyRepository
+	OccupancyRepo    OccupancyRepository
+	HotlineRepo      HotlineRepository
+	FreezeRepo       FreezeRepository
+	HistoryRepo      HistoryRepository
+	UserRepo         UserRepository
+	JournalRepo      JournalRepository
+	SyncRunRepo      SyncRunRepository
+	TeamRepo         TeamRepository
+	ConsistencyRepo  ConsistencyRepository
+	PushRepo         PushSubscriptionRepository
+	GeoRepo          GeoRepository
+	DeveloperRepo    DeveloperRepository
+	BackfillRepo     BackfillRepository
+	RetentionRepo    RetentionRepository
+	DB               *sql.DB
+	// Dialect is the SQL of DB, Migrations the directory of the migrations
+	// its schema is checked against.
+	Dialect    migrations.Dialect
+	Migrations string
+
+	backend *storage.Backend
+}
+
+// NewRepositories builds the repositories over the databases of b, hedging
+// the reads of its replica to its primary after hedgeAfter.
+func NewRepositories(b *storage.Backend, hedgeAfter time.Duration) (*Repository, error) {
+	db, dialect := b.DB, b.Dialect
+	countryRepo := NewCountryRepo(db, dialect)
+	countryRepo.replica = b.Replica
+	countryRepo.hedgeAfter = hedgeAfter
+
+	return &Repository{
+		CountryRepo:      countryRepo,
+		ProvinceRepo:     NewProvinceRepo(db, dialect),
+		DistrictRepo:     NewDistrictRepo(db, dialect),
+		MetricRepo:       NewMetricRepo(db),
+		NotificationRepo: NewNotificationRepo(db),
+		CaseDefRepo:      NewCaseDefinitionRepo(db),
+		MortalityRepo:    NewMortalityRepo(db),
+		WastewaterRepo:   NewWastewaterRepo(db, dialect),
+		SequencingRepo:   NewSequencingRepo(db, dialect),
+		OutbreakRepo:     NewOutbreakRepo(db),
+		SupplyRepo:       NewSupplyRepo(db),
+		OccupancyRepo:    NewOccupancyRepo(db),
+		HotlineRepo:      NewHotlineRepo(db, dialect),
+		FreezeRepo:       NewFreezeRepo(db),
+		HistoryRepo:      NewHistoryRepo(db, dialect),
+		UserRepo:         NewUserRepo(db),
+		JournalRepo:      NewJournalRepo(db),
+		SyncRunRepo:      NewSyncRunRepo(db, dialect),
+		TeamRepo:         NewTeamRepo(db),
+		ConsistencyRepo:  NewConsistencyRepo(db),
+		PushRepo:         NewPushSubscriptionRepo(db),
+		GeoRepo:          NewGeoRepo(db),
+		DeveloperRepo:    NewDeveloperRepo(db),
+		BackfillRepo:     NewBackfillRepo(db),
+		RetentionRepo:    NewRetentionRepo(db, dialect),
+		DB:               db,
+		Dialect:          dialect,
+		Migrations:       b.Migrations,
+		backend:          b,
+	}, nil
+}
+
+// setPoolSizes applies the pool sizes of cfg, leaving those not set to
+// database/sql.
+func setPoolSizes(db *sql.DB, cfg config.Database) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	}
+}
+
+func (r *Repository) Close() error {
+	return r.backend.Close()
+}
+
+// Country Repo
+type countryRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+
+	// reads go to replica when set, hedged to db after hedgeAfter
+	replica    *sql.DB
+	hedgeAfter time.Duration
+}
+
+var _ CountryRepository = &countryRepo{}
+
+func NewCountryRepo(db *sql.DB, dialect migrations.Dialect) *countryRepo {
+	return &countryRepo{db: db, dialect: dialect}
+}
+
+func (cr *countryRepo) Save(ctx context.Context, c *Country) (err error) {
+	tx, err := cr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return wrapErr("country", c.ID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("country", c.ID, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	if _, err := squirrel.Insert("country").
+		Columns("id",
+			"name",
+			"iso2",
+			"iso3",
+			"total",
+			"new_case",
+			"treated",
+			"decovering_case",
+			"test_case",
+			"dead",
+			"negative_case",
+			"attributes",
+			"updated_at").
+		Values(&c.ID,
+			&c.Name,
+			squirrel.Expr("NULLIF(?, '')", c.ISO2),
+			squirrel.Expr("NULLIF(?, '')", c.ISO3),
+			&c.Total,
+			&c.NewCase,
+			&c.Treated,
+			&c.DecoveringCase,
+			&c.TestCase,
+			&c.Dead,
+			&c.NegativeTest,
+			&c.Attributes,
+			&c.UpdatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("country", c.ID, "insert country", err)
+	}
+
+	stmProvince := squirrel.Insert("provinces").
+		Columns("id",
+			"name",
+			"total",
+			"new_case",
+			"treated",
+			"decovering_case",
+			"test_case",
+			"dead",
+			"negative_case",
+			"country_id",
+			"latitude",
+			"longitude",
+			"attributes",
+			"updated_at")
+	for _, p := range c.Provinces {
+		stmProvince = stmProvince.Values(&p.ID,
+			&p.Name,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&c.ID,
+			p.Latitude,
+			p.Longitude,
+			&p.Attributes,
+			&p.UpdatedAt)
+	}
+
+	if _, err := stmProvince.PlaceholderFormat(squirrel.Dollar).RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("country", c.ID, "insert provinces", err)
+	}
+
+	return nil
+}
+func (cr *countryRepo) Update(ctx context.Context, c *Country) error {
+	res, err := squirrel.Update("country").
+		Set("name", &c.Name).
+		Set("iso2", squirrel.Expr("NULLIF(?, '')", c.ISO2)).
+		Set("iso3", squirrel.Expr("NULLIF(?, '')", c.ISO3)).
+		Set("total", &c.Total).
+		Set("new_case", &c.NewCase).
+		Set("treated", &c.Treated).
+		Set("decovering_case", &c.DecoveringCase).
+		Set("test_case", &c.TestCase).
+		Set("dead", &c.Dead).
+		Set("negative_case", &c.NegativeTest).
+		Set("attributes", &c.Attributes).
+		Set("updated_at", &c.UpdatedAt).
+		Where(squirrel.Eq{"id": &c.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(cr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("country", c.ID, "update country", err)
+	}
+	return wrapErr("country", c.ID, "update country", affectedOne(res))
+}
+func (cr *countryRepo) Delete(ctx context.Context, c *Country) (err error) {
+	tx, err := cr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return wrapErr("country", c.ID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("country", c.ID, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	if _, err := squirrel.Delete("country").
+		Where(squirrel.Eq{"id": &c.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("country", c.ID, "delete country", err)
+	}
+
+	if _, err := squirrel.Delete("provinces").
+		Where(squirrel.Eq{"country_id": &c.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("country", c.ID, "delete provinces", err)
+	}
+
+	return nil
+}
+func (cr *countryRepo) GetByID(ctx context.Context, id string) (*Country, error) {
+	v, err := hedgedRead(ctx, cr.db, cr.replica, cr.hedgeAfter, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return cr.getByID(ctx, db, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Country), nil
+}
+
+func (cr *countryRepo) List(ctx context.Context, page, limit uint64) (Countries, error) {
+	v, err := hedgedRead(ctx, cr.db, cr.replica, cr.hedgeAfter, func(ctx context.Context, db *sql.DB) (interface{}, error) {
+		return cr.list(ctx, db, page, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(Countries), nil
+}
+
+func (cr *countryRepo) list(ctx context.Context, db *sql.DB, page, limit uint64) (Countries, error) {
+	rows, err := squirrel.Select("id",
+		"name",
+		"COALESCE(iso2, '')",
+		"COALESCE(iso3, '')",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"attributes",
+		"updated_at").From("country").
+		OrderBy("name", "id").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("country", "", "select countries", err)
+	}
+	defer rows.Close()
+
+	var cs = make(Countries, 0)
+	for rows.Next() {
+		var c Country
+		if err := rows.Scan(&c.ID,
+			&c.Name,
+			&c.ISO2,
+			&c.ISO3,
+			&c.Total,
+			&c.NewCase,
+			&c.Treated,
+			&c.DecoveringCase,
+			&c.TestCase,
+			&c.Dead,
+			&c.NegativeTest,
+			&c.Attributes,
+			&c.UpdatedAt); err != nil {
+			return nil, wrapErr("country", "", "scan countries", err)
+		}
+		cs = append(cs, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("country", "", "select countries", err)
+	}
+	return cs, nil
+}
+
+func (cr *countryRepo) getByID(ctx context.Context, db *sql.DB, id string) (*Country, error) {
+	var c Country
+	err := squirrel.Select("id",
+		"name",
+		"COALESCE(iso2, '')",
+		"COALESCE(iso3, '')",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"attributes",
+		"updated_at").From("country").
+		Where(countryIDOrCode(id)).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(db).ScanContext(ctx,
+		&c.ID,
+		&c.Name,
+		&c.ISO2,
+		&c.ISO3,
+		&c.Total,
+		&c.NewCase,
+		&c.Treated,
+		&c.DecoveringCase,
+		&c.TestCase,
+		&c.Dead,
+		&c.NegativeTest,
+		&c.Attributes,
+		&c.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("country", id, "select country", err)
+	}
+
+	rows, err := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").
+		From("provinces").
+		Where(squirrel.Eq{"country_id": c.ID}).
+		OrderBy("total DESC").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("country", id, "select provinces", err)
+	}
+	defer rows.Close()
+
+	var ps = make(Provinces, 0)
+	for rows.Next() {
+		var p Province
+		if err := rows.Scan(&p.ID,
+			&p.Name,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&p.Latitude,
+			&p.Longitude,
+			&p.Attributes,
+			&p.UpdatedAt); err != nil {
+			return nil, wrapErr("country", id, "scan provinces", err)
+		}
+		ps = append(ps, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("country", id, "select provinces", err)
+	}
+
+	c.Provinces = ps
+
+	ids := []string{c.ID}
+	for _, p := range ps {
+		ids = append(ids, p.ID)
+	}
+	metrics, err := selectMetrics(ctx, db, ids...)
+	if err != nil {
+		return nil, err
+	}
+	c.Metrics = metrics[c.ID]
+	for _, p := range ps {
+		p.Metrics = metrics[p.ID]
+	}
+
+	return &c, nil
+}
+
+// Province Repo
+type provinceRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ ProvinceRepository = &provinceRepo{}
+
+func NewProvinceRepo(db *sql.DB, dialect migrations.Dialect) *provinceRepo {
+	return &provinceRepo{db: db, dialect: dialect}
+}
+
+func (pr *provinceRepo) Save(ctx context.Context, p *Province) error {
+	return nil
+}
+func (pr *provinceRepo) Update(ctx context.Context, p *Province) error {
+	return updateProvince(ctx, pr.db, p)
+}
+
+func updateProvince(ctx context.Context, runner squirrel.BaseRunner, p *Province) error {
+	res, err := squirrel.Update("provinces").
+		Set("name", &p.Name).
+		Set("total", &p.Total).
+		Set("new_case", &p.NewCase).
+		Set("treated", &p.Treated).
+		Set("decovering_case", &p.DecoveringCase).
+		Set("test_case", &p.TestCase).
+		Set("dead", &p.Dead).
+		Set("negative_case", &p.NegativeTest).
+		// coordinates left out are kept
+		Set("latitude", squirrel.Expr("COALESCE(?, latitude)", p.Latitude)).
+		Set("longitude", squirrel.Expr("COALESCE(?, longitude)", p.Longitude)).
+		Set("attributes", &p.Attributes).
+		Set("updated_at", &p.UpdatedAt).
+		Where(squirrel.Eq{"id": &p.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("province", p.ID, "update province", err)
+	}
+	return wrapErr("province", p.ID, "update province", affectedOne(res))
+}
+func (pr *provinceRepo) Delete(ctx context.Context, p *Province) error {
+	return nil
+}
+func (pr *provinceRepo) GetByID(ctx context.Context, id string) (*Province, error) {
+	var p Province
+	err := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").From("provinces").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ScanContext(ctx,
+		&p.ID,
+		&p.Name,
+		&p.Total,
+		&p.NewCase,
+		&p.Treated,
+		&p.DecoveringCase,
+		&p.TestCase,
+		&p.Dead,
+		&p.NegativeTest,
+		&p.Latitude,
+		&p.Longitude,
+		&p.Attributes,
+		&p.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("province", id, "select province", err)
+	}
+
+	metrics, err := selectMetrics(ctx, pr.db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Metrics = metrics[p.ID]
+
+	districts, err := selectDistricts(ctx, pr.db, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Districts = districts
+	return &p, nil
+}
+func (pr *provinceRepo) GetUpdatedBefore(ctx context.Context, before time.Time) (Provinces, error) {
+	rows, err := squirrel.Select("id", "name", "updated_at").
+		From("provinces").
+		Where(squirrel.Lt{"updated_at": before}).
+		OrderBy("updated_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", "", "select stale provinces", err)
+	}
+	defer rows.Close()
+
+	var ps = make(Provinces, 0)
+	for rows.Next() {
+		var p Province
+		if err := rows.Scan(&p.ID, &p.Name, &p.UpdatedAt); err != nil {
+			return nil, wrapErr("province", "", "scan stale provinces", err)
+		}
+		ps = append(ps, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", "", "select stale provinces", err)
+	}
+	return ps, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lruCache is an in-memory cache of at most size entries, each kept for ttl,
+// the least recently used entry making room for new ones. Values are stored
+// encoded, so that callers changing what they read do not change the cache.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: size, ttl: ttl, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get decodes the entry of key into v, reporting whether there was one.
+func (lc *lruCache) Get(key string, v interface{}) bool {
+	lc.mu.Lock()
+	el, ok := lc.items[key]
+	if !ok {
+		lc.mu.Unlock()
+		return false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		lc.order.Remove(el)
+		delete(lc.items, key)
+		lc.mu.Unlock()
+		return false
+	}
+	lc.order.MoveToFront(el)
+	value := e.value
+	lc.mu.Unlock()
+	return json.Unmarshal(value, v) == nil
+}
+
+func (lc *lruCache) Set(key string, v interface{}) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if el, ok := lc.items[key]; ok {
+		lc.order.Remove(el)
+	}
+	lc.items[key] = lc.order.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(lc.ttl)})
+	for lc.order.Len() > lc.size {
+		el := lc.order.Back()
+		lc.order.Remove(el)
+		delete(lc.items, el.Value.(*lruEntry).key)
+	}
+}
+
+func (lc *lruCache) Delete(keys ...string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := lc.items[key]; ok {
+			lc.order.Remove(el)
+			delete(lc.items, key)
+		}
+	}
+}
+
+// DeletePrefix drops the entries whose key starts with prefix.
+func (lc *lruCache) DeletePrefix(prefix string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for key, el := range lc.items {
+		if strings.HasPrefix(key, prefix) {
+			lc.order.Remove(el)
+			delete(lc.items, key)
+		}
+	}
+}
+
+// localCountryRepo keeps the countries read by id in cache. Writes through it
+// drop the country they write, and changes within a country, which holds its
+// provinces and their districts, drop every country. Reads for a write, see
+// forWrite, go around it.
+type localCountryRepo struct {
+	CountryRepository
+	cache *lruCache
+}
+
+var _ CountryRepository = &localCountryRepo{}
+
+func newLocalCountryRepo(repo CountryRepository, cache *lruCache, changes *changeHub) *localCountryRepo {
+	cr := &localCountryRepo{CountryRepository: repo, cache: cache}
+	changes.Listen(func(keys []string) {
+		for _, key := range keys {
+			if strings.HasPrefix(key, "country:") {
+				cache.Delete(key)
+			} else {
+				cache.DeletePrefix("country:")
+				return
+			}
+		}
+	})
+	return cr
+}
+
+func (cr *localCountryRepo) GetByID(ctx context.Context, id string) (*Country, error) {
+	// a write compares to the country as it is
+	if readsForWrite(ctx) {
+		return cr.CountryRepository.GetByID(ctx, id)
+	}
+	var c Country
+	if cr.cache.Get(countryKey(id), &c) {
+		return &c, nil
+	}
+	got, err := cr.CountryRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// a country looked up by its ISO code is kept under its id, for the
+	// changes of it to drop it
+	cr.cache.Set(countryKey(got.ID), got)
+	return got, nil
+}
+
+func (cr *localCountryRepo) Save(ctx context.Context, c *Country) error {
+	err := cr.CountryRepository.Save(ctx, c)
+	cr.cache.Delete(countryKey(c.ID))
+	return err
+}
+
+func (cr *localCountryRepo) Update(ctx context.Context, c *Country) error {
+	err := cr.CountryRepository.Update(ctx, c)
+	cr.cache.Delete(countryKey(c.ID))
+	return err
+}
+
+func (cr *localCountryRepo) Delete(ctx context.Context, c *Country) error {
+	err := cr.CountryRepository.Delete(ctx, c)
+	cr.cache.Delete(countryKey(c.ID))
+	return err
+}
+
+func (cr *localCountryRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	err := cr.CountryRepository.PatchAttributes(ctx, id, patch, updatedAt)
+	cr.cache.Delete(countryKey(id))
+	return err
+}
+
+func (cr *localCountryRepo) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	err := cr.CountryRepository.UpdatePartial(ctx, id, columns, updatedAt)
+	cr.cache.Delete(countryKey(id))
+	return err
+}
+
+// localProvinceRepo keeps the provinces read by id in cache, writes through it
+// and changes of a province, or of its districts, dropping it.
+type localProvinceRepo struct {
+	ProvinceRepository
+	cache *lruCache
+}
+
+var _ ProvinceRepository = &localProvinceRepo{}
+
+func newLocalProvinceRepo(repo ProvinceRepository, cache *lruCache, changes *changeHub) *localProvinceRepo {
+	pr := &localProvinceRepo{ProvinceRepository: repo, cache: cache}
+	changes.Listen(func(keys []string) {
+		district := false
+		for _, key := range keys {
+			switch {
+			case strings.HasPrefix(key, "province:"):
+				cache.Delete(key)
+				district = false
+			case strings.HasPrefix(key, "district:"):
+				district = true
+			}
+		}
+		// a deleted district names no province
+		if district {
+			cache.DeletePrefix("province:")
+		}
+	})
+	return pr
+}
+
+func (pr *localProvinceRepo) GetByID(ctx context.Context, id string) (*Province, error) {
+	if readsForWrite(ctx) {
+		return pr.ProvinceRepository.GetByID(ctx, id)
+	}
+	var p Province
+	if pr.cache.Get(provinceKey(id), &p) {
+		return &p, nil
+	}
+	got, err := pr.ProvinceRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	pr.cache.Set(provinceKey(id), got)
+	return got, nil
+}
+
+func (pr *localProvinceRepo) Save(ctx context.Context, p *Province) error {
+	err := pr.ProvinceRepository.Save(ctx, p)
+	pr.cache.Delete(provinceKey(p.ID))
+	return err
+}
+
+func (pr *localProvinceRepo) Update(ctx context.Context, p *Province) error {
+	err := pr.ProvinceRepository.Update(ctx, p)
+	pr.cache.Delete(provinceKey(p.ID))
+	return err
+}
+
+func (pr *localProvinceRepo) Delete(ctx context.Context, p *Province) error {
+	err := pr.ProvinceRepository.Delete(ctx, p)
+	pr.cache.Delete(provinceKey(p.ID))
+	return err
+}
+
+func (pr *localProvinceRepo) Merge(ctx context.Context, sourceID, targetID string) (*Province, error) {
+	p, err := pr.ProvinceRepository.Merge(ctx, sourceID, targetID)
+	pr.cache.Delete(provinceKey(sourceID), provinceKey(targetID))
+	return p, err
+}
+
+func (pr *localProvinceRepo) Split(ctx context.Context, id string, parts Provinces) error {
+	err := pr.ProvinceRepository.Split(ctx, id, parts)
+	pr.cache.Delete(provinceKey(id))
+	return err
+}
+
+func (pr *localProvinceRepo) PatchAttributes(ctx context.Context, id string, patch Attributes, updatedAt time.Time) error {
+	err := pr.ProvinceRepository.PatchAttributes(ctx, id, patch, updatedAt)
+	pr.cache.Delete(provinceKey(id))
+	return err
+}
+
+func (pr *localProvinceRepo) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	err := pr.ProvinceRepository.UpdatePartial(ctx, id, columns, updatedAt)
+	pr.cache.Delete(provinceKey(id))
+	return err
+}
+
+func (pr *localProvinceRepo) UpdateAll(ctx context.Context, ps Provinces) error {
+	err := pr.ProvinceRepository.UpdateAll(ctx, ps)
+	for _, p := range ps {
+		pr.cache.Delete(provinceKey(p.ID))
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// metricLevels maps the region levels a metric can be attached to to the
+// table holding the regions of that level.
+var metricLevels = map[string]string{
+	"country":  "country",
+	"province": "provinces",
+}
+
+var metricNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Metric is a named counter defined by admins on top of the built-in figures,
+// e.g. home_isolation or oxygen_cylinders.
+type Metric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Level       string    `json:"level"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Metrics []*Metric
+
+func (m *Metric) Prepare() {
+	m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+	m.Description = html.EscapeString(strings.TrimSpace(m.Description))
+	m.Level = strings.ToLower(strings.TrimSpace(m.Level))
+}
+
+func (m *Metric) Validate() error {
+	if !metricNamePattern.MatchString(m.Name) {
+		return errors.New("metric: name must be lowercase letters, digits and underscores")
+	}
+	if _, ok := metricLevels[m.Level]; !ok {
+		return errors.New("metric: level must be country or province")
+	}
+	return nil
+}
+
+type MetricValue struct {
+	Value     float64   `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Repository
+type MetricRepository interface {
+	Save(ctx context.Context, m *Metric) error
+	Delete(ctx context.Context, name string) error
+	GetAll(ctx context.Context) (Metrics, error)
+	SetValue(ctx context.Context, name, regionID string, v *MetricValue) error
+}
+
+type metricRepo struct {
+	db *sql.DB
+}
+
+var _ MetricRepository = &metricRepo{}
+
+func NewMetricRepo(db *sql.DB) *metricRepo {
+	return &metricRepo{db}
+}
+
+func (mr *metricRepo) Save(ctx context.Context, m *Metric) error {
+	if _, err := squirrel.Insert("metric_definitions").
+		Columns("name", "description", "level", "created_at").
+		Values(&m.Name, &m.Description, &m.Level, &m.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ExecContext(ctx); err != nil {
+		return wrapErr("metric", m.Name, "insert metric", err)
+	}
+	return nil
+}
+
+func (mr *metricRepo) Delete(ctx context.Context, name string) error {
+	res, err := squirrel.Delete("metric_definitions").
+		Where(squirrel.Eq{"name": name}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("metric", name, "delete metric", err)
+	}
+	return wrapErr("metric", name, "delete metric", affectedOne(res))
+}
+
+func (mr *metricRepo) GetAll(ctx context.Context) (Metrics, error) {
+	rows, err := squirrel.Select("name", "description", "level", "created_at").
+		From("metric_definitions").
+		OrderBy("name").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("metric", "", "select metrics", err)
+	}
+	defer rows.Close()
+
+	var ms = make(Metrics, 0)
+	for rows.Next() {
+		var m Metric
+		if err := rows.Scan(&m.Name, &m.Description, &m.Level, &m.CreatedAt); err != nil {
+			return nil, wrapErr("metric", "", "scan metrics", err)
+		}
+		ms = append(ms, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("metric", "", "select metrics", err)
+	}
+	return ms, nil
+}
+
+// SetValue stores the value of a metric for a region of the level the metric
+// is defined at.
+func (mr *metricRepo) SetValue(ctx context.Context, name, regionID string, v *MetricValue) error {
+	var level string
+	if err := squirrel.Select("level").
+		From("metric_definitions").
+		Where(squirrel.Eq{"name": name}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ScanContext(ctx, &level); err != nil {
+		return wrapErr("metric", name, "select metric", err)
+	}
+
+	var exists bool
+	if err := squirrel.Select("true").
+		From(metricLevels[level]).
+		Where(squirrel.Eq{"id": regionID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ScanContext(ctx, &exists); err != nil {
+		return wrapErr(level, regionID, "select region", err)
+	}
+
+	if _, err := squirrel.Insert("metric_values").
+		Columns("metric", "region_id", "value", "updated_at").
+		Values(name, regionID, &v.Value, &v.UpdatedAt).
+		Suffix("ON CONFLICT (metric, region_id) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ExecContext(ctx); err != nil {
+		return wrapErr("metric", name, "upsert value", err)
+	}
+	return nil
+}
+
+// selectMetrics reads the custom metric values of the given regions, keyed by
+// region id and then by metric name.
+func selectMetrics(ctx context.Context, runner squirrel.BaseRunner, regionIDs ...string) (map[string]map[string]float64, error) {
+	rows, err := squirrel.Select("region_id", "metric", "value").
+		From("metric_values").
+		Where(squirrel.Eq{"region_id": regionIDs}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("metric", "", "select values", err)
+	}
+	defer rows.Close()
+
+	metrics := make(map[string]map[string]float64, len(regionIDs))
+	for _, id := range regionIDs {
+		metrics[id] = map[string]float64{}
+	}
+	for rows.Next() {
+		var regionID, metric string
+		var value float64
+		if err := rows.Scan(&regionID, &metric, &value); err != nil {
+			return nil, wrapErr("metric", "", "scan values", err)
+		}
+		metrics[regionID][metric] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("metric", "", "select values", err)
+	}
+	return metrics, nil
+}
+
+// handler
+type metricService struct {
+	mApp MetricRepository
+}
+
+func NewMetricService(mApp MetricRepository) *metricService {
+	return &metricService{mApp: mApp}
+}
+
+func (mA *metricService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (mA *metricService) ListMetrics(c echo.Context) error {
+	ms, err := mA.mApp.GetAll(c.Request().Context())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Metrics{"metrics": ms})
+}
+
+func (mA *metricService) Store(c echo.Context) error {
+	var m Metric
+	if err := c.Bind(&m); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, mA.errMessage("request: unable to parse request payload"))
+	}
+	m.Prepare()
+	m.CreatedAt = time.Now()
+	if err := m.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, mA.errMessage(err.Error()))
+	}
+
+	if err := mA.mApp.Save(c.Request().Context(), &m); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*Metric{"metric": &m})
+}
+
+func (mA *metricService) Delete(c echo.Context) error {
+	if err := mA.mApp.Delete(c.Request().Context(), c.Param("name")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (mA *metricService) SetValue(c echo.Context) error {
+	var v MetricValue
+	if err := c.Bind(&v); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, mA.errMessage("request: unable to parse request payload"))
+	}
+	v.UpdatedAt = time.Now()
+
+	if err := mA.mApp.SetValue(c.Request().Context(), c.Param("name"), c.Param("region_id"), &v); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not set metric value")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*MetricValue{"value": &v})
+}
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS country (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           BIGINT NOT NULL DEFAULT 0,
+    new_case        BIGINT NOT NULL DEFAULT 0,
+    treated         BIGINT NOT NULL DEFAULT 0,
+    decovering_case BIGINT NOT NULL DEFAULT 0,
+    test_case       BIGINT NOT NULL DEFAULT 0,
+    dead            BIGINT NOT NULL DEFAULT 0,
+    negative_case   BIGINT NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS provinces (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           BIGINT NOT NULL DEFAULT 0,
+    new_case        BIGINT NOT NULL DEFAULT 0,
+    treated         BIGINT NOT NULL DEFAULT 0,
+    decovering_case BIGINT NOT NULL DEFAULT 0,
+    test_case       BIGINT NOT NULL DEFAULT 0,
+    dead            BIGINT NOT NULL DEFAULT 0,
+    negative_case   BIGINT NOT NULL DEFAULT 0,
+    country_id      TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS provinces_country_id_idx ON provinces (country_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS province_aliases (
+    name        TEXT NOT NULL,
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+-- an alias has to resolve to a single province
+CREATE UNIQUE INDEX IF NOT EXISTS province_aliases_name_idx ON province_aliases (lower(name));
+CREATE INDEX IF NOT EXISTS province_aliases_province_id_idx ON province_aliases (province_id);
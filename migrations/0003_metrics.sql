@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS metric_definitions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    level       TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS metric_values (
+    metric     TEXT NOT NULL REFERENCES metric_definitions (name) ON DELETE CASCADE,
+    region_id  TEXT NOT NULL,
+    value      DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (metric, region_id)
+);
+
+CREATE INDEX IF NOT EXISTS metric_values_region_id_idx ON metric_values (region_id);
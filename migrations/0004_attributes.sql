@@ -0,0 +1,2 @@
+ALTER TABLE country ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE provinces ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
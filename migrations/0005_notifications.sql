@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id         TEXT PRIMARY KEY,
+    kind       TEXT NOT NULL,
+    subject_id TEXT NOT NULL DEFAULT '',
+    message    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    read_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notifications_created_at_idx ON notifications (created_at DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (created_at DESC) WHERE read_at IS NULL;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS case_definitions (
+    version        TEXT PRIMARY KEY,
+    description    TEXT NOT NULL DEFAULT '',
+    effective_from TIMESTAMPTZ NOT NULL UNIQUE,
+    created_at     TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS mortality_months (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    month       DATE NOT NULL,
+    baseline    BIGINT NOT NULL,
+    observed    BIGINT NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (province_id, month)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS wastewater_samples (
+    id          TEXT PRIMARY KEY,
+    site        TEXT NOT NULL,
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id TEXT NOT NULL,
+    sampled_on  DATE NOT NULL,
+    viral_load  DOUBLE PRECISION NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS wastewater_samples_site_idx ON wastewater_samples (site, sampled_on);
+CREATE INDEX IF NOT EXISTS wastewater_samples_district_id_idx ON wastewater_samples (district_id, sampled_on);
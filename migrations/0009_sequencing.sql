@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS sequencing_submissions (
+    id               TEXT PRIMARY KEY,
+    lab              TEXT NOT NULL,
+    sample_date      DATE NOT NULL,
+    lineage          TEXT NOT NULL,
+    gisaid_accession TEXT UNIQUE,
+    case_id          TEXT NOT NULL DEFAULT '',
+    province_id      TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id      TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sequencing_submissions_province_id_idx ON sequencing_submissions (province_id, sample_date);
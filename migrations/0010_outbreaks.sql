@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS outbreaks (
+    id               TEXT PRIMARY KEY,
+    institution_type TEXT NOT NULL,
+    institution_name TEXT NOT NULL,
+    province_id      TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id      TEXT NOT NULL,
+    case_count       BIGINT NOT NULL DEFAULT 0,
+    status           TEXT NOT NULL,
+    reported_at      TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbreaks_province_id_idx ON outbreaks (province_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS supply_stocks (
+    province_id         TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    facility            TEXT NOT NULL DEFAULT '',
+    item                TEXT NOT NULL,
+    stock               DOUBLE PRECISION NOT NULL,
+    daily_consumption   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    low_stock_threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at          TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (province_id, facility, item)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS bed_occupancy (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    day         DATE NOT NULL,
+    beds        BIGINT NOT NULL,
+    occupied    BIGINT NOT NULL,
+    admissions  BIGINT NOT NULL DEFAULT 0,
+    discharges  BIGINT NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (province_id, day)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS hotline_calls (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    day         DATE NOT NULL,
+    category    TEXT NOT NULL,
+    calls       BIGINT NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (province_id, day, category)
+);
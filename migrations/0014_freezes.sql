@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS frozen_countries (
+    country_id TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    day        DATE NOT NULL,
+    revision   INTEGER NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    figures    JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (country_id, day, revision)
+);
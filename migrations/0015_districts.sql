@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS districts (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           BIGINT NOT NULL DEFAULT 0,
+    new_case        BIGINT NOT NULL DEFAULT 0,
+    treated         BIGINT NOT NULL DEFAULT 0,
+    decovering_case BIGINT NOT NULL DEFAULT 0,
+    test_case       BIGINT NOT NULL DEFAULT 0,
+    dead            BIGINT NOT NULL DEFAULT 0,
+    negative_case   BIGINT NOT NULL DEFAULT 0,
+    province_id     TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS districts_province_id_idx ON districts (province_id);
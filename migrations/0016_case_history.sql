@@ -0,0 +1,71 @@
+-- case_history keeps the figures of every country, province and district as
+-- they were at the end of each day they changed on, written by triggers so
+-- that every writer is covered.
+CREATE TABLE IF NOT EXISTS case_history (
+    kind            TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    day             DATE NOT NULL,
+    total           BIGINT NOT NULL,
+    new_case        BIGINT NOT NULL,
+    treated         BIGINT NOT NULL,
+    decovering_case BIGINT NOT NULL,
+    test_case       BIGINT NOT NULL,
+    dead            BIGINT NOT NULL,
+    negative_case   BIGINT NOT NULL,
+    recorded_at     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, entity_id, day)
+);
+
+CREATE OR REPLACE FUNCTION record_case_history() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO case_history (kind, entity_id, day, total, new_case, treated, decovering_case,
+                              test_case, dead, negative_case, recorded_at)
+    VALUES (TG_ARGV[0], NEW.id, (NEW.updated_at AT TIME ZONE 'UTC')::date, NEW.total, NEW.new_case,
+            NEW.treated, NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = EXCLUDED.total,
+        new_case = EXCLUDED.new_case,
+        treated = EXCLUDED.treated,
+        decovering_case = EXCLUDED.decovering_case,
+        test_case = EXCLUDED.test_case,
+        dead = EXCLUDED.dead,
+        negative_case = EXCLUDED.negative_case,
+        recorded_at = EXCLUDED.recorded_at
+    WHERE case_history.recorded_at <= EXCLUDED.recorded_at;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS country_case_history ON country;
+CREATE TRIGGER country_case_history
+    AFTER INSERT OR UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON country
+    FOR EACH ROW EXECUTE PROCEDURE record_case_history('country');
+
+DROP TRIGGER IF EXISTS provinces_case_history ON provinces;
+CREATE TRIGGER provinces_case_history
+    AFTER INSERT OR UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON provinces
+    FOR EACH ROW EXECUTE PROCEDURE record_case_history('province');
+
+DROP TRIGGER IF EXISTS districts_case_history ON districts;
+CREATE TRIGGER districts_case_history
+    AFTER INSERT OR UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON districts
+    FOR EACH ROW EXECUTE PROCEDURE record_case_history('district');
+
+-- the figures already stored are the first day of history
+INSERT INTO case_history
+SELECT 'country', id, (updated_at AT TIME ZONE 'UTC')::date, total, new_case, treated, decovering_case,
+       test_case, dead, negative_case, updated_at
+FROM country
+ON CONFLICT DO NOTHING;
+
+INSERT INTO case_history
+SELECT 'province', id, (updated_at AT TIME ZONE 'UTC')::date, total, new_case, treated, decovering_case,
+       test_case, dead, negative_case, updated_at
+FROM provinces
+ON CONFLICT DO NOTHING;
+
+INSERT INTO case_history
+SELECT 'district', id, (updated_at AT TIME ZONE 'UTC')::date, total, new_case, treated, decovering_case,
+       test_case, dead, negative_case, updated_at
+FROM districts
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,13 @@
+-- users are the staff allowed to change data. Editors with a province_id only
+-- change that province and are removed with it, editors without one change
+-- any province.
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    email         TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role          TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    province_id   TEXT REFERENCES provinces (id) ON DELETE CASCADE,
+    created_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
@@ -0,0 +1,12 @@
+-- request_journal records write requests, with secrets removed, so that they
+-- can be replayed against a staging deployment.
+CREATE TABLE IF NOT EXISTS request_journal (
+    id          BIGSERIAL PRIMARY KEY,
+    method      TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    query       TEXT NOT NULL DEFAULT '',
+    body        TEXT NOT NULL DEFAULT '',
+    actor       TEXT NOT NULL DEFAULT '',
+    status      INTEGER NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,16 @@
+-- sync_runs records every run of an importer from an external source, the
+-- latest one being its status.
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id                TEXT PRIMARY KEY,
+    source            TEXT NOT NULL,
+    status            TEXT NOT NULL,
+    report_date       DATE,
+    countries_updated INTEGER NOT NULL DEFAULT 0,
+    provinces_updated INTEGER NOT NULL DEFAULT 0,
+    unmatched         TEXT[] NOT NULL DEFAULT '{}',
+    error             TEXT NOT NULL DEFAULT '',
+    started_at        TIMESTAMPTZ NOT NULL,
+    finished_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sync_runs_source_idx ON sync_runs (source, started_at DESC);
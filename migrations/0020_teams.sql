@@ -0,0 +1,30 @@
+-- teams manage the dataset of the one country delegated to them, its
+-- provinces and districts, with API keys of their own and a daily quota of
+-- writes. Keys are stored as their SHA-256, the key itself being shown once.
+CREATE TABLE IF NOT EXISTS teams (
+    id                TEXT PRIMARY KEY,
+    name              TEXT NOT NULL,
+    country_id        TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    daily_write_quota INTEGER NOT NULL CHECK (daily_write_quota > 0),
+    created_at        TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS teams_country_id_idx ON teams (country_id);
+
+CREATE TABLE IF NOT EXISTS team_keys (
+    id         TEXT PRIMARY KEY,
+    team_id    TEXT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    prefix     TEXT NOT NULL,
+    key_hash   TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS team_keys_key_hash_idx ON team_keys (key_hash);
+CREATE INDEX IF NOT EXISTS team_keys_team_id_idx ON team_keys (team_id);
+
+CREATE TABLE IF NOT EXISTS team_usage (
+    team_id TEXT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    day     DATE NOT NULL,
+    writes  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (team_id, day)
+);
@@ -0,0 +1 @@
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS districts_updated INTEGER NOT NULL DEFAULT 0;
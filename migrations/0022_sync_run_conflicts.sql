@@ -0,0 +1 @@
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS conflicts TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,13 @@
+-- data_quality is the report of the consistency checks, the violations found
+-- by the last run, each kept with the time it was first seen.
+CREATE TABLE IF NOT EXISTS data_quality (
+    rule        TEXT NOT NULL,
+    kind        TEXT NOT NULL,
+    subject_id  TEXT NOT NULL,
+    field       TEXT NOT NULL,
+    day         DATE,
+    message     TEXT NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS data_quality_detected_at_idx ON data_quality (detected_at DESC);
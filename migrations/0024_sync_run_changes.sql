@@ -0,0 +1,19 @@
+-- sync_run_changes keeps the figures every record an import updated had
+-- before it, for the import to be rolled back.
+ALTER TABLE sync_runs ADD COLUMN IF NOT EXISTS rolled_back_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS sync_run_changes (
+    run_id          TEXT NOT NULL REFERENCES sync_runs (id) ON DELETE CASCADE,
+    kind            TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    parent_id       TEXT NOT NULL DEFAULT '',
+    total           BIGINT NOT NULL,
+    new_case        BIGINT NOT NULL,
+    treated         BIGINT NOT NULL,
+    decovering_case BIGINT NOT NULL,
+    test_case       BIGINT NOT NULL,
+    dead            BIGINT NOT NULL,
+    negative_case   BIGINT NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (run_id, kind, entity_id)
+);
@@ -0,0 +1,8 @@
+-- push_subscriptions are the browsers subscribed to Web Push, by the
+-- endpoint of their push service.
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    endpoint   TEXT PRIMARY KEY,
+    p256dh     TEXT NOT NULL,
+    auth       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
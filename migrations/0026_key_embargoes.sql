@@ -0,0 +1,4 @@
+-- an API key with an embargo, a time of day in UTC formatted as HH:MM, is
+-- shown the figures of the day before until that time, for partners who may
+-- only publish the daily numbers after it. NULL means no embargo.
+ALTER TABLE team_keys ADD COLUMN IF NOT EXISTS embargo TEXT;
@@ -0,0 +1,7 @@
+-- ISO 3166-1 alpha-2 and alpha-3 codes of countries, for clients to look
+-- them up by code instead of storing our ids. NULL until set.
+ALTER TABLE country ADD COLUMN IF NOT EXISTS iso2 TEXT;
+ALTER TABLE country ADD COLUMN IF NOT EXISTS iso3 TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso2_idx ON country (iso2);
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso3_idx ON country (iso3);
@@ -0,0 +1,6 @@
+-- the coordinates of provinces and districts, in WGS 84 degrees, for maps to
+-- place them. NULL until set.
+ALTER TABLE provinces ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE provinces ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+ALTER TABLE districts ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE districts ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
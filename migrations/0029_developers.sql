@@ -0,0 +1,25 @@
+-- developers register themselves for a read-only, rate-limited API key,
+-- issued once the email they registered with is verified. The key and the
+-- verification token are stored as their SHA-256, the key being shown once.
+CREATE TABLE IF NOT EXISTS developers (
+    id               TEXT PRIMARY KEY,
+    email            TEXT NOT NULL,
+    name             TEXT NOT NULL,
+    key_prefix       TEXT,
+    key_hash         TEXT,
+    token_hash       TEXT,
+    token_expires_at TIMESTAMPTZ,
+    verified_at      TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS developers_email_idx ON developers (email);
+CREATE UNIQUE INDEX IF NOT EXISTS developers_key_hash_idx ON developers (key_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS developers_token_hash_idx ON developers (token_hash);
+
+CREATE TABLE IF NOT EXISTS developer_usage (
+    developer_id TEXT NOT NULL REFERENCES developers (id) ON DELETE CASCADE,
+    day          DATE NOT NULL,
+    requests     INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (developer_id, day)
+);
@@ -0,0 +1,7 @@
+-- the tables purged past their retention window, see RETENTION_<TABLE>, are
+-- indexed by the column their rows expire by, for a purge not to scan them
+-- whole.
+CREATE INDEX IF NOT EXISTS request_journal_recorded_at_idx ON request_journal (recorded_at);
+CREATE INDEX IF NOT EXISTS sync_runs_finished_at_idx ON sync_runs (finished_at);
+CREATE INDEX IF NOT EXISTS team_usage_day_idx ON team_usage (day);
+CREATE INDEX IF NOT EXISTS developer_usage_day_idx ON developer_usage (day);
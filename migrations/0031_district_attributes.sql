@@ -0,0 +1 @@
+ALTER TABLE districts ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
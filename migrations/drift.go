@@ -0,0 +1,185 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	createTableRe = regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?(\w+) \($`)
+	addColumnRe   = regexp.MustCompile(`(?i)^ALTER TABLE (\w+) ADD COLUMN (?:IF NOT EXISTS )?(\w+)`)
+	createIndexRe = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (?:IF NOT EXISTS )?(\w+) ON`)
+	columnRe      = regexp.MustCompile(`^\s+(\w+)\s`)
+)
+
+// table constraints listed among the columns of a CREATE TABLE
+var constraintWords = map[string]bool{
+	"PRIMARY": true, "UNIQUE": true, "CHECK": true, "CONSTRAINT": true, "FOREIGN": true, "EXCLUDE": true,
+}
+
+// Schema is what the migrations create: the columns of every table and the
+// names of the indexes.
+type Schema struct {
+	Tables  map[string][]string
+	Indexes []string
+}
+
+// Expected reads the schema the migrations of dir create. It understands the
+// statements the way they are written in this directory, one column per line.
+func Expected(dir string) (*Schema, error) {
+	ms, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{Tables: make(map[string][]string)}
+	for _, m := range ms {
+		if err := s.read(m.Path); err != nil {
+			return nil, fmt.Errorf("migrations: %s: %w", m.Version, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) read(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var table string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if table != "" {
+			if strings.HasPrefix(line, ")") {
+				table = ""
+				continue
+			}
+			m := columnRe.FindStringSubmatch(line)
+			if m != nil && !constraintWords[strings.ToUpper(m[1])] {
+				s.Tables[table] = append(s.Tables[table], m[1])
+			}
+			continue
+		}
+		if m := createTableRe.FindStringSubmatch(line); m != nil {
+			table = m[1]
+			if _, ok := s.Tables[table]; !ok {
+				s.Tables[table] = nil
+			}
+		} else if m := addColumnRe.FindStringSubmatch(line); m != nil {
+			s.Tables[m[1]] = append(s.Tables[m[1]], m[2])
+		} else if m := createIndexRe.FindStringSubmatch(line); m != nil {
+			s.Indexes = append(s.Indexes, m[1])
+		}
+	}
+	return sc.Err()
+}
+
+// Drift compares the database with the migrations of dir and describes every
+// difference: migrations not applied, and tables, columns or indexes they
+// create that are missing. None means the database is what the code expects.
+func Drift(ctx context.Context, db *sql.DB, d Dialect, dir string) ([]string, error) {
+	ms, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := Applied(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, m := range ms {
+		if !applied[m.Version] {
+			problems = append(problems, "migration "+m.Version+" is not applied")
+		}
+	}
+
+	expected, err := Expected(dir)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := existingColumns(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(expected.Tables))
+	for t := range expected.Tables {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		have, ok := columns[t]
+		if !ok {
+			problems = append(problems, "table "+t+" is missing")
+			continue
+		}
+		for _, c := range expected.Tables[t] {
+			if !have[c] {
+				problems = append(problems, "column "+t+"."+c+" is missing")
+			}
+		}
+	}
+
+	indexes, err := existingIndexes(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range expected.Indexes {
+		if !indexes[i] {
+			problems = append(problems, "index "+i+" is missing")
+		}
+	}
+	return problems, nil
+}
+
+func existingColumns(ctx context.Context, db *sql.DB, d Dialect) (map[string]map[string]bool, error) {
+	query := "SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema()"
+	if d == SQLite {
+		query = "SELECT m.name, c.name FROM sqlite_master m JOIN pragma_table_info(m.name) c WHERE m.type = 'table'"
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: select columns: %w", err)
+	}
+	defer rows.Close()
+	columns := make(map[string]map[string]bool)
+	for rows.Next() {
+		var t, c string
+		if err := rows.Scan(&t, &c); err != nil {
+			return nil, fmt.Errorf("migrations: scan columns: %w", err)
+		}
+		if columns[t] == nil {
+			columns[t] = make(map[string]bool)
+		}
+		columns[t][c] = true
+	}
+	return columns, rows.Err()
+}
+
+func existingIndexes(ctx context.Context, db *sql.DB, d Dialect) (map[string]bool, error) {
+	query := "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()"
+	if d == SQLite {
+		query = "SELECT name FROM sqlite_master WHERE type = 'index'"
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: select indexes: %w", err)
+	}
+	defer rows.Close()
+	indexes := make(map[string]bool)
+	for rows.Next() {
+		var i string
+		if err := rows.Scan(&i); err != nil {
+			return nil, fmt.Errorf("migrations: scan indexes: %w", err)
+		}
+		indexes[i] = true
+	}
+	return indexes, rows.Err()
+}
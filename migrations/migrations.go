@@ -0,0 +1,169 @@
+// Package migrations applies the SQL files of this directory to a database in
+// the order of their names, recording every applied file in schema_migrations
+// so that each one runs once. The files of this directory are written for
+// postgres, those of sqlite/ for SQLite.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lockID is the advisory lock held while migrating, so that two releases
+// started at the same time do not apply the same file twice.
+const lockID = 40190001
+
+// Dialect is the SQL of the database the migrations are applied to, which
+// their bookkeeping differs by.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// Migration is one SQL file, its version being the file name without .sql.
+type Migration struct {
+	Version string
+	Path    string
+}
+
+// Load lists the migrations in dir by version.
+func Load(dir string) ([]*Migration, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	ms := make([]*Migration, len(paths))
+	for i, p := range paths {
+		ms[i] = &Migration{Version: strings.TrimSuffix(filepath.Base(p), ".sql"), Path: p}
+	}
+	return ms, nil
+}
+
+// Applied returns the versions recorded in schema_migrations, none when the
+// table does not exist yet.
+func Applied(ctx context.Context, db *sql.DB, d Dialect) (map[string]bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if d == SQLite {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')"
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migrations: check schema_migrations: %w", err)
+	}
+	applied := make(map[string]bool)
+	if !exists {
+		return applied, nil
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migrations: select versions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("migrations: scan versions: %w", err)
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// Apply runs the migrations of dir that were not applied yet, each in its own
+// transaction, and returns the versions it applied.
+func Apply(ctx context.Context, db *sql.DB, d Dialect, dir string) ([]string, error) {
+	ms, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	create := `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    TEXT PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+	if d == SQLite {
+		create = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    TEXT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+	}
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return nil, fmt.Errorf("migrations: create schema_migrations: %w", err)
+	}
+
+	var done []string
+	for _, m := range ms {
+		ok, err := apply(ctx, db, d, m)
+		if err != nil {
+			return done, err
+		}
+		if ok {
+			done = append(done, m.Version)
+		}
+	}
+	return done, nil
+}
+
+func apply(ctx context.Context, db *sql.DB, d Dialect, m *Migration) (ok bool, err error) {
+	script, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("migrations: %s: begin: %w", m.Version, err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = fmt.Errorf("migrations: %s: commit: %w", m.Version, commitErr)
+			}
+			return
+		}
+		tx.Rollback()
+	}()
+
+	// SQLite takes the lock of the whole database with the transaction
+	if d == Postgres {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", lockID); err != nil {
+			return false, fmt.Errorf("migrations: %s: lock: %w", m.Version, err)
+		}
+	}
+	var applied bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.Version).Scan(&applied); err != nil {
+		return false, fmt.Errorf("migrations: %s: check: %w", m.Version, err)
+	}
+	if applied {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return false, fmt.Errorf("migrations: %s: %w", m.Version, err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.Version); err != nil {
+		return false, fmt.Errorf("migrations: %s: record: %w", m.Version, err)
+	}
+	return true, nil
+}
+
+// Current returns the latest applied version, empty when none is.
+func Current(ctx context.Context, db *sql.DB, d Dialect) (string, error) {
+	applied, err := Applied(ctx, db, d)
+	if err != nil {
+		return "", err
+	}
+	var current string
+	for v := range applied {
+		if v > current {
+			current = v
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,418 @@
+-- the schema of the postgres migrations up to 0031, for SQLite. Times are
+-- stored as text in UTC, days as YYYY-MM-DD, arrays in the text format of
+-- postgres and JSON documents as text, so that they compare and scan the
+-- same way.
+CREATE TABLE IF NOT EXISTS country (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           INTEGER NOT NULL DEFAULT 0,
+    new_case        INTEGER NOT NULL DEFAULT 0,
+    treated         INTEGER NOT NULL DEFAULT 0,
+    decovering_case INTEGER NOT NULL DEFAULT 0,
+    test_case       INTEGER NOT NULL DEFAULT 0,
+    dead            INTEGER NOT NULL DEFAULT 0,
+    negative_case   INTEGER NOT NULL DEFAULT 0,
+    updated_at      TIMESTAMP NOT NULL,
+    attributes      TEXT NOT NULL DEFAULT '{}',
+    iso2            TEXT,
+    iso3            TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso2_idx ON country (iso2);
+CREATE UNIQUE INDEX IF NOT EXISTS country_iso3_idx ON country (iso3);
+
+CREATE TABLE IF NOT EXISTS provinces (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           INTEGER NOT NULL DEFAULT 0,
+    new_case        INTEGER NOT NULL DEFAULT 0,
+    treated         INTEGER NOT NULL DEFAULT 0,
+    decovering_case INTEGER NOT NULL DEFAULT 0,
+    test_case       INTEGER NOT NULL DEFAULT 0,
+    dead            INTEGER NOT NULL DEFAULT 0,
+    negative_case   INTEGER NOT NULL DEFAULT 0,
+    country_id      TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    updated_at      TIMESTAMP NOT NULL,
+    attributes      TEXT NOT NULL DEFAULT '{}',
+    latitude        REAL,
+    longitude       REAL
+);
+
+CREATE INDEX IF NOT EXISTS provinces_country_id_idx ON provinces (country_id);
+
+CREATE TABLE IF NOT EXISTS province_aliases (
+    name        TEXT NOT NULL,
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS province_aliases_name_idx ON province_aliases (lower(name));
+CREATE INDEX IF NOT EXISTS province_aliases_province_id_idx ON province_aliases (province_id);
+
+CREATE TABLE IF NOT EXISTS districts (
+    id              TEXT PRIMARY KEY,
+    name            TEXT NOT NULL,
+    total           INTEGER NOT NULL DEFAULT 0,
+    new_case        INTEGER NOT NULL DEFAULT 0,
+    treated         INTEGER NOT NULL DEFAULT 0,
+    decovering_case INTEGER NOT NULL DEFAULT 0,
+    test_case       INTEGER NOT NULL DEFAULT 0,
+    dead            INTEGER NOT NULL DEFAULT 0,
+    negative_case   INTEGER NOT NULL DEFAULT 0,
+    province_id     TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    updated_at      TIMESTAMP NOT NULL,
+    latitude        REAL,
+    longitude       REAL,
+    attributes      TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS districts_province_id_idx ON districts (province_id);
+
+CREATE TABLE IF NOT EXISTS metric_definitions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    level       TEXT NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS metric_values (
+    metric     TEXT NOT NULL REFERENCES metric_definitions (name) ON DELETE CASCADE,
+    region_id  TEXT NOT NULL,
+    value      REAL NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (metric, region_id)
+);
+
+CREATE INDEX IF NOT EXISTS metric_values_region_id_idx ON metric_values (region_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         TEXT PRIMARY KEY,
+    kind       TEXT NOT NULL,
+    subject_id TEXT NOT NULL DEFAULT '',
+    message    TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notifications_created_at_idx ON notifications (created_at DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (created_at DESC) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS case_definitions (
+    version        TEXT PRIMARY KEY,
+    description    TEXT NOT NULL DEFAULT '',
+    effective_from TIMESTAMP NOT NULL UNIQUE,
+    created_at     TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS mortality_months (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    month       DATE NOT NULL,
+    baseline    INTEGER NOT NULL,
+    observed    INTEGER NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (province_id, month)
+);
+
+CREATE TABLE IF NOT EXISTS wastewater_samples (
+    id          TEXT PRIMARY KEY,
+    site        TEXT NOT NULL,
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id TEXT NOT NULL,
+    sampled_on  DATE NOT NULL,
+    viral_load  REAL NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS wastewater_samples_site_idx ON wastewater_samples (site, sampled_on);
+CREATE INDEX IF NOT EXISTS wastewater_samples_district_id_idx ON wastewater_samples (district_id, sampled_on);
+
+CREATE TABLE IF NOT EXISTS sequencing_submissions (
+    id               TEXT PRIMARY KEY,
+    lab              TEXT NOT NULL,
+    sample_date      DATE NOT NULL,
+    lineage          TEXT NOT NULL,
+    gisaid_accession TEXT UNIQUE,
+    case_id          TEXT NOT NULL DEFAULT '',
+    province_id      TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id      TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sequencing_submissions_province_id_idx ON sequencing_submissions (province_id, sample_date);
+
+CREATE TABLE IF NOT EXISTS outbreaks (
+    id               TEXT PRIMARY KEY,
+    institution_type TEXT NOT NULL,
+    institution_name TEXT NOT NULL,
+    province_id      TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    district_id      TEXT NOT NULL,
+    case_count       INTEGER NOT NULL DEFAULT 0,
+    status           TEXT NOT NULL,
+    reported_at      TIMESTAMP NOT NULL,
+    updated_at       TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbreaks_province_id_idx ON outbreaks (province_id);
+
+CREATE TABLE IF NOT EXISTS supply_stocks (
+    province_id         TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    facility            TEXT NOT NULL DEFAULT '',
+    item                TEXT NOT NULL,
+    stock               REAL NOT NULL,
+    daily_consumption   REAL NOT NULL DEFAULT 0,
+    low_stock_threshold REAL NOT NULL DEFAULT 0,
+    updated_at          TIMESTAMP NOT NULL,
+    PRIMARY KEY (province_id, facility, item)
+);
+
+CREATE TABLE IF NOT EXISTS bed_occupancy (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    day         DATE NOT NULL,
+    beds        INTEGER NOT NULL,
+    occupied    INTEGER NOT NULL,
+    admissions  INTEGER NOT NULL DEFAULT 0,
+    discharges  INTEGER NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (province_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS hotline_calls (
+    province_id TEXT NOT NULL REFERENCES provinces (id) ON DELETE CASCADE,
+    day         DATE NOT NULL,
+    category    TEXT NOT NULL,
+    calls       INTEGER NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    PRIMARY KEY (province_id, day, category)
+);
+
+CREATE TABLE IF NOT EXISTS frozen_countries (
+    country_id TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    day        DATE NOT NULL,
+    revision   INTEGER NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    figures    TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (country_id, day, revision)
+);
+
+-- case_history keeps the figures of every country, province and district as
+-- they were at the end of each day they changed on, written by the triggers
+-- below so that every writer is covered.
+CREATE TABLE IF NOT EXISTS case_history (
+    kind            TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    day             DATE NOT NULL,
+    total           INTEGER NOT NULL,
+    new_case        INTEGER NOT NULL,
+    treated         INTEGER NOT NULL,
+    decovering_case INTEGER NOT NULL,
+    test_case       INTEGER NOT NULL,
+    dead            INTEGER NOT NULL,
+    negative_case   INTEGER NOT NULL,
+    recorded_at     TIMESTAMP NOT NULL,
+    PRIMARY KEY (kind, entity_id, day)
+);
+
+CREATE TRIGGER IF NOT EXISTS country_case_history_insert AFTER INSERT ON country
+BEGIN
+    INSERT INTO case_history VALUES ('country', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TRIGGER IF NOT EXISTS country_case_history_update
+AFTER UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON country
+BEGIN
+    INSERT INTO case_history VALUES ('country', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TRIGGER IF NOT EXISTS provinces_case_history_insert AFTER INSERT ON provinces
+BEGIN
+    INSERT INTO case_history VALUES ('province', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TRIGGER IF NOT EXISTS provinces_case_history_update
+AFTER UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON provinces
+BEGIN
+    INSERT INTO case_history VALUES ('province', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TRIGGER IF NOT EXISTS districts_case_history_insert AFTER INSERT ON districts
+BEGIN
+    INSERT INTO case_history VALUES ('district', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TRIGGER IF NOT EXISTS districts_case_history_update
+AFTER UPDATE OF total, new_case, treated, decovering_case, test_case, dead, negative_case ON districts
+BEGIN
+    INSERT INTO case_history VALUES ('district', NEW.id, date(NEW.updated_at), NEW.total, NEW.new_case, NEW.treated,
+                                     NEW.decovering_case, NEW.test_case, NEW.dead, NEW.negative_case, NEW.updated_at)
+    ON CONFLICT (kind, entity_id, day) DO UPDATE SET
+        total = excluded.total, new_case = excluded.new_case, treated = excluded.treated,
+        decovering_case = excluded.decovering_case, test_case = excluded.test_case, dead = excluded.dead,
+        negative_case = excluded.negative_case, recorded_at = excluded.recorded_at
+    WHERE case_history.recorded_at <= excluded.recorded_at;
+END;
+
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    email         TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    role          TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'admin')),
+    province_id   TEXT REFERENCES provinces (id) ON DELETE CASCADE,
+    created_at    TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
+
+CREATE TABLE IF NOT EXISTS request_journal (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    method      TEXT NOT NULL,
+    path        TEXT NOT NULL,
+    query       TEXT NOT NULL DEFAULT '',
+    body        TEXT NOT NULL DEFAULT '',
+    actor       TEXT NOT NULL DEFAULT '',
+    status      INTEGER NOT NULL,
+    recorded_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS request_journal_recorded_at_idx ON request_journal (recorded_at);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id                TEXT PRIMARY KEY,
+    source            TEXT NOT NULL,
+    status            TEXT NOT NULL,
+    report_date       DATE,
+    countries_updated INTEGER NOT NULL DEFAULT 0,
+    provinces_updated INTEGER NOT NULL DEFAULT 0,
+    unmatched         TEXT NOT NULL DEFAULT '{}',
+    error             TEXT NOT NULL DEFAULT '',
+    started_at        TIMESTAMP NOT NULL,
+    finished_at       TIMESTAMP NOT NULL,
+    districts_updated INTEGER NOT NULL DEFAULT 0,
+    conflicts         TEXT NOT NULL DEFAULT '{}',
+    rolled_back_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sync_runs_source_idx ON sync_runs (source, started_at DESC);
+CREATE INDEX IF NOT EXISTS sync_runs_finished_at_idx ON sync_runs (finished_at);
+
+CREATE TABLE IF NOT EXISTS sync_run_changes (
+    run_id          TEXT NOT NULL REFERENCES sync_runs (id) ON DELETE CASCADE,
+    kind            TEXT NOT NULL,
+    entity_id       TEXT NOT NULL,
+    parent_id       TEXT NOT NULL DEFAULT '',
+    total           INTEGER NOT NULL,
+    new_case        INTEGER NOT NULL,
+    treated         INTEGER NOT NULL,
+    decovering_case INTEGER NOT NULL,
+    test_case       INTEGER NOT NULL,
+    dead            INTEGER NOT NULL,
+    negative_case   INTEGER NOT NULL,
+    updated_at      TIMESTAMP NOT NULL,
+    PRIMARY KEY (run_id, kind, entity_id)
+);
+
+CREATE TABLE IF NOT EXISTS teams (
+    id                TEXT PRIMARY KEY,
+    name              TEXT NOT NULL,
+    country_id        TEXT NOT NULL REFERENCES country (id) ON DELETE CASCADE,
+    daily_write_quota INTEGER NOT NULL CHECK (daily_write_quota > 0),
+    created_at        TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS teams_country_id_idx ON teams (country_id);
+
+CREATE TABLE IF NOT EXISTS team_keys (
+    id         TEXT PRIMARY KEY,
+    team_id    TEXT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    prefix     TEXT NOT NULL,
+    key_hash   TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    embargo    TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS team_keys_key_hash_idx ON team_keys (key_hash);
+CREATE INDEX IF NOT EXISTS team_keys_team_id_idx ON team_keys (team_id);
+
+CREATE TABLE IF NOT EXISTS team_usage (
+    team_id TEXT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    day     DATE NOT NULL,
+    writes  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (team_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS team_usage_day_idx ON team_usage (day);
+
+CREATE TABLE IF NOT EXISTS data_quality (
+    rule        TEXT NOT NULL,
+    kind        TEXT NOT NULL,
+    subject_id  TEXT NOT NULL,
+    field       TEXT NOT NULL,
+    day         DATE,
+    message     TEXT NOT NULL,
+    detected_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS data_quality_detected_at_idx ON data_quality (detected_at DESC);
+
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    endpoint   TEXT PRIMARY KEY,
+    p256dh     TEXT NOT NULL,
+    auth       TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS developers (
+    id               TEXT PRIMARY KEY,
+    email            TEXT NOT NULL,
+    name             TEXT NOT NULL,
+    key_prefix       TEXT,
+    key_hash         TEXT,
+    token_hash       TEXT,
+    token_expires_at TIMESTAMP,
+    verified_at      TIMESTAMP,
+    created_at       TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS developers_email_idx ON developers (email);
+CREATE UNIQUE INDEX IF NOT EXISTS developers_key_hash_idx ON developers (key_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS developers_token_hash_idx ON developers (token_hash);
+
+CREATE TABLE IF NOT EXISTS developer_usage (
+    developer_id TEXT NOT NULL REFERENCES developers (id) ON DELETE CASCADE,
+    day          DATE NOT NULL,
+    requests     INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (developer_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS developer_usage_day_idx ON developer_usage (day);
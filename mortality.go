@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const monthLayout = "2006-01"
+
+// MortalityMonth is the all-cause deaths of a month against the baseline
+// expected for it, from which excess mortality is estimated.
+type MortalityMonth struct {
+	Month     string    `json:"month"`
+	Baseline  int64     `json:"baseline"`
+	Observed  int64     `json:"observed"`
+	Excess    int64     `json:"excess"`
+	PScore    float64   `json:"p_score"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type MortalityMonths []*MortalityMonth
+
+func (m *MortalityMonth) Validate() error {
+	if _, err := time.Parse(monthLayout, m.Month); err != nil {
+		return errors.New("mortality: month must be formatted as YYYY-MM")
+	}
+	if m.Baseline < 0 || m.Observed < 0 {
+		return errors.New("mortality: deaths must not be negative")
+	}
+	return nil
+}
+
+// Estimate fills in the excess deaths and the P-score, the excess as a
+// percentage of the baseline.
+func (m *MortalityMonth) Estimate() {
+	m.Excess = m.Observed - m.Baseline
+	m.PScore = pScore(m.Excess, m.Baseline)
+}
+
+func pScore(excess, baseline int64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return math.Round(float64(excess)/float64(baseline)*10000) / 100
+}
+
+type ExcessMortality struct {
+	Months   MortalityMonths `json:"months"`
+	Baseline int64           `json:"baseline"`
+	Observed int64           `json:"observed"`
+	Excess   int64           `json:"excess"`
+	PScore   float64         `json:"p_score"`
+}
+
+func NewExcessMortality(months MortalityMonths) *ExcessMortality {
+	em := &ExcessMortality{Months: months}
+	for _, m := range months {
+		m.Estimate()
+		em.Baseline += m.Baseline
+		em.Observed += m.Observed
+	}
+	em.Excess = em.Observed - em.Baseline
+	em.PScore = pScore(em.Excess, em.Baseline)
+	return em
+}
+
+// Repository
+type MortalityRepository interface {
+	Save(ctx context.Context, provinceID string, m *MortalityMonth) error
+	GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (MortalityMonths, error)
+	// GetByCountry adds the months of every province of the country up.
+	GetByCountry(ctx context.Context, countryID string, from, to time.Time) (MortalityMonths, error)
+}
+
+type mortalityRepo struct {
+	db *sql.DB
+}
+
+var _ MortalityRepository = &mortalityRepo{}
+
+func NewMortalityRepo(db *sql.DB) *mortalityRepo {
+	return &mortalityRepo{db}
+}
+
+func (mr *mortalityRepo) Save(ctx context.Context, provinceID string, m *MortalityMonth) error {
+	month, err := time.Parse(monthLayout, m.Month)
+	if err != nil {
+		return err
+	}
+	if _, err := squirrel.Insert("mortality_months").
+		Columns("province_id", "month", "baseline", "observed", "updated_at").
+		Values(provinceID, month, &m.Baseline, &m.Observed, &m.UpdatedAt).
+		Suffix("ON CONFLICT (province_id, month) DO UPDATE SET baseline = EXCLUDED.baseline, observed = EXCLUDED.observed, updated_at = EXCLUDED.updated_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).ExecContext(ctx); err != nil {
+		return wrapErr("province", provinceID, "upsert mortality", err)
+	}
+	return nil
+}
+
+func (mr *mortalityRepo) GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (MortalityMonths, error) {
+	rows, err := squirrel.Select("month", "baseline", "observed", "updated_at").
+		From("mortality_months").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"month": from}).
+		Where(squirrel.LtOrEq{"month": to}).
+		OrderBy("month").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select mortality", err)
+	}
+	ms, err := scanMortalityMonths(rows)
+	return ms, wrapErr("province", provinceID, "select mortality", err)
+}
+
+func (mr *mortalityRepo) GetByCountry(ctx context.Context, countryID string, from, to time.Time) (MortalityMonths, error) {
+	rows, err := squirrel.Select("m.month", "SUM(m.baseline)", "SUM(m.observed)", "MAX(m.updated_at)").
+		From("mortality_months m").
+		Join("provinces p ON p.id = m.province_id").
+		Where(squirrel.Eq{"p.country_id": countryID}).
+		Where(squirrel.GtOrEq{"m.month": from}).
+		Where(squirrel.LtOrEq{"m.month": to}).
+		GroupBy("m.month").
+		OrderBy("m.month").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(mr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("country", countryID, "select mortality", err)
+	}
+	ms, err := scanMortalityMonths(rows)
+	return ms, wrapErr("country", countryID, "select mortality", err)
+}
+
+func scanMortalityMonths(rows *sql.Rows) (MortalityMonths, error) {
+	defer rows.Close()
+
+	var ms = make(MortalityMonths, 0)
+	for rows.Next() {
+		var m MortalityMonth
+		var month time.Time
+		if err := rows.Scan(&month, &m.Baseline, &m.Observed, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		m.Month = month.Format(monthLayout)
+		ms = append(ms, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// handler
+type mortalityService struct {
+	mApp MortalityRepository
+}
+
+func NewMortalityService(mApp MortalityRepository) *mortalityService {
+	return &mortalityService{mApp: mApp}
+}
+
+func (mA *mortalityService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (mA *mortalityService) StoreMonth(c echo.Context) error {
+	var m MortalityMonth
+	if err := c.Bind(&m); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, mA.errMessage("request: unable to parse request payload"))
+	}
+	m.Month = c.Param("month")
+	m.UpdatedAt = time.Now()
+	if err := m.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, mA.errMessage(err.Error()))
+	}
+
+	if err := mA.mApp.Save(c.Request().Context(), c.Param("province_id"), &m); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	m.Estimate()
+	return c.JSON(http.StatusOK, map[string]*MortalityMonth{"mortality": &m})
+}
+
+func (mA *mortalityService) ProvinceExcess(c echo.Context) error {
+	from, to, err := monthRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, mA.errMessage(err.Error()))
+	}
+	if err := checkMonths(from, to, maxMortalityMonths); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, mA.errMessage(err.Error()))
+	}
+	ms, err := mA.mApp.GetByProvince(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*ExcessMortality{"excess_mortality": NewExcessMortality(ms)})
+}
+
+func (mA *mortalityService) CountryExcess(c echo.Context) error {
+	from, to, err := monthRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, mA.errMessage(err.Error()))
+	}
+	if err := checkMonths(from, to, maxMortalityMonths); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, mA.errMessage(err.Error()))
+	}
+	ms, err := mA.mApp.GetByCountry(c.Request().Context(), c.Param("country_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, mA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*ExcessMortality{"excess_mortality": NewExcessMortality(ms)})
+}
+
+// monthRange reads ?from= and ?to= as YYYY-MM, defaulting to the last twelve
+// months.
+func monthRange(c echo.Context) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -11, 0)
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse(monthLayout, v)
+		if err != nil {
+			return from, to, errors.New("request: from must be formatted as YYYY-MM")
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse(monthLayout, v)
+		if err != nil {
+			return from, to, errors.New("request: to must be formatted as YYYY-MM")
+		}
+		to = t
+	}
+	if to.Before(from) {
+		return from, to, errors.New("request: to must not be before from")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+// kinds of system events operators are notified about
+const (
+	NotificationJobFailed         = "job_failed"
+	NotificationImportFailed      = "import_failed"
+	NotificationAnomaly           = "anomaly"
+	NotificationWebhookDeadLetter = "webhook_dead_letter"
+	NotificationStaleProvince     = "stale_province"
+	NotificationLowStock          = "low_stock"
+	NotificationViolation         = "data_quality"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 500
+)
+
+type Notification struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	SubjectID string     `json:"subject_id"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+type Notifications []*Notification
+
+func NewNotification(kind, subjectID, format string, args ...interface{}) *Notification {
+	return &Notification{
+		ID:        uuid.NewV4().String(),
+		Kind:      kind,
+		SubjectID: subjectID,
+		Message:   fmt.Sprintf(format, args...),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Repository
+type NotificationRepository interface {
+	Save(ctx context.Context, n *Notification) error
+	GetAll(ctx context.Context, unreadOnly bool, limit uint64) (Notifications, error)
+	MarkRead(ctx context.Context, id string, readAt time.Time) error
+	MarkAllRead(ctx context.Context, readAt time.Time) error
+}
+
+type notificationRepo struct {
+	db *sql.DB
+}
+
+var _ NotificationRepository = &notificationRepo{}
+
+func NewNotificationRepo(db *sql.DB) *notificationRepo {
+	return &notificationRepo{db}
+}
+
+func (nr *notificationRepo) Save(ctx context.Context, n *Notification) error {
+	if _, err := squirrel.Insert("notifications").
+		Columns("id", "kind", "subject_id", "message", "created_at").
+		Values(&n.ID, &n.Kind, &n.SubjectID, &n.Message, &n.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(nr.db).ExecContext(ctx); err != nil {
+		return wrapErr("notification", n.ID, "insert notification", err)
+	}
+	return nil
+}
+
+func (nr *notificationRepo) GetAll(ctx context.Context, unreadOnly bool, limit uint64) (Notifications, error) {
+	stm := squirrel.Select("id", "kind", "subject_id", "message", "created_at", "read_at").
+		From("notifications").
+		OrderBy("created_at DESC").
+		Limit(limit)
+	if unreadOnly {
+		stm = stm.Where(squirrel.Eq{"read_at": nil})
+	}
+	rows, err := stm.PlaceholderFormat(squirrel.Dollar).
+		RunWith(nr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("notification", "", "select notifications", err)
+	}
+	defer rows.Close()
+
+	var ns = make(Notifications, 0)
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Kind, &n.SubjectID, &n.Message, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, wrapErr("notification", "", "scan notifications", err)
+		}
+		ns = append(ns, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("notification", "", "select notifications", err)
+	}
+	return ns, nil
+}
+
+func (nr *notificationRepo) MarkRead(ctx context.Context, id string, readAt time.Time) error {
+	res, err := squirrel.Update("notifications").
+		Set("read_at", squirrel.Expr("COALESCE(read_at, ?)", readAt)).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(nr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("notification", id, "mark read", err)
+	}
+	return wrapErr("notification", id, "mark read", affectedOne(res))
+}
+
+func (nr *notificationRepo) MarkAllRead(ctx context.Context, readAt time.Time) error {
+	if _, err := squirrel.Update("notifications").
+		Set("read_at", readAt).
+		Where(squirrel.Eq{"read_at": nil}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(nr.db).ExecContext(ctx); err != nil {
+		return wrapErr("notification", "", "mark all read", err)
+	}
+	return nil
+}
+
+// handler
+type notificationService struct {
+	nApp NotificationRepository
+}
+
+func NewNotificationService(nApp NotificationRepository) *notificationService {
+	return &notificationService{nApp: nApp}
+}
+
+func (nA *notificationService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (nA *notificationService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+func (nA *notificationService) ListNotifications(c echo.Context) error {
+	limit := uint64(defaultNotificationLimit)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || n == 0 || n > maxNotificationLimit {
+			return c.JSON(http.StatusBadRequest, nA.errMessage(fmt.Sprintf("request: limit must be between 1 and %d", maxNotificationLimit)))
+		}
+		limit = n
+	}
+	unreadOnly := c.QueryParam("unread") == "true"
+
+	ns, err := nA.nApp.GetAll(c.Request().Context(), unreadOnly, limit)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, nA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Notifications{"notifications": ns})
+}
+
+func (nA *notificationService) MarkRead(c echo.Context) error {
+	if err := nA.nApp.MarkRead(c.Request().Context(), c.Param("notification_id"), time.Now()); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, nA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (nA *notificationService) MarkAllRead(c echo.Context) error {
+	if err := nA.nApp.MarkAllRead(c.Request().Context(), time.Now()); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, nA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, nA.successMsg("notifications marked as read"))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultProjectionWindow = 7
+	maxProjectionWindow     = 60
+)
+
+// BedOccupancy is the hospital bed capacity of a province on a day, how
+// many of the beds were occupied and the admissions and discharges of the
+// day.
+type BedOccupancy struct {
+	Day        string    `json:"day"`
+	Beds       int64     `json:"beds"`
+	Occupied   int64     `json:"occupied"`
+	Admissions int64     `json:"admissions"`
+	Discharges int64     `json:"discharges"`
+	Rate       float64   `json:"rate"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type BedOccupancies []*BedOccupancy
+
+func (b *BedOccupancy) Validate() error {
+	if _, err := time.Parse(dateLayout, b.Day); err != nil {
+		return errors.New("occupancy: day must be formatted as YYYY-MM-DD")
+	}
+	if b.Beds < 0 || b.Occupied < 0 || b.Admissions < 0 || b.Discharges < 0 {
+		return errors.New("occupancy: counts must not be negative")
+	}
+	if b.Occupied > b.Beds {
+		return errors.New("occupancy: occupied must not exceed beds")
+	}
+	return nil
+}
+
+func (b *BedOccupancy) Estimate() {
+	b.Rate = 0
+	if b.Beds > 0 {
+		b.Rate = math.Round(float64(b.Occupied)/float64(b.Beds)*10000) / 100
+	}
+}
+
+// BedProjection estimates when a province runs out of beds if admissions
+// keep outpacing discharges at the average of the last Window days.
+// DaysUntilFull is null while occupancy is flat or falling.
+type BedProjection struct {
+	ProvinceID    string   `json:"province_id"`
+	Day           string   `json:"day"`
+	Beds          int64    `json:"beds"`
+	Occupied      int64    `json:"occupied"`
+	Window        int      `json:"window"`
+	NetAdmissions float64  `json:"net_admissions"`
+	DaysUntilFull *float64 `json:"days_until_full"`
+	FullBy        *string  `json:"full_by"`
+}
+
+func NewBedProjection(provinceID string, window int, history BedOccupancies) *BedProjection {
+	latest := history[len(history)-1]
+	bp := &BedProjection{
+		ProvinceID: provinceID,
+		Day:        latest.Day,
+		Beds:       latest.Beds,
+		Occupied:   latest.Occupied,
+		Window:     window,
+	}
+	if len(history) > window {
+		history = history[len(history)-window:]
+	}
+	var net int64
+	for _, b := range history {
+		net += b.Admissions - b.Discharges
+	}
+	bp.NetAdmissions = math.Round(float64(net)/float64(len(history))*100) / 100
+	if bp.NetAdmissions <= 0 {
+		return bp
+	}
+
+	days := math.Round(float64(bp.Beds-bp.Occupied)/bp.NetAdmissions*10) / 10
+	bp.DaysUntilFull = &days
+	if day, err := time.Parse(dateLayout, bp.Day); err == nil {
+		fullBy := day.AddDate(0, 0, int(math.Ceil(days))).Format(dateLayout)
+		bp.FullBy = &fullBy
+	}
+	return bp
+}
+
+// Repository
+type OccupancyRepository interface {
+	Save(ctx context.Context, provinceID string, b *BedOccupancy) error
+	// GetByProvince returns the days of a province in order, the last one
+	// being the latest recorded.
+	GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (BedOccupancies, error)
+}
+
+type occupancyRepo struct {
+	db *sql.DB
+}
+
+var _ OccupancyRepository = &occupancyRepo{}
+
+func NewOccupancyRepo(db *sql.DB) *occupancyRepo {
+	return &occupancyRepo{db}
+}
+
+func (or *occupancyRepo) Save(ctx context.Context, provinceID string, b *BedOccupancy) error {
+	day, err := time.Parse(dateLayout, b.Day)
+	if err != nil {
+		return err
+	}
+	if _, err := squirrel.Insert("bed_occupancy").
+		Columns("province_id", "day", "beds", "occupied", "admissions", "discharges", "updated_at").
+		Values(provinceID, day, &b.Beds, &b.Occupied, &b.Admissions, &b.Discharges, &b.UpdatedAt).
+		Suffix("ON CONFLICT (province_id, day) DO UPDATE SET beds = EXCLUDED.beds, occupied = EXCLUDED.occupied, admissions = EXCLUDED.admissions, discharges = EXCLUDED.discharges, updated_at = EXCLUDED.updated_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).ExecContext(ctx); err != nil {
+		return wrapErr("province", provinceID, "upsert bed occupancy", err)
+	}
+	return nil
+}
+
+func (or *occupancyRepo) GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (BedOccupancies, error) {
+	rows, err := squirrel.Select("day", "beds", "occupied", "admissions", "discharges", "updated_at").
+		From("bed_occupancy").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"day": from}).
+		Where(squirrel.LtOrEq{"day": to}).
+		OrderBy("day").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select bed occupancy", err)
+	}
+	defer rows.Close()
+
+	var bs = make(BedOccupancies, 0)
+	for rows.Next() {
+		var b BedOccupancy
+		var day time.Time
+		if err := rows.Scan(&day, &b.Beds, &b.Occupied, &b.Admissions, &b.Discharges, &b.UpdatedAt); err != nil {
+			return nil, wrapErr("province", provinceID, "scan bed occupancy", err)
+		}
+		b.Day = day.Format(dateLayout)
+		b.Estimate()
+		bs = append(bs, &b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select bed occupancy", err)
+	}
+	return bs, nil
+}
+
+// handler
+type occupancyService struct {
+	oApp OccupancyRepository
+}
+
+func NewOccupancyService(oApp OccupancyRepository) *occupancyService {
+	return &occupancyService{oApp: oApp}
+}
+
+func (oA *occupancyService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (oA *occupancyService) StoreDay(c echo.Context) error {
+	var b BedOccupancy
+	if err := c.Bind(&b); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage("request: unable to parse request payload"))
+	}
+	b.Day = c.Param("day")
+	b.UpdatedAt = time.Now()
+	if err := b.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, oA.errMessage(err.Error()))
+	}
+
+	if err := oA.oApp.Save(c.Request().Context(), c.Param("province_id"), &b); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	b.Estimate()
+	return c.JSON(http.StatusOK, map[string]*BedOccupancy{"bed_occupancy": &b})
+}
+
+func (oA *occupancyService) History(c echo.Context) error {
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, oA.errMessage(err.Error()))
+	}
+	if err := checkDays(from, to, maxRecordDays); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage(err.Error()))
+	}
+	bs, err := oA.oApp.GetByProvince(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]BedOccupancies{"bed_occupancies": bs})
+}
+
+// Projection estimates the days until a province's beds are full from the
+// ?window= latest days recorded, 7 by default.
+func (oA *occupancyService) Projection(c echo.Context) error {
+	window := defaultProjectionWindow
+	if v := c.QueryParam("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxProjectionWindow {
+			return c.JSON(http.StatusBadRequest, oA.errMessage("request: window must be between 1 and 60"))
+		}
+		window = n
+	}
+
+	// look back further than the window so that gaps in reporting still
+	// leave enough days to average over
+	now := time.Now().UTC()
+	bs, err := oA.oApp.GetByProvince(c.Request().Context(), c.Param("province_id"), now.AddDate(0, 0, -4*window), now)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	if len(bs) == 0 {
+		return c.JSON(http.StatusNotFound, oA.errMessage(errNotFound.Error()))
+	}
+	return c.JSON(http.StatusOK, map[string]*BedProjection{"bed_projection": NewBedProjection(c.Param("province_id"), window, bs)})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// apiOperation documents one route: the model its body is read into, and the
+// key of responseSchemas its response is wrapped in.
+type apiOperation struct {
+	summary  string
+	request  interface{}
+	response string
+}
+
+// apiOperations documents the routes by "METHOD path". Routes left out are
+// still listed in the spec, with a response that may hold any known key.
+var apiOperations = map[string]apiOperation{
+	"GET /api/v1/countries":                                 {summary: "List countries by name", response: "countries"},
+	"GET /api/v1/country/:country_id":                       {summary: "Get a country with its provinces, by id or ISO 3166-1 code", response: "country"},
+	"GET /api/v1/country/:country_id/wait":                  {summary: "Wait for a country to change", response: "country"},
+	"POST /api/v1/country":                                  {summary: "Create a country with its provinces", request: Country{}, response: "country"},
+	"PATCH /api/v1/country/:country_id":                     {summary: "Update the fields of a country given in a JSON merge patch", request: Country{}, response: "country"},
+	"PUT /api/v1/country/:country_id":                       {summary: "Update a country and its provinces", request: Country{}, response: "country"},
+	"PATCH /api/v1/country/:country_id/attributes":          {summary: "Patch the attributes of a country", request: Attributes{}, response: "country"},
+	"GET /api/v1/country/:country_id/history":               {summary: "Daily history of a country", response: "history"},
+	"GET /api/v1/province/:province_id":                     {summary: "Get a province by id, name or alias", response: "province"},
+	"PATCH /api/v1/province/:province_id":                   {summary: "Update the fields of a province given in a JSON merge patch", request: Province{}, response: "province"},
+	"GET /api/v1/provinces":                                 {summary: "List provinces, filtered and sorted", response: "provinces"},
+	"PUT /api/v1/provinces":                                 {summary: "Update several provinces at once, all or none", request: Provinces{}, response: "provinces"},
+	"PUT /api/v1/province/:province_id":                     {summary: "Update a province", request: Province{}, response: "province"},
+	"PATCH /api/v1/province/:province_id/attributes":        {summary: "Patch the attributes of a province", request: Attributes{}, response: "province"},
+	"GET /api/v1/province/:province_id/aliases":             {summary: "List the aliases of a province", response: "aliases"},
+	"POST /api/v1/province/:province_id/aliases":            {summary: "Add an alias to a province", request: Alias{}, response: "alias"},
+	"GET /api/v1/province/:province_id/history":             {summary: "Daily history of a province", response: "history"},
+	"GET /api/v1/province/:province_id/districts":           {summary: "List the districts of a province", response: "districts"},
+	"GET /api/v1/district/:district_id":                     {summary: "Get a district", response: "district"},
+	"POST /api/v1/district":                                 {summary: "Create a district", request: District{}, response: "district"},
+	"PATCH /api/v1/district/:district_id/attributes":        {summary: "Patch the attributes of a district", request: Attributes{}, response: "district"},
+	"PUT /api/v1/district/:district_id":                     {summary: "Update a district", request: District{}, response: "district"},
+	"GET /api/v1/district/:district_id/history":             {summary: "Daily history of a district", response: "history"},
+	"POST /api/v1/validate":                                 {summary: "Check a country, province or district payload without storing it", request: validationRequest{}, response: "validation"},
+	"GET /api/v1/jobs/:job_id":                              {summary: "Get an asynchronous job", response: "job"},
+	"GET /api/v1/metrics":                                   {summary: "List custom metrics", response: "metrics"},
+	"GET /api/v1/case-definitions":                          {summary: "List case definition versions", response: "case_definitions"},
+	"GET /api/v1/province/:province_id/excess-mortality":    {summary: "Excess mortality of a province", response: "excess_mortality"},
+	"GET /api/v1/country/:country_id/excess-mortality":      {summary: "Excess mortality of a country", response: "excess_mortality"},
+	"GET /api/v1/wastewater":                                {summary: "List wastewater samples", response: "wastewater_samples"},
+	"GET /api/v1/wastewater/trend":                          {summary: "Weekly wastewater trend", response: "wastewater_trend"},
+	"GET /api/v1/province/:province_id/lineages":            {summary: "Weekly lineage shares", response: "lineage_trend"},
+	"GET /api/v1/outbreaks/summary":                         {summary: "Outbreaks by institution type", response: "outbreak_summary"},
+	"GET /api/v1/province/:province_id/supplies":            {summary: "Medical supply stock of a province", response: "supplies"},
+	"GET /api/v1/province/:province_id/beds":                {summary: "Bed occupancy history", response: "bed_occupancies"},
+	"GET /api/v1/province/:province_id/beds/projection":     {summary: "Projection of when beds run out", response: "bed_projection"},
+	"GET /api/v1/province/:province_id/hotline":             {summary: "Hotline calls by day", response: "hotline_days"},
+	"GET /api/v1/province/:province_id/hotline/trend":       {summary: "Weekly hotline trend", response: "hotline_trend"},
+	"GET /api/v1/country/:country_id/frozen/:day":           {summary: "Figures frozen for publication", response: "frozen_country"},
+	"GET /api/v1/country/:country_id/frozen/:day/revisions": {summary: "Revisions of frozen figures", response: "frozen_countries"},
+	"GET /api/v1/changelog":                                 {summary: "Changes of the API contract", response: "changelog"},
+	"GET /api/v1/country/:country_id/fhir/MeasureReport":    {summary: "Figures of a country and its provinces as a FHIR Bundle of MeasureReports"},
+	"GET /api/v1/export/xlsx":                               {summary: "Countries, provinces and districts as an Excel workbook, a sheet each"},
+	"POST /api/v1/export/history":                           {summary: "Export the history of every country, province or district as CSV, NDJSON or Parquet in a job", response: "job"},
+	"GET /api/v1/export/history/:job_id":                    {summary: "Download the file of a history export job"},
+	"GET /api/v1/export/owid":                               {summary: "Country history as Our World in Data compact CSV"},
+	"GET /api/v1/report/daily.pdf":                          {summary: "The daily situation report of a country as a PDF"},
+	"GET /api/v1/geojson":                                   {summary: "Provinces or districts with coordinates as a GeoJSON FeatureCollection"},
+	"GET /api/v1/meta":                                      {summary: "Who runs the deployment, for which country, and its default locale and timezone", response: "deployment"},
+	"GET /api/v1/meta/license":                              {summary: "License and attribution of the data", response: "license"},
+	"GET /api/v1/openapi.json":                              {summary: "This specification"},
+	"POST /api/v1/auth/login":                               {summary: "Issue a bearer token", request: loginRequest{}, response: "token"},
+	"GET /ws":                                               {summary: "Live changes of the countries subscribed to, over a WebSocket"},
+	"GET /api/v1/stream":                                    {summary: "Server-Sent Events of the changes of countries and provinces"},
+	"GET /version":                                          {summary: "The running release", response: "version"},
+	"GET /readyz":                                           {summary: "Readiness of the instance", response: "ready"},
+	"GET /metrics":                                          {summary: "The current figures as Prometheus gauges"},
+	"GET /api/v1/push/vapid-key":                            {summary: "The application server key to subscribe to Web Push with", response: "vapid_public_key"},
+	"POST /api/v1/push/subscriptions":                       {summary: "Subscribe a browser to Web Push", request: PushSubscription{}, response: "push_subscription"},
+	"POST /api/v1/auth/embed-tokens":                        {summary: "Sign a short-lived token reading one province, for embeds", request: EmbedTokenRequest{}, response: "embed_token"},
+	"POST /api/v1/developers":                               {summary: "Register for an API key, a verification token being mailed", request: Developer{}, response: "success"},
+	"POST /api/v1/developers/verify":                        {summary: "Verify the email of a developer, issuing their API key", request: DeveloperVerification{}, response: "developer_key"},
+	"GET /api/v1/developers/me/usage":                       {summary: "The requests made with the developer key of the request", response: "usage"},
+	"POST /api/v1/developers/me/key":                        {summary: "Replace the developer key of the request", response: "developer_key"},
+	"DELETE /api/v1/push/subscriptions":                     {summary: "Unsubscribe a browser from Web Push", request: PushSubscription{}},
+	"POST /api/v1/admin/country/:country_id/freeze/:day":    {summary: "Freeze the figures of a country for a day", response: "frozen_country"},
+	"POST /api/v1/admin/provinces/merge":                    {summary: "Merge a province into another", response: "province"},
+	"PUT /api/v1/province/:province_id/mortality/:month":    {summary: "Store the mortality of a month", request: MortalityMonth{}, response: "mortality"},
+	"PUT /api/v1/province/:province_id/beds/:day":           {summary: "Store the bed occupancy of a day", request: BedOccupancy{}, response: "bed_occupancy"},
+	"PUT /api/v1/province/:province_id/hotline/:day":        {summary: "Store the hotline calls of a day", request: HotlineDay{}, response: "hotline_day"},
+	"PUT /api/v1/province/:province_id/supplies":            {summary: "Store the stock of a supply", request: SupplyStock{}, response: "supply"},
+	"POST /api/v1/wastewater":                               {summary: "Record a wastewater sample", request: WastewaterSample{}, response: "wastewater_sample"},
+	"POST /api/v1/sequencing":                               {summary: "Record a sequencing submission", request: SequencingSubmission{}, response: "sequencing_submission"},
+	"GET /api/v1/sequencing/:submission_id":                 {summary: "Get a sequencing submission", response: "sequencing_submission"},
+	"GET /api/v1/province/:province_id/sequencing":          {summary: "List the sequencing submissions of a province", response: "sequencing_submissions"},
+	"GET /api/v1/wastewater/:sample_id":                     {summary: "Get a wastewater sample", response: "wastewater_sample"},
+	"PUT /api/v1/wastewater/:sample_id":                     {summary: "Update a wastewater sample", request: WastewaterSample{}, response: "wastewater_sample"},
+	"GET /api/v1/supplies/low-stock":                        {summary: "Supplies running low", response: "supplies"},
+	"PUT /api/v1/metrics/:name/:region_id":                  {summary: "Set the value of a metric", request: MetricValue{}, response: "value"},
+	"POST /api/v1/admin/metrics":                            {summary: "Define a metric", request: Metric{}, response: "metric"},
+	"POST /api/v1/admin/case-definitions":                   {summary: "Add a case definition version", request: CaseDefinition{}, response: "case_definition"},
+	"GET /api/v1/admin/outbreaks":                           {summary: "List outbreaks", response: "outbreaks"},
+	"GET /api/v1/admin/outbreaks/:outbreak_id":              {summary: "Get an outbreak", response: "outbreak"},
+	"POST /api/v1/admin/outbreaks":                          {summary: "Record an outbreak", request: Outbreak{}, response: "outbreak"},
+	"PUT /api/v1/admin/outbreaks/:outbreak_id":              {summary: "Update an outbreak", request: Outbreak{}, response: "outbreak"},
+	"GET /api/v1/admin/notifications":                       {summary: "List notifications", response: "notifications"},
+	"GET /api/v1/admin/data-quality":                        {summary: "The violations found by the last consistency check", response: "violations"},
+	"GET /api/v1/admin/journal":                             {summary: "Page through the recorded write requests", response: "journal"},
+	"POST /api/v1/admin/sync/jhu":                           {summary: "Start a sync from the JHU CSSE daily reports", response: "job"},
+	"POST /api/v1/admin/sync/dhis2":                         {summary: "Start a push of daily figures to DHIS2", response: "job"},
+	"GET /api/v1/admin/sync/dhis2":                          {summary: "The last push of daily figures to DHIS2", response: "sync_run"},
+	"POST /api/v1/admin/sync/dhis2/pull":                    {summary: "Start a pull of daily figures from DHIS2", response: "job"},
+	"GET /api/v1/admin/sync/dhis2/pull":                     {summary: "The last pull of daily figures from DHIS2", response: "sync_run"},
+	"GET /api/v1/admin/sync/jhu":                            {summary: "The last sync from the JHU CSSE daily reports", response: "sync_run"},
+	"GET /api/v1/admin/retention":                           {summary: "The retention windows of the logs and usage tables and their last purges", response: "retention"},
+	"POST /api/v1/admin/retention/purge":                    {summary: "Purge the rows past their retention window now", response: "job"},
+	"POST /api/v1/admin/history/backfill":                   {summary: "Fill history from a historical spreadsheet with its mapping profile", response: "backfill"},
+	"POST /api/v1/admin/imports/:sync_run_id/rollback":      {summary: "Restore the records an import updated to their figures before it", response: "sync_run"},
+	"GET /api/v1/admin/teams":                               {summary: "List the teams countries are delegated to", response: "teams"},
+	"POST /api/v1/admin/teams":                              {summary: "Delegate a country to a team", request: Team{}, response: "team"},
+	"POST /api/v1/admin/teams/:team_id/keys":                {summary: "Issue an API key for a team", response: "team_key"},
+	"PUT /api/v1/admin/teams/:team_id/keys/:key_id/embargo": {summary: "Show a key the figures of the day before until a time of day", request: KeyEmbargo{}, response: "embargo"},
+	"GET /api/v1/admin/users":                               {summary: "List users", response: "users"},
+	"POST /api/v1/admin/users":                              {summary: "Create a user", request: User{}, response: "user"},
+}
+
+// fieldDescriptions document the fields whose name is not self-explanatory.
+var fieldDescriptions = map[string]string{
+	"treaded": "Number of people treated. The name is misspelled and kept as is for compatibility.",
+}
+
+type openAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       map[string]string                       `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components map[string]map[string]*openAPISchema    `json:"components"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIBody struct {
+	Required bool                                 `json:"required"`
+	Content  map[string]map[string]*openAPISchema `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                               `json:"description"`
+	Content     map[string]map[string]*openAPISchema `json:"content,omitempty"`
+}
+
+// openAPISchema is schema in OpenAPI 3.0 terms, with descriptions.
+type openAPISchema struct {
+	Ref         string                    `json:"$ref,omitempty"`
+	Type        string                    `json:"type,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Nullable    bool                      `json:"nullable,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Properties  map[string]*openAPISchema `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+	Items       *openAPISchema            `json:"items,omitempty"`
+}
+
+func toOpenAPISchema(s *schema) *openAPISchema {
+	if s == nil {
+		return nil
+	}
+	o := &openAPISchema{
+		Type:     s.Type,
+		Format:   s.Format,
+		Nullable: s.Nullable,
+		Required: s.Required,
+		Items:    toOpenAPISchema(s.Items),
+	}
+	if s.Properties != nil {
+		o.Properties = make(map[string]*openAPISchema, len(s.Properties))
+		for name, p := range s.Properties {
+			o.Properties[name] = toOpenAPISchema(p)
+			o.Properties[name].Description = fieldDescriptions[name]
+		}
+	}
+	return o
+}
+
+func jsonContent(s *openAPISchema) map[string]map[string]*openAPISchema {
+	return map[string]map[string]*openAPISchema{echo.MIMEApplicationJSON: {"schema": s}}
+}
+
+// buildOpenAPI describes routes, the response envelopes being the keys of
+// responseSchemas under components.
+func buildOpenAPI(routes []*echo.Route) *openAPIDoc {
+	doc := &openAPIDoc{
+		OpenAPI:    "3.0.3",
+		Info:       map[string]string{"title": "covid19 API", "version": "1"},
+		Paths:      make(map[string]map[string]*openAPIOperation),
+		Components: map[string]map[string]*openAPISchema{"schemas": {}},
+	}
+	envelope := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	for key, s := range responseSchemas {
+		doc.Components["schemas"][key] = toOpenAPISchema(s)
+		envelope.Properties[key] = &openAPISchema{Ref: "#/components/schemas/" + key}
+	}
+	errorBody := &openAPIResponse{
+		Description: "Error",
+		Content: jsonContent(&openAPISchema{Type: "object", Required: []string{"error"},
+			Properties: map[string]*openAPISchema{"error": {Type: "string"}}}),
+	}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	for _, r := range routes {
+		if strings.Contains(r.Path, "*") {
+			continue
+		}
+		path, params := openAPIPath(r.Path)
+		op := &openAPIOperation{
+			Parameters: params,
+			Responses:  map[string]*openAPIResponse{"default": errorBody},
+		}
+		success := &openAPIResponse{Description: "Success", Content: jsonContent(envelope)}
+		if info, ok := apiOperations[r.Method+" "+r.Path]; ok {
+			op.Summary = info.summary
+			if info.request != nil {
+				op.RequestBody = &openAPIBody{
+					Required: true,
+					Content:  jsonContent(toOpenAPISchema(schemaOf(reflect.TypeOf(info.request)))),
+				}
+			}
+			if info.response != "" {
+				success.Content = jsonContent(&openAPISchema{
+					Type:       "object",
+					Required:   []string{info.response},
+					Properties: map[string]*openAPISchema{info.response: {Ref: "#/components/schemas/" + info.response}},
+				})
+			}
+		}
+		op.Responses["2XX"] = success
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// openAPIPath turns an echo path into an OpenAPI one and its parameters.
+func openAPIPath(p string) (string, []*openAPIParameter) {
+	var params []*openAPIParameter
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			name := s[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, &openAPIParameter{Name: name, In: "path", Required: true, Schema: &openAPISchema{Type: "string"}})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// handler
+type openAPIService struct {
+	once sync.Once
+	doc  *openAPIDoc
+}
+
+func NewOpenAPIService() *openAPIService {
+	return &openAPIService{}
+}
+
+// Spec serves the specification of the routes registered on the server, built
+// on the first request once every route is registered.
+func (oA *openAPIService) Spec(c echo.Context) error {
+	oA.once.Do(func() {
+		oA.doc = buildOpenAPI(c.Echo().Routes())
+	})
+	return c.JSON(http.StatusOK, oA.doc)
+}
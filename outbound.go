@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var errDestinationNotAllowed = errors.New("outbound: destination is not in the allowlist")
+
+// outboundConfig is how integrations talking to other systems (webhooks,
+// syncs, SMS) reach the outside, deployments inside the ministry network
+// can only do so through a proxy and to a fixed set of hosts.
+type outboundConfig struct {
+	// Proxy is used for every request, the usual HTTP(S)_PROXY variables
+	// apply when nil.
+	Proxy   *url.URL
+	Timeout time.Duration
+	// Allowlist holds the hosts requests may go to, "*.example.org" matching
+	// any subdomain. Every host is allowed when empty.
+	Allowlist []string
+}
+
+// outboundConfigFromEnv reads OUTBOUND_PROXY, OUTBOUND_TIMEOUT and the comma
+// separated OUTBOUND_ALLOWLIST.
+func outboundConfigFromEnv() (outboundConfig, error) {
+	cfg := outboundConfig{Timeout: 10 * time.Second}
+	if v := os.Getenv("OUTBOUND_PROXY"); v != "" {
+		proxy, err := url.Parse(v)
+		if err != nil {
+			return cfg, fmt.Errorf("outbound: invalid OUTBOUND_PROXY: %w", err)
+		}
+		cfg.Proxy = proxy
+	}
+	if v := os.Getenv("OUTBOUND_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("outbound: invalid OUTBOUND_TIMEOUT: %w", err)
+		}
+		cfg.Timeout = timeout
+	}
+	for _, host := range strings.Split(os.Getenv("OUTBOUND_ALLOWLIST"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cfg.Allowlist = append(cfg.Allowlist, host)
+		}
+	}
+	return cfg, nil
+}
+
+// newOutboundClient returns the client every outbound integration has to
+// use.
+func newOutboundClient(cfg outboundConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != nil {
+		transport.Proxy = http.ProxyURL(cfg.Proxy)
+	}
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &allowlistTransport{allowlist: cfg.Allowlist, next: transport},
+	}
+}
+
+// allowlistTransport refuses requests, redirects included, to hosts outside
+// the allowlist.
+type allowlistTransport struct {
+	allowlist []string
+	next      http.RoundTripper
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allowed(req.URL.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", errDestinationNotAllowed, req.URL.Hostname())
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (t *allowlistTransport) allowed(host string) bool {
+	if len(t.allowlist) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range t.allowlist {
+		if allowed == host {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
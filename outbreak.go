@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+var institutionTypes = map[string]bool{
+	"school":     true,
+	"university": true,
+	"workplace":  true,
+	"factory":    true,
+	"care_home":  true,
+	"hospital":   true,
+	"prison":     true,
+	"other":      true,
+}
+
+const (
+	OutbreakActive = "active"
+	OutbreakClosed = "closed"
+)
+
+// Outbreak is a cluster of cases at a school, workplace or other
+// institution. The institution name identifies it and is only served on the
+// admin routes, the public only sees Outbreaks summed up per institution type.
+type Outbreak struct {
+	ID              string    `json:"id"`
+	InstitutionType string    `json:"institution_type"`
+	InstitutionName string    `json:"institution_name"`
+	ProvinceID      string    `json:"province_id"`
+	DistrictID      string    `json:"district_id"`
+	CaseCount       int64     `json:"case_count"`
+	Status          string    `json:"status"`
+	ReportedAt      time.Time `json:"reported_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type Outbreaks []*Outbreak
+
+func (o *Outbreak) Prepare() {
+	o.InstitutionType = strings.ToLower(strings.TrimSpace(o.InstitutionType))
+	o.InstitutionName = html.EscapeString(strings.TrimSpace(o.InstitutionName))
+	o.ProvinceID = strings.TrimSpace(o.ProvinceID)
+	o.DistrictID = strings.TrimSpace(o.DistrictID)
+	o.Status = strings.ToLower(strings.TrimSpace(o.Status))
+	if o.Status == "" {
+		o.Status = OutbreakActive
+	}
+}
+
+func (o *Outbreak) BeforeSave() {
+	o.ID = uuid.NewV4().String()
+}
+
+func (o *Outbreak) Validate() error {
+	if !institutionTypes[o.InstitutionType] {
+		return errors.New("outbreak: unknown institution_type")
+	}
+	if o.InstitutionName == "" {
+		return errors.New("outbreak: institution_name is required")
+	}
+	if o.ProvinceID == "" || o.DistrictID == "" {
+		return errors.New("outbreak: province_id and district_id are required")
+	}
+	if o.CaseCount < 0 {
+		return errors.New("outbreak: case_count must not be negative")
+	}
+	if o.Status != OutbreakActive && o.Status != OutbreakClosed {
+		return errors.New("outbreak: status must be active or closed")
+	}
+	return nil
+}
+
+// OutbreakSummary is the public view of outbreaks, one per institution type.
+type OutbreakSummary struct {
+	InstitutionType string `json:"institution_type"`
+	Outbreaks       int64  `json:"outbreaks"`
+	Active          int64  `json:"active"`
+	Cases           int64  `json:"cases"`
+}
+
+type OutbreakSummaries []*OutbreakSummary
+
+// Repository
+type OutbreakRepository interface {
+	Save(ctx context.Context, o *Outbreak) error
+	Update(ctx context.Context, o *Outbreak) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Outbreak, error)
+	GetAll(ctx context.Context, provinceID string) (Outbreaks, error)
+	Summary(ctx context.Context, provinceID string) (OutbreakSummaries, error)
+}
+
+type outbreakRepo struct {
+	db *sql.DB
+}
+
+var _ OutbreakRepository = &outbreakRepo{}
+
+func NewOutbreakRepo(db *sql.DB) *outbreakRepo {
+	return &outbreakRepo{db}
+}
+
+func (or *outbreakRepo) Save(ctx context.Context, o *Outbreak) error {
+	if _, err := squirrel.Insert("outbreaks").
+		Columns("id", "institution_type", "institution_name", "province_id", "district_id", "case_count", "status", "reported_at", "updated_at").
+		Values(&o.ID, &o.InstitutionType, &o.InstitutionName, &o.ProvinceID, &o.DistrictID, &o.CaseCount, &o.Status, &o.ReportedAt, &o.UpdatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).ExecContext(ctx); err != nil {
+		return wrapErr("outbreak", o.ID, "insert outbreak", err)
+	}
+	return nil
+}
+
+func (or *outbreakRepo) Update(ctx context.Context, o *Outbreak) error {
+	res, err := squirrel.Update("outbreaks").
+		Set("institution_type", &o.InstitutionType).
+		Set("institution_name", &o.InstitutionName).
+		Set("province_id", &o.ProvinceID).
+		Set("district_id", &o.DistrictID).
+		Set("case_count", &o.CaseCount).
+		Set("status", &o.Status).
+		Set("updated_at", &o.UpdatedAt).
+		Where(squirrel.Eq{"id": o.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("outbreak", o.ID, "update outbreak", err)
+	}
+	return wrapErr("outbreak", o.ID, "update outbreak", affectedOne(res))
+}
+
+func (or *outbreakRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("outbreaks").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("outbreak", id, "delete outbreak", err)
+	}
+	return wrapErr("outbreak", id, "delete outbreak", affectedOne(res))
+}
+
+func (or *outbreakRepo) GetByID(ctx context.Context, id string) (*Outbreak, error) {
+	var o Outbreak
+	err := squirrel.Select("id", "institution_type", "institution_name", "province_id", "district_id", "case_count", "status", "reported_at", "updated_at").
+		From("outbreaks").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).ScanContext(ctx, &o.ID, &o.InstitutionType, &o.InstitutionName, &o.ProvinceID, &o.DistrictID, &o.CaseCount, &o.Status, &o.ReportedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("outbreak", id, "select outbreak", err)
+	}
+	return &o, nil
+}
+
+func (or *outbreakRepo) GetAll(ctx context.Context, provinceID string) (Outbreaks, error) {
+	q := squirrel.Select("id", "institution_type", "institution_name", "province_id", "district_id", "case_count", "status", "reported_at", "updated_at").
+		From("outbreaks")
+	if provinceID != "" {
+		q = q.Where(squirrel.Eq{"province_id": provinceID})
+	}
+	rows, err := q.OrderBy("reported_at DESC").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("outbreak", "", "select outbreaks", err)
+	}
+	defer rows.Close()
+
+	var obs = make(Outbreaks, 0)
+	for rows.Next() {
+		var o Outbreak
+		if err := rows.Scan(&o.ID, &o.InstitutionType, &o.InstitutionName, &o.ProvinceID, &o.DistrictID, &o.CaseCount, &o.Status, &o.ReportedAt, &o.UpdatedAt); err != nil {
+			return nil, wrapErr("outbreak", "", "scan outbreaks", err)
+		}
+		obs = append(obs, &o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("outbreak", "", "select outbreaks", err)
+	}
+	return obs, nil
+}
+
+func (or *outbreakRepo) Summary(ctx context.Context, provinceID string) (OutbreakSummaries, error) {
+	q := squirrel.Select("institution_type", "COUNT(*)", "COUNT(*) FILTER (WHERE status = 'active')", "COALESCE(SUM(case_count), 0)").
+		From("outbreaks")
+	if provinceID != "" {
+		q = q.Where(squirrel.Eq{"province_id": provinceID})
+	}
+	rows, err := q.GroupBy("institution_type").
+		OrderBy("institution_type").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(or.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("outbreak", "", "select outbreak summary", err)
+	}
+	defer rows.Close()
+
+	var ss = make(OutbreakSummaries, 0)
+	for rows.Next() {
+		var s OutbreakSummary
+		if err := rows.Scan(&s.InstitutionType, &s.Outbreaks, &s.Active, &s.Cases); err != nil {
+			return nil, wrapErr("outbreak", "", "scan outbreak summary", err)
+		}
+		ss = append(ss, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("outbreak", "", "select outbreak summary", err)
+	}
+	return ss, nil
+}
+
+// handler
+type outbreakService struct {
+	oApp OutbreakRepository
+}
+
+func NewOutbreakService(oApp OutbreakRepository) *outbreakService {
+	return &outbreakService{oApp: oApp}
+}
+
+func (oA *outbreakService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (oA *outbreakService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+func (oA *outbreakService) Summary(c echo.Context) error {
+	ss, err := oA.oApp.Summary(c.Request().Context(), c.QueryParam("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]OutbreakSummaries{"outbreak_summary": ss})
+}
+
+func (oA *outbreakService) ListOutbreaks(c echo.Context) error {
+	obs, err := oA.oApp.GetAll(c.Request().Context(), c.QueryParam("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Outbreaks{"outbreaks": obs})
+}
+
+func (oA *outbreakService) FindByOutbreakID(c echo.Context) error {
+	o, err := oA.oApp.GetByID(c.Request().Context(), c.Param("outbreak_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*Outbreak{"outbreak": o})
+}
+
+func (oA *outbreakService) Store(c echo.Context) error {
+	var o Outbreak
+	if err := c.Bind(&o); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage("request: unable to parse request payload"))
+	}
+	o.Prepare()
+	if err := o.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, oA.errMessage(err.Error()))
+	}
+	o.BeforeSave()
+	if o.ReportedAt.IsZero() {
+		o.ReportedAt = time.Now()
+	}
+	o.UpdatedAt = time.Now()
+
+	if err := oA.oApp.Save(c.Request().Context(), &o); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*Outbreak{"outbreak": &o})
+}
+
+func (oA *outbreakService) Edit(c echo.Context) error {
+	var o Outbreak
+	if err := c.Bind(&o); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage("request: unable to parse request payload"))
+	}
+	o.ID = c.Param("outbreak_id")
+	o.Prepare()
+	if err := o.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, oA.errMessage(err.Error()))
+	}
+	o.UpdatedAt = time.Now()
+
+	if err := oA.oApp.Update(c.Request().Context(), &o); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, oA.successMsg("Updated outbreak successfully"))
+}
+
+func (oA *outbreakService) Delete(c echo.Context) error {
+	if err := oA.oApp.Delete(c.Request().Context(), c.Param("outbreak_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// the countries one OWID export holds at most
+const maxOWIDCountries = 50
+
+// owidColumns are the columns of the Our World in Data compact format that
+// the figures of a country fill, in the order of the OWID files.
+var owidColumns = []string{"location", "date", "total_cases", "new_cases", "total_deaths", "new_deaths", "total_tests"}
+
+// owidRows turns the history of the country named location into daily rows.
+// Days without a point between two of them had no change and repeat the
+// figures of the day before with no new cases or deaths. new_deaths is left
+// empty on the first day, which has no day before to compare with.
+func owidRows(location string, h History) ([][]string, error) {
+	rows := make([][]string, 0, len(h))
+	var prev *HistoryPoint
+	var day time.Time
+	for _, p := range h {
+		d, err := time.Parse(dateLayout, p.Day)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil {
+			for day = day.AddDate(0, 0, 1); day.Before(d); day = day.AddDate(0, 0, 1) {
+				rows = append(rows, owidRow(location, day, prev.Total, 0, prev.Dead, "0", prev.TestCase))
+			}
+		}
+		newDeaths := ""
+		if prev != nil {
+			newDeaths = strconv.FormatInt(p.Dead-prev.Dead, 10)
+		}
+		rows = append(rows, owidRow(location, d, p.Total, p.NewCase, p.Dead, newDeaths, p.TestCase))
+		prev, day = p, d
+	}
+	return rows, nil
+}
+
+func owidRow(location string, day time.Time, totalCases, newCases, totalDeaths int64, newDeaths string, totalTests int64) []string {
+	return []string{
+		location,
+		day.Format(dateLayout),
+		strconv.FormatInt(totalCases, 10),
+		strconv.FormatInt(newCases, 10),
+		strconv.FormatInt(totalDeaths, 10),
+		newDeaths,
+		strconv.FormatInt(totalTests, 10),
+	}
+}
+
+// handler
+type owidService struct {
+	cApp CountryRepository
+	hApp HistoryRepository
+}
+
+func NewOWIDService(cApp CountryRepository, hApp HistoryRepository) *owidService {
+	return &owidService{cApp: cApp, hApp: hApp}
+}
+
+func (oA *owidService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// countries returns the countries of ?country_id=, which may be repeated,
+// or every country when there is none.
+func (oA *owidService) countries(c echo.Context) (Countries, error) {
+	ctx := c.Request().Context()
+	ids := c.QueryParams()["country_id"]
+	if len(ids) == 0 {
+		var all Countries
+		for page := uint64(1); ; page++ {
+			countries, err := oA.cApp.List(ctx, page, maxCountryLimit)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, countries...)
+			if len(countries) < maxCountryLimit {
+				return all, nil
+			}
+		}
+	}
+	countries := make(Countries, 0, len(ids))
+	for _, id := range ids {
+		country, err := oA.cApp.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		countries = append(countries, country)
+	}
+	return countries, nil
+}
+
+// Export writes the history of countries as CSV in the Our World in Data
+// compact format, country by country and oldest first, for ?from= to ?to=.
+func (oA *owidService) Export(c echo.Context) error {
+	if len(c.QueryParams()["country_id"]) > maxOWIDCountries {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage(fmt.Sprintf("request: at most %d country_id", maxOWIDCountries)))
+	}
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, oA.errMessage(err.Error()))
+	}
+	countries, err := oA.countries(c)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, oA.errMessage(msg))
+	}
+	if n := len(countries) * spanDays(from, to); n > maxOWIDCountryDays {
+		return c.JSON(http.StatusUnprocessableEntity, oA.errMessage(fmt.Sprintf(
+			"request: %d countries over %d days is %d country-days, at most %d can be exported at once, narrow country_id or from and to",
+			len(countries), spanDays(from, to), n, maxOWIDCountryDays)))
+	}
+
+	rows := [][]string{owidColumns}
+	for _, country := range countries {
+		h, err := oA.hApp.Get(c.Request().Context(), "country", country.ID, from, to)
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, oA.errMessage(msg))
+		}
+		if at, ok := embargoed(c); ok {
+			h = h.before(at)
+		}
+		countryRows, err := owidRows(country.Name, h)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, oA.errMessage("Internal server error"))
+		}
+		rows = append(rows, countryRows...)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="owid-covid-data.csv"`)
+	res.WriteHeader(http.StatusOK)
+	w := csv.NewWriter(res)
+	w.WriteAll(rows)
+	return w.Error()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+const mimeMergePatchJSON = "application/merge-patch+json"
+
+// figurePatchColumns are the columns of the name and figures a patch of a
+// country or a province may set, by field of the payload.
+var figurePatchColumns = map[string]string{
+	"name":            "name",
+	"total":           "total",
+	"new_case":        "new_case",
+	"treaded":         "treated",
+	"decovering_case": "decovering_case",
+	"test_case":       "test_case",
+	"negative_case":   "negative_case",
+	"dead":            "dead",
+}
+
+// applyFigurePatch applies the JSON merge patch body to the fields of a copy
+// of a country or a province, field giving where a column is read into and
+// attrs being its attributes. It returns the columns the patch sets, the
+// attributes as the patch updatePartial merges key by key. Provinces and
+// districts are left to PUT, and the figures cannot be removed.
+func applyFigurePatch(body []byte, field func(column string) interface{}, attrs *Attributes) (map[string]interface{}, error) {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return nil, errors.New("request: patch must be a JSON object")
+	}
+	columns := make(map[string]interface{}, len(patch))
+	for name, raw := range patch {
+		if name == "attributes" {
+			var a Attributes
+			if err := json.Unmarshal(raw, &a); err != nil || a == nil {
+				return nil, errors.New("request: attributes must be an object")
+			}
+			*attrs = attrs.merge(a)
+			columns["attributes"] = a
+			continue
+		}
+		column, ok := figurePatchColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("request: %s cannot be patched", name)
+		}
+		if string(raw) == "null" {
+			return nil, fmt.Errorf("request: %s cannot be removed", name)
+		}
+		dst := field(column)
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return nil, fmt.Errorf("request: invalid %s", name)
+		}
+		if s, ok := dst.(*string); ok {
+			*s = html.EscapeString(strings.TrimSpace(*s))
+		}
+		columns[column] = dst
+	}
+	return columns, nil
+}
+
+// countryField is the field of c a patch column is read into.
+func countryField(c *Country) func(column string) interface{} {
+	return func(column string) interface{} {
+		switch column {
+		case "name":
+			return &c.Name
+		case "total":
+			return &c.Total
+		case "new_case":
+			return &c.NewCase
+		case "treated":
+			return &c.Treated
+		case "decovering_case":
+			return &c.DecoveringCase
+		case "test_case":
+			return &c.TestCase
+		case "negative_case":
+			return &c.NegativeTest
+		case "dead":
+			return &c.Dead
+		}
+		return nil
+	}
+}
+
+// provinceField is the field of p a patch column is read into.
+func provinceField(p *Province) func(column string) interface{} {
+	return func(column string) interface{} {
+		switch column {
+		case "name":
+			return &p.Name
+		case "total":
+			return &p.Total
+		case "new_case":
+			return &p.NewCase
+		case "treated":
+			return &p.Treated
+		case "decovering_case":
+			return &p.DecoveringCase
+		case "test_case":
+			return &p.TestCase
+		case "negative_case":
+			return &p.NegativeTest
+		case "dead":
+			return &p.Dead
+		}
+		return nil
+	}
+}
+
+// updatePartial sets the columns given and updated_at of the record id in
+// table, merging the attributes, a merge patch, into those of the record.
+func updatePartial(ctx context.Context, runner squirrel.BaseRunner, dialect migrations.Dialect, table, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	set := make(map[string]interface{}, len(columns))
+	for column, v := range columns {
+		if a, ok := v.(Attributes); ok && column == "attributes" {
+			v = attributesExpr(dialect, a)
+		}
+		set[column] = v
+	}
+	res, err := squirrel.Update(table).
+		SetMap(set).
+		Set("updated_at", updatedAt).
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	return affectedOne(res)
+}
+
+func (cr *countryRepo) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	return wrapErr("country", id, "update country", updatePartial(ctx, cr.db, cr.dialect, "country", id, columns, updatedAt))
+}
+
+func (pr *provinceRepo) UpdatePartial(ctx context.Context, id string, columns map[string]interface{}, updatedAt time.Time) error {
+	return wrapErr("province", id, "update province", updatePartial(ctx, pr.db, pr.dialect, "provinces", id, columns, updatedAt))
+}
+
+// Patch updates the fields of a country the JSON merge patch of the body
+// holds, leaving the others as they are.
+func (cA *countryService) Patch(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, cA.errMessage("request: unable to parse request payload"))
+	}
+
+	ctx := c.Request().Context()
+	current, err := cA.cApp.GetByID(forWrite(ctx), c.Param("country_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	if preconditionFailed(c.Request(), current.lastUpdated()) {
+		return c.JSON(http.StatusPreconditionFailed, cA.errMessage(errModified.Error()))
+	}
+	country := *current
+	columns, err := applyFigurePatch(body, countryField(&country), &country.Attributes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+	if err := country.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, cA.errMessage(err.Error()))
+	}
+	if current.Equal(&country) {
+		setEntityTag(c, current.lastUpdated())
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	country.UpdatedAt = updateTime()
+	if err := cA.cApp.UpdatePartial(ctx, country.ID, columns, country.UpdatedAt); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, cA.errMessage(msg))
+	}
+	cA.changes.Publish(countryKey(country.ID))
+	setEntityTag(c, country.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Country{"country": &country})
+}
+
+// Patch updates the fields of a province the JSON merge patch of the body
+// holds, leaving the others as they are.
+func (pA *provinceService) Patch(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+
+	ctx := c.Request().Context()
+	current, err := pA.pApp.GetByID(forWrite(ctx), c.Param("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	if preconditionFailed(c.Request(), current.lastUpdated()) {
+		return c.JSON(http.StatusPreconditionFailed, pA.errMessage(errModified.Error()))
+	}
+	p := *current
+	columns, err := applyFigurePatch(body, provinceField(&p), &p.Attributes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+	if err := p.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+	if current.Equal(&p) {
+		setEntityTag(c, current.lastUpdated())
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	p.UpdatedAt = updateTime()
+	if err := pA.pApp.UpdatePartial(ctx, p.ID, columns, p.UpdatedAt); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update province information")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	pA.changes.Publish(provinceKey(p.ID))
+	if err := keepOldName(ctx, pA.pApp, current, &p); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not keep the old province name")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	setEntityTag(c, p.lastUpdated())
+	return c.JSON(http.StatusOK, map[string]*Province{"province": &p})
+}
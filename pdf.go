@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, and the margins of its text
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+// the fonts of the documents, both of the standard 14 that viewers have
+const (
+	pdfRegular = "F1"
+	pdfBold    = "F2"
+)
+
+// pdfWidths are the widths of the Helvetica glyphs that lines are measured
+// with, in thousandths of the font size, others taking pdfDefaultWidth.
+var pdfWidths = map[rune]int{
+	' ': 278, ',': 278, '.': 278, ':': 278, '-': 333, '+': 584, '(': 333, ')': 333, '/': 278,
+	'0': 556, '1': 556, '2': 556, '3': 556, '4': 556, '5': 556, '6': 556, '7': 556, '8': 556, '9': 556,
+	'i': 222, 'j': 222, 'l': 222, 'f': 278, 't': 278, 'r': 333, 'm': 833, 'w': 722,
+	'I': 278, 'J': 500, 'M': 833, 'W': 944,
+}
+
+const pdfDefaultWidth = 556
+
+// pdfTextWidth is the width of s in points at size.
+func pdfTextWidth(s string, size float64) float64 {
+	w := 0
+	for _, r := range s {
+		if n, ok := pdfWidths[r]; ok {
+			w += n
+		} else {
+			w += pdfDefaultWidth
+		}
+	}
+	// with some room for the bold glyphs, which are slightly wider
+	return float64(w) * size / 1000 * 1.05
+}
+
+// pdfString encodes s as a PDF string in the WinAnsi encoding of the
+// standard fonts, the characters it has none for being written as ?.
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfDocument lays out text on A4 pages from the top down, starting a new
+// page when the current one is full.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	// y is where the next line goes on the current page, from its bottom
+	y float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// advance moves down by leading, on a new page when it does not fit.
+func (d *pdfDocument) advance(leading float64) {
+	if d.y-leading < pdfMargin {
+		d.newPage()
+	}
+	d.y -= leading
+}
+
+// Text writes s at x on the current line.
+func (d *pdfDocument) Text(x float64, font string, size float64, s string) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %g Tf %.2f %.2f Td %s Tj ET\n", font, size, x, d.y, pdfString(s))
+}
+
+// Rule draws a line across the page just below the current line.
+func (d *pdfDocument) Rule() {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, d.y-4, pdfPageWidth-pdfMargin, d.y-4)
+}
+
+// Line writes s on a line of its own, wrapped at the margins.
+func (d *pdfDocument) Line(font string, size, leading float64, s string) {
+	width := pdfPageWidth - 2*pdfMargin
+	words := strings.Fields(s)
+	for len(words) > 0 {
+		n := 1
+		for n < len(words) && pdfTextWidth(strings.Join(words[:n+1], " "), size) <= width {
+			n++
+		}
+		d.advance(leading)
+		d.Text(pdfMargin, font, size, strings.Join(words[:n], " "))
+		words = words[n:]
+	}
+}
+
+// Row writes the cells of a table row, the first column taking the space
+// the others leave, those being right aligned.
+func (d *pdfDocument) Row(font string, size, leading float64, cells []string) {
+	d.advance(leading)
+	if len(cells) == 0 {
+		return
+	}
+	const column = 80.0
+	d.Text(pdfMargin, font, size, cells[0])
+	for i, cell := range cells[1:] {
+		right := pdfPageWidth - pdfMargin - float64(len(cells)-2-i)*column
+		d.Text(right-pdfTextWidth(cell, size), font, size, cell)
+	}
+}
+
+// Bytes writes out the document.
+func (d *pdfDocument) Bytes() []byte {
+	var b bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// the pages are objects 5 on, each followed by its content
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, pdfRegular, pdfBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return b.Bytes()
+}
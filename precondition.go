@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// entityTag is the strong ETag of a record, derived from its updated_at. The
+// routes of single records send it, see setEntityTag, and the If-Match of
+// writes is compared with it.
+func entityTag(updatedAt time.Time) string {
+	return fmt.Sprintf(`"%x"`, updatedAt.UnixNano())
+}
+
+// setEntityTag tags the response with the ETag of a record last updated at
+// updatedAt, which etagMiddleware then keeps.
+func setEntityTag(c echo.Context, updatedAt time.Time) {
+	c.Response().Header().Set("ETag", entityTag(updatedAt))
+}
+
+// updateTime is the updated_at of a record written now, at the microsecond
+// resolution the database keeps, so that the tag of a write response is the
+// one the record is read back with.
+func updateTime() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// latest is the latest of times.
+func latest(times ...time.Time) time.Time {
+	var at time.Time
+	for _, t := range times {
+		if t.After(at) {
+			at = t
+		}
+	}
+	return at
+}
+
+// lastUpdated is the latest updated_at of the country and of the provinces it
+// is shown with, which a change to any of them moves.
+func (c *Country) lastUpdated() time.Time {
+	at := c.UpdatedAt
+	for _, p := range c.Provinces {
+		at = latest(at, p.UpdatedAt)
+	}
+	return at
+}
+
+// lastUpdated is the latest updated_at of the province and of its districts.
+func (p *Province) lastUpdated() time.Time {
+	at := p.UpdatedAt
+	for _, d := range p.Districts {
+		at = latest(at, d.UpdatedAt)
+	}
+	return at
+}
+
+// preconditionFailed reports whether the If-Match or, when that is absent,
+// the If-Unmodified-Since header of r rules out writing over a record last
+// updated at updatedAt.
+func preconditionFailed(r *http.Request, updatedAt time.Time) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		tag := entityTag(updatedAt)
+		for _, t := range strings.Split(ifMatch, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || t == tag {
+				return false
+			}
+		}
+		return true
+	}
+
+	if since := r.Header.Get("If-Unmodified-Since"); since != "" {
+		t, err := http.ParseTime(since)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have a one second resolution
+		return updatedAt.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// newPreconditionTestServer serves the GET and PUT routes of countries and
+// provinces, without their authorization, and the list of provinces, over LA
+// with VTE and LPB.
+func newPreconditionTestServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now().Add(-time.Hour))
+
+	e := echo.New()
+	e.Use(requestDeadline(5 * time.Second))
+	e.Use(etagMiddleware)
+	changes := newChangeHub()
+	country := NewCountryService(r.CountryRepo, r.ProvinceRepo, newJobRunner(r.NotificationRepo), changes, r.HistoryRepo)
+	province := NewProvinceService(r.ProvinceRepo, newJobRunner(r.NotificationRepo), changes, r.HistoryRepo)
+	e.GET("/api/v1/country/:country_id", country.FindByCountryID)
+	e.PUT("/api/v1/country/:country_id", country.Edit)
+	e.GET("/api/v1/province/:province_id", province.FindByProvinceID)
+	e.PUT("/api/v1/province/:province_id", province.UpdateProvince)
+	e.GET("/api/v1/provinces", province.ListProvinces)
+	return e
+}
+
+// serve answers a request of method to path with the If-Match, or for GET
+// the If-None-Match, tag, if set.
+func serve(e *echo.Echo, method, path, tag, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	switch {
+	case tag == "":
+	case method == http.MethodGet:
+		req.Header.Set("If-None-Match", tag)
+	default:
+		req.Header.Set("If-Match", tag)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPutProvinceIfMatchTheTagOfItsGet(t *testing.T) {
+	e := newPreconditionTestServer(t)
+	get := serve(e, http.MethodGet, "/api/v1/province/VTE", "", "")
+	tag := get.Header().Get("ETag")
+	if get.Code != http.StatusOK || tag == "" {
+		t.Fatalf("GET = %d with ETag %q", get.Code, tag)
+	}
+
+	rec := serve(e, http.MethodPut, "/api/v1/province/VTE", tag, `{"name":"Vientiane","total":7}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT with the tag of the GET = %d %s", rec.Code, rec.Body)
+	}
+	written := rec.Header().Get("ETag")
+	if written == "" || written == tag {
+		t.Errorf("PUT answered the ETag %q, want a new one", written)
+	}
+	if rec := serve(e, http.MethodPut, "/api/v1/province/VTE", tag, `{"name":"Vientiane","total":8}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale tag = %d %s, want 412", rec.Code, rec.Body)
+	}
+	if got := serve(e, http.MethodGet, "/api/v1/province/VTE", "", "").Header().Get("ETag"); got != written {
+		t.Errorf("GET after the PUT answered the ETag %q, the PUT %q", got, written)
+	}
+	if rec := serve(e, http.MethodPut, "/api/v1/province/VTE", written, `{"name":"Vientiane","total":8}`); rec.Code != http.StatusOK {
+		t.Errorf("PUT with the tag of the previous PUT = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPutCountryIfMatchTheTagOfItsGet(t *testing.T) {
+	e := newPreconditionTestServer(t)
+	tag := serve(e, http.MethodGet, "/api/v1/country/LA", "", "").Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("GET answered no ETag")
+	}
+	if rec := serve(e, http.MethodPut, "/api/v1/country/LA", tag, `{"name":"Laos","total":11}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT with the tag of the GET = %d %s", rec.Code, rec.Body)
+	}
+
+	// the tag of a country moves with its provinces, which it is shown with
+	tag = serve(e, http.MethodGet, "/api/v1/country/LA", "", "").Header().Get("ETag")
+	if rec := serve(e, http.MethodPut, "/api/v1/province/LPB", "", `{"name":"Luang Prabang","total":5}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT province = %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(e, http.MethodPut, "/api/v1/country/LA", tag, `{"name":"Laos","total":12}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with the tag from before a province changed = %d %s, want 412", rec.Code, rec.Body)
+	}
+}
+
+func TestETagOfRecordsIsTheirEntityTag(t *testing.T) {
+	e := newPreconditionTestServer(t)
+	get := serve(e, http.MethodGet, "/api/v1/province/VTE", "", "")
+	tag := get.Header().Get("ETag")
+	var body struct {
+		Province *Province `json:"province"`
+	}
+	if err := json.Unmarshal(get.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if want := entityTag(body.Province.lastUpdated()); tag != want {
+		t.Errorf("GET province answered the ETag %q, want the entity tag %q", tag, want)
+	}
+	if rec := serve(e, http.MethodGet, "/api/v1/province/VTE", tag, ""); rec.Code != http.StatusNotModified {
+		t.Errorf("GET province with its tag = %d, want 304", rec.Code)
+	}
+
+	// lists are tagged with the hash of their body
+	list := serve(e, http.MethodGet, "/api/v1/provinces", "", "")
+	sum := sha256.Sum256(list.Body.Bytes())
+	if got, want := list.Header().Get("ETag"), `"`+hex.EncodeToString(sum[:16])+`"`; got != want {
+		t.Errorf("GET provinces answered the ETag %q, want the hash %q", got, want)
+	}
+	if rec := serve(e, http.MethodGet, "/api/v1/provinces", list.Header().Get("ETag"), ""); rec.Code != http.StatusNotModified {
+		t.Errorf("GET provinces with its tag = %d, want 304", rec.Code)
+	}
+}
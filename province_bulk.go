@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// the provinces one bulk update holds at most
+const maxBulkProvinces = 100
+
+func (pr *provinceRepo) UpdateAll(ctx context.Context, ps Provinces) (err error) {
+	tx, err := pr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("province", "", "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("province", "", "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	for _, p := range ps {
+		// the old name of a renamed province is kept within the transaction,
+		// no rename being written without it
+		if err := keepOldNameTx(ctx, tx, pr.dialect, p); err != nil {
+			return err
+		}
+		if err := updateProvince(ctx, tx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepOldNameTx records the name the province has before p renames it as an
+// alias, as keepOldName does, unless another province goes by it already.
+func keepOldNameTx(ctx context.Context, runner squirrel.BaseRunner, dialect migrations.Dialect, p *Province) error {
+	createdAt := "?::timestamptz"
+	if dialect == migrations.SQLite {
+		createdAt = "?"
+	}
+	if _, err := squirrel.Insert("province_aliases").
+		Columns("name", "province_id", "created_at").
+		Select(squirrel.Select("name", "id").
+			Column(createdAt, time.Now()).
+			From("provinces").
+			Where(squirrel.Eq{"id": p.ID}).
+			Where(squirrel.NotEq{"name": p.Name})).
+		Suffix("ON CONFLICT DO NOTHING").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ExecContext(ctx); err != nil {
+		return wrapErr("province", p.ID, "insert alias", err)
+	}
+	return nil
+}
+
+// UpdateProvinces updates the provinces of the array of the body at once,
+// as daily reporting does. Every entry is checked before any is written, and
+// either all of them are written, with the old names of those renamed, or
+// none. With Prefer: respond-async, the checked entries are written in a job.
+func (pA *provinceService) UpdateProvinces(c echo.Context) error {
+	var ps Provinces
+	if err := c.Bind(&ps); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	if len(ps) == 0 || len(ps) > maxBulkProvinces {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(fmt.Sprintf("request: between 1 and %d provinces", maxBulkProvinces)))
+	}
+
+	ctx := c.Request().Context()
+	var problems []string
+	seen := make(map[string]bool, len(ps))
+	for i, p := range ps {
+		if p == nil {
+			problems = append(problems, fmt.Sprintf("provinces[%d]: must be an object", i))
+			continue
+		}
+		p.Prepare()
+		if err := p.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("provinces[%d]: %s", i, err))
+		}
+		if seen[p.ID] {
+			problems = append(problems, fmt.Sprintf("provinces[%d]: %s is given twice", i, p.ID))
+		}
+		seen[p.ID] = true
+	}
+	if len(problems) > 0 {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(strings.Join(problems, ", ")))
+	}
+	for _, p := range ps {
+		if err := authorizeProvince(ctx, p.ID); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, pA.errMessage(msg))
+		}
+	}
+
+	// a batch of provinces can be more than fits in the router timeout
+	if respondAsync(c.Request()) {
+		job := pA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+			if _, err := pA.updateProvinces(ctx, ps); err != nil {
+				return nil, err
+			}
+			return map[string]Provinces{"provinces": ps}, nil
+		})
+		return acceptJob(c, job)
+	}
+
+	changed, err := pA.updateProvinces(ctx, ps)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not update province information")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	if len(changed) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, map[string]Provinces{"provinces": ps})
+}
+
+// updateProvinces writes the provinces of ps that differ from the current
+// ones, returning them. Only those are written, so that an identical entry
+// does not bump updated_at.
+func (pA *provinceService) updateProvinces(ctx context.Context, ps Provinces) (Provinces, error) {
+	var changed Provinces
+	now := time.Now()
+	for _, p := range ps {
+		current, err := pA.pApp.GetByID(forWrite(ctx), p.ID)
+		if err != nil {
+			return nil, err
+		}
+		// attributes left out of the payload are kept as they are
+		if p.Attributes == nil {
+			p.Attributes = current.Attributes
+		}
+		if current.Equal(p) {
+			p.UpdatedAt = current.UpdatedAt
+			continue
+		}
+		p.UpdatedAt = now
+		changed = append(changed, p)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	if err := pA.pApp.UpdateAll(ctx, changed); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(changed))
+	for _, p := range changed {
+		keys = append(keys, provinceKey(p.ID))
+	}
+	pA.changes.Publish(keys...)
+	return changed, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+const (
+	defaultProvinceLimit = 50
+	maxProvinceLimit     = 500
+)
+
+// provinceSorts maps the values of ?sort= to the columns provinces are
+// ordered by, only these ever reaching the query.
+var provinceSorts = map[string]string{
+	"total":    "total",
+	"new_case": "new_case",
+	"dead":     "dead",
+	"name":     "name",
+}
+
+// ProvinceFilter selects and orders the provinces of a listing. The zero
+// value lists every province by total, largest first, as the country
+// endpoint always did.
+type ProvinceFilter struct {
+	// CountryID only keeps the provinces of a country when set.
+	CountryID string
+	Sort      string
+	Asc       bool
+	// MinTotal leaves out the provinces with fewer confirmed cases.
+	MinTotal *int64
+}
+
+// parseProvinceFilter reads ?sort=, ?order= and ?min_total=. Counts are
+// ordered largest first and names alphabetically unless ?order= is given.
+func parseProvinceFilter(c echo.Context) (*ProvinceFilter, error) {
+	f := &ProvinceFilter{Sort: c.QueryParam("sort")}
+	if f.Sort == "" {
+		f.Sort = "total"
+	}
+	if _, ok := provinceSorts[f.Sort]; !ok {
+		return nil, errors.New("request: sort must be total, new_case, dead or name")
+	}
+	switch c.QueryParam("order") {
+	case "":
+		f.Asc = f.Sort == "name"
+	case "asc":
+		f.Asc = true
+	case "desc":
+		f.Asc = false
+	default:
+		return nil, errors.New("request: order must be asc or desc")
+	}
+	if v := c.QueryParam("min_total"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, errors.New("request: min_total must be a non-negative integer")
+		}
+		f.MinTotal = &n
+	}
+	return f, nil
+}
+
+// provinceFilterGiven tells whether the query string asks for a listing
+// other than the default one.
+func provinceFilterGiven(c echo.Context) bool {
+	return c.QueryParam("sort") != "" || c.QueryParam("order") != "" || c.QueryParam("min_total") != ""
+}
+
+func (f *ProvinceFilter) apply(stm squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if f.CountryID != "" {
+		stm = stm.Where(squirrel.Eq{"country_id": f.CountryID})
+	}
+	if f.MinTotal != nil {
+		stm = stm.Where(squirrel.GtOrEq{"total": *f.MinTotal})
+	}
+	column, ok := provinceSorts[f.Sort]
+	if !ok {
+		column = "total"
+	}
+	if !f.Asc {
+		column += " DESC"
+	}
+	return stm.OrderBy(column, "id")
+}
+
+// keep leaves out of ps, whose figures were rebuilt from history, the
+// provinces below the minimum total of f, if any.
+func (f *ProvinceFilter) keep(ps Provinces) Provinces {
+	if f == nil || f.MinTotal == nil {
+		return ps
+	}
+	kept := make(Provinces, 0, len(ps))
+	for _, p := range ps {
+		if p.Total >= *f.MinTotal {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func (pr *provinceRepo) GetAll(ctx context.Context, f *ProvinceFilter) (Provinces, error) {
+	if f == nil {
+		f = &ProvinceFilter{}
+	}
+	rows, err := f.apply(squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"latitude",
+		"longitude",
+		"attributes",
+		"updated_at").
+		From("provinces")).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", "", "select provinces", err)
+	}
+	defer rows.Close()
+
+	var ps = make(Provinces, 0)
+	for rows.Next() {
+		var p Province
+		if err := rows.Scan(&p.ID,
+			&p.Name,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&p.Latitude,
+			&p.Longitude,
+			&p.Attributes,
+			&p.UpdatedAt); err != nil {
+			return nil, wrapErr("province", "", "scan provinces", err)
+		}
+		ps = append(ps, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", "", "select provinces", err)
+	}
+	return ps, nil
+}
+
+// ListProvinces lists the provinces of every country, filtered and ordered
+// by the query string, without their districts and metrics.
+func (pA *provinceService) ListProvinces(c echo.Context) error {
+	f, err := parseProvinceFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+	ps, err := pA.pApp.GetAll(c.Request().Context(), f)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	if at, ok := embargoed(c); ok {
+		if ps, err = provincesAsOf(c.Request().Context(), pA.history, ps, at); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, pA.errMessage(msg))
+		}
+		ps = f.keep(ps)
+	}
+	return c.JSON(http.StatusOK, map[string]Provinces{"provinces": ps})
+}
+
+// Pagination tells which page of a nested list a response holds, with links
+// to the pages around it, nil at either end.
+type Pagination struct {
+	Page  uint64  `json:"page"`
+	Limit uint64  `json:"limit"`
+	Total int     `json:"total"`
+	Next  *string `json:"next"`
+	Prev  *string `json:"prev"`
+}
+
+// pageProvinces keeps the page of ps asked for with ?province_page= and
+// ?province_limit=, every province being kept, with no pagination, when
+// neither is given.
+func pageProvinces(c echo.Context, ps Provinces) (Provinces, *Pagination, error) {
+	pageParam, limitParam := c.QueryParam("province_page"), c.QueryParam("province_limit")
+	if pageParam == "" && limitParam == "" {
+		return ps, nil, nil
+	}
+	page := uint64(1)
+	if pageParam != "" {
+		n, err := strconv.ParseUint(pageParam, 10, 64)
+		if err != nil || n == 0 {
+			return nil, nil, errors.New("request: province_page must be a positive integer")
+		}
+		page = n
+	}
+	limit := uint64(defaultProvinceLimit)
+	if limitParam != "" {
+		n, err := strconv.ParseUint(limitParam, 10, 64)
+		if err != nil || n == 0 || n > maxProvinceLimit {
+			return nil, nil, fmt.Errorf("request: province_limit must be between 1 and %d", maxProvinceLimit)
+		}
+		limit = n
+	}
+
+	p := &Pagination{Page: page, Limit: limit, Total: len(ps)}
+	link := func(page uint64) *string {
+		u := *c.Request().URL
+		q := u.Query()
+		q.Set("province_page", strconv.FormatUint(page, 10))
+		q.Set("province_limit", strconv.FormatUint(limit, 10))
+		u.RawQuery = q.Encode()
+		v := u.RequestURI()
+		return &v
+	}
+	start := (page - 1) * limit
+	if start >= uint64(len(ps)) {
+		start = uint64(len(ps))
+	}
+	end := start + limit
+	if end >= uint64(len(ps)) {
+		end = uint64(len(ps))
+	} else {
+		p.Next = link(page + 1)
+	}
+	if page > 1 {
+		p.Prev = link(page - 1)
+	}
+	return ps[start:end], p, nil
+}
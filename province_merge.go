@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+var (
+	errDifferentCountries  = errors.New("province: provinces belong to different countries")
+	errUnassignedDistricts = errors.New("province: every district of the split province must be assigned to one of the provinces")
+)
+
+type provinceMergeRequest struct {
+	SourceID string `json:"source_id"`
+	TargetID string `json:"target_id"`
+}
+
+// provinceSplitPart is one of the provinces a province is split into. Either
+// every part carries a weight, and the figures are shared out proportionally,
+// or none does and every part carries its figures explicitly. The districts
+// of the split province move to the part listing their id in its districts.
+type provinceSplitPart struct {
+	Province
+	Weight int64 `json:"weight"`
+}
+
+type provinceSplitRequest struct {
+	Provinces []*provinceSplitPart `json:"provinces"`
+}
+
+func (pA *provinceService) MergeProvinces(c echo.Context) error {
+	var req provinceMergeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	if req.SourceID == "" || req.TargetID == "" {
+		return c.JSON(http.StatusBadRequest, pA.errMessage("province: source_id and target_id are required"))
+	}
+	if req.SourceID == req.TargetID {
+		return c.JSON(http.StatusBadRequest, pA.errMessage("province: cannot merge a province into itself"))
+	}
+
+	p, err := pA.pApp.Merge(c.Request().Context(), req.SourceID, req.TargetID)
+	if errors.Is(err, errDifferentCountries) {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(errDifferentCountries.Error()))
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not merge provinces")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	pA.changes.Publish(provinceKey(req.SourceID), provinceKey(req.TargetID))
+	return c.JSON(http.StatusOK, map[string]*Province{"province": p})
+}
+
+func (pA *provinceService) SplitProvince(c echo.Context) error {
+	var req provinceSplitRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	if len(req.Provinces) < 2 {
+		return c.JSON(http.StatusBadRequest, pA.errMessage("province: a split needs at least two provinces"))
+	}
+
+	weighted := 0
+	parts := make(Provinces, len(req.Provinces))
+	weights := make([]int64, len(req.Provinces))
+	for i, part := range req.Provinces {
+		p := part.Province
+		p.Prepare()
+		p.BeforeSave()
+		p.UpdatedAt = time.Now()
+		if err := p.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+		}
+		if part.Weight < 0 {
+			return c.JSON(http.StatusBadRequest, pA.errMessage("province: weight must not be negative"))
+		}
+		if part.Weight > 0 {
+			weighted++
+		}
+		parts[i], weights[i] = &p, part.Weight
+	}
+	if weighted != 0 && weighted != len(parts) {
+		return c.JSON(http.StatusBadRequest, pA.errMessage("province: either every province or none has a weight"))
+	}
+
+	ctx := c.Request().Context()
+	original, err := pA.pApp.GetByID(forWrite(ctx), c.Param("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+
+	if weighted > 0 {
+		allocateFigures(original, parts, weights)
+	} else if !original.Equal(sumFigures(original.Name, parts)) {
+		return c.JSON(http.StatusBadRequest, pA.errMessage("province: the figures of the parts must add up to the split province"))
+	}
+
+	err = pA.pApp.Split(ctx, original.ID, parts)
+	if errors.Is(err, errUnassignedDistricts) {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(errUnassignedDistricts.Error()))
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not split province")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	pA.changes.Publish(provinceKey(original.ID))
+	return c.JSON(http.StatusOK, map[string]Provinces{"provinces": parts})
+}
+
+// allocateFigures shares every figure of p out over parts in proportion to
+// weights, by largest remainder so that the parts add up exactly.
+func allocateFigures(p *Province, parts Provinces, weights []int64) {
+	share := func(total int64, set func(part *Province, v int64)) {
+		for i, v := range allocate(total, weights) {
+			set(parts[i], v)
+		}
+	}
+	share(p.Total, func(part *Province, v int64) { part.Total = v })
+	share(p.NewCase, func(part *Province, v int64) { part.NewCase = v })
+	share(p.Treated, func(part *Province, v int64) { part.Treated = v })
+	share(p.DecoveringCase, func(part *Province, v int64) { part.DecoveringCase = v })
+	share(p.TestCase, func(part *Province, v int64) { part.TestCase = v })
+	share(p.Dead, func(part *Province, v int64) { part.Dead = v })
+	share(p.NegativeTest, func(part *Province, v int64) { part.NegativeTest = v })
+}
+
+func allocate(total int64, weights []int64) []int64 {
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	shares := make([]int64, len(weights))
+	remainders := make([]int64, len(weights))
+	left := total
+	for i, w := range weights {
+		shares[i] = total * w / sum
+		remainders[i] = total * w % sum
+		left -= shares[i]
+	}
+	for ; left > 0; left-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		shares[best]++
+		remainders[best] = -1
+	}
+	return shares
+}
+
+func sumFigures(name string, ps Provinces) *Province {
+	sum := &Province{Name: name}
+	for _, p := range ps {
+		sum.Total += p.Total
+		sum.NewCase += p.NewCase
+		sum.Treated += p.Treated
+		sum.DecoveringCase += p.DecoveringCase
+		sum.TestCase += p.TestCase
+		sum.Dead += p.Dead
+		sum.NegativeTest += p.NegativeTest
+	}
+	return sum
+}
+
+// selectProvince reads a province along with the country it belongs to,
+// locking the row when lock is set, in the SQL of dialect.
+func selectProvince(ctx context.Context, runner squirrel.BaseRunner, dialect migrations.Dialect, id string, lock bool) (*Province, string, error) {
+	var p Province
+	var countryID string
+	stm := squirrel.Select("id",
+		"name",
+		"total",
+		"new_case",
+		"treated",
+		"decovering_case",
+		"test_case",
+		"dead",
+		"negative_case",
+		"attributes",
+		"updated_at",
+		"country_id").From("provinces").
+		Where(squirrel.Eq{"id": id})
+	if lock {
+		stm = forUpdate(dialect, stm)
+	}
+	err := stm.PlaceholderFormat(squirrel.Dollar).
+		RunWith(runner).ScanContext(ctx,
+		&p.ID,
+		&p.Name,
+		&p.Total,
+		&p.NewCase,
+		&p.Treated,
+		&p.DecoveringCase,
+		&p.TestCase,
+		&p.Dead,
+		&p.NegativeTest,
+		&p.Attributes,
+		&p.UpdatedAt,
+		&countryID)
+	if err != nil {
+		return nil, "", wrapErr("province", id, "select province", err)
+	}
+	return &p, countryID, nil
+}
+
+func (pr *provinceRepo) Merge(ctx context.Context, sourceID, targetID string) (p *Province, err error) {
+	tx, err := pr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, wrapErr("province", targetID, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				p, err = nil, wrapErr("province", targetID, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	source, sourceCountry, err := selectProvince(ctx, tx, pr.dialect, sourceID, true)
+	if err != nil {
+		return nil, err
+	}
+	target, targetCountry, err := selectProvince(ctx, tx, pr.dialect, targetID, true)
+	if err != nil {
+		return nil, err
+	}
+	if sourceCountry != targetCountry {
+		return nil, errDifferentCountries
+	}
+
+	merged := sumFigures(target.Name, Provinces{source, target})
+	merged.ID = target.ID
+	merged.Attributes = target.Attributes
+	merged.UpdatedAt = time.Now()
+	if _, err := squirrel.Update("provinces").
+		Set("total", merged.Total).
+		Set("new_case", merged.NewCase).
+		Set("treated", merged.Treated).
+		Set("decovering_case", merged.DecoveringCase).
+		Set("test_case", merged.TestCase).
+		Set("dead", merged.Dead).
+		Set("negative_case", merged.NegativeTest).
+		Set("updated_at", merged.UpdatedAt).
+		Where(squirrel.Eq{"id": target.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return nil, wrapErr("province", target.ID, "update province", err)
+	}
+
+	if _, err := squirrel.Update("districts").
+		Set("province_id", target.ID).
+		Where(squirrel.Eq{"province_id": source.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return nil, wrapErr("province", source.ID, "move districts", err)
+	}
+
+	if _, err := squirrel.Delete("provinces").
+		Where(squirrel.Eq{"id": source.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return nil, wrapErr("province", source.ID, "delete province", err)
+	}
+
+	return merged, nil
+}
+
+func (pr *provinceRepo) Split(ctx context.Context, id string, parts Provinces) (err error) {
+	tx, err := pr.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return wrapErr("province", id, "begin", err)
+	}
+	defer func() {
+		if err == nil {
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = wrapErr("province", id, "commit", commitErr)
+			}
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return
+		}
+	}()
+
+	_, countryID, err := selectProvince(ctx, tx, pr.dialect, id, true)
+	if err != nil {
+		return err
+	}
+
+	stm := squirrel.Insert("provinces").
+		Columns("id",
+			"name",
+			"total",
+			"new_case",
+			"treated",
+			"decovering_case",
+			"test_case",
+			"dead",
+			"negative_case",
+			"country_id",
+			"attributes",
+			"updated_at")
+	for _, p := range parts {
+		stm = stm.Values(&p.ID,
+			&p.Name,
+			&p.Total,
+			&p.NewCase,
+			&p.Treated,
+			&p.DecoveringCase,
+			&p.TestCase,
+			&p.Dead,
+			&p.NegativeTest,
+			&countryID,
+			&p.Attributes,
+			&p.UpdatedAt)
+	}
+	if _, err := stm.PlaceholderFormat(squirrel.Dollar).RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("province", id, "insert provinces", err)
+	}
+
+	for _, p := range parts {
+		if len(p.Districts) == 0 {
+			continue
+		}
+		ids := make([]string, len(p.Districts))
+		for i, d := range p.Districts {
+			ids[i] = d.ID
+		}
+		if _, err := squirrel.Update("districts").
+			Set("province_id", p.ID).
+			Where(squirrel.Eq{"province_id": id, "id": ids}).
+			PlaceholderFormat(squirrel.Dollar).
+			RunWith(tx).ExecContext(ctx); err != nil {
+			return wrapErr("province", id, "move districts", err)
+		}
+	}
+	var left int64
+	if err := squirrel.Select("COUNT(*)").
+		From("districts").
+		Where(squirrel.Eq{"province_id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ScanContext(ctx, &left); err != nil {
+		return wrapErr("province", id, "count districts", err)
+	}
+	if left > 0 {
+		return errUnassignedDistricts
+	}
+
+	if _, err := squirrel.Delete("provinces").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tx).ExecContext(ctx); err != nil {
+		return wrapErr("province", id, "delete province", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+)
+
+const (
+	// how long changes are collected before a push, so that a daily upload
+	// touching every province makes one notification
+	pushDelay     = 30 * time.Second
+	pushQueueSize = 1024
+	// how long a push to every subscription may take, its database calls
+	// needing a deadline
+	pushRunTimeout = 5 * time.Minute
+	// how long push services keep a notification for an offline browser
+	pushTTL = 24 * time.Hour
+	// the record size of the aes128gcm content coding, RFC 8188
+	pushRecordSize = 4096
+	pushMaxPayload = 3072
+)
+
+var errPushOff = errors.New("Error: Push notifications are not configured")
+
+// PushSubscription is a browser subscribed to Web Push, as the
+// PushSubscription.toJSON() of the browser gives it.
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PushSubscriptions []*PushSubscription
+
+func (s *PushSubscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("required valid https endpoint")
+	}
+	if key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.P256dh, "=")); err != nil || len(key) != 65 {
+		return errors.New("required valid keys.p256dh")
+	}
+	if secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.Auth, "=")); err != nil || len(secret) != 16 {
+		return errors.New("required valid keys.auth")
+	}
+	return nil
+}
+
+// PushNotification is the payload pushed to the browsers, for the service
+// worker of the PWA to show.
+type PushNotification struct {
+	Type      string   `json:"type"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	Countries []string `json:"countries"`
+	Provinces []string `json:"provinces"`
+}
+
+// Repository
+type PushSubscriptionRepository interface {
+	Save(ctx context.Context, s *PushSubscription) error
+	Delete(ctx context.Context, endpoint string) error
+	GetAll(ctx context.Context) (PushSubscriptions, error)
+}
+
+type pushSubscriptionRepo struct {
+	db *sql.DB
+}
+
+var _ PushSubscriptionRepository = &pushSubscriptionRepo{}
+
+func NewPushSubscriptionRepo(db *sql.DB) *pushSubscriptionRepo {
+	return &pushSubscriptionRepo{db}
+}
+
+func (pr *pushSubscriptionRepo) Save(ctx context.Context, s *PushSubscription) error {
+	if _, err := squirrel.Insert("push_subscriptions").
+		Columns("endpoint", "p256dh", "auth", "created_at").
+		Values(s.Endpoint, s.Keys.P256dh, s.Keys.Auth, s.CreatedAt).
+		Suffix("ON CONFLICT (endpoint) DO UPDATE SET p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ExecContext(ctx); err != nil {
+		return wrapErr("push subscription", "", "insert push subscription", err)
+	}
+	return nil
+}
+
+func (pr *pushSubscriptionRepo) Delete(ctx context.Context, endpoint string) error {
+	res, err := squirrel.Delete("push_subscriptions").
+		Where(squirrel.Eq{"endpoint": endpoint}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("push subscription", "", "delete push subscription", err)
+	}
+	return wrapErr("push subscription", "", "delete push subscription", affectedOne(res))
+}
+
+func (pr *pushSubscriptionRepo) GetAll(ctx context.Context) (PushSubscriptions, error) {
+	rows, err := squirrel.Select("endpoint", "p256dh", "auth", "created_at").
+		From("push_subscriptions").
+		OrderBy("created_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(pr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("push subscription", "", "select push subscriptions", err)
+	}
+	defer rows.Close()
+
+	var ss = make(PushSubscriptions, 0)
+	for rows.Next() {
+		var s PushSubscription
+		if err := rows.Scan(&s.Endpoint, &s.Keys.P256dh, &s.Keys.Auth, &s.CreatedAt); err != nil {
+			return nil, wrapErr("push subscription", "", "scan push subscriptions", err)
+		}
+		ss = append(ss, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("push subscription", "", "select push subscriptions", err)
+	}
+	return ss, nil
+}
+
+// webPusher pushes a notification to every subscribed browser when the
+// figures of countries are published, through the same change hub the CDN
+// purge and the live endpoints listen to.
+type webPusher struct {
+	key *ecdsa.PrivateKey
+	// publicKey is the application server key browsers subscribe with
+	publicKey string
+	subject   string
+	client    *http.Client
+	subs      PushSubscriptionRepository
+	queue     chan string
+	// delay is how long changes are collected before a push, pushDelay
+	delay time.Duration
+}
+
+// webPusherFromEnv reads VAPID_PRIVATE_KEY, the base64url encoded P-256
+// private key identifying the server to push services, and VAPID_SUBJECT, a
+// mailto: or https: contact for them. It returns nil when no key is set.
+func webPusherFromEnv(client *http.Client, subs PushSubscriptionRepository) (*webPusher, error) {
+	raw := os.Getenv("VAPID_PRIVATE_KEY")
+	if raw == "" {
+		return nil, nil
+	}
+	d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+	if err != nil || len(d) != 32 {
+		return nil, errors.New("push: VAPID_PRIVATE_KEY must be a base64url encoded P-256 private key")
+	}
+	subject := os.Getenv("VAPID_SUBJECT")
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https:") {
+		return nil, errors.New("push: VAPID_SUBJECT must be a mailto: or https: URL")
+	}
+
+	curve := elliptic.P256()
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	key.Curve = curve
+	key.X, key.Y = curve.ScalarBaseMult(d)
+	return &webPusher{
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(elliptic.Marshal(curve, key.X, key.Y)),
+		subject:   subject,
+		client:    client,
+		subs:      subs,
+		queue:     make(chan string, pushQueueSize),
+		delay:     pushDelay,
+	}, nil
+}
+
+// Enqueue is the change hub listener of the pusher, which only cares for
+// countries and provinces. Keys that do not fit in the queue are dropped.
+func (wp *webPusher) Enqueue(keys []string) {
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "country:") && !strings.HasPrefix(key, "province:") {
+			continue
+		}
+		select {
+		case wp.queue <- key:
+		default:
+			logger.Warn().Str("key", key).Msg("push: queue full, dropped")
+		}
+	}
+}
+
+func (wp *webPusher) Run(ctx context.Context) {
+	for {
+		var first string
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-wp.queue:
+		}
+
+		pending := map[string]struct{}{first: {}}
+		timer := time.NewTimer(wp.delay)
+	collect:
+		for {
+			select {
+			case key := <-wp.queue:
+				pending[key] = struct{}{}
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		n := &PushNotification{
+			Type:      "figures_published",
+			Title:     "New figures",
+			Body:      "The latest COVID-19 figures are published.",
+			Countries: make([]string, 0),
+			Provinces: make([]string, 0),
+		}
+		for key := range pending {
+			if strings.HasPrefix(key, "country:") {
+				n.Countries = append(n.Countries, strings.TrimPrefix(key, "country:"))
+			} else {
+				n.Provinces = append(n.Provinces, strings.TrimPrefix(key, "province:"))
+			}
+		}
+		sort.Strings(n.Countries)
+		sort.Strings(n.Provinces)
+		wp.pushAll(ctx, n)
+	}
+}
+
+// pushAll pushes n to every subscription, removing the ones the push service
+// says are gone.
+func (wp *webPusher) pushAll(ctx context.Context, n *PushNotification) {
+	ctx, cancel := context.WithTimeout(ctx, pushRunTimeout)
+	defer cancel()
+
+	payload, err := json.Marshal(n)
+	// push services take about 4KB, the service worker fetching what
+	// changed when the lists do not fit
+	if err == nil && len(payload) > pushMaxPayload {
+		n.Countries, n.Provinces = make([]string, 0), make([]string, 0)
+		payload, err = json.Marshal(n)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("push: failed to encode notification")
+		return
+	}
+	subs, err := wp.subs.GetAll(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("push: failed to list subscriptions")
+		return
+	}
+	for _, s := range subs {
+		err := wp.push(ctx, s, payload)
+		if errors.Is(err, errNotFound) {
+			if err := wp.subs.Delete(ctx, s.Endpoint); err != nil && !errors.Is(err, errNotFound) {
+				logger.Error().Err(err).Msg("push: failed to remove expired subscription")
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("push_service", endpointHost(s.Endpoint)).Msg("push: failed to push")
+		}
+	}
+}
+
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// push sends payload to s, encrypted as RFC 8291 specifies. A subscription
+// the push service no longer knows returns errNotFound.
+func (wp *webPusher) push(ctx context.Context, s *PushSubscription, payload []byte) error {
+	body, err := encryptPush(s, payload)
+	if err != nil {
+		return err
+	}
+	auth, err := wp.vapid(s.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(pushTTL.Seconds())))
+	res, err := wp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return errNotFound
+	case res.StatusCode >= 300:
+		return fmt.Errorf("push: %s answered %s", req.URL.Host, res.Status)
+	}
+	return nil
+}
+
+// vapid is the Authorization header identifying the server to the push
+// service of endpoint, RFC 8292.
+func (wp *webPusher) vapid(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{
+		Audience:  u.Scheme + "://" + u.Host,
+		ExpiresAt: time.Now().Add(12 * time.Hour).Unix(),
+		Subject:   wp.subject,
+	}).SignedString(wp.key)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + token + ", k=" + wp.publicKey, nil
+}
+
+func hmacSHA256(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// encryptPush encrypts payload for s with the aes128gcm content coding, in a
+// single record, as RFC 8291 specifies.
+func encryptPush(s *PushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.P256dh, "="))
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s.Keys.Auth, "="))
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, _, _, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return sealPush(uaPublic, authSecret, asPrivate, salt, payload)
+}
+
+// sealPush encrypts payload for the browser key uaPublic and authSecret with
+// the server key asPrivate, used once, and salt.
+func sealPush(uaPublic, authSecret, asPrivate, salt, payload []byte) ([]byte, error) {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, uaPublic)
+	if x == nil {
+		return nil, errors.New("push: invalid p256dh key")
+	}
+	asX, asY := curve.ScalarBaseMult(asPrivate)
+	asPublic := elliptic.Marshal(curve, asX, asY)
+	sx, _ := curve.ScalarMult(x, y, asPrivate)
+	ecdhSecret := make([]byte, 32)
+	sx.FillBytes(ecdhSecret)
+
+	// HKDF with a single block of output, every key being at most 32 bytes
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := hmacSHA256(hmacSHA256(authSecret, ecdhSecret), keyInfo, []byte{1})
+	prk := hmacSHA256(salt, ikm)
+	cek := hmacSHA256(prk, []byte("Content-Encoding: aes128gcm\x00"), []byte{1})[:16]
+	nonce := hmacSHA256(prk, []byte("Content-Encoding: nonce\x00"), []byte{1})[:12]
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// the delimiter of the last record
+	plaintext := append(append([]byte{}, payload...), 2)
+	if len(plaintext)+gcm.Overhead() > pushRecordSize {
+		return nil, errors.New("push: payload too large")
+	}
+
+	header := make([]byte, 16+4+1)
+	copy(header, salt)
+	binary.BigEndian.PutUint32(header[16:], pushRecordSize)
+	header[20] = byte(len(asPublic))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// handler
+type pushService struct {
+	// nil when push is not configured
+	pusher *webPusher
+	subs   PushSubscriptionRepository
+}
+
+func NewPushService(pusher *webPusher, subs PushSubscriptionRepository) *pushService {
+	return &pushService{pusher: pusher, subs: subs}
+}
+
+func (pA *pushService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// VAPIDKey answers the application server key the PWA subscribes with.
+func (pA *pushService) VAPIDKey(c echo.Context) error {
+	if pA.pusher == nil {
+		return c.JSON(http.StatusNotFound, pA.errMessage(errPushOff.Error()))
+	}
+	return c.JSON(http.StatusOK, map[string]string{"vapid_public_key": pA.pusher.publicKey})
+}
+
+func (pA *pushService) Subscribe(c echo.Context) error {
+	if pA.pusher == nil {
+		return c.JSON(http.StatusNotFound, pA.errMessage(errPushOff.Error()))
+	}
+	var s PushSubscription
+	if err := c.Bind(&s); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	if err := s.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, pA.errMessage(err.Error()))
+	}
+	s.CreatedAt = time.Now()
+	if err := pA.subs.Save(c.Request().Context(), &s); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*PushSubscription{"push_subscription": &s})
+}
+
+// Unsubscribe removes the subscription of the endpoint of the body, the
+// endpoint being what only the browser holding it knows.
+func (pA *pushService) Unsubscribe(c echo.Context) error {
+	var s PushSubscription
+	if err := c.Bind(&s); err != nil || s.Endpoint == "" {
+		return c.JSON(http.StatusUnprocessableEntity, pA.errMessage("request: unable to parse request payload"))
+	}
+	if err := pA.subs.Delete(c.Request().Context(), s.Endpoint); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, pA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// the longest ranges the analytics endpoints answer in one request, for no
+// single request to scan the whole of a history table
+const (
+	// days of the history of a country or a province
+	maxHistoryDays = 731
+	// days of the history of a district, of which there are many more rows
+	maxDistrictHistoryDays = 184
+	// days of the records of a province, such as hotline days
+	maxRecordDays = 366
+	// weekly buckets of a trend
+	maxTrendWeeks = 104
+	// months of excess mortality
+	maxMortalityMonths = 60
+	// country-days of an OWID export, its countries times its days
+	maxOWIDCountryDays = 50 * 366
+)
+
+// spanDays is the number of days from from to to, both included.
+func spanDays(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24) + 1
+}
+
+// checkDays fails when from to to spans more than limit days.
+func checkDays(from, to time.Time, limit int) error {
+	if n := spanDays(from, to); n > limit {
+		return fmt.Errorf("request: from and to span %d days, at most %d can be asked for at once", n, limit)
+	}
+	return nil
+}
+
+// checkWeeks fails when from to to holds more than limit weekly buckets.
+func checkWeeks(from, to time.Time, limit int) error {
+	if n := (spanDays(from, to) + 6) / 7; n > limit {
+		return fmt.Errorf("request: from and to span %d weeks, at most %d can be asked for at once", n, limit)
+	}
+	return nil
+}
+
+// checkMonths fails when from to to, first days of months, spans more than
+// limit months.
+func checkMonths(from, to time.Time, limit int) error {
+	n := (to.Year()-from.Year())*12 + int(to.Month()-from.Month()) + 1
+	if n > limit {
+		return fmt.Errorf("request: from and to span %d months, at most %d can be asked for at once", n, limit)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// how often buckets left full are dropped
+const rateLimitSweep = time.Minute
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens a second,
+// every request taking one.
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// rateLimiter keeps a token bucket per client. Clients that stop sending
+// requests are forgotten once their bucket is full again.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter allows perMinute requests a minute, all of them at once at
+// most.
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:      float64(perMinute) / 60,
+		burst:     float64(perMinute),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take takes a token of the bucket of client, reporting whether there was
+// one, the tokens left, and how long until the next token and until the
+// bucket is full.
+func (rl *rateLimiter) take(client string, now time.Time) (bool, int, time.Duration, time.Duration) {
+	return rl.fill(client, now, true)
+}
+
+// peek reports what take would, without taking the token.
+func (rl *rateLimiter) peek(client string, now time.Time) (bool, int, time.Duration, time.Duration) {
+	return rl.fill(client, now, false)
+}
+
+func (rl *rateLimiter) fill(client string, now time.Time, take bool) (bool, int, time.Duration, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if now.Sub(rl.lastSweep) > rateLimitSweep {
+		for k, b := range rl.buckets {
+			if b.tokens+now.Sub(b.at).Seconds()*rl.rate >= rl.burst {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, at: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.at).Seconds()*rl.rate)
+	b.at = now
+	allowed := b.tokens >= 1
+	if allowed && take {
+		b.tokens--
+	}
+	next := time.Duration(math.Max(0, 1-b.tokens) / rl.rate * float64(time.Second))
+	full := time.Duration((rl.burst - b.tokens) / rl.rate * float64(time.Second))
+	return allowed, int(b.tokens), next, full
+}
+
+// the requests a minute allowed per developer key unless set
+const defaultDeveloperRateLimit = 60
+
+// the requests a minute allowed per embed token unless set, every visitor of
+// the page embedding it sharing the token
+const defaultEmbedRateLimit = 600
+
+// rateLimits limits the requests made with an API key or an embed token per
+// key or token, and the others per client IP.
+type rateLimits struct {
+	ip        *rateLimiter
+	key       *rateLimiter
+	developer *rateLimiter
+	embed     *rateLimiter
+	// proxies are the networks of the proxies whose X-Forwarded-For is
+	// believed, the client being the peer of the connection otherwise
+	proxies []*net.IPNet
+}
+
+// rateLimitsFromEnv reads RATE_LIMIT_PER_IP and RATE_LIMIT_PER_KEY, the
+// requests a minute allowed per client IP and per API key of a team, either
+// being unlimited when not set, and RATE_LIMIT_PER_DEVELOPER_KEY and
+// RATE_LIMIT_PER_EMBED_TOKEN, which developer keys and embed tokens are
+// always limited to, defaultDeveloperRateLimit and defaultEmbedRateLimit
+// unless set.
+// TRUSTED_PROXIES lists the CIDRs of the load balancers in front of the
+// server, e.g. 10.0.0.0/8,192.168.1.5, whose X-Forwarded-For is believed.
+func rateLimitsFromEnv() (*rateLimits, error) {
+	rls := &rateLimits{developer: newRateLimiter(defaultDeveloperRateLimit), embed: newRateLimiter(defaultEmbedRateLimit)}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if !strings.Contains(s, "/") {
+				if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+					s += "/32"
+				} else {
+					s += "/128"
+				}
+			}
+			_, n, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit: invalid TRUSTED_PROXIES %q", s)
+			}
+			rls.proxies = append(rls.proxies, n)
+		}
+	}
+	for _, l := range []struct {
+		env string
+		rl  **rateLimiter
+	}{
+		{"RATE_LIMIT_PER_IP", &rls.ip},
+		{"RATE_LIMIT_PER_KEY", &rls.key},
+		{"RATE_LIMIT_PER_DEVELOPER_KEY", &rls.developer},
+		{"RATE_LIMIT_PER_EMBED_TOKEN", &rls.embed},
+	} {
+		v := os.Getenv(l.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("rate limit: invalid %s %q", l.env, v)
+		}
+		*l.rl = newRateLimiter(n)
+	}
+	return rls, nil
+}
+
+func (rls *rateLimits) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (rls *rateLimits) trusted(ip net.IP) bool {
+	for _, n := range rls.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the peer of the connection, or when it is a trusted proxy the
+// last address of X-Forwarded-For that is not one, clients setting the
+// header themselves being ignored.
+func (rls *rateLimits) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !rls.trusted(ip) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values(echo.HeaderXForwardedFor), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			break
+		}
+		host = hop
+		if !rls.trusted(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// Middleware limits the requests per client IP. It runs before
+// authentication, for a flood of made up API keys not to reach the
+// database: the requests with a key or an embed token are only refused once
+// the bucket of their IP is empty, and take a token of it unless the key or
+// the embed token authenticated them, KeyMiddleware limiting those per key
+// or token. One that authenticated nothing, be it refused, unknown with
+// authentication off, or sent to a route that does not check it, counts as
+// the IP's.
+func (rls *rateLimits) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if rls.ip == nil {
+			return next(c)
+		}
+		client := "ip:" + rls.clientIP(c.Request())
+		if c.Request().Header.Get(headerAPIKey) == "" && c.QueryParam(embedTokenParam) == "" {
+			return rls.limit(c, rls.ip, client, rls.ip.take, next)
+		}
+		err := rls.limit(c, rls.ip, client, rls.ip.peek, next)
+		// Authenticate set the identity on the request it passed on
+		if id, ok := c.Request().Context().Value(identityKey{}).(*identity); !ok || (id.team == nil && id.developer == nil && id.embed == "") {
+			rls.ip.take(client, time.Now())
+		}
+		return err
+	}
+}
+
+// KeyMiddleware runs after authentication, limiting the requests made with
+// the key of a team or of a developer per key, and those made with an embed
+// token per token.
+func (rls *rateLimits) KeyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var rl *rateLimiter
+		var client string
+		if id, ok := c.Request().Context().Value(identityKey{}).(*identity); ok && id.team != nil {
+			rl, client = rls.key, "key:"+hashTeamKey(c.Request().Header.Get(headerAPIKey))
+		} else if ok && id.developer != nil {
+			rl, client = rls.developer, "developer:"+id.developer.ID
+		} else if ok && id.embed != "" {
+			rl, client = rls.embed, "embed:"+hashTeamKey(c.QueryParam(embedTokenParam))
+		}
+		if rl == nil {
+			return next(c)
+		}
+		return rls.limit(c, rl, client, rl.take, next)
+	}
+}
+
+// limit answers 429 when get finds no token for client, setting the
+// X-RateLimit headers either way.
+func (rls *rateLimits) limit(c echo.Context, rl *rateLimiter, client string, get func(string, time.Time) (bool, int, time.Duration, time.Duration), next echo.HandlerFunc) error {
+	allowed, remaining, wait, reset := get(client, time.Now())
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(int(rl.burst)))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+	if !allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return c.JSON(http.StatusTooManyRequests, rls.errMessage("Error: Too many requests, retry later"))
+	}
+	return next(c)
+}
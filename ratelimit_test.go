@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// newRateLimitTestServer limits clients to two requests a minute per IP,
+// authenticating with secret, authentication being off when it is empty.
+func newRateLimitTestServer(t *testing.T, secret string) (*echo.Echo, string) {
+	t.Helper()
+	r, ctx := openTestStorage(t)
+	saveTestCountry(t, ctx, r, time.Now())
+	teamKey := saveTestTeam(t, ctx, r, "LA")
+
+	e := echo.New()
+	limits := &rateLimits{ip: newRateLimiter(2)}
+	auth := NewAuthService(r.UserRepo, r.TeamRepo, r.DeveloperRepo, newDeveloperUsage(r.DeveloperRepo), secret, time.Hour)
+	e.Use(requestDeadline(5 * time.Second))
+	e.Use(limits.Middleware)
+	e.Use(auth.Authenticate)
+	e.Use(limits.KeyMiddleware)
+	e.GET("/api/v1/countries", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	return e, teamKey
+}
+
+// getWithKey answers n requests sent with the API key key, returning the
+// status of the last one.
+func getWithKey(e *echo.Echo, key string, n int) int {
+	var rec *httptest.ResponseRecorder
+	for i := 0; i < n; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/countries", nil)
+		req.Header.Set(headerAPIKey, key)
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+	}
+	return rec.Code
+}
+
+func TestRateLimitCountsUnauthenticatedKeysPerIP(t *testing.T) {
+	e, _ := newRateLimitTestServer(t, "")
+	if code := getWithKey(e, "made-up", 3); code != http.StatusTooManyRequests {
+		t.Errorf("third request with a made up key and authentication off = %d, want 429", code)
+	}
+}
+
+func TestRateLimitSparesKeysThatAuthenticated(t *testing.T) {
+	e, teamKey := newRateLimitTestServer(t, testJWTSecret)
+	if code := getWithKey(e, teamKey, 3); code != http.StatusOK {
+		t.Errorf("third request with the key of a team = %d, want 200", code)
+	}
+	if code := getWithKey(e, "made-up", 1); code != http.StatusUnauthorized {
+		t.Errorf("request with a made up key = %d, want 401", code)
+	}
+	if code := getWithKey(e, "made-up", 2); code != http.StatusTooManyRequests {
+		t.Errorf("third request with a made up key = %d, want 429", code)
+	}
+}
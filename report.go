@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// the provinces listed by the daily report, by their new cases
+const reportTopProvinces = 10
+
+var errReportNoData = errors.New("report: there are no figures by that day")
+
+// dailyReportTemplate writes the lines of the daily situation report, laid
+// out by renderReport: # a title, ## a heading, !| a table header and | a
+// table row, cells separated by |, an empty line a gap, any other a
+// paragraph.
+var dailyReportTemplate = template.Must(template.New("daily").Funcs(template.FuncMap{
+	"num":   reportNumber,
+	"delta": reportDelta,
+	"cell":  reportCell,
+}).Parse(`# COVID-19 situation report: {{cell .Country.Name}}
+Figures at the end of {{.Day}}, compared to the day before. Generated {{.GeneratedAt.Format "2006-01-02 15:04"}} UTC.
+
+## Totals
+!|Figure|{{.Day}}|{{.Before.Day}}|Change
+|Confirmed cases|{{num .Today.Total}}|{{num .Before.Total}}|{{delta .Today.Total .Before.Total}}
+|New cases|{{num .Today.NewCase}}|{{num .Before.NewCase}}|{{delta .Today.NewCase .Before.NewCase}}
+|Deaths|{{num .Today.Dead}}|{{num .Before.Dead}}|{{delta .Today.Dead .Before.Dead}}
+|Treated|{{num .Today.Treated}}|{{num .Before.Treated}}|{{delta .Today.Treated .Before.Treated}}
+|Recovering|{{num .Today.DecoveringCase}}|{{num .Before.DecoveringCase}}|{{delta .Today.DecoveringCase .Before.DecoveringCase}}
+|Tests|{{num .Today.TestCase}}|{{num .Before.TestCase}}|{{delta .Today.TestCase .Before.TestCase}}
+|Negative tests|{{num .Today.NegativeTest}}|{{num .Before.NegativeTest}}|{{delta .Today.NegativeTest .Before.NegativeTest}}
+
+## Top provinces by new cases
+{{- if .Provinces}}
+!|Province|New cases|Change|Confirmed|Deaths
+{{- range .Provinces}}
+|{{cell .Name}}|{{num .Today.NewCase}}|{{delta .Today.NewCase .Before.NewCase}}|{{num .Today.Total}}|{{num .Today.Dead}}
+{{- end}}
+{{- else}}
+No province reported new cases on {{.Day}}.
+{{- end}}
+`))
+
+// DailyReport is what the daily situation report is rendered from, Before
+// being the figures at the end of the day before Day, zero when there were
+// none.
+type DailyReport struct {
+	Country     *Country
+	Day         string
+	GeneratedAt time.Time
+	Today       *HistoryPoint
+	Before      *HistoryPoint
+	Provinces   []*ReportProvince
+}
+
+// ReportProvince is a province of the daily report.
+type ReportProvince struct {
+	Name   string
+	Today  *HistoryPoint
+	Before *HistoryPoint
+}
+
+// reportNumber writes n with thousands separators.
+func reportNumber(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// reportDelta writes the change from before to now, signed.
+func reportDelta(now, before int64) string {
+	if d := now - before; d > 0 {
+		return "+" + reportNumber(d)
+	}
+	return reportNumber(now - before)
+}
+
+// reportCell keeps a name from being split into cells.
+func reportCell(s string) string {
+	return strings.Replace(s, "|", "/", -1)
+}
+
+// renderReport lays out the lines written by a report template as a PDF.
+func renderReport(lines string) []byte {
+	d := newPDFDocument()
+	for _, line := range strings.Split(lines, "\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			d.Line(pdfBold, 18, 26, strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "## "):
+			d.Line(pdfBold, 13, 22, strings.TrimPrefix(line, "## "))
+		case strings.HasPrefix(line, "!|"):
+			d.Row(pdfBold, 10, 18, strings.Split(strings.TrimPrefix(line, "!|"), "|"))
+			d.Rule()
+		case strings.HasPrefix(line, "|"):
+			d.Row(pdfRegular, 10, 15, strings.Split(strings.TrimPrefix(line, "|"), "|"))
+		case strings.TrimSpace(line) == "":
+			d.advance(8)
+		default:
+			d.Line(pdfRegular, 10, 14, line)
+		}
+	}
+	return d.Bytes()
+}
+
+// handler
+type reportService struct {
+	cApp CountryRepository
+	pApp ProvinceRepository
+	hApp HistoryRepository
+}
+
+func NewReportService(cApp CountryRepository, pApp ProvinceRepository, hApp HistoryRepository) *reportService {
+	return &reportService{cApp: cApp, pApp: pApp, hApp: hApp}
+}
+
+func (rA *reportService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// reportDay returns the day of ?day=, today unless set, and the time the
+// report shows its figures as of: the end of that day, or the embargo of the
+// key of the caller when earlier, the day then being the one of the embargo.
+func reportDay(c echo.Context) (time.Time, time.Time, error) {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := c.QueryParam("day"); v != "" {
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return day, day, errors.New("request: day must be formatted as YYYY-MM-DD")
+		}
+		day = t
+	}
+	at := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	if cutoff, ok := embargoed(c); ok && cutoff.Before(at) {
+		at = cutoff
+		day = cutoff.UTC().Truncate(24 * time.Hour)
+	}
+	return day, at, nil
+}
+
+// Daily renders the situation report of the country of ?country_id= for
+// ?day=, today unless set, as a PDF: its totals and new cases compared to
+// the day before, and its provinces with the most new cases.
+func (rA *reportService) Daily(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.QueryParam("country_id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, rA.errMessage("request: country_id is required"))
+	}
+	day, at, err := reportDay(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, rA.errMessage(err.Error()))
+	}
+	before := day.Add(-time.Nanosecond)
+
+	country, err := rA.cApp.GetByID(ctx, id)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, rA.errMessage(msg))
+	}
+	report := DailyReport{
+		Country:     country,
+		Day:         day.Format(dateLayout),
+		GeneratedAt: time.Now().UTC(),
+		Before:      &HistoryPoint{Day: before.Format(dateLayout)},
+	}
+	points, err := rA.hApp.AsOf(ctx, "country", []string{country.ID}, at)
+	if err == nil {
+		report.Today = points[country.ID]
+		points, err = rA.hApp.AsOf(ctx, "country", []string{country.ID}, before)
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, rA.errMessage(msg))
+	}
+	if report.Today == nil {
+		return c.JSON(http.StatusNotFound, rA.errMessage(errReportNoData.Error()))
+	}
+	if p, ok := points[country.ID]; ok {
+		report.Before = p
+	}
+
+	provinces, err := rA.pApp.GetAll(ctx, &ProvinceFilter{CountryID: country.ID})
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, rA.errMessage(msg))
+	}
+	ids := make([]string, len(provinces))
+	for i, p := range provinces {
+		ids[i] = p.ID
+	}
+	today, err := rA.hApp.AsOf(ctx, "province", ids, at)
+	var yesterday map[string]*HistoryPoint
+	if err == nil {
+		yesterday, err = rA.hApp.AsOf(ctx, "province", ids, before)
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, rA.errMessage(msg))
+	}
+	for _, p := range provinces {
+		// the history of a day only holds the provinces updated on it
+		pt, ok := today[p.ID]
+		if !ok || pt.Day != report.Day || pt.NewCase == 0 {
+			continue
+		}
+		rp := &ReportProvince{Name: p.Name, Today: pt, Before: &HistoryPoint{}}
+		if pb, ok := yesterday[p.ID]; ok {
+			rp.Before = pb
+		}
+		report.Provinces = append(report.Provinces, rp)
+	}
+	sort.SliceStable(report.Provinces, func(i, j int) bool {
+		a, b := report.Provinces[i].Today, report.Provinces[j].Today
+		if a.NewCase != b.NewCase {
+			return a.NewCase > b.NewCase
+		}
+		return a.Total > b.Total
+	})
+	if len(report.Provinces) > reportTopProvinces {
+		report.Provinces = report.Provinces[:reportTopProvinces]
+	}
+
+	var lines bytes.Buffer
+	if err := dailyReportTemplate.Execute(&lines, &report); err != nil {
+		return c.JSON(http.StatusInternalServerError, rA.errMessage("Internal server error"))
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`inline; filename="situation-report-%s-%s.pdf"`, country.ID, report.Day))
+	return c.Blob(http.StatusOK, "application/pdf", renderReport(lines.String()))
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+const (
+	defaultRetentionInterval = time.Hour
+	// the rows a purge deletes per statement, for it not to hold its locks
+	// nor grow the WAL for long on a small database
+	retentionBatch = 5000
+	// how long a batch may take, the guard rejecting statements without a
+	// deadline
+	retentionBatchTimeout = time.Minute
+)
+
+var errRetentionOff = errors.New("Error: No retention window is configured")
+
+// retentionTables are the tables that only grow, and the column their rows
+// expire by. A window is set for each with RETENTION_<TABLE>, e.g.
+// RETENTION_REQUEST_JOURNAL=90d, the tables without one being kept whole.
+// Purging sync runs purges the changes they recorded, the imports then no
+// longer being rolled back.
+var retentionTables = []struct {
+	table, column string
+}{
+	{"request_journal", "recorded_at"},
+	{"notifications", "created_at"},
+	{"sync_runs", "finished_at"},
+	{"team_usage", "day"},
+	{"developer_usage", "day"},
+}
+
+// RetentionPolicy is how long the rows of a table are kept, and how its last
+// purge went.
+type RetentionPolicy struct {
+	Table       string     `json:"table"`
+	Window      string     `json:"window"`
+	LastPurgeAt *time.Time `json:"last_purge_at"`
+	LastPurged  int64      `json:"last_purged"`
+	LastError   string     `json:"last_error,omitempty"`
+
+	column string
+	window time.Duration
+}
+
+// parseRetentionWindow reads a window as days, "90d", or as a duration.
+func parseRetentionWindow(v string) (time.Duration, error) {
+	var d time.Duration
+	if days := strings.TrimSuffix(v, "d"); days != v {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, err
+		}
+	}
+	if d <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return d, nil
+}
+
+// Repository
+type RetentionRepository interface {
+	// Purge deletes up to limit rows of table whose column is before the
+	// given time, returning how many it deleted.
+	Purge(ctx context.Context, table, column string, before time.Time, limit uint64) (int64, error)
+}
+
+type retentionRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ RetentionRepository = &retentionRepo{}
+
+func NewRetentionRepo(db *sql.DB, dialect migrations.Dialect) *retentionRepo {
+	return &retentionRepo{db: db, dialect: dialect}
+}
+
+func (rr *retentionRepo) Purge(ctx context.Context, table, column string, before time.Time, limit uint64) (int64, error) {
+	// table and column only ever come from retentionTables
+	row := "ctid"
+	if rr.dialect == migrations.SQLite {
+		row = "rowid"
+	}
+	res, err := squirrel.Delete(table).
+		Where(squirrel.Expr(fmt.Sprintf("%s IN (SELECT %[1]s FROM %s WHERE %s < ? LIMIT ?)", row, table, column), before, limit)).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(rr.db).ExecContext(ctx)
+	if err != nil {
+		return 0, wrapErr(table, "", "purge expired rows", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapErr(table, "", "purge expired rows", err)
+	}
+	return n, nil
+}
+
+// retentionPurger deletes the expired rows of the tables with a window every
+// interval.
+type retentionPurger struct {
+	repo     RetentionRepository
+	interval time.Duration
+
+	mu       sync.Mutex
+	policies []*RetentionPolicy
+	// purging keeps a purge asked for by an admin off the scheduled one
+	purging sync.Mutex
+}
+
+// retentionFromEnv reads the windows of the tables, and RETENTION_INTERVAL,
+// an hour unless set. It returns nil when no table has a window.
+func retentionFromEnv(repo RetentionRepository) (*retentionPurger, error) {
+	rp := &retentionPurger{repo: repo, interval: defaultRetentionInterval}
+	for _, t := range retentionTables {
+		name := "RETENTION_" + strings.ToUpper(t.table)
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		window, err := parseRetentionWindow(v)
+		if err != nil {
+			return nil, fmt.Errorf("retention: invalid %s: %v", name, err)
+		}
+		rp.policies = append(rp.policies, &RetentionPolicy{Table: t.table, Window: v, column: t.column, window: window})
+	}
+	if len(rp.policies) == 0 {
+		return nil, nil
+	}
+	if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+		var err error
+		if rp.interval, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("retention: invalid RETENTION_INTERVAL: %w", err)
+		}
+	}
+	return rp, nil
+}
+
+// Run purges every interval until ctx is done.
+func (rp *retentionPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(rp.interval)
+	defer ticker.Stop()
+	for {
+		if err := rp.Purge(ctx); err != nil {
+			logger.Error().Err(err).Msg("retention: purge failed")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge deletes the expired rows of every table with a window, in batches,
+// going on with the other tables when one fails. It returns the first
+// failure.
+func (rp *retentionPurger) Purge(ctx context.Context) error {
+	rp.purging.Lock()
+	defer rp.purging.Unlock()
+
+	var first error
+	for _, p := range rp.policies {
+		now := time.Now()
+		before := now.Add(-p.window)
+		var purged int64
+		var err error
+		for {
+			var n int64
+			if n, err = rp.purgeBatch(ctx, p, before); err != nil {
+				break
+			}
+			purged += n
+			if n < retentionBatch {
+				break
+			}
+		}
+
+		rp.mu.Lock()
+		p.LastPurgeAt, p.LastPurged, p.LastError = &now, purged, ""
+		if err != nil {
+			p.LastError = err.Error()
+		}
+		rp.mu.Unlock()
+		if err != nil && first == nil {
+			first = err
+		}
+		if purged > 0 {
+			logger.Info().Str("table", p.Table).Int64("purged", purged).Msg("retention: purged expired rows")
+		}
+	}
+	return first
+}
+
+// purgeBatch deletes a batch of the expired rows of p, under its own deadline.
+func (rp *retentionPurger) purgeBatch(ctx context.Context, p *RetentionPolicy, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, retentionBatchTimeout)
+	defer cancel()
+	return rp.repo.Purge(ctx, p.Table, p.column, before, retentionBatch)
+}
+
+// Policies returns a copy of the policies as they are.
+func (rp *retentionPurger) Policies() []*RetentionPolicy {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	ps := make([]*RetentionPolicy, len(rp.policies))
+	for i, p := range rp.policies {
+		cp := *p
+		ps[i] = &cp
+	}
+	return ps
+}
+
+// handler
+type retentionService struct {
+	purger *retentionPurger
+	jobs   *jobRunner
+}
+
+func NewRetentionService(purger *retentionPurger, jobs *jobRunner) *retentionService {
+	return &retentionService{purger: purger, jobs: jobs}
+}
+
+func (rA *retentionService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// Policies answers the retention window of every table with one, and how
+// its last purge went.
+func (rA *retentionService) Policies(c echo.Context) error {
+	if rA.purger == nil {
+		return c.JSON(http.StatusNotFound, rA.errMessage(errRetentionOff.Error()))
+	}
+	return c.JSON(http.StatusOK, map[string][]*RetentionPolicy{"retention": rA.purger.Policies()})
+}
+
+// Purge purges the expired rows now, as a job, without waiting for the next
+// scheduled purge.
+func (rA *retentionService) Purge(c echo.Context) error {
+	if rA.purger == nil {
+		return c.JSON(http.StatusNotFound, rA.errMessage(errRetentionOff.Error()))
+	}
+	job := rA.jobs.Submit(func(ctx context.Context) (interface{}, error) {
+		if err := rA.purger.Purge(ctx); err != nil {
+			return nil, err
+		}
+		return map[string][]*RetentionPolicy{"retention": rA.purger.Policies()}, nil
+	})
+	return acceptJob(c, job)
+}
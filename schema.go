@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// schema describes the JSON shape of a response body. It is derived from the
+// data model structs so that it can never drift from what the handlers encode.
+type schema struct {
+	Type       string             `json:"type"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Properties map[string]*schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *schema            `json:"items,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaOf(t reflect.Type) *schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s *schema
+	switch {
+	case t == timeType:
+		s = &schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.String:
+		s = &schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		s = &schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = &schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		s = &schema{Type: "array", Items: schemaOf(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case t.Kind() == reflect.Map:
+		s = &schema{Type: "object", Nullable: true}
+	case t.Kind() == reflect.Struct:
+		s = &schema{Type: "object", Properties: map[string]*schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, omitempty := jsonFieldName(f)
+			if name == "" {
+				continue
+			}
+			s.Properties[name] = schemaOf(f.Type)
+			if !omitempty {
+				s.Required = append(s.Required, name)
+			}
+		}
+	default:
+		s = &schema{}
+	}
+	s.Nullable = s.Nullable || nullable
+	return s
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// responseSchemas maps the top-level keys handlers wrap their payload in to
+// the schema of the value under that key.
+var responseSchemas = map[string]*schema{
+	"country":                schemaOf(reflect.TypeOf(Country{})),
+	"province":               schemaOf(reflect.TypeOf(Province{})),
+	"provinces":              schemaOf(reflect.TypeOf(Provinces{})),
+	"district":               schemaOf(reflect.TypeOf(District{})),
+	"districts":              schemaOf(reflect.TypeOf(Districts{})),
+	"history":                schemaOf(reflect.TypeOf(History{})),
+	"countries":              schemaOf(reflect.TypeOf(Countries{})),
+	"job":                    schemaOf(reflect.TypeOf(Job{})),
+	"alias":                  schemaOf(reflect.TypeOf(Alias{})),
+	"aliases":                schemaOf(reflect.TypeOf(Aliases{})),
+	"metric":                 schemaOf(reflect.TypeOf(Metric{})),
+	"metrics":                schemaOf(reflect.TypeOf(Metrics{})),
+	"value":                  schemaOf(reflect.TypeOf(MetricValue{})),
+	"notifications":          schemaOf(reflect.TypeOf(Notifications{})),
+	"violations":             schemaOf(reflect.TypeOf(Violations{})),
+	"push_subscription":      schemaOf(reflect.TypeOf(PushSubscription{})),
+	"vapid_public_key":       {Type: "string"},
+	"case_definition":        schemaOf(reflect.TypeOf(CaseDefinition{})),
+	"case_definitions":       schemaOf(reflect.TypeOf(CaseDefinitions{})),
+	"mortality":              schemaOf(reflect.TypeOf(MortalityMonth{})),
+	"excess_mortality":       schemaOf(reflect.TypeOf(ExcessMortality{})),
+	"wastewater_sample":      schemaOf(reflect.TypeOf(WastewaterSample{})),
+	"wastewater_samples":     schemaOf(reflect.TypeOf(WastewaterSamples{})),
+	"wastewater_trend":       schemaOf(reflect.TypeOf(WastewaterTrend{})),
+	"sequencing_submission":  schemaOf(reflect.TypeOf(SequencingSubmission{})),
+	"sequencing_submissions": schemaOf(reflect.TypeOf(SequencingSubmissions{})),
+	"lineage_trend":          schemaOf(reflect.TypeOf(LineageTrend{})),
+	"outbreak":               schemaOf(reflect.TypeOf(Outbreak{})),
+	"outbreaks":              schemaOf(reflect.TypeOf(Outbreaks{})),
+	"outbreak_summary":       schemaOf(reflect.TypeOf(OutbreakSummaries{})),
+	"supply":                 schemaOf(reflect.TypeOf(SupplyStock{})),
+	"supplies":               schemaOf(reflect.TypeOf(SupplyStocks{})),
+	"bed_occupancy":          schemaOf(reflect.TypeOf(BedOccupancy{})),
+	"bed_occupancies":        schemaOf(reflect.TypeOf(BedOccupancies{})),
+	"bed_projection":         schemaOf(reflect.TypeOf(BedProjection{})),
+	"hotline_day":            schemaOf(reflect.TypeOf(HotlineDay{})),
+	"hotline_days":           schemaOf(reflect.TypeOf(HotlineDays{})),
+	"hotline_trend":          schemaOf(reflect.TypeOf(HotlineTrend{})),
+	"frozen_country":         schemaOf(reflect.TypeOf(FrozenCountry{})),
+	"frozen_countries":       schemaOf(reflect.TypeOf(FrozenCountries{})),
+	"changelog":              schemaOf(reflect.TypeOf(Changelog{})),
+	"version":                schemaOf(reflect.TypeOf(Version{})),
+	"validation":             schemaOf(reflect.TypeOf(Validation{})),
+	"deployment":             schemaOf(reflect.TypeOf(Deployment{})),
+	"license":                schemaOf(reflect.TypeOf(License{})),
+	"ready":                  schemaOf(reflect.TypeOf(Readiness{})),
+	"token":                  schemaOf(reflect.TypeOf(Token{})),
+	"user":                   schemaOf(reflect.TypeOf(User{})),
+	"users":                  schemaOf(reflect.TypeOf([]*User{})),
+	"journal":                schemaOf(reflect.TypeOf(Journal{})),
+	"sync_run":               schemaOf(reflect.TypeOf(SyncRun{})),
+	"team":                   schemaOf(reflect.TypeOf(Team{})),
+	"teams":                  schemaOf(reflect.TypeOf(Teams{})),
+	"team_key":               schemaOf(reflect.TypeOf(TeamKey{})),
+	"embargo":                schemaOf(reflect.TypeOf(KeyEmbargo{})),
+	"embed_token":            schemaOf(reflect.TypeOf(EmbedToken{})),
+	"backfill":               schemaOf(reflect.TypeOf(BackfillReport{})),
+	"retention":              schemaOf(reflect.TypeOf([]*RetentionPolicy{})),
+	"developer_key":          schemaOf(reflect.TypeOf(DeveloperKey{})),
+	"usage":                  schemaOf(reflect.TypeOf(DeveloperUsageReport{})),
+	"data":                   {Type: "object"},
+	"errors":                 {Type: "array", Items: &schema{Type: "object"}},
+	"meta":                   schemaOf(reflect.TypeOf(ResponseMeta{})),
+	"error":                  {Type: "string"},
+	"success":                {Type: "string"},
+}
+
+func (s *schema) validate(path string, v interface{}) []string {
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: unexpected null", path)}
+	}
+
+	var violations []string
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %T", path, v)}
+		}
+		if s.Properties == nil {
+			return nil
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				violations = append(violations, fmt.Sprintf("%s.%s: missing required field", path, name))
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				violations = append(violations, fmt.Sprintf("%s.%s: field not in schema", path, name))
+				continue
+			}
+			violations = append(violations, prop.validate(path+"."+name, obj[name])...)
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %T", path, v)}
+		}
+		for i, item := range arr {
+			violations = append(violations, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected string, got %T", path, v)}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				violations = append(violations, fmt.Sprintf("%s: invalid date-time %q", path, str))
+			}
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return []string{fmt.Sprintf("%s: expected integer, got %v", path, v)}
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return []string{fmt.Sprintf("%s: expected number, got %T", path, v)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected boolean, got %T", path, v)}
+		}
+	}
+	return violations
+}
+
+// rawResponses are routes serving a document of another format, or a stream,
+// rather than the API envelope, left out of validation.
+var rawResponses = map[string]bool{"/api/v1/openapi.json": true, "/ws": true, "/api/v1/stream": true, "/metrics": true, "/api/v1/export/xlsx": true}
+
+// validateResponse is a body dump handler that checks JSON responses against
+// responseSchemas and logs every violation. It never alters the response.
+func validateResponse(c echo.Context, reqBody, resBody []byte) {
+	if !strings.HasPrefix(c.Response().Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) || rawResponses[c.Path()] {
+		return
+	}
+	// the schemas describe the keyed envelope
+	if envelope, _ := c.Get("envelope").(string); envelope != "" && envelope != EnvelopeKeyed {
+		return
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(resBody, &body); err != nil {
+		logFor(c.Request().Context()).Warn().Err(err).Msg("schema: response is not a JSON object")
+		return
+	}
+
+	var violations []string
+	for key, v := range body {
+		s, ok := responseSchemas[key]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s: unknown response key", key))
+			continue
+		}
+		violations = append(violations, s.validate(key, v)...)
+	}
+	for _, v := range violations {
+		logFor(c.Request().Context()).Warn().Str("violation", v).Msg("schema: response does not match")
+	}
+}
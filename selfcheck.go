@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// migrationsDir holds the migrations shipped with the release, relative to
+// the working directory the slug runs in.
+const migrationsDir = "migrations"
+
+var errReadOnly = errors.New("Error: Service is read-only until the database schema is migrated")
+
+// Readiness is what /readyz reports.
+type Readiness struct {
+	Ready bool `json:"ready"`
+	// Problems lists the schema drift found, empty when ready.
+	Problems  []string  `json:"problems"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// selfCheck compares the database with the migrations, on boot and on every
+// /readyz, so that a half-migrated database is refused or served read-only
+// instead of answering with 500s.
+type selfCheck struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+	dir     string
+
+	mu    sync.Mutex
+	state Readiness
+}
+
+func newSelfCheck(db *sql.DB, dialect migrations.Dialect, dir string) *selfCheck {
+	return &selfCheck{db: db, dialect: dialect, dir: dir}
+}
+
+func (sc *selfCheck) Check(ctx context.Context) (Readiness, error) {
+	problems, err := migrations.Drift(ctx, sc.db, sc.dialect, sc.dir)
+	if err != nil {
+		return Readiness{}, err
+	}
+	r := Readiness{Ready: len(problems) == 0, Problems: problems, CheckedAt: time.Now()}
+	if r.Problems == nil {
+		r.Problems = make([]string, 0)
+	}
+	sc.mu.Lock()
+	sc.state = r
+	sc.mu.Unlock()
+	return r, nil
+}
+
+func (sc *selfCheck) ready() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.state.Ready
+}
+
+// ReadOnly rejects writes while the last check found drift.
+func (sc *selfCheck) ReadOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return next(c)
+		}
+		if !sc.ready() {
+			return c.JSON(http.StatusServiceUnavailable, &ErrorMsg{errReadOnly.Error()})
+		}
+		return next(c)
+	}
+}
+
+// Readyz answers 200 once the database is reachable and matches the
+// migrations, 503 with the problems found otherwise.
+func (sc *selfCheck) Readyz(c echo.Context) error {
+	ctx := c.Request().Context()
+	if err := sc.db.PingContext(ctx); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]*Readiness{"ready": {
+			Problems: []string{"database is unreachable"}, CheckedAt: time.Now()}})
+	}
+	r, err := sc.Check(ctx)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]*Readiness{"ready": {
+			Problems: []string{"schema could not be checked"}, CheckedAt: time.Now()}})
+	}
+	if !r.Ready {
+		return c.JSON(http.StatusServiceUnavailable, map[string]*Readiness{"ready": &r})
+	}
+	return c.JSON(http.StatusOK, map[string]*Readiness{"ready": &r})
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+var gisaidAccession = regexp.MustCompile(`^EPI_ISL_[0-9]+$`)
+
+// SequencingSubmission is a genome sequenced by a lab, with the lineage it
+// was called as and the GISAID accession it was deposited under, if any.
+type SequencingSubmission struct {
+	ID              string    `json:"id"`
+	Lab             string    `json:"lab"`
+	SampleDate      time.Time `json:"sample_date"`
+	Lineage         string    `json:"lineage"`
+	GISAIDAccession string    `json:"gisaid_accession"`
+	CaseID          string    `json:"case_id"`
+	ProvinceID      string    `json:"province_id"`
+	DistrictID      string    `json:"district_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type SequencingSubmissions []*SequencingSubmission
+
+func (s *SequencingSubmission) Prepare() {
+	s.Lab = html.EscapeString(strings.TrimSpace(s.Lab))
+	s.Lineage = strings.ToUpper(strings.TrimSpace(s.Lineage))
+	s.GISAIDAccession = strings.ToUpper(strings.TrimSpace(s.GISAIDAccession))
+	s.CaseID = strings.TrimSpace(s.CaseID)
+	s.ProvinceID = strings.TrimSpace(s.ProvinceID)
+	s.DistrictID = strings.TrimSpace(s.DistrictID)
+}
+
+func (s *SequencingSubmission) BeforeSave() {
+	s.ID = uuid.NewV4().String()
+}
+
+func (s *SequencingSubmission) Validate() error {
+	if s.Lab == "" {
+		return errors.New("sequencing: lab is required")
+	}
+	if s.Lineage == "" {
+		return errors.New("sequencing: lineage is required")
+	}
+	if s.ProvinceID == "" {
+		return errors.New("sequencing: province_id is required")
+	}
+	if s.SampleDate.IsZero() {
+		return errors.New("sequencing: sample_date is required")
+	}
+	if s.GISAIDAccession != "" && !gisaidAccession.MatchString(s.GISAIDAccession) {
+		return errors.New("sequencing: gisaid_accession must look like EPI_ISL_123456")
+	}
+	return nil
+}
+
+// LineageWeek is how many of a province's sequences taken in the week
+// starting on Week were called as Lineage, and their share of the week.
+type LineageWeek struct {
+	Week      time.Time `json:"week"`
+	Lineage   string    `json:"lineage"`
+	Sequences int64     `json:"sequences"`
+	Share     float64   `json:"share"`
+}
+
+type LineageTrend []*LineageWeek
+
+// Repository
+type SequencingRepository interface {
+	Save(ctx context.Context, s *SequencingSubmission) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*SequencingSubmission, error)
+	GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (SequencingSubmissions, error)
+	LineageTrend(ctx context.Context, provinceID string, from, to time.Time) (LineageTrend, error)
+}
+
+type sequencingRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ SequencingRepository = &sequencingRepo{}
+
+func NewSequencingRepo(db *sql.DB, dialect migrations.Dialect) *sequencingRepo {
+	return &sequencingRepo{db: db, dialect: dialect}
+}
+
+func (sr *sequencingRepo) Save(ctx context.Context, s *SequencingSubmission) error {
+	// an empty accession is stored as NULL so that it stays out of the
+	// unique constraint
+	var accession sql.NullString
+	if s.GISAIDAccession != "" {
+		accession = sql.NullString{String: s.GISAIDAccession, Valid: true}
+	}
+	if _, err := squirrel.Insert("sequencing_submissions").
+		Columns("id", "lab", "sample_date", "lineage", "gisaid_accession", "case_id", "province_id", "district_id", "created_at").
+		Values(&s.ID, &s.Lab, &s.SampleDate, &s.Lineage, accession, &s.CaseID, &s.ProvinceID, &s.DistrictID, &s.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ExecContext(ctx); err != nil {
+		return wrapErr("sequencing submission", s.ID, "insert sequencing submission", err)
+	}
+	return nil
+}
+
+func (sr *sequencingRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("sequencing_submissions").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("sequencing submission", id, "delete sequencing submission", err)
+	}
+	return wrapErr("sequencing submission", id, "delete sequencing submission", affectedOne(res))
+}
+
+var sequencingColumns = []string{"id", "lab", "sample_date", "lineage", "COALESCE(gisaid_accession, '')", "case_id", "province_id", "district_id", "created_at"}
+
+func (s *SequencingSubmission) scanDest() []interface{} {
+	return []interface{}{&s.ID, &s.Lab, &s.SampleDate, &s.Lineage, &s.GISAIDAccession, &s.CaseID, &s.ProvinceID, &s.DistrictID, &s.CreatedAt}
+}
+
+func (sr *sequencingRepo) GetByID(ctx context.Context, id string) (*SequencingSubmission, error) {
+	var s SequencingSubmission
+	err := squirrel.Select(sequencingColumns...).
+		From("sequencing_submissions").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ScanContext(ctx, s.scanDest()...)
+	if err != nil {
+		return nil, wrapErr("sequencing submission", id, "select sequencing submission", err)
+	}
+	return &s, nil
+}
+
+func (sr *sequencingRepo) GetByProvince(ctx context.Context, provinceID string, from, to time.Time) (SequencingSubmissions, error) {
+	rows, err := squirrel.Select(sequencingColumns...).
+		From("sequencing_submissions").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"sample_date": from}).
+		Where(squirrel.LtOrEq{"sample_date": to}).
+		OrderBy("sample_date", "id").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select sequencing submissions", err)
+	}
+	defer rows.Close()
+
+	var ss = make(SequencingSubmissions, 0)
+	for rows.Next() {
+		var s SequencingSubmission
+		if err := rows.Scan(s.scanDest()...); err != nil {
+			return nil, wrapErr("province", provinceID, "scan sequencing submissions", err)
+		}
+		ss = append(ss, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select sequencing submissions", err)
+	}
+	return ss, nil
+}
+
+func (sr *sequencingRepo) LineageTrend(ctx context.Context, provinceID string, from, to time.Time) (LineageTrend, error) {
+	rows, err := squirrel.Select(weekOf(sr.dialect, "sample_date")+" AS week", "lineage", "COUNT(*)",
+		"SUM(COUNT(*)) OVER (PARTITION BY date_trunc('week', sample_date))").
+		From("sequencing_submissions").
+		Where(squirrel.Eq{"province_id": provinceID}).
+		Where(squirrel.GtOrEq{"sample_date": from}).
+		Where(squirrel.LtOrEq{"sample_date": to}).
+		GroupBy("week", "lineage").
+		OrderBy("week", "COUNT(*) DESC", "lineage").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("province", provinceID, "select lineage trend", err)
+	}
+	defer rows.Close()
+
+	var trend = make(LineageTrend, 0)
+	for rows.Next() {
+		var lw LineageWeek
+		var weekTotal int64
+		if err := rows.Scan(&lw.Week, &lw.Lineage, &lw.Sequences, &weekTotal); err != nil {
+			return nil, wrapErr("province", provinceID, "scan lineage trend", err)
+		}
+		lw.Share = math.Round(float64(lw.Sequences)/float64(weekTotal)*10000) / 100
+		trend = append(trend, &lw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("province", provinceID, "select lineage trend", err)
+	}
+	return trend, nil
+}
+
+// handler
+type sequencingService struct {
+	sApp SequencingRepository
+}
+
+func NewSequencingService(sApp SequencingRepository) *sequencingService {
+	return &sequencingService{sApp: sApp}
+}
+
+func (sA *sequencingService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (sA *sequencingService) Store(c echo.Context) error {
+	var s SequencingSubmission
+	if err := c.Bind(&s); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, sA.errMessage("request: unable to parse request payload"))
+	}
+	s.Prepare()
+	if err := s.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, sA.errMessage(err.Error()))
+	}
+	if err := authorizeProvince(c.Request().Context(), s.ProvinceID); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	s.BeforeSave()
+	s.CreatedAt = time.Now()
+
+	if err := sA.sApp.Save(c.Request().Context(), &s); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*SequencingSubmission{"sequencing_submission": &s})
+}
+
+func (sA *sequencingService) FindBySubmissionID(c echo.Context) error {
+	s, err := sA.sApp.GetByID(c.Request().Context(), c.Param("submission_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*SequencingSubmission{"sequencing_submission": s})
+}
+
+func (sA *sequencingService) Delete(c echo.Context) error {
+	s, err := sA.sApp.GetByID(c.Request().Context(), c.Param("submission_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	if err := authorizeProvince(c.Request().Context(), s.ProvinceID); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	if err := sA.sApp.Delete(c.Request().Context(), s.ID); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (sA *sequencingService) ListByProvince(c echo.Context) error {
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, sA.errMessage(err.Error()))
+	}
+	if err := checkDays(from, to, maxRecordDays); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, sA.errMessage(err.Error()))
+	}
+	ss, err := sA.sApp.GetByProvince(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]SequencingSubmissions{"sequencing_submissions": ss})
+}
+
+func (sA *sequencingService) LineageTrend(c echo.Context) error {
+	from, to, err := dayRange(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, sA.errMessage(err.Error()))
+	}
+	if err := checkWeeks(from, to, maxTrendWeeks); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, sA.errMessage(err.Error()))
+	}
+	trend, err := sA.sApp.LineageTrend(c.Request().Context(), c.Param("province_id"), from, to)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]LineageTrend{"lineage_trend": trend})
+}
+
+// dayRange reads ?from= and ?to= as YYYY-MM-DD, defaulting to the last 90
+// days.
+func dayRange(c echo.Context) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -89)
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return from, to, errors.New("request: from must be formatted as YYYY-MM-DD")
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return from, to, errors.New("request: to must be formatted as YYYY-MM-DD")
+		}
+		to = t
+	}
+	if to.Before(from) {
+		return from, to, errors.New("request: to must not be before from")
+	}
+	return from, to, nil
+}
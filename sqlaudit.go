@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAuditExplainCost = 1000
+
+// auditDriverFromEnv wraps next when SQL_AUDIT=true, meant for development,
+// to log every statement with its arguments and the plan of the queries whose
+// estimated cost is above SQL_AUDIT_EXPLAIN_COST.
+func auditDriverFromEnv(next driver.Driver) (driver.Driver, error) {
+	if os.Getenv("SQL_AUDIT") != "true" {
+		return next, nil
+	}
+	cost := float64(defaultAuditExplainCost)
+	if v := os.Getenv("SQL_AUDIT_EXPLAIN_COST"); v != "" {
+		var err error
+		if cost, err = strconv.ParseFloat(v, 64); err != nil || cost < 0 {
+			return nil, fmt.Errorf("sql audit: invalid SQL_AUDIT_EXPLAIN_COST %q", v)
+		}
+	}
+	return &auditDriver{next: next, explainCost: cost, out: os.Stdout}, nil
+}
+
+// auditDriver wraps the postgres driver, logging the statements run through
+// it. Prepared statements are logged when prepared, without their arguments.
+type auditDriver struct {
+	next        driver.Driver
+	explainCost float64
+	out         io.Writer
+}
+
+func (ad *auditDriver) Open(name string) (driver.Conn, error) {
+	conn, err := ad.next.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &auditConn{Conn: conn, driver: ad}, nil
+}
+
+// auditConn is a postgres connection, which implements the context aware
+// interfaces asserted below.
+type auditConn struct {
+	driver.Conn
+	driver *auditDriver
+}
+
+func (ac *auditConn) Prepare(query string) (driver.Stmt, error) {
+	fmt.Fprintf(ac.driver.out, "sql: prepare %s\n", query)
+	return ac.Conn.Prepare(query)
+}
+
+func (ac *auditConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return ac.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (ac *auditConn) Ping(ctx context.Context) error {
+	return ac.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (ac *auditConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if isExplainable(query) {
+		ac.explain(ctx, query, args)
+	}
+	start := time.Now()
+	rows, err := ac.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	ac.log(query, args, time.Since(start), err)
+	return rows, err
+}
+
+func (ac *auditConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := ac.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	ac.log(query, args, time.Since(start), err)
+	return res, err
+}
+
+func (ac *auditConn) log(query string, args []driver.NamedValue, took time.Duration, err error) {
+	values := make([]string, len(args))
+	for i, a := range args {
+		values[i] = auditValue(a.Value)
+	}
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	fmt.Fprintf(ac.driver.out, "sql: %s [%s] %s %s\n", query, strings.Join(values, ", "), took, result)
+}
+
+// explain logs the plan of query when its estimated cost is above the
+// threshold. A failing EXPLAIN is only logged, the query then failing the
+// same way.
+func (ac *auditConn) explain(ctx context.Context, query string, args []driver.NamedValue) {
+	rows, err := ac.Conn.(driver.QueryerContext).QueryContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args)
+	if err != nil {
+		fmt.Fprintf(ac.driver.out, "sql: explain failed: %v\n", err)
+		return
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	if err := rows.Next(dest); err != nil {
+		fmt.Fprintf(ac.driver.out, "sql: explain failed: %v\n", err)
+		return
+	}
+	var plan []byte
+	switch v := dest[0].(type) {
+	case []byte:
+		plan = v
+	case string:
+		plan = []byte(v)
+	}
+
+	cost, err := planCost(plan)
+	if err != nil {
+		fmt.Fprintf(ac.driver.out, "sql: explain failed: %v\n", err)
+		return
+	}
+	if cost > ac.driver.explainCost {
+		fmt.Fprintf(ac.driver.out, "sql: cost %.2f above %.2f for %s\nsql: plan %s\n", cost, ac.driver.explainCost, query, plan)
+	}
+}
+
+// planCost is the total cost estimated by a JSON plan.
+func planCost(plan []byte) (float64, error) {
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &plans); err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("empty plan")
+	}
+	return plans[0].Plan.TotalCost, nil
+}
+
+// isExplainable tells the queries worth a plan, leaving out the ones the
+// audit runs itself.
+func isExplainable(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "SELECT") || strings.HasPrefix(q, "WITH")
+}
+
+// auditValue formats an argument for the log, quoting text.
+func auditValue(v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		return strconv.Quote(string(v))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var (
+	_ driver.QueryerContext = &auditConn{}
+	_ driver.ExecerContext  = &auditConn{}
+	_ driver.ConnBeginTx    = &auditConn{}
+	_ driver.Pinger         = &auditConn{}
+)
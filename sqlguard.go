@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// the driver name of the postgres driver with the checks below
+const guardedDriverName = "postgres-guarded"
+
+// what a database call without a deadline gets, SQL_DEADLINES
+const (
+	DeadlinesEnforce = "enforce"
+	DeadlinesWarn    = "warn"
+)
+
+// sqlDriverFromEnv registers the driver the databases are opened with and
+// returns its name: postgres, audited with SQL_AUDIT, failing calls whose
+// context is done before they reach the database and, unless SQL_DEADLINES
+// is warn, calls whose context has no deadline.
+func sqlDriverFromEnv() (string, error) {
+	d, err := auditDriverFromEnv(pq.Driver{})
+	if err != nil {
+		return "", err
+	}
+	gd, err := guardFromEnv(d, migrations.Postgres)
+	if err != nil {
+		return "", err
+	}
+	sql.Register(guardedDriverName, gd)
+	return guardedDriverName, nil
+}
+
+// guardFromEnv wraps next, a driver of dialect, in the checks of
+// SQL_DEADLINES.
+func guardFromEnv(next driver.Driver, dialect migrations.Dialect) (*guardDriver, error) {
+	mode := os.Getenv("SQL_DEADLINES")
+	if mode == "" {
+		mode = DeadlinesEnforce
+	}
+	if mode != DeadlinesEnforce && mode != DeadlinesWarn {
+		return nil, fmt.Errorf("sql: SQL_DEADLINES must be %s or %s", DeadlinesEnforce, DeadlinesWarn)
+	}
+	return &guardDriver{next: next, enforce: mode == DeadlinesEnforce, system: sqlSystem(dialect)}, nil
+}
+
+// guardDriver checks the context of every call before handing it to next,
+// so that queries are not left running for clients that went away.
+type guardDriver struct {
+	next    driver.Driver
+	enforce bool
+	// system names the database of the spans, see sqlSystem
+	system string
+}
+
+func (gd *guardDriver) Open(name string) (driver.Conn, error) {
+	conn, err := gd.next.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &guardConn{Conn: conn, driver: gd}, nil
+}
+
+type guardConn struct {
+	driver.Conn
+	driver *guardDriver
+}
+
+// check fails calls whose ctx is done, and those without a deadline when
+// enforced, naming the function they come from.
+func (gc *guardConn) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return nil
+	}
+	err := fmt.Errorf("sql: call without a deadline from %s", sqlCaller())
+	if gc.driver.enforce {
+		return err
+	}
+	logFor(ctx).Warn().Err(err).Msg("sql: no deadline")
+	return nil
+}
+
+// sqlCaller is the first function of the application up the stack, outside
+// of the drivers.
+func sqlCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, "main.") &&
+			!strings.HasPrefix(f.Function, "main.(*guardConn)") &&
+			!strings.HasPrefix(f.Function, "main.(*auditConn)") {
+			return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func (gc *guardConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := gc.check(ctx); err != nil {
+		return nil, err
+	}
+	return gc.Conn.Prepare(query)
+}
+
+func (gc *guardConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := gc.check(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := gc.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	logSQLError(ctx, "BEGIN", err)
+	if err != nil || spanFrom(ctx) == nil {
+		return tx, err
+	}
+	return &tracedTx{Tx: tx, ctx: ctx, system: gc.driver.system}, nil
+}
+
+func (gc *guardConn) Ping(ctx context.Context) error {
+	if err := gc.check(ctx); err != nil {
+		return err
+	}
+	return gc.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (gc *guardConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := gc.check(ctx); err != nil {
+		return nil, err
+	}
+	_, s := startSQLSpan(ctx, gc.driver.system, query)
+	rows, err := gc.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	s.finish(err)
+	logSQLError(ctx, query, err)
+	return rows, err
+}
+
+func (gc *guardConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := gc.check(ctx); err != nil {
+		return nil, err
+	}
+	_, s := startSQLSpan(ctx, gc.driver.system, query)
+	res, err := gc.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	s.finish(err)
+	logSQLError(ctx, query, err)
+	return res, err
+}
+
+var (
+	_ driver.ConnPrepareContext = &guardConn{}
+	_ driver.QueryerContext     = &guardConn{}
+	_ driver.ExecerContext      = &guardConn{}
+	_ driver.ConnBeginTx        = &guardConn{}
+	_ driver.Pinger             = &guardConn{}
+)
+
+// logSQLError logs the failure of query with the details postgres gave, to
+// the logger of the request it was made for. Calls whose context ran out
+// are left to the requests, which answer them.
+func logSQLError(ctx context.Context, query string, err error) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	ev := logFor(ctx).Error().Err(err).Str("query", query).Str("caller", sqlCaller())
+	if pqErr, ok := err.(*pq.Error); ok {
+		ev = ev.Str("sql_state", string(pqErr.Code)).
+			Str("detail", pqErr.Detail).
+			Str("table", pqErr.Table).
+			Str("constraint", pqErr.Constraint)
+	}
+	ev.Msg("sql: call failed")
+}
+
+// startSQLSpan starts the span of a statement to the database system,
+// named after its first keyword.
+func startSQLSpan(ctx context.Context, system, query string) (context.Context, *span) {
+	name := "SQL"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		name = strings.ToUpper(fields[0])
+	}
+	ctx, s := startSpan(ctx, name, spanKindClient)
+	s.setString("db.system", system)
+	s.setString("db.statement", query)
+	return ctx, s
+}
+
+// sqlSystem names the database of dialect in spans, as OpenTelemetry does.
+func sqlSystem(dialect migrations.Dialect) string {
+	if dialect == migrations.SQLite {
+		return "sqlite"
+	}
+	return "postgresql"
+}
+
+// tracedTx adds the span of the commit of a transaction of a traced
+// request.
+type tracedTx struct {
+	driver.Tx
+	ctx    context.Context
+	system string
+}
+
+func (tx *tracedTx) Commit() error {
+	_, s := startSpan(tx.ctx, "COMMIT", spanKindClient)
+	s.setString("db.system", tx.system)
+	err := tx.Tx.Commit()
+	s.finish(err)
+	return err
+}
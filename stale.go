@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const staleCacheMaxEntries = 1024
+
+// staleCache remembers the last successful response of read endpoints and
+// serves it, marked as stale, when the handler fails with a server error such
+// as the database being unavailable.
+type staleCache struct {
+	mu      sync.RWMutex
+	entries map[string]*staleEntry
+}
+
+type staleEntry struct {
+	contentType string
+	body        []byte
+	storedAt    time.Time
+}
+
+func newStaleCache() *staleCache {
+	return &staleCache{entries: make(map[string]*staleEntry)}
+}
+
+// bufferedWriter holds the response back so that a failed one can be replaced
+// before anything reaches the client.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (sc *staleCache) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// responses under embargo are the caller's own
+		if _, ok := embargoAt(c.Request().Context(), time.Now()); c.Request().Method != http.MethodGet || ok {
+			return next(c)
+		}
+
+		res := c.Response()
+		w := res.Writer
+		buf := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		res.Writer = buf
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		res.Writer = w
+
+		key := c.Request().URL.RequestURI()
+		if buf.status >= http.StatusInternalServerError {
+			if entry := sc.get(key); entry != nil {
+				res.Header().Set(echo.HeaderContentType, entry.contentType)
+				res.Header().Set("Warning", `110 - "Response is Stale"`)
+				res.Header().Set("X-Data-Stale", "true")
+				res.Header().Set("Age", strconv.Itoa(int(time.Since(entry.storedAt).Seconds())))
+				res.Status = http.StatusOK
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write(entry.body)
+				return err
+			}
+		}
+
+		if buf.status == http.StatusOK {
+			sc.put(key, &staleEntry{
+				contentType: res.Header().Get(echo.HeaderContentType),
+				body:        buf.body.Bytes(),
+				storedAt:    time.Now(),
+			})
+		}
+		w.WriteHeader(buf.status)
+		_, err := w.Write(buf.body.Bytes())
+		return err
+	}
+}
+
+func (sc *staleCache) get(key string) *staleEntry {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.entries[key]
+}
+
+func (sc *staleCache) put(key string, entry *staleEntry) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if _, ok := sc.entries[key]; !ok && len(sc.entries) >= staleCacheMaxEntries {
+		// evict an arbitrary entry, the cache only has to bound memory
+		for k := range sc.entries {
+			delete(sc.entries, k)
+			break
+		}
+	}
+	sc.entries[key] = entry
+}
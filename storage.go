@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/phuangpheth/covid19/config"
+	"github.com/phuangpheth/covid19/migrations"
+	"github.com/phuangpheth/covid19/storage"
+)
+
+// forUpdate has stm lock the rows it selects until the transaction ends.
+// SQLite locks the whole database for the transaction already.
+func forUpdate(dialect migrations.Dialect, stm squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if dialect == migrations.SQLite {
+		return stm
+	}
+	return stm.Suffix("FOR UPDATE")
+}
+
+// weekOf is the Monday of the week of the date or time of column, as a
+// date.
+func weekOf(dialect migrations.Dialect, column string) string {
+	if dialect == migrations.SQLite {
+		return "date_trunc('week', " + column + ")"
+	}
+	return "date_trunc('week', " + column + ")::date"
+}
+
+func init() {
+	storage.Register("postgres", openPostgres)
+}
+
+// openStorage opens the repositories of the backend cfg.Driver names, see
+// the storage package.
+func openStorage(ctx context.Context, cfg config.Database) (*Repository, error) {
+	b, err := storage.Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRepositories(b, time.Duration(cfg.HedgeAfter))
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// openPostgres connects to the database of cfg.URL, and to its replica when
+// set, through the driver of sqlDriverFromEnv.
+func openPostgres(ctx context.Context, cfg config.Database) (*storage.Backend, error) {
+	sqlDriver, err := sqlDriverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(sqlDriver, cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	setPoolSizes(db, cfg)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var replica *sql.DB
+	if cfg.ReplicaURL != "" {
+		if replica, err = sql.Open(sqlDriver, cfg.ReplicaURL); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		setPoolSizes(replica, cfg)
+	}
+	return &storage.Backend{DB: db, Replica: replica, Dialect: migrations.Postgres, Migrations: migrationsDir}, nil
+}
@@ -0,0 +1,93 @@
+// Package storage is the registry of the databases the API can keep its data
+// in. A backend registers from the init of its own file or package under the
+// name the database driver setting selects it by, so that adding one changes
+// neither the handlers nor main:
+//
+//	func init() {
+//		storage.Register("cockroach", openCockroach)
+//	}
+//
+// A backend opens a database/sql database speaking one of the dialects of
+// the migrations package, which the repositories write their SQL for.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/phuangpheth/covid19/config"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// Backend is an opened database.
+type Backend struct {
+	// DB is the database written to.
+	DB *sql.DB
+	// Replica, when set, serves the reads that may lag behind DB.
+	Replica *sql.DB
+	// Dialect is the SQL of DB, Migrations the directory of the migrations
+	// its schema is checked against.
+	Dialect    migrations.Dialect
+	Migrations string
+	// Keep, when set, is closed along with the backend, e.g. the connection
+	// holding a database in memory open.
+	Keep io.Closer
+}
+
+// Close closes the databases of b.
+func (b *Backend) Close() error {
+	if b.Keep != nil {
+		b.Keep.Close()
+	}
+	if b.Replica != nil {
+		b.Replica.Close()
+	}
+	return b.DB.Close()
+}
+
+// Opener opens the backend of cfg.
+type Opener func(ctx context.Context, cfg config.Database) (*Backend, error)
+
+var (
+	mu       sync.RWMutex
+	backends = map[string]Opener{}
+)
+
+// Register makes a backend available to the database driver setting under
+// name. It panics when name is taken.
+func Register(name string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic("storage: backend " + name + " registered twice")
+	}
+	backends[name] = open
+}
+
+// Drivers lists the names of the registered backends, sorted.
+func Drivers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the backend cfg.Driver names.
+func Open(ctx context.Context, cfg config.Database) (*Backend, error) {
+	mu.RLock()
+	open, ok := backends[cfg.Driver]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown driver %q, expected one of %s", cfg.Driver, strings.Join(Drivers(), ", "))
+	}
+	return open(ctx, cfg)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/phuangpheth/covid19/config"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+func TestOpenRegisteredBackend(t *testing.T) {
+	opened := &Backend{Dialect: migrations.SQLite, Migrations: "testdata"}
+	Register("test", func(ctx context.Context, cfg config.Database) (*Backend, error) {
+		if cfg.URL != "test://" {
+			t.Errorf("opened with %q", cfg.URL)
+		}
+		return opened, nil
+	})
+
+	b, err := Open(context.Background(), config.Database{Driver: "test", URL: "test://"})
+	if err != nil || b != opened {
+		t.Fatalf("Open = %v, %v", b, err)
+	}
+	if _, err := Open(context.Background(), config.Database{Driver: "unknown"}); err == nil || !strings.Contains(err.Error(), "test") {
+		t.Errorf("Open of an unknown driver = %v, want the drivers listed", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	Register("test", nil)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/config"
+	"github.com/phuangpheth/covid19/migrations"
+	"github.com/phuangpheth/covid19/storage"
+)
+
+// sqliteMigrationsDir holds the schema of the SQLite backends, which they
+// migrate themselves to when opened.
+var sqliteMigrationsDir = filepath.Join(migrationsDir, "sqlite")
+
+// the settings of every SQLite connection: foreign keys are enforced as in
+// postgres, and transactions take the write lock when they begin, so that
+// two of them never deadlock upgrading their locks.
+const sqliteParams = "_foreign_keys=on&_txlock=immediate&_busy_timeout=5000"
+
+func init() {
+	storage.Register("sqlite", openSQLite)
+	storage.Register("memory", openMemory)
+}
+
+// openSQLite opens the SQLite database file of cfg.URL, creating it when it
+// does not exist. It suits a single instance of the API, SQLite taking one
+// writer at a time.
+func openSQLite(ctx context.Context, cfg config.Database) (*storage.Backend, error) {
+	dsn := cfg.URL
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return openSQLiteDSN(ctx, cfg, dsn+sep+sqliteParams+"&_journal_mode=WAL")
+}
+
+// openMemory keeps the data in a SQLite database in memory, of its own and
+// lost when the process exits, for tests and demos.
+func openMemory(ctx context.Context, cfg config.Database) (*storage.Backend, error) {
+	// memdb databases are shared by the connections opening the same name,
+	// and dropped once the last of them is closed
+	b, err := openSQLiteDSN(ctx, cfg, "file:/"+uuid.NewV4().String()+"?vfs=memdb&"+sqliteParams)
+	if err != nil {
+		return nil, err
+	}
+	keep, err := b.DB.Conn(ctx)
+	if err != nil {
+		b.DB.Close()
+		return nil, err
+	}
+	b.Keep = keep
+	return b, nil
+}
+
+func openSQLiteDSN(ctx context.Context, cfg config.Database, dsn string) (*storage.Backend, error) {
+	if cfg.ReplicaURL != "" {
+		return nil, fmt.Errorf("storage: %s has no replicas", cfg.Driver)
+	}
+	gd, err := guardFromEnv(sqliteDriver, migrations.SQLite)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(&sqliteConnector{dsn: dsn, driver: gd})
+	setPoolSizes(db, cfg)
+	if _, err := migrations.Apply(ctx, db, migrations.SQLite, sqliteMigrationsDir); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &storage.Backend{DB: db, Dialect: migrations.SQLite, Migrations: sqliteMigrationsDir}, nil
+}
+
+// sqliteConnector opens connections to dsn, database/sql not knowing the
+// driver by a name.
+type sqliteConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (sc *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return sc.driver.Open(sc.dsn)
+}
+
+func (sc *sqliteConnector) Driver() driver.Driver {
+	return sc.driver
+}
+
+// sqliteDriver is SQLite with the functions of postgres the repositories use
+// and it lacks, its times kept in UTC.
+var sqliteDriver driver.Driver = sqliteTimes{&sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterFunc("date_trunc", sqliteDateTrunc, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("patch_attributes", sqlitePatchAttributes, true)
+}}}
+
+// sqliteDateTrunc is date_trunc of postgres for the day, week and month of
+// a date or time, as a date.
+func sqliteDateTrunc(unit, value string) (string, error) {
+	if len(value) < len(dateLayout) {
+		return "", fmt.Errorf("date_trunc: invalid date %q", value)
+	}
+	day, err := time.Parse(dateLayout, value[:len(dateLayout)])
+	if err != nil {
+		return "", fmt.Errorf("date_trunc: %w", err)
+	}
+	switch unit {
+	case "day":
+	case "week":
+		// weeks start on Monday, as in ISO 8601
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		day = day.AddDate(0, 0, 1-day.Day())
+	default:
+		return "", fmt.Errorf("date_trunc: unsupported unit %q", unit)
+	}
+	return day.Format(dateLayout), nil
+}
+
+// sqlitePatchAttributes is (attributes || set) - remove of postgres, set
+// being a JSON object and remove an array in the text format of postgres.
+func sqlitePatchAttributes(attributes, set, remove string) (string, error) {
+	var a, patch Attributes
+	if err := json.Unmarshal([]byte(attributes), &a); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(set), &patch); err != nil {
+		return "", err
+	}
+	var keys pq.StringArray
+	if err := keys.Scan(remove); err != nil {
+		return "", err
+	}
+	for _, k := range keys {
+		patch[k] = nil
+	}
+	b, err := json.Marshal(a.merge(patch))
+	return string(b), err
+}
+
+// sqliteTimes stores the times it is given in UTC, as text that sorts in
+// time order, midnight being stored as a date so that times and dates
+// compare equal on the columns of days. It reads the dates and times that
+// expressions return, which SQLite has no type for, as times, the way the
+// columns of those types are read.
+type sqliteTimes struct {
+	driver.Driver
+}
+
+func (st sqliteTimes) Open(name string) (driver.Conn, error) {
+	conn, err := st.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (sc *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := sc.SQLiteConn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStmt{stmt.(*sqlite3.SQLiteStmt)}, nil
+}
+
+func (sc *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := sc.SQLiteConn.QueryContext(ctx, query, sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+func (sc *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return sc.SQLiteConn.ExecContext(ctx, query, sqliteArgs(args))
+}
+
+type sqliteStmt struct {
+	*sqlite3.SQLiteStmt
+}
+
+func (ss *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := ss.SQLiteStmt.QueryContext(ctx, sqliteArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteRows{rows.(*sqlite3.SQLiteRows)}, nil
+}
+
+func (ss *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return ss.SQLiteStmt.ExecContext(ctx, sqliteArgs(args))
+}
+
+// sqliteArgs formats the times of args.
+func sqliteArgs(args []driver.NamedValue) []driver.NamedValue {
+	converted := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		if t, ok := a.Value.(time.Time); ok {
+			t = t.UTC()
+			if t.Equal(t.Truncate(24 * time.Hour)) {
+				a.Value = t.Format(dateLayout)
+			} else {
+				a.Value = t.Format(sqlite3.SQLiteTimestampFormats[0])
+			}
+		}
+		converted[i] = a
+	}
+	return converted
+}
+
+// sqliteTimeRe matches the dates and times sqliteArgs stores.
+var sqliteTimeRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}( \d{2}:\d{2}:\d{2}(\.\d+)?\+00:00)?$`)
+
+type sqliteRows struct {
+	*sqlite3.SQLiteRows
+}
+
+func (sr *sqliteRows) Next(dest []driver.Value) error {
+	if err := sr.SQLiteRows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		s, ok := v.(string)
+		if !ok || sr.ColumnTypeDatabaseTypeName(i) != "" || !sqliteTimeRe.MatchString(s) {
+			continue
+		}
+		layout := dateLayout
+		if len(s) > len(dateLayout) {
+			layout = sqlite3.SQLiteTimestampFormats[0]
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		dest[i] = t.UTC()
+	}
+	return nil
+}
+
+var (
+	_ driver.Connector        = &sqliteConnector{}
+	_ driver.QueryerContext   = &sqliteConn{}
+	_ driver.ExecerContext    = &sqliteConn{}
+	_ driver.ConnBeginTx      = &sqliteConn{}
+	_ driver.Pinger           = &sqliteConn{}
+	_ driver.StmtQueryContext = &sqliteStmt{}
+	_ driver.StmtExecContext  = &sqliteStmt{}
+)
+
+// sqliteErrorKinds are the SQLite errors handlers care about, as
+// pqErrorKinds.
+var sqliteErrorKinds = map[sqlite3.ErrNoExtended]error{
+	sqlite3.ErrConstraintUnique:     errConflict,
+	sqlite3.ErrConstraintPrimaryKey: errConflict,
+	sqlite3.ErrConstraintForeignKey: errInvalidReference,
+}
+
+// sqliteErrorKind maps err to the domain error of its SQLite error, if any.
+func sqliteErrorKind(err error) (error, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil, false
+	}
+	if sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked {
+		return errSerialization, true
+	}
+	if sqliteErr.Code == sqlite3.ErrInterrupt {
+		return errTimeout, true
+	}
+	kind, ok := sqliteErrorKinds[sqliteErr.ExtendedCode]
+	return kind, ok
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/phuangpheth/covid19/config"
+)
+
+// openTestStorage opens a memory backend of the test's own, through the
+// driver that refuses calls without a deadline.
+func openTestStorage(t *testing.T) (*Repository, context.Context) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	r, err := openStorage(ctx, config.Database{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, ctx
+}
+
+// saveTestCountry saves the country LA, of ISO code LAO, with the provinces
+// VTE and LPB, updated at.
+func saveTestCountry(t *testing.T, ctx context.Context, r *Repository, at time.Time) *Country {
+	t.Helper()
+	c := &Country{ID: "LA", Name: "Laos", ISO3: "LAO", Total: 10, Attributes: Attributes{}, UpdatedAt: at, Provinces: Provinces{
+		{ID: "VTE", Name: "Vientiane", Total: 6, Attributes: Attributes{}, UpdatedAt: at},
+		{ID: "LPB", Name: "Luang Prabang", Total: 4, Attributes: Attributes{}, UpdatedAt: at},
+	}}
+	if err := r.CountryRepo.Save(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestMemoryStorageMatchesItsMigrations(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	readiness, err := newSelfCheck(r.DB, r.Dialect, r.Migrations).Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !readiness.Ready {
+		t.Errorf("drift on a new database: %v", readiness.Problems)
+	}
+}
+
+func TestMemoryStorageRecordsHistory(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	yesterday := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	c := saveTestCountry(t, ctx, r, yesterday)
+	c.Total, c.UpdatedAt = 12, yesterday.Add(24*time.Hour)
+	if err := r.CountryRepo.Update(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := r.HistoryRepo.Get(ctx, "country", "LA", yesterday.Add(-24*time.Hour), c.UpdatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[0].Day != "2026-10-16" || h[0].Total != 10 || h[1].Day != "2026-10-17" || h[1].Total != 12 {
+		t.Errorf("history = %+v %+v", h[0], h[len(h)-1])
+	}
+	points, err := r.HistoryRepo.AsOf(ctx, "country", []string{"LA"}, yesterday.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := points["LA"]; p == nil || p.Total != 10 {
+		t.Errorf("as of yesterday = %+v, want a total of 10", p)
+	}
+}
+
+func TestMemoryStorageTrendWeeks(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	now := time.Now()
+	saveTestCountry(t, ctx, r, now)
+	// a Wednesday and the Sunday ending its week, then the Monday after
+	for i, day := range []time.Time{
+		time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+	} {
+		ws := &WastewaterSample{ID: string(rune('a' + i)), Site: "s", ProvinceID: "VTE", DistrictID: "d",
+			SampledOn: day, ViralLoad: float64(i + 1), CreatedAt: now, UpdatedAt: now}
+		if err := r.WastewaterRepo.Save(ctx, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trend, err := r.WastewaterRepo.Trend(ctx, WastewaterFilter{Site: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 2 {
+		t.Fatalf("got %d weeks, want 2", len(trend))
+	}
+	if w := trend[0]; w.Week.Format(dateLayout) != "2026-10-12" || w.Samples != 2 || w.MeanViralLoad != 1.5 {
+		t.Errorf("first week = %+v", w)
+	}
+	if w := trend[1]; w.Week.Format(dateLayout) != "2026-10-19" || w.Samples != 1 {
+		t.Errorf("second week = %+v", w)
+	}
+}
+
+func TestMemoryStoragePatchesAttributes(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	c := saveTestCountry(t, ctx, r, time.Now())
+	c.Attributes = Attributes{"who_region": "SEARO", "iso": "LA"}
+	if err := r.CountryRepo.Update(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CountryRepo.PatchAttributes(ctx, "LA", Attributes{"iso": nil, "income": "lower-middle"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.CountryRepo.GetByID(ctx, "LA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Attributes{"who_region": "SEARO", "income": "lower-middle"}
+	if !got.Attributes.Equal(want) {
+		t.Errorf("attributes = %v, want %v", got.Attributes, want)
+	}
+}
+
+func TestMemoryStorageMapsErrors(t *testing.T) {
+	r, ctx := openTestStorage(t)
+	c := saveTestCountry(t, ctx, r, time.Now())
+	if err := r.CountryRepo.Save(ctx, c); !errors.Is(err, errConflict) {
+		t.Errorf("saving twice: got %v, want errConflict", err)
+	}
+	d := &District{ID: "d", ProvinceID: "nowhere", Name: "d", Attributes: Attributes{}, UpdatedAt: time.Now()}
+	if err := r.DistrictRepo.Save(ctx, d); !errors.Is(err, errInvalidReference) {
+		t.Errorf("district of no province: got %v, want errInvalidReference", err)
+	}
+	if _, err := r.CountryRepo.GetByID(ctx, "XX"); !errors.Is(err, errNotFound) {
+		t.Errorf("unknown country: got %v, want errNotFound", err)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// events kept for clients resuming with Last-Event-ID
+	streamBacklog   = 256
+	streamHeartbeat = 15 * time.Second
+	// how long clients wait before reconnecting, in milliseconds
+	streamRetry = 5000
+)
+
+// events of the stream
+const (
+	EventCountryUpdated  = "country.updated"
+	EventProvinceUpdated = "province.updated"
+	// EventStreamReset tells a client resuming from an event no longer kept
+	// that it missed changes and should read the data again.
+	EventStreamReset = "stream.reset"
+)
+
+// routes holding their connection open, left out of what buffers responses
+var streamingRoutes = map[string]bool{"/ws": true, "/api/v1/stream": true}
+
+type streamEvent struct {
+	ID   int64
+	Name string
+	Data []byte
+}
+
+// streamService serves the changes of countries and provinces as Server-Sent
+// Events. Event ids increase within a process and start from its boot time,
+// so that ids of an earlier process are recognised as too old to resume from.
+type streamService struct {
+	countries CountryRepository
+	provinces ProvinceRepository
+	keys      chan []string
+	closed    <-chan struct{}
+
+	mu     sync.Mutex
+	nextID int64
+	events []*streamEvent
+	// closed, and replaced, on every new event
+	wake chan struct{}
+}
+
+func NewStreamService(countries CountryRepository, provinces ProvinceRepository, changes *changeHub) *streamService {
+	sA := &streamService{
+		countries: countries,
+		provinces: provinces,
+		keys:      make(chan []string, streamBacklog),
+		closed:    changes.Closed(),
+		nextID:    time.Now().UnixNano(),
+		wake:      make(chan struct{}),
+	}
+	changes.Listen(sA.enqueue)
+	return sA
+}
+
+func (sA *streamService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (sA *streamService) enqueue(keys []string) {
+	select {
+	case sA.keys <- keys:
+	default:
+		logger.Warn().Strs("keys", keys).Msg("stream: queue full, dropped change")
+	}
+}
+
+// Run reads the entities that changed and adds their events until ctx is
+// done.
+func (sA *streamService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case keys := <-sA.keys:
+			for _, key := range keys {
+				sA.read(ctx, key)
+			}
+		}
+	}
+}
+
+// read adds the event of the change of key. Districts changing also publish
+// their province, and are not streamed on their own.
+func (sA *streamService) read(ctx context.Context, key string) {
+	kv := strings.SplitN(key, ":", 2)
+	if len(kv) != 2 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, liveReadTimeout)
+	defer cancel()
+	var (
+		name   string
+		entity interface{}
+		err    error
+	)
+	switch kv[0] {
+	case "country":
+		name = EventCountryUpdated
+		entity, err = sA.countries.GetByID(ctx, kv[1])
+	case "province":
+		name = EventProvinceUpdated
+		entity, err = sA.provinces.GetByID(ctx, kv[1])
+	default:
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			logger.Error().Err(err).Str(kv[0]+"_id", kv[1]).Msg("stream: failed to read")
+		}
+		return
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		fmt.Printf("stream: failed to encode %s: %+v\n", key, err)
+		return
+	}
+
+	sA.mu.Lock()
+	defer sA.mu.Unlock()
+	sA.events = append(sA.events, &streamEvent{ID: sA.nextID, Name: name, Data: data})
+	sA.nextID++
+	if len(sA.events) > streamBacklog {
+		sA.events = sA.events[len(sA.events)-streamBacklog:]
+	}
+	close(sA.wake)
+	sA.wake = make(chan struct{})
+}
+
+// since returns the events after lastID, false when some of them are no
+// longer kept, along with the id of the latest event and a channel closed on
+// the next one.
+func (sA *streamService) since(lastID int64) ([]*streamEvent, bool, int64, <-chan struct{}) {
+	sA.mu.Lock()
+	defer sA.mu.Unlock()
+	latest := sA.nextID - 1
+	oldest := sA.nextID
+	if len(sA.events) > 0 {
+		oldest = sA.events[0].ID
+	}
+	if lastID < oldest-1 || lastID > latest {
+		return nil, false, latest, sA.wake
+	}
+	i := len(sA.events) - int(latest-lastID)
+	return sA.events[i:], true, latest, sA.wake
+}
+
+// Stream sends the changes as they happen, from the one after Last-Event-ID,
+// or ?last_event_id=, when resuming. Comments keep idle connections alive.
+func (sA *streamService) Stream(c echo.Context) error {
+	lastID := int64(-1)
+	v := c.Request().Header.Get("Last-Event-ID")
+	if v == "" {
+		v = c.QueryParam("last_event_id")
+	}
+	if v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return c.JSON(http.StatusBadRequest, sA.errMessage("request: Last-Event-ID must be an event id"))
+		}
+		lastID = id
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry); err != nil {
+		return nil
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request().Context()
+	for {
+		// the client reconnects, and is refused until the embargo is over
+		if _, embargo := embargoAt(ctx, time.Now()); embargo {
+			return nil
+		}
+		events, ok, latest, wake := sA.since(lastID)
+		switch {
+		case lastID < 0:
+			// a new client only gets the changes from now on
+		case !ok:
+			if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: {}\n\n", latest, EventStreamReset); err != nil {
+				return nil
+			}
+		default:
+			for _, e := range events {
+				if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Name, e.Data); err != nil {
+					return nil
+				}
+			}
+		}
+		lastID = latest
+		res.Flush()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sA.closed:
+			// the client resumes from lastID on another instance
+			return nil
+		case <-wake:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+)
+
+// tracked supplies and the unit their stock is counted in
+var supplyItems = map[string]string{
+	"oxygen":    "cylinders",
+	"ppe":       "sets",
+	"test_kits": "kits",
+}
+
+// SupplyStock is the stock of a supply held by a facility of a province, or
+// by the province's own stores when Facility is empty.
+type SupplyStock struct {
+	ProvinceID        string    `json:"province_id"`
+	Facility          string    `json:"facility"`
+	Item              string    `json:"item"`
+	Unit              string    `json:"unit"`
+	Stock             float64   `json:"stock"`
+	DailyConsumption  float64   `json:"daily_consumption"`
+	LowStockThreshold float64   `json:"low_stock_threshold"`
+	DaysRemaining     *float64  `json:"days_remaining"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type SupplyStocks []*SupplyStock
+
+func (s *SupplyStock) Prepare() {
+	s.Facility = html.EscapeString(strings.TrimSpace(s.Facility))
+	s.Item = strings.ToLower(strings.TrimSpace(s.Item))
+}
+
+func (s *SupplyStock) Validate() error {
+	if _, ok := supplyItems[s.Item]; !ok {
+		return errors.New("supply: item must be one of oxygen, ppe or test_kits")
+	}
+	if s.Stock < 0 || s.DailyConsumption < 0 || s.LowStockThreshold < 0 {
+		return errors.New("supply: stock, daily_consumption and low_stock_threshold must not be negative")
+	}
+	return nil
+}
+
+// Low reports whether the stock fell below its threshold.
+func (s *SupplyStock) Low() bool {
+	return s.Stock < s.LowStockThreshold
+}
+
+// Estimate fills in the unit and how many days the stock lasts at the
+// current consumption.
+func (s *SupplyStock) Estimate() {
+	s.Unit = supplyItems[s.Item]
+	s.DaysRemaining = nil
+	if s.DailyConsumption > 0 {
+		days := math.Round(s.Stock/s.DailyConsumption*10) / 10
+		s.DaysRemaining = &days
+	}
+}
+
+func (s *SupplyStock) key() string {
+	if s.Facility == "" {
+		return s.ProvinceID + "/" + s.Item
+	}
+	return s.ProvinceID + "/" + s.Facility + "/" + s.Item
+}
+
+// Repository
+type SupplyRepository interface {
+	Save(ctx context.Context, s *SupplyStock) error
+	Delete(ctx context.Context, provinceID, facility, item string) error
+	Get(ctx context.Context, provinceID, facility, item string) (*SupplyStock, error)
+	GetByProvince(ctx context.Context, provinceID string) (SupplyStocks, error)
+	GetLow(ctx context.Context) (SupplyStocks, error)
+}
+
+type supplyRepo struct {
+	db *sql.DB
+}
+
+var _ SupplyRepository = &supplyRepo{}
+
+func NewSupplyRepo(db *sql.DB) *supplyRepo {
+	return &supplyRepo{db}
+}
+
+func (sr *supplyRepo) Save(ctx context.Context, s *SupplyStock) error {
+	if _, err := squirrel.Insert("supply_stocks").
+		Columns("province_id", "facility", "item", "stock", "daily_consumption", "low_stock_threshold", "updated_at").
+		Values(&s.ProvinceID, &s.Facility, &s.Item, &s.Stock, &s.DailyConsumption, &s.LowStockThreshold, &s.UpdatedAt).
+		Suffix("ON CONFLICT (province_id, facility, item) DO UPDATE SET stock = EXCLUDED.stock, daily_consumption = EXCLUDED.daily_consumption, low_stock_threshold = EXCLUDED.low_stock_threshold, updated_at = EXCLUDED.updated_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ExecContext(ctx); err != nil {
+		return wrapErr("supply", s.key(), "upsert supply", err)
+	}
+	return nil
+}
+
+func (sr *supplyRepo) Delete(ctx context.Context, provinceID, facility, item string) error {
+	key := (&SupplyStock{ProvinceID: provinceID, Facility: facility, Item: item}).key()
+	res, err := squirrel.Delete("supply_stocks").
+		Where(squirrel.Eq{"province_id": provinceID, "facility": facility, "item": item}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("supply", key, "delete supply", err)
+	}
+	return wrapErr("supply", key, "delete supply", affectedOne(res))
+}
+
+func (sr *supplyRepo) Get(ctx context.Context, provinceID, facility, item string) (*SupplyStock, error) {
+	s := SupplyStock{ProvinceID: provinceID, Facility: facility, Item: item}
+	err := squirrel.Select("stock", "daily_consumption", "low_stock_threshold", "updated_at").
+		From("supply_stocks").
+		Where(squirrel.Eq{"province_id": provinceID, "facility": facility, "item": item}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).ScanContext(ctx, &s.Stock, &s.DailyConsumption, &s.LowStockThreshold, &s.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("supply", s.key(), "select supply", err)
+	}
+	s.Estimate()
+	return &s, nil
+}
+
+func (sr *supplyRepo) GetByProvince(ctx context.Context, provinceID string) (SupplyStocks, error) {
+	return sr.selectStocks(ctx, squirrel.Eq{"province_id": provinceID})
+}
+
+func (sr *supplyRepo) GetLow(ctx context.Context) (SupplyStocks, error) {
+	return sr.selectStocks(ctx, squirrel.Expr("stock < low_stock_threshold"))
+}
+
+func (sr *supplyRepo) selectStocks(ctx context.Context, pred squirrel.Sqlizer) (SupplyStocks, error) {
+	rows, err := squirrel.Select("province_id", "facility", "item", "stock", "daily_consumption", "low_stock_threshold", "updated_at").
+		From("supply_stocks").
+		Where(pred).
+		OrderBy("province_id", "facility", "item").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(sr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("supply", "", "select supplies", err)
+	}
+	defer rows.Close()
+
+	var ss = make(SupplyStocks, 0)
+	for rows.Next() {
+		var s SupplyStock
+		if err := rows.Scan(&s.ProvinceID, &s.Facility, &s.Item, &s.Stock, &s.DailyConsumption, &s.LowStockThreshold, &s.UpdatedAt); err != nil {
+			return nil, wrapErr("supply", "", "scan supplies", err)
+		}
+		s.Estimate()
+		ss = append(ss, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("supply", "", "select supplies", err)
+	}
+	return ss, nil
+}
+
+// handler
+type supplyService struct {
+	sApp          SupplyRepository
+	notifications NotificationRepository
+}
+
+func NewSupplyService(sApp SupplyRepository, notifications NotificationRepository) *supplyService {
+	return &supplyService{sApp: sApp, notifications: notifications}
+}
+
+func (sA *supplyService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (sA *supplyService) ListByProvince(c echo.Context) error {
+	ss, err := sA.sApp.GetByProvince(c.Request().Context(), c.Param("province_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]SupplyStocks{"supplies": ss})
+}
+
+func (sA *supplyService) ListLowStock(c echo.Context) error {
+	ss, err := sA.sApp.GetLow(c.Request().Context())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]SupplyStocks{"supplies": ss})
+}
+
+// Store records the stock of a supply and notifies operators when it falls
+// below its threshold. Stock that stays low is only notified about once.
+func (sA *supplyService) Store(c echo.Context) error {
+	var s SupplyStock
+	if err := c.Bind(&s); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, sA.errMessage("request: unable to parse request payload"))
+	}
+	s.ProvinceID = c.Param("province_id")
+	s.Prepare()
+	if err := s.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, sA.errMessage(err.Error()))
+	}
+	s.UpdatedAt = time.Now()
+
+	ctx := c.Request().Context()
+	wasLow := false
+	old, err := sA.sApp.Get(ctx, s.ProvinceID, s.Facility, s.Item)
+	switch {
+	case err == nil:
+		wasLow = old.Low()
+	case !errors.Is(err, errNotFound):
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+
+	if err := sA.sApp.Save(ctx, &s); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	s.Estimate()
+	if s.Low() && !wasLow {
+		n := NewNotification(NotificationLowStock, s.key(), "%s stock of %s is down to %v %s, below the threshold of %v",
+			s.Item, supplyHolder(&s), s.Stock, s.Unit, s.LowStockThreshold)
+		if err := sA.notifications.Save(ctx, n); err != nil {
+			logFor(c.Request().Context()).Error().Err(err).Str("supply", s.key()).Msg("supply: failed to notify low stock")
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]*SupplyStock{"supply": &s})
+}
+
+func (sA *supplyService) Delete(c echo.Context) error {
+	if err := sA.sApp.Delete(c.Request().Context(), c.Param("province_id"), c.QueryParam("facility"), c.Param("item")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, sA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func supplyHolder(s *SupplyStock) string {
+	if s.Facility == "" {
+		return fmt.Sprintf("province %s", s.ProvinceID)
+	}
+	return fmt.Sprintf("%s in province %s", s.Facility, s.ProvinceID)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+)
+
+// header carrying the API key of a team
+const headerAPIKey = "X-API-Key"
+
+// API keys are apiKeyPrefix followed by 32 random bytes in hex
+const apiKeyPrefix = "cvd_"
+
+var errQuotaExceeded = errors.New("Error: The daily write quota of the team is used up")
+
+// Team manages the dataset of the country delegated to it, its provinces and
+// districts, through API keys of its own, within a daily quota of writes.
+type Team struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	CountryID       string     `json:"country_id"`
+	DailyWriteQuota int        `json:"daily_write_quota"`
+	WritesToday     int        `json:"writes_today"`
+	Keys            []*TeamKey `json:"keys"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type Teams []*Team
+
+// TeamKey is an API key of a team. Key is only set in the response creating
+// it, the prefix identifying it afterwards. Embargo is the time of day, in
+// UTC, before which the key is shown the figures of the day before.
+type TeamKey struct {
+	ID        string    `json:"id"`
+	Prefix    string    `json:"prefix"`
+	Key       string    `json:"key,omitempty"`
+	Embargo   string    `json:"embargo"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *Team) Prepare() {
+	t.Name = html.EscapeString(strings.TrimSpace(t.Name))
+	t.CountryID = strings.TrimSpace(t.CountryID)
+}
+
+func (t *Team) BeforeSave() {
+	t.ID = uuid.NewV4().String()
+	t.Keys = make([]*TeamKey, 0)
+}
+
+func (t *Team) Validate() error {
+	if t.Name == "" {
+		return errors.New("team: name is required")
+	}
+	if t.CountryID == "" {
+		return errors.New("team: country_id is required")
+	}
+	if t.DailyWriteQuota <= 0 {
+		return errors.New("team: daily_write_quota must be positive")
+	}
+	return nil
+}
+
+// newTeamKey generates a key, returning it with the hash it is stored as.
+func newTeamKey() (*TeamKey, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(b)
+	return &TeamKey{
+		ID:        uuid.NewV4().String(),
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Key:       key,
+		CreatedAt: time.Now(),
+	}, hashTeamKey(key), nil
+}
+
+func hashTeamKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// teamIdentity is what a request authenticated by an API key acts as: an
+// editor of the country of the team and of its provinces, under the embargo
+// of the key.
+func teamIdentity(t *Team, k *TeamKey, provinceIDs []string) *identity {
+	regions := map[string]bool{t.CountryID: true}
+	for _, id := range provinceIDs {
+		regions[id] = true
+	}
+	return &identity{
+		claims:  &authClaims{Role: RoleEditor, StandardClaims: jwt.StandardClaims{Subject: "team:" + t.ID}},
+		team:    t,
+		regions: regions,
+		embargo: k.Embargo,
+	}
+}
+
+// Repository
+type TeamRepository interface {
+	Save(ctx context.Context, t *Team) error
+	GetAll(ctx context.Context, day time.Time) (Teams, error)
+	Delete(ctx context.Context, id string) error
+	SaveKey(ctx context.Context, teamID string, k *TeamKey, hash string) error
+	DeleteKey(ctx context.Context, teamID, keyID string) error
+	// GetByKey returns the team and the key of a key hash, with the
+	// provinces of its country.
+	GetByKey(ctx context.Context, hash string) (*Team, *TeamKey, []string, error)
+	// SetKeyEmbargo sets the embargo of a key, an empty one lifting it.
+	SetKeyEmbargo(ctx context.Context, teamID, keyID, embargo string) error
+	// CountWrite adds a write of the team on day, returning how many it made
+	// that day.
+	CountWrite(ctx context.Context, teamID string, day time.Time) (int, error)
+}
+
+type teamRepo struct {
+	db *sql.DB
+}
+
+var _ TeamRepository = &teamRepo{}
+
+func NewTeamRepo(db *sql.DB) *teamRepo {
+	return &teamRepo{db}
+}
+
+func (tr *teamRepo) Save(ctx context.Context, t *Team) error {
+	if _, err := squirrel.Insert("teams").
+		Columns("id", "name", "country_id", "daily_write_quota", "created_at").
+		Values(&t.ID, &t.Name, &t.CountryID, &t.DailyWriteQuota, &t.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ExecContext(ctx); err != nil {
+		return wrapErr("team", t.ID, "insert team", err)
+	}
+	return nil
+}
+
+func (tr *teamRepo) GetAll(ctx context.Context, day time.Time) (Teams, error) {
+	rows, err := squirrel.Select("t.id", "t.name", "t.country_id", "t.daily_write_quota", "COALESCE(u.writes, 0)", "t.created_at").
+		From("teams t").
+		LeftJoin("team_usage u ON u.team_id = t.id AND u.day = ?", day.Format(dateLayout)).
+		OrderBy("t.name").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("team", "", "select teams", err)
+	}
+	defer rows.Close()
+
+	var teams = make(Teams, 0)
+	byID := make(map[string]*Team)
+	for rows.Next() {
+		t := Team{Keys: make([]*TeamKey, 0)}
+		if err := rows.Scan(&t.ID, &t.Name, &t.CountryID, &t.DailyWriteQuota, &t.WritesToday, &t.CreatedAt); err != nil {
+			return nil, wrapErr("team", "", "scan teams", err)
+		}
+		teams = append(teams, &t)
+		byID[t.ID] = &t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("team", "", "select teams", err)
+	}
+
+	keyRows, err := squirrel.Select("id", "team_id", "prefix", "COALESCE(embargo, '')", "created_at").
+		From("team_keys").
+		OrderBy("created_at").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("team", "", "select team keys", err)
+	}
+	defer keyRows.Close()
+	for keyRows.Next() {
+		var k TeamKey
+		var teamID string
+		if err := keyRows.Scan(&k.ID, &teamID, &k.Prefix, &k.Embargo, &k.CreatedAt); err != nil {
+			return nil, wrapErr("team", "", "scan team keys", err)
+		}
+		if t, ok := byID[teamID]; ok {
+			t.Keys = append(t.Keys, &k)
+		}
+	}
+	if err := keyRows.Err(); err != nil {
+		return nil, wrapErr("team", "", "select team keys", err)
+	}
+	return teams, nil
+}
+
+func (tr *teamRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("teams").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("team", id, "delete team", err)
+	}
+	return wrapErr("team", id, "delete team", affectedOne(res))
+}
+
+func (tr *teamRepo) SaveKey(ctx context.Context, teamID string, k *TeamKey, hash string) error {
+	if _, err := squirrel.Insert("team_keys").
+		Columns("id", "team_id", "prefix", "key_hash", "created_at").
+		Values(&k.ID, teamID, &k.Prefix, hash, &k.CreatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ExecContext(ctx); err != nil {
+		return wrapErr("team", teamID, "insert team key", err)
+	}
+	return nil
+}
+
+func (tr *teamRepo) DeleteKey(ctx context.Context, teamID, keyID string) error {
+	res, err := squirrel.Delete("team_keys").
+		Where(squirrel.Eq{"id": keyID, "team_id": teamID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("team", teamID, "delete team key", err)
+	}
+	return wrapErr("team", teamID, "delete team key", affectedOne(res))
+}
+
+func (tr *teamRepo) GetByKey(ctx context.Context, hash string) (*Team, *TeamKey, []string, error) {
+	var t Team
+	var k TeamKey
+	err := squirrel.Select("t.id", "t.name", "t.country_id", "t.daily_write_quota", "t.created_at",
+		"k.id", "k.prefix", "COALESCE(k.embargo, '')", "k.created_at").
+		From("teams t").
+		Join("team_keys k ON k.team_id = t.id").
+		Where(squirrel.Eq{"k.key_hash": hash}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).ScanContext(ctx, &t.ID, &t.Name, &t.CountryID, &t.DailyWriteQuota, &t.CreatedAt,
+		&k.ID, &k.Prefix, &k.Embargo, &k.CreatedAt)
+	if err != nil {
+		return nil, nil, nil, wrapErr("team", "", "select team by key", err)
+	}
+
+	rows, err := squirrel.Select("id").
+		From("provinces").
+		Where(squirrel.Eq{"country_id": t.CountryID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, nil, nil, wrapErr("team", t.ID, "select team provinces", err)
+	}
+	defer rows.Close()
+	var provinceIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, nil, nil, wrapErr("team", t.ID, "scan team provinces", err)
+		}
+		provinceIDs = append(provinceIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, wrapErr("team", t.ID, "select team provinces", err)
+	}
+	return &t, &k, provinceIDs, nil
+}
+
+func (tr *teamRepo) CountWrite(ctx context.Context, teamID string, day time.Time) (int, error) {
+	var writes int
+	err := squirrel.Insert("team_usage").
+		Columns("team_id", "day", "writes").
+		Values(teamID, day.Format(dateLayout), 1).
+		Suffix("ON CONFLICT (team_id, day) DO UPDATE SET writes = team_usage.writes + 1 RETURNING writes").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(tr.db).QueryRowContext(ctx).Scan(&writes)
+	if err != nil {
+		return 0, wrapErr("team", teamID, "count team write", err)
+	}
+	return writes, nil
+}
+
+// authenticateKey resolves the API key of a request to the identity of its
+// team, counting the writes against the quota of the team.
+func (aA *authService) authenticateKey(c echo.Context, key string) (*identity, error) {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return aA.keyIdentity(c.Request().Context(), key, false, c.Response().Header())
+	}
+	return aA.keyIdentity(c.Request().Context(), key, true, c.Response().Header())
+}
+
+// keyIdentity resolves the API key of a team, a write counting against its
+// daily quota, which is reported in h.
+func (aA *authService) keyIdentity(ctx context.Context, key string, write bool, h http.Header) (*identity, error) {
+	t, k, provinceIDs, err := aA.teams.GetByKey(ctx, hashTeamKey(key))
+	if errors.Is(err, errNotFound) {
+		return nil, errUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !write {
+		return teamIdentity(t, k, provinceIDs), nil
+	}
+	now := time.Now().UTC()
+	writes, err := aA.teams.CountWrite(ctx, t.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	h.Set("X-Quota-Limit", strconv.Itoa(t.DailyWriteQuota))
+	remaining := t.DailyWriteQuota - writes
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set("X-Quota-Remaining", strconv.Itoa(remaining))
+	if writes > t.DailyWriteQuota {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		h.Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+		return nil, errQuotaExceeded
+	}
+	return teamIdentity(t, k, provinceIDs), nil
+}
+
+// handler
+type teamService struct {
+	tApp TeamRepository
+}
+
+func NewTeamService(tApp TeamRepository) *teamService {
+	return &teamService{tApp: tApp}
+}
+
+func (tA *teamService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (tA *teamService) ListTeams(c echo.Context) error {
+	teams, err := tA.tApp.GetAll(c.Request().Context(), time.Now().UTC())
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]Teams{"teams": teams})
+}
+
+// StoreTeam delegates a country to a new team, a country being delegated to
+// one team at most.
+func (tA *teamService) StoreTeam(c echo.Context) error {
+	var t Team
+	if err := c.Bind(&t); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, tA.errMessage("request: unable to parse request payload"))
+	}
+	t.Prepare()
+	if err := t.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, tA.errMessage(err.Error()))
+	}
+	t.BeforeSave()
+	t.CreatedAt = time.Now()
+
+	if err := tA.tApp.Save(c.Request().Context(), &t); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not save team")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*Team{"team": &t})
+}
+
+func (tA *teamService) DeleteTeam(c echo.Context) error {
+	if err := tA.tApp.Delete(c.Request().Context(), c.Param("team_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// StoreKey issues an API key for the team, answered this once only.
+func (tA *teamService) StoreKey(c echo.Context) error {
+	k, hash, err := newTeamKey()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, tA.errMessage("Internal server error"))
+	}
+	if err := tA.tApp.SaveKey(c.Request().Context(), c.Param("team_id"), k, hash); err != nil {
+		status, msg := errorStatus(err, "Internal server error, could not save key")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*TeamKey{"team_key": k})
+}
+
+func (tA *teamService) DeleteKey(c echo.Context) error {
+	if err := tA.tApp.DeleteKey(c.Request().Context(), c.Param("team_id"), c.Param("key_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, tA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
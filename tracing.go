@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	traceQueueSize  = 4096
+	traceBatchSize  = 512
+	traceFlushEvery = 5 * time.Second
+	// the service.name of the spans when OTEL_SERVICE_NAME is not set
+	defaultTraceService = "covid19-api"
+)
+
+// the kinds and status codes of OTLP spans
+const (
+	spanKindServer  = 2
+	spanKindClient  = 3
+	spanStatusError = 2
+)
+
+// tracer exports the spans of the requests, it is nil when tracing is off.
+var tracer *otlpTracer
+
+// otlpTracer sends spans to an OpenTelemetry collector over OTLP/HTTP, in
+// its JSON encoding, in batches. Spans that do not fit in the queue are
+// dropped rather than holding requests back.
+type otlpTracer struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+	queue   chan *span
+}
+
+// otlpTracerFromEnv reads OTEL_EXPORTER_OTLP_ENDPOINT, the base URL of the
+// collector such as http://localhost:4318, OTEL_EXPORTER_OTLP_HEADERS, comma
+// separated key=value pairs sent with every export, and OTEL_SERVICE_NAME.
+// It returns nil when no endpoint is configured.
+func otlpTracerFromEnv() (*otlpTracer, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+		return nil, fmt.Errorf("tracing: invalid OTEL_EXPORTER_OTLP_ENDPOINT %q", endpoint)
+	}
+	t := &otlpTracer{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers: make(map[string]string),
+		service: os.Getenv("OTEL_SERVICE_NAME"),
+		// the collector is usually a sidecar, it is not reached through the
+		// outbound proxy
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *span, traceQueueSize),
+	}
+	if t.service == "" {
+		t.service = defaultTraceService
+	}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("tracing: invalid OTEL_EXPORTER_OTLP_HEADERS entry %q", kv)
+		}
+		t.headers[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return t, nil
+}
+
+// span is one timed operation of a trace. A nil span records nothing, so
+// that callers need not check whether tracing is on.
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []otlpAttribute
+	failure  string
+	failed   bool
+}
+
+type spanKey struct{}
+
+// spanFrom is the span ctx is in, nil when none.
+func spanFrom(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// startSpan starts a span as a child of the one ctx is in. Calls outside of
+// a traced request, such as those of the background jobs, are not traced.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	parent := spanFrom(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &span{traceID: parent.traceID, parentID: parent.spanID, name: name, kind: kind, start: time.Now()}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) setString(key, v string) {
+	if s != nil {
+		s.attrs = append(s.attrs, otlpAttribute{key, map[string]string{"stringValue": v}})
+	}
+}
+
+func (s *span) setInt(key string, v int64) {
+	if s != nil {
+		// 64 bit integers are strings in the JSON encoding
+		s.attrs = append(s.attrs, otlpAttribute{key, map[string]string{"intValue": strconv.FormatInt(v, 10)}})
+	}
+}
+
+// finish ends the span, failed when err is not nil, and hands it to the
+// tracer.
+func (s *span) finish(err error) {
+	if s == nil || tracer == nil {
+		return
+	}
+	if err != nil {
+		s.failed, s.failure = true, err.Error()
+	}
+	s.end = time.Now()
+	select {
+	case tracer.queue <- s:
+	default:
+	}
+}
+
+// parseTraceparent reads the trace id and parent span id of a W3C
+// traceparent header, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(h string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
+
+// traceRequests starts the trace of every request, continuing the one of
+// its traceparent header, with a span named after the route. It must come
+// before requestLogger so that the trace id is logged.
+func traceRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if tracer == nil {
+			return next(c)
+		}
+		req := c.Request()
+		s := &span{name: req.Method + " " + c.Path(), kind: spanKindServer, start: time.Now()}
+		if traceID, parentID, ok := parseTraceparent(req.Header.Get("traceparent")); ok {
+			s.traceID, s.parentID = traceID, parentID
+		} else {
+			rand.Read(s.traceID[:])
+		}
+		rand.Read(s.spanID[:])
+		c.SetRequest(req.WithContext(context.WithValue(req.Context(), spanKey{}, s)))
+
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		s.setString("http.method", req.Method)
+		s.setString("http.route", c.Path())
+		s.setString("http.target", req.RequestURI)
+		s.setInt("http.status_code", int64(c.Response().Status))
+		var err error
+		if c.Response().Status >= 500 {
+			err = fmt.Errorf("%d %s", c.Response().Status, http.StatusText(c.Response().Status))
+		}
+		s.finish(err)
+		return nil
+	}
+}
+
+// Run exports the spans in batches until ctx is done, then exports those
+// still queued.
+func (t *otlpTracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(traceFlushEvery)
+	defer ticker.Stop()
+	batch := make([]*span, 0, traceBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for len(t.queue) > 0 && len(batch) < cap(batch) {
+				batch = append(batch, <-t.queue)
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			t.flush(flushCtx, batch)
+			cancel()
+			return
+		case s := <-t.queue:
+			if batch = append(batch, s); len(batch) < traceBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		t.flush(ctx, batch)
+		batch = batch[:0]
+	}
+}
+
+func (t *otlpTracer) flush(ctx context.Context, batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := t.export(ctx, batch); err != nil {
+		logger.Warn().Err(err).Int("spans", len(batch)).Msg("tracing: failed to export")
+	}
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// export posts one batch of spans to the collector.
+func (t *otlpTracer) export(ctx context.Context, batch []*span) error {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	scope.Scope.Name = "github.com/phuangpheth/covid19"
+	for _, s := range batch {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        s.attrs,
+		}
+		if s.parentID != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.failed {
+			o.Status = otlpStatus{Code: spanStatusError, Message: s.failure}
+		}
+		scope.Spans = append(scope.Spans, o)
+	}
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpAttribute{{"service.name", map[string]string{"stringValue": t.service}}}
+	body, err := json.Marshal(map[string][]otlpResourceSpans{"resourceSpans": {rs}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("tracing: %s answered %s", req.URL.Host, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// ValidationIssue is a problem of a submission, at the JSON path of the
+// field or record it is about.
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validation is the outcome of checking a submission without storing it.
+// Errors would have it refused, warnings point at figures that are likely
+// wrong but are accepted.
+type Validation struct {
+	Valid    bool               `json:"valid"`
+	Errors   []*ValidationIssue `json:"errors"`
+	Warnings []*ValidationIssue `json:"warnings"`
+}
+
+func (v *Validation) fail(path, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, &ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *Validation) warn(path, format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, &ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validationRequest holds the payloads to check, keyed as the responses
+// are, each being what the matching write endpoint takes.
+type validationRequest struct {
+	Country   *Country  `json:"country"`
+	Province  *Province `json:"province"`
+	Provinces Provinces `json:"provinces"`
+	District  *District `json:"district"`
+}
+
+// figures are the counts a country, a province and a district all carry.
+type figures struct {
+	Total, NewCase, Treated, DecoveringCase, TestCase, Dead, NegativeTest int64
+}
+
+// checkFigures adds the issues of f to v, compared to current, the stored
+// figures, when the record exists.
+func checkFigures(v *Validation, path string, f, current *figures) {
+	counts := []struct {
+		field string
+		n     int64
+	}{
+		{"total", f.Total}, {"new_case", f.NewCase}, {"treaded", f.Treated}, {"decovering_case", f.DecoveringCase},
+		{"test_case", f.TestCase}, {"dead", f.Dead}, {"negative_case", f.NegativeTest},
+	}
+	for _, c := range counts {
+		if c.n < 0 {
+			v.fail(path+"."+c.field, "must not be negative")
+		}
+	}
+	if f.NewCase > f.Total {
+		v.warn(path+".new_case", "%d new cases are more than the %d confirmed", f.NewCase, f.Total)
+	}
+	if f.Treated+f.Dead > f.Total {
+		v.warn(path+".treaded", "%d treated and %d dead are more than the %d confirmed", f.Treated, f.Dead, f.Total)
+	}
+	if f.NegativeTest > f.TestCase {
+		v.warn(path+".negative_case", "%d negative tests are more than the %d tests", f.NegativeTest, f.TestCase)
+	}
+	if current == nil {
+		return
+	}
+	// cumulative counts only grow, a decrease is usually a typo or a
+	// correction that needs a note
+	for _, c := range []struct {
+		field         string
+		next, current int64
+	}{
+		{"total", f.Total, current.Total}, {"test_case", f.TestCase, current.TestCase}, {"dead", f.Dead, current.Dead},
+	} {
+		if c.next < c.current {
+			v.warn(path+"."+c.field, "decreases from %d to %d", c.current, c.next)
+		}
+	}
+}
+
+func countryFigures(c *Country) *figures {
+	return &figures{c.Total, c.NewCase, c.Treated, c.DecoveringCase, c.TestCase, c.Dead, c.NegativeTest}
+}
+
+func provinceFigures(p *Province) *figures {
+	return &figures{p.Total, p.NewCase, p.Treated, p.DecoveringCase, p.TestCase, p.Dead, p.NegativeTest}
+}
+
+func districtFigures(d *District) *figures {
+	return &figures{d.Total, d.NewCase, d.Treated, d.DecoveringCase, d.TestCase, d.Dead, d.NegativeTest}
+}
+
+// handler
+type validationService struct {
+	cApp CountryAppInterface
+	pApp ProvinceInterface
+	dApp DistrictInterface
+}
+
+func NewValidationService(cApp CountryAppInterface, pApp ProvinceInterface, dApp DistrictInterface) *validationService {
+	return &validationService{cApp: cApp, pApp: pApp, dApp: dApp}
+}
+
+func (vA *validationService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// lookup ignores errNotFound, records that are not stored being left nil.
+func lookup(err error) error {
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (vA *validationService) country(ctx context.Context, v *Validation, c *Country) error {
+	c.Prepare()
+	if err := c.Validate(); err != nil {
+		v.fail("country", "%s", err)
+	}
+	var currentFigures *figures
+	if c.ID != "" {
+		current, err := vA.cApp.GetByID(ctx, c.ID)
+		if err := lookup(err); err != nil {
+			return err
+		}
+		if current != nil {
+			currentFigures = countryFigures(current)
+		}
+	}
+	checkFigures(v, "country", countryFigures(c), currentFigures)
+
+	var sum int64
+	for i, p := range c.Provinces {
+		path := fmt.Sprintf("country.provinces[%d]", i)
+		if p == nil {
+			v.fail(path, "must be an object")
+			continue
+		}
+		if err := vA.province(ctx, v, path, p, false); err != nil {
+			return err
+		}
+		sum += p.Total
+	}
+	if sum > c.Total {
+		v.warn("country.total", "the provinces add up to %d confirmed, more than %d", sum, c.Total)
+	}
+	return nil
+}
+
+// province checks p, which must exist when mustExist, as PUT and the bulk
+// update only update provinces.
+func (vA *validationService) province(ctx context.Context, v *Validation, path string, p *Province, mustExist bool) error {
+	p.Prepare()
+	if err := p.Validate(); err != nil {
+		v.fail(path, "%s", err)
+	}
+	var currentFigures *figures
+	if p.ID != "" {
+		current, err := vA.pApp.GetByID(ctx, p.ID)
+		if err := lookup(err); err != nil {
+			return err
+		}
+		if current != nil {
+			currentFigures = provinceFigures(current)
+		}
+	}
+	if currentFigures == nil && mustExist {
+		v.fail(path+".id", "no province %q", p.ID)
+	}
+	checkFigures(v, path, provinceFigures(p), currentFigures)
+	return nil
+}
+
+func (vA *validationService) district(ctx context.Context, v *Validation, d *District) error {
+	d.Prepare()
+	if err := d.Validate(); err != nil {
+		v.fail("district", "%s", err)
+	}
+	if d.ProvinceID != "" {
+		p, err := vA.pApp.GetByID(ctx, d.ProvinceID)
+		if err := lookup(err); err != nil {
+			return err
+		}
+		if p == nil {
+			v.fail("district.province_id", "no province %q", d.ProvinceID)
+		}
+	}
+	var currentFigures *figures
+	if d.ID != "" {
+		current, err := vA.dApp.GetByID(ctx, d.ID)
+		if err := lookup(err); err != nil {
+			return err
+		}
+		if current != nil {
+			currentFigures = districtFigures(current)
+		}
+	}
+	checkFigures(v, "district", districtFigures(d), currentFigures)
+	return nil
+}
+
+// Validate runs the checks of the write endpoints, and the consistency
+// checks of the figures, on the payloads of the body without storing
+// anything, for submitters to check a daily file beforehand.
+func (vA *validationService) Validate(c echo.Context) error {
+	var req validationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, vA.errMessage("request: unable to parse request payload"))
+	}
+	if req.Country == nil && req.Province == nil && req.Provinces == nil && req.District == nil {
+		return c.JSON(http.StatusBadRequest, vA.errMessage("request: nothing to validate, expected country, province, provinces or district"))
+	}
+
+	ctx := c.Request().Context()
+	v := &Validation{Errors: make([]*ValidationIssue, 0), Warnings: make([]*ValidationIssue, 0)}
+	var err error
+	if req.Country != nil {
+		err = vA.country(ctx, v, req.Country)
+	}
+	if err == nil && req.Province != nil {
+		err = vA.province(ctx, v, "province", req.Province, true)
+	}
+	seen := make(map[string]bool, len(req.Provinces))
+	for i, p := range req.Provinces {
+		if err != nil {
+			break
+		}
+		path := fmt.Sprintf("provinces[%d]", i)
+		if p == nil {
+			v.fail(path, "must be an object")
+			continue
+		}
+		if seen[p.ID] {
+			v.fail(path+".id", "%s is given twice", p.ID)
+		}
+		seen[p.ID] = true
+		err = vA.province(ctx, v, path, p, true)
+	}
+	if err == nil && req.District != nil {
+		err = vA.district(ctx, v, req.District)
+	}
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, vA.errMessage(msg))
+	}
+	v.Valid = len(v.Errors) == 0
+	return c.JSON(http.StatusOK, map[string]*Validation{"validation": v})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+// Version describes the running release, from the Heroku dyno metadata, and
+// the schema it runs against.
+type Version struct {
+	App         string     `json:"app"`
+	Dyno        string     `json:"dyno"`
+	Release     string     `json:"release"`
+	Commit      string     `json:"commit"`
+	Description string     `json:"description"`
+	ReleasedAt  *time.Time `json:"released_at"`
+	// SchemaVersion is the latest applied migration, PendingMigrations the
+	// ones shipped with the release but not applied, which should always be
+	// empty once the release phase succeeded.
+	SchemaVersion     string   `json:"schema_version"`
+	PendingMigrations []string `json:"pending_migrations"`
+}
+
+// releaseFromEnv reads the dyno metadata Heroku sets with the runtime-dyno-metadata
+// lab feature, the fields being empty elsewhere.
+func releaseFromEnv() *Version {
+	v := &Version{
+		App:         os.Getenv("HEROKU_APP_NAME"),
+		Dyno:        os.Getenv("DYNO"),
+		Release:     os.Getenv("HEROKU_RELEASE_VERSION"),
+		Commit:      os.Getenv("HEROKU_SLUG_COMMIT"),
+		Description: os.Getenv("HEROKU_SLUG_DESCRIPTION"),
+	}
+	if t, err := time.Parse(time.RFC3339, os.Getenv("HEROKU_RELEASE_CREATED_AT")); err == nil {
+		v.ReleasedAt = &t
+	}
+	return v
+}
+
+// handler
+type versionService struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+	release *Version
+	dir     string
+}
+
+func NewVersionService(db *sql.DB, dialect migrations.Dialect, dir string) *versionService {
+	return &versionService{db: db, dialect: dialect, release: releaseFromEnv(), dir: dir}
+}
+
+func (vA *versionService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (vA *versionService) Version(c echo.Context) error {
+	ms, err := migrations.Load(vA.dir)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, vA.errMessage("Internal server error"))
+	}
+	applied, err := migrations.Applied(c.Request().Context(), vA.db, vA.dialect)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, vA.errMessage("Internal server error"))
+	}
+
+	v := *vA.release
+	v.PendingMigrations = make([]string, 0)
+	for _, m := range ms {
+		if !applied[m.Version] {
+			v.PendingMigrations = append(v.PendingMigrations, m.Version)
+		} else if m.Version > v.SchemaVersion {
+			v.SchemaVersion = m.Version
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]*Version{"version": &v})
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/labstack/echo"
+	"github.com/myesui/uuid"
+	"github.com/phuangpheth/covid19/migrations"
+)
+
+const dateLayout = "2006-01-02"
+
+// WastewaterSample is a viral load measured at a sewage sampling site,
+// in gene copies per litre.
+type WastewaterSample struct {
+	ID         string    `json:"id"`
+	Site       string    `json:"site"`
+	ProvinceID string    `json:"province_id"`
+	DistrictID string    `json:"district_id"`
+	SampledOn  time.Time `json:"sampled_on"`
+	ViralLoad  float64   `json:"viral_load"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WastewaterSamples []*WastewaterSample
+
+func (ws *WastewaterSample) Prepare() {
+	ws.Site = html.EscapeString(strings.TrimSpace(ws.Site))
+	ws.ProvinceID = strings.TrimSpace(ws.ProvinceID)
+	ws.DistrictID = strings.TrimSpace(ws.DistrictID)
+}
+
+func (ws *WastewaterSample) BeforeSave() {
+	ws.ID = uuid.NewV4().String()
+}
+
+func (ws *WastewaterSample) Validate() error {
+	if ws.Site == "" {
+		return errors.New("wastewater: site is required")
+	}
+	if ws.ProvinceID == "" || ws.DistrictID == "" {
+		return errors.New("wastewater: province_id and district_id are required")
+	}
+	if ws.SampledOn.IsZero() {
+		return errors.New("wastewater: sampled_on is required")
+	}
+	if ws.ViralLoad < 0 {
+		return errors.New("wastewater: viral_load must not be negative")
+	}
+	return nil
+}
+
+// WastewaterWeek is the mean viral load of the samples taken in the week
+// starting on Week, with the percentage change against the week before.
+type WastewaterWeek struct {
+	Week          time.Time `json:"week"`
+	Samples       int64     `json:"samples"`
+	MeanViralLoad float64   `json:"mean_viral_load"`
+	Change        *float64  `json:"change"`
+}
+
+type WastewaterTrend []*WastewaterWeek
+
+// WastewaterFilter narrows samples down to a site, district or province
+// and a range of days. Empty fields match everything.
+type WastewaterFilter struct {
+	Site       string
+	ProvinceID string
+	DistrictID string
+	From       time.Time
+	To         time.Time
+}
+
+func (f WastewaterFilter) where(q squirrel.SelectBuilder) squirrel.SelectBuilder {
+	if f.Site != "" {
+		q = q.Where(squirrel.Eq{"site": f.Site})
+	}
+	if f.ProvinceID != "" {
+		q = q.Where(squirrel.Eq{"province_id": f.ProvinceID})
+	}
+	if f.DistrictID != "" {
+		q = q.Where(squirrel.Eq{"district_id": f.DistrictID})
+	}
+	if !f.From.IsZero() {
+		q = q.Where(squirrel.GtOrEq{"sampled_on": f.From})
+	}
+	if !f.To.IsZero() {
+		q = q.Where(squirrel.LtOrEq{"sampled_on": f.To})
+	}
+	return q
+}
+
+// Repository
+type WastewaterRepository interface {
+	Save(ctx context.Context, ws *WastewaterSample) error
+	Update(ctx context.Context, ws *WastewaterSample) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*WastewaterSample, error)
+	GetAll(ctx context.Context, f WastewaterFilter) (WastewaterSamples, error)
+	Trend(ctx context.Context, f WastewaterFilter) (WastewaterTrend, error)
+}
+
+type wastewaterRepo struct {
+	db      *sql.DB
+	dialect migrations.Dialect
+}
+
+var _ WastewaterRepository = &wastewaterRepo{}
+
+func NewWastewaterRepo(db *sql.DB, dialect migrations.Dialect) *wastewaterRepo {
+	return &wastewaterRepo{db: db, dialect: dialect}
+}
+
+func (wr *wastewaterRepo) Save(ctx context.Context, ws *WastewaterSample) error {
+	if _, err := squirrel.Insert("wastewater_samples").
+		Columns("id", "site", "province_id", "district_id", "sampled_on", "viral_load", "created_at", "updated_at").
+		Values(&ws.ID, &ws.Site, &ws.ProvinceID, &ws.DistrictID, &ws.SampledOn, &ws.ViralLoad, &ws.CreatedAt, &ws.UpdatedAt).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).ExecContext(ctx); err != nil {
+		return wrapErr("wastewater sample", ws.ID, "insert wastewater sample", err)
+	}
+	return nil
+}
+
+func (wr *wastewaterRepo) Update(ctx context.Context, ws *WastewaterSample) error {
+	res, err := squirrel.Update("wastewater_samples").
+		Set("site", &ws.Site).
+		Set("province_id", &ws.ProvinceID).
+		Set("district_id", &ws.DistrictID).
+		Set("sampled_on", &ws.SampledOn).
+		Set("viral_load", &ws.ViralLoad).
+		Set("updated_at", &ws.UpdatedAt).
+		Where(squirrel.Eq{"id": ws.ID}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("wastewater sample", ws.ID, "update wastewater sample", err)
+	}
+	return wrapErr("wastewater sample", ws.ID, "update wastewater sample", affectedOne(res))
+}
+
+func (wr *wastewaterRepo) Delete(ctx context.Context, id string) error {
+	res, err := squirrel.Delete("wastewater_samples").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).ExecContext(ctx)
+	if err != nil {
+		return wrapErr("wastewater sample", id, "delete wastewater sample", err)
+	}
+	return wrapErr("wastewater sample", id, "delete wastewater sample", affectedOne(res))
+}
+
+func (wr *wastewaterRepo) GetByID(ctx context.Context, id string) (*WastewaterSample, error) {
+	var ws WastewaterSample
+	err := squirrel.Select("id", "site", "province_id", "district_id", "sampled_on", "viral_load", "created_at", "updated_at").
+		From("wastewater_samples").
+		Where(squirrel.Eq{"id": id}).
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).ScanContext(ctx, &ws.ID, &ws.Site, &ws.ProvinceID, &ws.DistrictID, &ws.SampledOn, &ws.ViralLoad, &ws.CreatedAt, &ws.UpdatedAt)
+	if err != nil {
+		return nil, wrapErr("wastewater sample", id, "select wastewater sample", err)
+	}
+	return &ws, nil
+}
+
+func (wr *wastewaterRepo) GetAll(ctx context.Context, f WastewaterFilter) (WastewaterSamples, error) {
+	q := squirrel.Select("id", "site", "province_id", "district_id", "sampled_on", "viral_load", "created_at", "updated_at").
+		From("wastewater_samples")
+	rows, err := f.where(q).
+		OrderBy("sampled_on", "site").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("wastewater sample", "", "select wastewater samples", err)
+	}
+	defer rows.Close()
+
+	var wss = make(WastewaterSamples, 0)
+	for rows.Next() {
+		var ws WastewaterSample
+		if err := rows.Scan(&ws.ID, &ws.Site, &ws.ProvinceID, &ws.DistrictID, &ws.SampledOn, &ws.ViralLoad, &ws.CreatedAt, &ws.UpdatedAt); err != nil {
+			return nil, wrapErr("wastewater sample", "", "scan wastewater samples", err)
+		}
+		wss = append(wss, &ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("wastewater sample", "", "select wastewater samples", err)
+	}
+	return wss, nil
+}
+
+func (wr *wastewaterRepo) Trend(ctx context.Context, f WastewaterFilter) (WastewaterTrend, error) {
+	q := squirrel.Select(weekOf(wr.dialect, "sampled_on")+" AS week", "COUNT(*)", "AVG(viral_load)").
+		From("wastewater_samples")
+	rows, err := f.where(q).
+		GroupBy("week").
+		OrderBy("week").
+		PlaceholderFormat(squirrel.Dollar).
+		RunWith(wr.db).QueryContext(ctx)
+	if err != nil {
+		return nil, wrapErr("wastewater sample", "", "select wastewater trend", err)
+	}
+	defer rows.Close()
+
+	var trend = make(WastewaterTrend, 0)
+	for rows.Next() {
+		var w WastewaterWeek
+		if err := rows.Scan(&w.Week, &w.Samples, &w.MeanViralLoad); err != nil {
+			return nil, wrapErr("wastewater sample", "", "scan wastewater trend", err)
+		}
+		if n := len(trend); n > 0 && trend[n-1].MeanViralLoad > 0 {
+			change := math.Round((w.MeanViralLoad/trend[n-1].MeanViralLoad-1)*10000) / 100
+			w.Change = &change
+		}
+		trend = append(trend, &w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("wastewater sample", "", "select wastewater trend", err)
+	}
+	return trend, nil
+}
+
+// handler
+type wastewaterService struct {
+	wApp WastewaterRepository
+}
+
+func NewWastewaterService(wApp WastewaterRepository) *wastewaterService {
+	return &wastewaterService{wApp: wApp}
+}
+
+func (wA *wastewaterService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+func (wA *wastewaterService) successMsg(success string) *SuccessResponse {
+	return &SuccessResponse{success}
+}
+
+func (wA *wastewaterService) ListSamples(c echo.Context) error {
+	f, err := wastewaterFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, wA.errMessage(err.Error()))
+	}
+	wss, err := wA.wApp.GetAll(c.Request().Context(), f)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]WastewaterSamples{"wastewater_samples": wss})
+}
+
+func (wA *wastewaterService) FindBySampleID(c echo.Context) error {
+	ws, err := wA.wApp.GetByID(c.Request().Context(), c.Param("sample_id"))
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]*WastewaterSample{"wastewater_sample": ws})
+}
+
+func (wA *wastewaterService) Store(c echo.Context) error {
+	var ws WastewaterSample
+	if err := c.Bind(&ws); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, wA.errMessage("request: unable to parse request payload"))
+	}
+	ws.Prepare()
+	if err := ws.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, wA.errMessage(err.Error()))
+	}
+	ws.BeforeSave()
+	ws.CreatedAt = time.Now()
+	ws.UpdatedAt = ws.CreatedAt
+
+	if err := wA.wApp.Save(c.Request().Context(), &ws); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.JSON(http.StatusCreated, map[string]*WastewaterSample{"wastewater_sample": &ws})
+}
+
+func (wA *wastewaterService) Edit(c echo.Context) error {
+	var ws WastewaterSample
+	if err := c.Bind(&ws); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, wA.errMessage("request: unable to parse request payload"))
+	}
+	ws.ID = c.Param("sample_id")
+	ws.Prepare()
+	if err := ws.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, wA.errMessage(err.Error()))
+	}
+	ws.UpdatedAt = time.Now()
+
+	if err := wA.wApp.Update(c.Request().Context(), &ws); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, wA.successMsg("Updated wastewater sample successfully"))
+}
+
+func (wA *wastewaterService) Delete(c echo.Context) error {
+	if err := wA.wApp.Delete(c.Request().Context(), c.Param("sample_id")); err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (wA *wastewaterService) Trend(c echo.Context) error {
+	f, err := wastewaterFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, wA.errMessage(err.Error()))
+	}
+	// without ?from=, the trend covers as many weeks as it can up to ?to=
+	to := f.To
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if f.From.IsZero() {
+		f.From = to.AddDate(0, 0, -7*maxTrendWeeks+1)
+	}
+	if err := checkWeeks(f.From, to, maxTrendWeeks); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, wA.errMessage(err.Error()))
+	}
+	trend, err := wA.wApp.Trend(c.Request().Context(), f)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, wA.errMessage(msg))
+	}
+	return c.JSON(http.StatusOK, map[string]WastewaterTrend{"wastewater_trend": trend})
+}
+
+// wastewaterFilter reads ?site=, ?province_id=, ?district_id= and the
+// ?from= and ?to= days formatted as YYYY-MM-DD.
+func wastewaterFilter(c echo.Context) (WastewaterFilter, error) {
+	f := WastewaterFilter{
+		Site:       c.QueryParam("site"),
+		ProvinceID: c.QueryParam("province_id"),
+		DistrictID: c.QueryParam("district_id"),
+	}
+	var err error
+	if v := c.QueryParam("from"); v != "" {
+		if f.From, err = time.Parse(dateLayout, v); err != nil {
+			return f, errors.New("request: from must be formatted as YYYY-MM-DD")
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if f.To, err = time.Parse(dateLayout, v); err != nil {
+			return f, errors.New("request: to must be formatted as YYYY-MM-DD")
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// downloads written to the client as they are generated, left out of what
+// buffers responses while keeping the request deadline
+var downloadRoutes = map[string]bool{"/api/v1/export/xlsx": true}
+
+// the cell styles of xlsxStyles, by their index
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleCount
+	xlsxStyleTime
+)
+
+// xlsxStyles holds a bold font for headers, thousands separators for counts
+// and a date and time format.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+// the day spreadsheets count dates from
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter writes an Office Open XML workbook sheet by sheet, row by row,
+// to w as it goes, holding no more than the row being written.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheets []string
+	sheet  io.Writer
+	row    int
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	return &xlsxWriter{zw: zip.NewWriter(w)}
+}
+
+// xlsxColumn names the column i, counted from 0, as A to Z, AA and on.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Sheet ends the sheet being written and starts the next, its first row,
+// the header, staying in view when scrolling. widths are those of its
+// columns, in characters.
+func (x *xlsxWriter) Sheet(name string, widths ...float64) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	x.sheets = append(x.sheets, name)
+	w, err := x.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(x.sheets)))
+	if err != nil {
+		return err
+	}
+	x.sheet, x.row = w, 0
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// Header writes a row of bold text.
+func (x *xlsxWriter) Header(cells ...string) error {
+	values := make([]interface{}, len(cells))
+	for i, v := range cells {
+		values[i] = v
+	}
+	return x.write(xlsxStyleHeader, values)
+}
+
+// Row writes a row of strings, counts and times, nil cells being left empty.
+func (x *xlsxWriter) Row(cells ...interface{}) error {
+	return x.write(xlsxStyleDefault, cells)
+}
+
+func (x *xlsxWriter) write(style int, cells []interface{}) error {
+	x.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, v := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(x.row)
+		switch v := v.(type) {
+		case nil:
+		case string:
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, style, xlsxEscape(v))
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxStyleCount, v)
+		case int:
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxStyleCount, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			serial := v.UTC().Sub(xlsxEpoch).Hours() / 24
+			fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleTime, strconv.FormatFloat(serial, 'f', -1, 64))
+		default:
+			return fmt.Errorf("xlsx: unsupported cell %T", v)
+		}
+	}
+	b.WriteString("</row>")
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+func (x *xlsxWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(x.sheet, "</sheetData></worksheet>")
+	x.sheet = nil
+	return err
+}
+
+// Close ends the last sheet and writes the parts of the workbook listing
+// them.
+func (x *xlsxWriter) Close() error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	var types, sheets, rels strings.Builder
+	for i, name := range x.sheets {
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		w, err := x.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, p.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// xlsxColumnIndex is the column, counted from 0, of a cell reference such
+// as B7.
+func xlsxColumnIndex(ref string) int {
+	i := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		i = i*26 + int(r-'A') + 1
+	}
+	return i - 1
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbookXML struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string   `xml:"t"`
+		Runs []string `xml:"r>t"`
+	} `xml:"si"`
+}
+
+type xlsxSheetXML struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func xlsxPart(zr *zip.Reader, name string, v interface{}) (bool, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return true, err
+		}
+		defer r.Close()
+		return true, xml.NewDecoder(r).Decode(v)
+	}
+	return false, nil
+}
+
+// readXLSX reads the cells of the sheet named sheet of a workbook, or of its
+// first sheet when empty, as text, rows and columns at their place in the
+// sheet. Numbers are left as written, dates being the serial numbers
+// spreadsheets store them as.
+func readXLSX(r io.ReaderAt, size int64, sheet string) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	var wb xlsxWorkbookXML
+	var rels xlsxRels
+	if ok, err := xlsxPart(zr, "xl/workbook.xml", &wb); !ok || err != nil {
+		return nil, fmt.Errorf("xlsx: no workbook: %v", err)
+	}
+	if ok, err := xlsxPart(zr, "xl/_rels/workbook.xml.rels", &rels); !ok || err != nil {
+		return nil, fmt.Errorf("xlsx: no workbook relationships: %v", err)
+	}
+	rid := ""
+	for _, s := range wb.Sheets {
+		if sheet == "" || s.Name == sheet {
+			rid = s.RID
+			break
+		}
+	}
+	path := ""
+	for _, rel := range rels.Rels {
+		if rel.ID == rid {
+			path = strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(path, "xl/") {
+				path = "xl/" + path
+			}
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("xlsx: no sheet %q", sheet)
+	}
+
+	var shared xlsxSharedStrings
+	if _, err := xlsxPart(zr, "xl/sharedStrings.xml", &shared); err != nil {
+		return nil, fmt.Errorf("xlsx: shared strings: %w", err)
+	}
+	strs := make([]string, len(shared.Items))
+	for i, si := range shared.Items {
+		strs[i] = si.Text + strings.Join(si.Runs, "")
+	}
+	var data xlsxSheetXML
+	if ok, err := xlsxPart(zr, path, &data); !ok || err != nil {
+		return nil, fmt.Errorf("xlsx: sheet %s: %v", path, err)
+	}
+
+	var rows [][]string
+	for n, row := range data.Rows {
+		at := row.R - 1
+		if row.R == 0 {
+			at = n
+		}
+		for len(rows) <= at {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColumnIndex(c.Ref)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			switch c.Type {
+			case "s":
+				k, err := strconv.Atoi(c.Value)
+				if err != nil || k < 0 || k >= len(strs) {
+					return nil, fmt.Errorf("xlsx: cell %s: invalid shared string %q", c.Ref, c.Value)
+				}
+				cells[col] = strs[k]
+			case "inlineStr":
+				cells[col] = c.Inline
+			default:
+				cells[col] = c.Value
+			}
+		}
+		rows[at] = cells
+	}
+	return rows, nil
+}
+
+// handler
+type xlsxService struct {
+	cApp CountryRepository
+	pApp ProvinceRepository
+	dApp DistrictRepository
+	hApp HistoryRepository
+}
+
+func NewXLSXService(cApp CountryRepository, pApp ProvinceRepository, dApp DistrictRepository, hApp HistoryRepository) *xlsxService {
+	return &xlsxService{cApp: cApp, pApp: pApp, dApp: dApp, hApp: hApp}
+}
+
+func (xA *xlsxService) errMessage(err string) *ErrorMsg {
+	return &ErrorMsg{err}
+}
+
+// countries returns the country of ?country_id=, or every country.
+func (xA *xlsxService) countries(c echo.Context) (Countries, error) {
+	ctx := c.Request().Context()
+	if id := c.QueryParam("country_id"); id != "" {
+		country, err := xA.cApp.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return Countries{country}, nil
+	}
+	var all Countries
+	for page := uint64(1); ; page++ {
+		countries, err := xA.cApp.List(ctx, page, maxCountryLimit)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, countries...)
+		if len(countries) < maxCountryLimit {
+			return all, nil
+		}
+	}
+}
+
+// xlsxFigureHeaders are the headers of the figures of every sheet.
+var xlsxFigureHeaders = []string{"Total", "New cases", "Treated", "Recovering", "Tests", "Deaths", "Negative tests", "Updated at"}
+
+func figureCells(total, newCase, treated, decovering, tests, dead, negative int64, updatedAt time.Time) []interface{} {
+	return []interface{}{total, newCase, treated, decovering, tests, dead, negative, updatedAt}
+}
+
+// Export writes a workbook of the figures of the countries, their provinces
+// and their districts, a sheet each, for the reports of health ministries.
+// ?country_id= keeps one country.
+func (xA *xlsxService) Export(c echo.Context) error {
+	ctx := c.Request().Context()
+	countries, err := xA.countries(c)
+	if err != nil {
+		status, msg := errorStatus(err, "Internal server error")
+		return c.JSON(status, xA.errMessage(msg))
+	}
+	var provinces Provinces
+	// the name of the country of every province
+	countryNames := make(map[string]string)
+	for _, country := range countries {
+		ps, err := xA.pApp.GetAll(ctx, &ProvinceFilter{CountryID: country.ID, Sort: "name", Asc: true})
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, xA.errMessage(msg))
+		}
+		for _, p := range ps {
+			countryNames[p.ID] = country.Name
+		}
+		provinces = append(provinces, ps...)
+	}
+	districts := make(map[string]Districts, len(provinces))
+	for _, p := range provinces {
+		if districts[p.ID], err = xA.dApp.GetAllByProvince(ctx, p.ID); err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, xA.errMessage(msg))
+		}
+	}
+	if at, ok := embargoed(c); ok {
+		if countries, err = countriesAsOf(ctx, xA.hApp, countries, at); err == nil {
+			provinces, err = provincesAsOf(ctx, xA.hApp, provinces, at)
+		}
+		for id, ds := range districts {
+			if err != nil {
+				break
+			}
+			districts[id], err = districtsAsOf(ctx, xA.hApp, ds, at)
+		}
+		if err != nil {
+			status, msg := errorStatus(err, "Internal server error")
+			return c.JSON(status, xA.errMessage(msg))
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeXLSX)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="covid19-report-%s.xlsx"`, time.Now().UTC().Format(dateLayout)))
+	res.WriteHeader(http.StatusOK)
+
+	// the status is sent, a failure from here on only cuts the file short
+	x := newXLSXWriter(res)
+	figureWidths := []float64{12, 12, 12, 12, 12, 12, 14, 18}
+	err = x.Sheet("Summary", append([]float64{30}, figureWidths...)...)
+	if err == nil {
+		err = x.Header(append([]string{"Country"}, xlsxFigureHeaders...)...)
+	}
+	for _, ct := range countries {
+		if err != nil {
+			break
+		}
+		err = x.Row(append([]interface{}{ct.Name}, figureCells(ct.Total, ct.NewCase, ct.Treated, ct.DecoveringCase, ct.TestCase, ct.Dead, ct.NegativeTest, ct.UpdatedAt)...)...)
+	}
+	if err == nil {
+		err = x.Sheet("Provinces", append([]float64{30, 30}, figureWidths...)...)
+	}
+	if err == nil {
+		err = x.Header(append([]string{"Country", "Province"}, xlsxFigureHeaders...)...)
+	}
+	provinceNames := make(map[string]string, len(provinces))
+	for _, p := range provinces {
+		if err != nil {
+			break
+		}
+		provinceNames[p.ID] = p.Name
+		err = x.Row(append([]interface{}{countryNames[p.ID], p.Name}, figureCells(p.Total, p.NewCase, p.Treated, p.DecoveringCase, p.TestCase, p.Dead, p.NegativeTest, p.UpdatedAt)...)...)
+	}
+	if err == nil {
+		err = x.Sheet("Districts", append([]float64{30, 30}, figureWidths...)...)
+	}
+	if err == nil {
+		err = x.Header(append([]string{"Province", "District"}, xlsxFigureHeaders...)...)
+	}
+	for _, p := range provinces {
+		for _, d := range districts[p.ID] {
+			if err != nil {
+				break
+			}
+			err = x.Row(append([]interface{}{provinceNames[p.ID], d.Name}, figureCells(d.Total, d.NewCase, d.Treated, d.DecoveringCase, d.TestCase, d.Dead, d.NegativeTest, d.UpdatedAt)...)...)
+		}
+	}
+	if err == nil {
+		err = x.Close()
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("xlsx: export cut short")
+	}
+	return err
+}